@@ -29,8 +29,8 @@ func main() {
 
 	// Configure CORS for frontend
 	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"http://localhost:5173", "http://localhost:5174", "http://localhost:3000"}
-	config.AllowMethods = []string{"GET", "POST", "OPTIONS"}
+	config.AllowOrigins = api.AllowedOrigins
+	config.AllowMethods = []string{"GET", "POST", "DELETE", "OPTIONS"}
 	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept"}
 	r.Use(cors.New(config))
 
@@ -39,10 +39,23 @@ func main() {
 	{
 		apiGroup.GET("/health", api.HealthCheck)
 		apiGroup.GET("/test-routing", api.TestRouting)
+		apiGroup.GET("/calibration", api.GetCalibration)
 		apiGroup.GET("/sample-data", api.GetSampleData)
 		apiGroup.POST("/optimize", api.OptimizeRoutes)
 		apiGroup.POST("/optimize-analytics", api.OptimizeWithAnalytics)
 		apiGroup.POST("/optimize-hybrid-stream", api.HybridSolveStream)
+		apiGroup.POST("/optimize-hybrid-sse", api.HybridSolveSSE)
+		apiGroup.GET("/optimize-hybrid-ws", api.HybridSolveWebSocket)
+		apiGroup.POST("/jobs", api.CreateJob)
+		apiGroup.GET("/jobs/:id", api.GetJob)
+		apiGroup.GET("/jobs/:id/events", api.StreamJobEvents)
+		apiGroup.DELETE("/jobs/:id", api.CancelJob)
+		apiGroup.POST("/geocode", api.GeocodeOrders)
+		apiGroup.POST("/plans", api.CreatePlan)
+		apiGroup.GET("/plans/:id", api.GetPlan)
+		apiGroup.POST("/plans/:id/insert", api.InsertOrders)
+		apiGroup.POST("/plans/:id/repair", api.RepairPlan)
+		apiGroup.POST("/plans/:id/shoppers/:shopperId/itinerary", api.GetItinerary)
 	}
 
 	log.Println("Multi-Strategy Routing Engine Backend starting on :8080")
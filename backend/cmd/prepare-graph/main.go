@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"shipt-route-optimizer/internal/routing"
+)
+
+// prepare-graph contracts an OSM extract ahead of time so the offline
+// routing provider starts without doing it on the first request.
+//
+//	go run ./cmd/prepare-graph birmingham.osm.pbf
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: prepare-graph <extract.osm.pbf|extract.geojson>")
+		os.Exit(2)
+	}
+
+	start := time.Now()
+	out, err := routing.PrepareRoadGraph(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote %s in %v", out, time.Since(start).Round(time.Millisecond))
+}
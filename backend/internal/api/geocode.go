@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/optimizer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GeocodeOrders geocodes orders given by address and returns them with the
+// validation report, without optimizing anything.
+func GeocodeOrders(c *gin.Context) {
+	var req models.GeocodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if len(req.Orders) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No orders provided"})
+		return
+	}
+
+	orders, report, err := optimizer.GeocodeOrders(c.Request.Context(), req.Orders, req.Shoppers, req.Geocoding)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.GeocodeResponse{Orders: orders, Report: report})
+}
+
+// geocodeOnIngest fills in coordinates for orders given by address. Orders
+// whose address fails or lands outside the market are left out, and the
+// report lists them; it is nil when no order needed geocoding. When the
+// options are strict and any address was rejected, or no order is left, it
+// answers 400 with the report and returns false instead.
+func geocodeOnIngest(c *gin.Context, orders *[]models.Order, shoppers []models.Shopper, opts models.GeocodeOptions) (*models.GeocodeReport, bool) {
+	report, problem := geocodeAddresses(c.Request.Context(), orders, shoppers, opts)
+	if problem != nil {
+		c.JSON(http.StatusBadRequest, problem)
+		return nil, false
+	}
+	return report, true
+}
+
+// geocodeAddresses is geocodeOnIngest for callers outside a plain HTTP
+// exchange: it returns the error body instead of writing it.
+func geocodeAddresses(ctx context.Context, orders *[]models.Order, shoppers []models.Shopper, opts models.GeocodeOptions) (*models.GeocodeReport, gin.H) {
+	needed := false
+	for _, order := range *orders {
+		needed = needed || optimizer.NeedsGeocoding(order)
+	}
+	if !needed {
+		return nil, nil
+	}
+
+	geocoded, report, err := optimizer.GeocodeOrders(ctx, *orders, shoppers, opts)
+	if err != nil {
+		return nil, gin.H{"error": err.Error()}
+	}
+	// Rejected orders keep zero coordinates, so they still need geocoding
+	placed := make([]models.Order, 0, len(geocoded))
+	for _, order := range geocoded {
+		if !optimizer.NeedsGeocoding(order) {
+			placed = append(placed, order)
+		}
+	}
+	if report.Rejected > 0 && (opts.Strict || len(placed) == 0) {
+		return nil, gin.H{
+			"error":         fmt.Sprintf("%d of %d addresses could not be placed in the market", report.Rejected, report.Total),
+			"geocodeReport": report,
+		}
+	}
+	*orders = placed
+	return &report, nil
+}
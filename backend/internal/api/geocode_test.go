@@ -0,0 +1,77 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"shipt-route-optimizer/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useTestGazetteer geocodes with an offline gazetteer holding one address in
+// Birmingham, AL and one in Seattle, far outside its market.
+func useTestGazetteer(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "places.csv")
+	csv := "address,lat,lng\n" +
+		"1 Main St Birmingham,33.5186,-86.8104\n" +
+		"1 Pike St Seattle,47.6097,-122.3331\n"
+	if err := os.WriteFile(path, []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GEOCODING_PROVIDER", "gazetteer")
+	t.Setenv("GEOCODING_GAZETTEER_PATH", path)
+}
+
+func TestOptimizeLeavesOutRejectedAddresses(t *testing.T) {
+	useTestGazetteer(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/optimize", OptimizeRoutes)
+	post := func(geocoding models.GeocodeOptions, addresses ...string) *httptest.ResponseRecorder {
+		req := models.OptimizeRequest{
+			Shoppers:  []models.Shopper{{ID: "S1", Lat: 33.51, Lng: -86.81, Capacity: 5}},
+			Geocoding: geocoding,
+		}
+		for i, address := range addresses {
+			req.Orders = append(req.Orders, models.Order{ID: fmt.Sprintf("O%d", i+1), Address: address, ItemCount: 1})
+		}
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/optimize", bytes.NewReader(body)))
+		return w
+	}
+
+	w := post(models.GeocodeOptions{}, "1 Main St Birmingham", "1 Pike St Seattle")
+	if w.Code != http.StatusOK {
+		t.Fatalf("optimize = %d %s, want 200", w.Code, w.Body)
+	}
+	var response models.OptimizeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	routed := 0
+	for _, assignment := range response.Assignments {
+		routed += len(assignment.Route)
+	}
+	if routed != 1 {
+		t.Errorf("routed %d orders, want only the one placed in the market", routed)
+	}
+	if report := response.GeocodeReport; report == nil || report.Geocoded != 1 || report.Rejected != 1 {
+		t.Errorf("geocode report = %+v, want 1 geocoded and 1 rejected", report)
+	}
+
+	if w := post(models.GeocodeOptions{Strict: true}, "1 Main St Birmingham", "1 Pike St Seattle"); w.Code != http.StatusBadRequest {
+		t.Errorf("strict optimize = %d, want 400", w.Code)
+	}
+	if w := post(models.GeocodeOptions{}, "1 Pike St Seattle"); w.Code != http.StatusBadRequest {
+		t.Errorf("optimize with no order placed = %d, want 400", w.Code)
+	}
+}
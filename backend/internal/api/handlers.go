@@ -1,9 +1,10 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
-	"os"
 	"shipt-route-optimizer/internal/data"
 	"shipt-route-optimizer/internal/models"
 	"shipt-route-optimizer/internal/optimizer"
@@ -13,41 +14,59 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// AllowedOrigins are the frontends allowed to call the API from a browser,
+// for CORS and for the WebSocket handshake
+var AllowedOrigins = []string{"http://localhost:5173", "http://localhost:5174", "http://localhost:3000"}
+
 // HealthCheck returns API health status
 func HealthCheck(c *gin.Context) {
-	apiKeySet := os.Getenv("OPENROUTE_API_KEY") != ""
+	cfg := routing.ConfigFromEnv()
 	c.JSON(http.StatusOK, gin.H{
-		"status":    "ok",
-		"service":   "shipt-route-optimizer",
-		"apiKeySet": apiKeySet,
+		"status":          "ok",
+		"service":         "shipt-route-optimizer",
+		"apiKeySet":       cfg.APIKey != "",
+		"routingProvider": cfg.Provider,
+		"routeCache":      routing.GetCacheStats(),
+		"routingBreakers": routing.BreakerStates(),
 	})
 }
 
-// TestRouting tests the OpenRouteService API
+// TestRouting tests the configured routing provider, or the one named by ?provider=
 func TestRouting(c *gin.Context) {
+	cfg := routing.ConfigFromEnv()
+	provider, err := routing.ProviderFor(c.Query("provider"), "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "providers": routing.ProviderNames()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	healthErr := provider.Health(ctx)
+
 	// Test route from Birmingham coordinates
-	segment, err := routing.GetRoute(33.5200, -86.8100, 33.5186, -86.8104)
+	segment, _ := routing.GetRouteWith(ctx, provider, 33.5200, -86.8100, 33.5186, -86.8104)
 
 	result := gin.H{
-		"error":         nil,
-		"pointCount":    0,
-		"distance":      0.0,
-		"duration":      0.0,
-		"apiKeySet":     os.Getenv("OPENROUTE_API_KEY") != "",
-		"apiKeyLength":  len(os.Getenv("OPENROUTE_API_KEY")),
-		"usingFallback": false,
+		"provider":       provider.Name(),
+		"healthy":        healthErr == nil,
+		"source":         segment.Source,
+		"fallbackReason": segment.FallbackReason,
+		"pointCount":     0,
+		"distance":       0.0,
+		"duration":       0.0,
+		"apiKeySet":      cfg.APIKey != "",
+		"apiKeyLength":   len(cfg.APIKey),
+		"usingFallback":  segment.Source == routing.SourceFallback,
 	}
 
-	if err != nil {
-		result["error"] = err.Error()
+	if healthErr != nil {
+		result["healthError"] = healthErr.Error()
 	}
 
 	if segment != nil {
 		result["pointCount"] = len(segment.Geometry)
 		result["distance"] = segment.Distance
 		result["duration"] = segment.Duration
-		// If only 2 points, it's using fallback straight line
-		result["usingFallback"] = len(segment.Geometry) == 2
 		if len(segment.Geometry) <= 5 {
 			result["geometry"] = segment.Geometry
 		} else {
@@ -62,6 +81,12 @@ func TestRouting(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// GetCalibration returns the detour factors and speeds learned from road
+// routes, which scale straight-line estimates when routing is unavailable
+func GetCalibration(c *gin.Context) {
+	c.JSON(http.StatusOK, routing.CalibrationStatus())
+}
+
 // GetSampleData returns mock orders and shoppers
 func GetSampleData(c *gin.Context) {
 	sampleData := data.GenerateSampleData()
@@ -87,6 +112,11 @@ func OptimizeRoutes(c *gin.Context) {
 		return
 	}
 
+	report, ok := geocodeOnIngest(c, &req.Orders, req.Shoppers, req.Geocoding)
+	if !ok {
+		return
+	}
+
 	// Run optimization algorithm
 	assignments, totalBefore, totalAfter := optimizer.Optimize(req.Orders, req.Shoppers)
 	optimizer.SortAssignmentsByShopper(assignments)
@@ -95,6 +125,7 @@ func OptimizeRoutes(c *gin.Context) {
 		Assignments:         assignments,
 		TotalDistanceBefore: totalBefore,
 		TotalDistanceAfter:  totalAfter,
+		GeocodeReport:       report,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -103,11 +134,11 @@ func OptimizeRoutes(c *gin.Context) {
 // OptimizeWithAnalytics performs optimization and returns detailed analytics
 func OptimizeWithAnalytics(c *gin.Context) {
 	var req struct {
-		Orders        []models.Order   `json:"orders"`
-		Shoppers      []models.Shopper `json:"shoppers"`
-		UseRealRoutes bool             `json:"useRealRoutes"`
-		Algorithm     string           `json:"algorithm"` // "nearest-neighbor" or "astar"
-		ApiKey        string           `json:"apiKey"`    // OpenRouteService API key from frontend
+		Orders    []models.Order        `json:"orders"`
+		Shoppers  []models.Shopper      `json:"shoppers"`
+		Algorithm string                `json:"algorithm"` // "nearest-neighbor" or "astar"
+		Geocoding models.GeocodeOptions `json:"geocoding"`
+		models.RoutingOptions
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -125,6 +156,21 @@ func OptimizeWithAnalytics(c *gin.Context) {
 		return
 	}
 
+	if err := optimizer.ValidateRoutingOptions(req.RoutingOptions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, ok := geocodeOnIngest(c, &req.Orders, req.Shoppers, req.Geocoding)
+	if !ok {
+		return
+	}
+
+	if err := optimizer.CheckRestrictions(req.Orders, req.Shoppers, req.RoutingOptions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Default to nearest-neighbor if not specified
 	if req.Algorithm == "" {
 		req.Algorithm = "nearest-neighbor"
@@ -132,12 +178,13 @@ func OptimizeWithAnalytics(c *gin.Context) {
 
 	// Run optimization with analytics
 	optimizeResponse, analyticsResponse := optimizer.OptimizeWithAnalytics(
+		c.Request.Context(),
 		req.Orders,
 		req.Shoppers,
-		req.UseRealRoutes,
 		req.Algorithm,
-		req.ApiKey, // Pass API key to optimizer
+		req.RoutingOptions, // Pass API key and provider to optimizer
 	)
+	optimizeResponse.GeocodeReport = report
 
 	// Combine both responses
 	response := gin.H{
@@ -149,21 +196,73 @@ func OptimizeWithAnalytics(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// HybridSolveStream runs the hybrid solver and streams progress events using NDJSON.
-func HybridSolveStream(c *gin.Context) {
+// hybridRequest is a validated hybrid solve request and the report on the
+// orders geocoded for it, if any.
+type hybridRequest struct {
+	models.HybridSolveRequest
+	geocodeReport *models.GeocodeReport
+}
+
+// run solves the request, reporting the geocoded orders with the result.
+func (req hybridRequest) run(ctx context.Context, progress func(models.HybridProgress)) (models.HybridSolveResponse, error) {
+	response, err := hybrid.Run(ctx, req.Orders, req.Shoppers, req.Options, progress)
+	response.Optimization.GeocodeReport = req.geocodeReport
+	return response, err
+}
+
+// bindHybridRequest reads and validates a hybrid solve request, geocoding
+// orders given by address. On failure it has already answered 400.
+func bindHybridRequest(c *gin.Context) (hybridRequest, bool) {
 	var req models.HybridSolveRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-		return
+		return hybridRequest{}, false
 	}
 
+	checked, problem := checkHybridRequest(c.Request.Context(), req)
+	if problem != nil {
+		c.JSON(http.StatusBadRequest, problem)
+		return hybridRequest{}, false
+	}
+	return checked, true
+}
+
+// checkHybridRequest validates a decoded hybrid solve request and geocodes
+// its orders given by address, returning the error body on failure.
+func checkHybridRequest(ctx context.Context, req models.HybridSolveRequest) (hybridRequest, gin.H) {
 	if len(req.Orders) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No orders provided"})
-		return
+		return hybridRequest{}, gin.H{"error": "No orders provided"}
 	}
 
 	if len(req.Shoppers) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No shoppers provided"})
+		return hybridRequest{}, gin.H{"error": "No shoppers provided"}
+	}
+
+	if err := optimizer.ValidateRoutingOptions(req.Options.RoutingOptions); err != nil {
+		return hybridRequest{}, gin.H{"error": err.Error()}
+	}
+
+	switch req.Options.Snapshots {
+	case "", hybrid.SnapshotsFull, hybrid.SnapshotsDelta:
+	default:
+		return hybridRequest{}, gin.H{"error": fmt.Sprintf("Unknown snapshots mode %q, expected \"full\" or \"delta\"", req.Options.Snapshots)}
+	}
+
+	report, problem := geocodeAddresses(ctx, &req.Orders, req.Shoppers, req.Geocoding)
+	if problem != nil {
+		return hybridRequest{}, problem
+	}
+
+	if err := optimizer.CheckRestrictions(req.Orders, req.Shoppers, req.Options.RoutingOptions); err != nil {
+		return hybridRequest{}, gin.H{"error": err.Error()}
+	}
+	return hybridRequest{HybridSolveRequest: req, geocodeReport: report}, nil
+}
+
+// HybridSolveStream runs the hybrid solver and streams progress events using NDJSON.
+func HybridSolveStream(c *gin.Context) {
+	req, ok := bindHybridRequest(c)
+	if !ok {
 		return
 	}
 
@@ -186,7 +285,7 @@ func HybridSolveStream(c *gin.Context) {
 
 	go func() {
 		defer close(progressCh)
-		response, err := hybrid.Run(ctx, req.Orders, req.Shoppers, req.Options, func(progress models.HybridProgress) {
+		response, err := req.run(ctx, func(progress models.HybridProgress) {
 			select {
 			case progressCh <- progress:
 			case <-ctx.Done():
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"shipt-route-optimizer/internal/jobs"
+	"shipt-route-optimizer/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	jobManagerOnce sync.Once
+	jobManager     *jobs.Manager
+)
+
+// defaultJobs returns the process-wide job manager, starting its workers on
+// first use.
+func defaultJobs() *jobs.Manager {
+	jobManagerOnce.Do(func() {
+		jobManager = jobs.NewManager(jobs.ConfigFromEnv())
+	})
+	return jobManager
+}
+
+// CreateJob queues a hybrid solve and returns its job ID straight away. The
+// body is the same as for the streaming endpoint.
+func CreateJob(c *gin.Context) {
+	req, ok := bindHybridRequest(c)
+	if !ok {
+		return
+	}
+
+	job, ok := submitHybridJob(c, req)
+	if !ok {
+		return
+	}
+
+	c.Header("Location", "/api/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// submitHybridJob queues the run, answering 503 when the queue is full and
+// 500 when the job cannot be queued for any other reason.
+func submitHybridJob(c *gin.Context, req hybridRequest) (models.Job, bool) {
+	job, err := defaultJobs().Submit(req.run)
+	switch {
+	case errors.Is(err, jobs.ErrQueueFull):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many queued jobs, try again later"})
+		return job, false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return job, false
+	}
+	return job, true
+}
+
+// GetJob returns a job's status, latest progress and, once done, its result.
+func GetJob(c *gin.Context) {
+	job, ok := defaultJobs().Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelJob stops a queued or running job, or forgets a finished one.
+func CancelJob(c *gin.Context) {
+	job, ok := defaultJobs().Cancel(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
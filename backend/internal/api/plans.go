@@ -0,0 +1,329 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/optimizer"
+	"shipt-route-optimizer/internal/optimizer/hybrid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// planStore keeps published plans in memory so mid-day adjustments can be
+// made by ID without resending the whole plan. Plans not updated within the
+// TTL are dropped, and past the size cap the least recently updated go first.
+type planStore struct {
+	ttl      time.Duration
+	maxPlans int
+
+	mu      sync.Mutex
+	entries map[string]*planEntry
+}
+
+// planEntry holds a stored plan, if there is one yet, and the lock that
+// serializes read-modify-write updates to it. Entries with editors holding
+// or waiting for the lock are never evicted, so they all share one lock.
+type planEntry struct {
+	plan    *models.Plan
+	updated time.Time
+	edit    sync.Mutex
+	editors int // guarded by planStore.mu
+}
+
+var (
+	plansOnce         sync.Once
+	planStoreInstance *planStore
+)
+
+// defaultPlans returns the process-wide plan store. PLANS_TTL (a Go duration
+// such as "12h") and PLANS_MAX size it; by default a plan lasts a day and at
+// most 1000 are kept.
+func defaultPlans() *planStore {
+	plansOnce.Do(func() {
+		ttl, maxPlans := 24*time.Hour, 1000
+		if v, err := time.ParseDuration(os.Getenv("PLANS_TTL")); err == nil && v > 0 {
+			ttl = v
+		}
+		if v, err := strconv.Atoi(os.Getenv("PLANS_MAX")); err == nil && v > 0 {
+			maxPlans = v
+		}
+		planStoreInstance = newPlanStore(ttl, maxPlans)
+	})
+	return planStoreInstance
+}
+
+func newPlanStore(ttl time.Duration, maxPlans int) *planStore {
+	return &planStore{ttl: ttl, maxPlans: maxPlans, entries: make(map[string]*planEntry)}
+}
+
+// lock holds the plan's edit lock until the returned func is called, so an
+// update that reads a plan, changes it and stores it again does not
+// overwrite a concurrent update to the same plan.
+func (s *planStore) lock(id string) func() {
+	s.mu.Lock()
+	entry, ok := s.entries[id]
+	if !ok {
+		entry = &planEntry{}
+		s.entries[id] = entry
+	}
+	entry.editors++
+	s.mu.Unlock()
+
+	entry.edit.Lock()
+	return func() {
+		entry.edit.Unlock()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		entry.editors--
+		if entry.editors == 0 && entry.plan == nil && s.entries[id] == entry {
+			delete(s.entries, id)
+		}
+	}
+}
+
+func (s *planStore) get(id string) (models.Plan, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(time.Now())
+	entry, ok := s.entries[id]
+	if !ok || entry.plan == nil {
+		return models.Plan{}, false
+	}
+	return *entry.plan, true
+}
+
+func (s *planStore) put(plan models.Plan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[plan.ID]
+	if !ok {
+		entry = &planEntry{}
+		s.entries[plan.ID] = entry
+	}
+	now := time.Now()
+	entry.plan = &plan
+	entry.updated = now
+	s.prune(now)
+}
+
+// prune drops expired plans, then the least recently updated ones while the
+// store is over its cap. Callers hold s.mu.
+func (s *planStore) prune(now time.Time) {
+	for id, entry := range s.entries {
+		if entry.editors == 0 && (entry.plan == nil || now.Sub(entry.updated) > s.ttl) {
+			delete(s.entries, id)
+		}
+	}
+	for len(s.entries) > s.maxPlans {
+		oldest := ""
+		for id, entry := range s.entries {
+			if entry.editors == 0 && (oldest == "" || entry.updated.Before(s.entries[oldest].updated)) {
+				oldest = id
+			}
+		}
+		if oldest == "" {
+			return // every remaining plan is being edited
+		}
+		delete(s.entries, oldest)
+	}
+}
+
+func newPlanID() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return "plan-" + hex.EncodeToString(buf)
+}
+
+// CreatePlan stores a plan (typically an optimization result) and returns it with its ID.
+func CreatePlan(c *gin.Context) {
+	var plan models.Plan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if len(plan.Shoppers) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No shoppers provided"})
+		return
+	}
+
+	if err := optimizer.ValidateAvoidAreas(plan.AvoidAreas); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Stored plans are created with the default geocoder and market. Every
+	// order must be placed, since the assignments may route it.
+	if _, ok := geocodeOnIngest(c, &plan.Orders, plan.Shoppers, models.GeocodeOptions{Strict: true}); !ok {
+		return
+	}
+
+	if err := hybrid.ValidatePlan(plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if plan.ID == "" {
+		plan.ID = newPlanID()
+	}
+	// Client-chosen IDs are checked and claimed under the plan's edit lock,
+	// so a create never replaces a stored plan or races an update to it
+	store := defaultPlans()
+	defer store.lock(plan.ID)()
+	if _, exists := store.get(plan.ID); exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Plan already exists"})
+		return
+	}
+	store.put(plan)
+
+	c.JSON(http.StatusCreated, plan)
+}
+
+// GetPlan returns a stored plan.
+func GetPlan(c *gin.Context) {
+	plan, ok := defaultPlans().get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// InsertOrders finds the cheapest feasible insertion of new orders into a plan.
+func InsertOrders(c *gin.Context) {
+	var req models.InsertOrdersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if len(req.Orders) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No orders provided"})
+		return
+	}
+
+	if req.Apply {
+		defer defaultPlans().lock(c.Param("id"))()
+	}
+
+	plan, ok := resolvePlan(c, req.Plan)
+	if !ok {
+		return
+	}
+
+	report, ok := geocodeOnIngest(c, &req.Orders, plan.Shoppers, req.Geocoding)
+	if !ok {
+		return
+	}
+
+	if req.Alternatives == 0 {
+		req.Alternatives = 3
+	}
+
+	response, err := hybrid.InsertOrders(plan, req.Orders, req.Alternatives)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	response.GeocodeReport = report
+
+	if req.Apply {
+		defaultPlans().put(response.Plan)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RepairPlan removes cancelled orders and unavailable shoppers from a plan and
+// re-inserts orphaned orders with minimal disruption.
+func RepairPlan(c *gin.Context) {
+	var req models.RepairPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if len(req.RemovedOrderIDs) == 0 && len(req.UnavailableShopperIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No removed orders or unavailable shoppers provided"})
+		return
+	}
+
+	if req.Apply {
+		defer defaultPlans().lock(c.Param("id"))()
+	}
+
+	plan, ok := resolvePlan(c, req.Plan)
+	if !ok {
+		return
+	}
+
+	response, err := hybrid.RepairPlan(plan, req.RemovedOrderIDs, req.UnavailableShopperIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Apply {
+		defaultPlans().put(response.Plan)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetItinerary returns turn-by-turn directions for one shopper's route in a
+// plan. The body is optional and carries routing options or an inline plan.
+func GetItinerary(c *gin.Context) {
+	var req models.ItineraryRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := optimizer.ValidateRoutingOptions(req.RoutingOptions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan, ok := resolvePlan(c, req.Plan)
+	if !ok {
+		return
+	}
+
+	itinerary, err := optimizer.BuildItinerary(c.Request.Context(), plan, c.Param("shopperId"), req.RoutingOptions)
+	if errors.Is(err, optimizer.ErrShopperNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shopper not found in plan"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, itinerary)
+}
+
+// resolvePlan returns the plan sent in the body, or the stored plan named by
+// the path ID. It writes a 404 and returns false when neither exists.
+func resolvePlan(c *gin.Context, inline *models.Plan) (models.Plan, bool) {
+	id := c.Param("id")
+	if inline != nil {
+		plan := *inline
+		plan.ID = id
+		return plan, true
+	}
+	stored, ok := defaultPlans().get(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+		return models.Plan{}, false
+	}
+	return stored, true
+}
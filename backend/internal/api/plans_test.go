@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shipt-route-optimizer/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPlanStoreExpiresPlans(t *testing.T) {
+	store := newPlanStore(time.Hour, 10)
+	store.put(models.Plan{ID: "old"})
+	store.entries["old"].updated = time.Now().Add(-2 * time.Hour)
+	store.put(models.Plan{ID: "new"})
+
+	if _, ok := store.get("old"); ok {
+		t.Error("plan past its TTL is still stored")
+	}
+	if _, ok := store.get("new"); !ok {
+		t.Error("fresh plan was dropped")
+	}
+}
+
+func TestPlanStoreDropsLeastRecentlyUpdated(t *testing.T) {
+	store := newPlanStore(time.Hour, 2)
+	for _, id := range []string{"a", "b"} {
+		store.put(models.Plan{ID: id})
+	}
+	store.entries["a"].updated = time.Now().Add(-time.Minute)
+	store.put(models.Plan{ID: "c"})
+
+	if len(store.entries) != 2 {
+		t.Errorf("kept %d plans, want 2", len(store.entries))
+	}
+	if _, ok := store.get("a"); ok {
+		t.Error("least recently updated plan is still stored")
+	}
+}
+
+func TestPlanStoreKeepsPlansBeingEdited(t *testing.T) {
+	store := newPlanStore(time.Hour, 1)
+	store.put(models.Plan{ID: "a"})
+	store.entries["a"].updated = time.Now().Add(-2 * time.Hour)
+	unlock := store.lock("a")
+	store.put(models.Plan{ID: "b"})
+
+	if _, ok := store.entries["a"]; !ok {
+		t.Fatal("plan was evicted while its edit lock was held")
+	}
+	unlock()
+	store.put(models.Plan{ID: "c"})
+	if _, ok := store.get("a"); ok {
+		t.Error("expired plan kept after its edit finished")
+	}
+}
+
+func TestPlanStoreLockWithoutPlan(t *testing.T) {
+	store := newPlanStore(time.Hour, 10)
+	unlock := store.lock("missing")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		store.lock("missing")()
+	}()
+	select {
+	case <-done:
+		t.Fatal("second editor did not wait for the first")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	<-done
+	if len(store.entries) != 0 {
+		t.Errorf("%d entries left after editing a plan that was never stored", len(store.entries))
+	}
+}
+
+func TestCreatePlan(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/plans", CreatePlan)
+	post := func(plan models.Plan) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(plan)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/plans", bytes.NewReader(body)))
+		return w
+	}
+	plan := models.Plan{
+		// The store is process-wide, so every run needs its own ID
+		ID:          fmt.Sprintf("plan-create-test-%d", time.Now().UnixNano()),
+		Orders:      []models.Order{{ID: "O1", Lat: 33.52, Lng: -86.80}},
+		Shoppers:    []models.Shopper{{ID: "S1", Lat: 33.51, Lng: -86.81}},
+		Assignments: []models.Assignment{{ShopperID: "S1", Route: []string{"O1"}}},
+	}
+
+	if w := post(plan); w.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s, want 201", w.Code, w.Body)
+	}
+	replacement := plan
+	replacement.Assignments = nil
+	if w := post(replacement); w.Code != http.StatusConflict {
+		t.Errorf("create with a taken ID = %d, want 409", w.Code)
+	}
+	if stored, _ := defaultPlans().get(plan.ID); len(stored.Assignments) != 1 {
+		t.Errorf("stored plan was replaced: %+v", stored)
+	}
+
+	invalid := []struct {
+		name        string
+		assignments []models.Assignment
+	}{
+		{"unknown shopper", []models.Assignment{{ShopperID: "S9", Route: []string{"O1"}}}},
+		{"unknown order", []models.Assignment{{ShopperID: "S1", Route: []string{"O9"}}}},
+		{"order assigned twice", []models.Assignment{{ShopperID: "S1", Route: []string{"O1", "O1"}}}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			bad := plan
+			bad.ID = ""
+			bad.Assignments = tt.assignments
+			if w := post(bad); w.Code != http.StatusBadRequest {
+				t.Errorf("create = %d, want 400", w.Code)
+			}
+		})
+	}
+}
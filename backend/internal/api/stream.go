@@ -0,0 +1,302 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"shipt-route-optimizer/internal/jobs"
+	"shipt-route-optimizer/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// streamKeepAlive is how often an idle stream shows it is still alive, so
+// proxies do not time it out during a long solver phase.
+const streamKeepAlive = 15 * time.Second
+
+// streamEvent is one message on a progress stream. The types match the
+// NDJSON stream ("progress", "completed", "error") plus "job" when a run is
+// queued and "snapshot" answering a WebSocket client. Progress and final
+// events carry the job event ID a client resumes after.
+type streamEvent struct {
+	Type  string      `json:"type"`
+	ID    int         `json:"id,omitempty"`
+	Data  interface{} `json:"data,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// keepAliveEvent is never sent as is; each transport writes its own idle marker.
+const keepAliveEvent = "keep-alive"
+
+// jobControl is a message from a WebSocket client.
+type jobControl struct {
+	Type        string                     `json:"type"`                  // "start", "attach", "cancel" or "snapshot"
+	Data        *models.HybridSolveRequest `json:"data,omitempty"`        // the run to start
+	JobID       string                     `json:"jobId,omitempty"`       // the job to attach to
+	LastEventID int                        `json:"lastEventId,omitempty"` // resume after this event when attaching
+}
+
+// followJob sends the job's events after lastID until the job finishes, ctx
+// ends or send fails. Control messages, for transports that have them, are
+// handled between events; a closed controls channel means the client left,
+// which ends the stream but not the job.
+func followJob(ctx context.Context, id string, lastID int, send func(streamEvent) error, controls <-chan jobControl) error {
+	manager := defaultJobs()
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		events, job, changed, ok := manager.Events(id, lastID)
+		if !ok {
+			return send(streamEvent{Type: "error", Error: "Job not found"})
+		}
+		for _, event := range events {
+			lastID = event.ID
+			if event.Type != jobs.EventProgress {
+				return send(finalEvent(job, event.ID))
+			}
+			if err := send(streamEvent{Type: "progress", ID: event.ID, Data: event.Progress}); err != nil {
+				return err
+			}
+		}
+		if jobs.Finished(job.Status) {
+			// The client already saw the final event before reconnecting
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-keepAlive.C:
+			if err := send(streamEvent{Type: keepAliveEvent}); err != nil {
+				return err
+			}
+		case control, ok := <-controls:
+			if !ok {
+				return nil
+			}
+			if err := handleControl(id, control, send); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleControl acts on a client message received while following a job.
+func handleControl(id string, control jobControl, send func(streamEvent) error) error {
+	switch control.Type {
+	case "cancel":
+		// The final event follows through the event log
+		defaultJobs().Cancel(id)
+		return nil
+	case "snapshot":
+		job, _ := defaultJobs().Get(id)
+		return send(streamEvent{Type: "snapshot", Data: job})
+	default:
+		return send(streamEvent{Type: "error", Error: fmt.Sprintf("Unknown control message %q", control.Type)})
+	}
+}
+
+// finalEvent reports how a job ended.
+func finalEvent(job models.Job, id int) streamEvent {
+	if job.Status == jobs.StatusCompleted {
+		return streamEvent{Type: "completed", ID: id, Data: job.Result}
+	}
+	return streamEvent{Type: "error", ID: id, Error: job.Error}
+}
+
+// HybridSolveSSE queues a hybrid solve as a job and streams its progress as
+// Server-Sent Events. The run outlives the connection; the client resumes
+// from GET /api/jobs/{id}/events with Last-Event-ID.
+//
+// Being a POST, this stream cannot be opened with the browser's EventSource,
+// which only sends GETs; it is for clients that read the response body
+// themselves, such as fetch. EventSource clients POST /api/jobs and then
+// open GET /api/jobs/{id}/events, which also reconnects on its own.
+func HybridSolveSSE(c *gin.Context) {
+	req, ok := bindHybridRequest(c)
+	if !ok {
+		return
+	}
+
+	job, ok := submitHybridJob(c, req)
+	if !ok {
+		return
+	}
+
+	c.Header("X-Job-ID", job.ID)
+	streamSSE(c, job.ID, 0, &job)
+}
+
+// StreamJobEvents streams a job's progress as Server-Sent Events, resuming
+// after the Last-Event-ID header (or lastEventId query parameter) if given.
+func StreamJobEvents(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := defaultJobs().Get(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	lastID, _ := strconv.Atoi(c.GetHeader("Last-Event-ID"))
+	if lastID == 0 {
+		lastID, _ = strconv.Atoi(c.Query("lastEventId"))
+	}
+	streamSSE(c, id, lastID, nil)
+}
+
+// streamSSE follows the job over the response, announcing it first when
+// the stream created it.
+func streamSSE(c *gin.Context, id string, lastID int, created *models.Job) {
+	writer := c.Writer
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming unsupported"})
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+
+	send := func(event streamEvent) error {
+		if err := writeSSE(writer, event); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	if created != nil {
+		if send(streamEvent{Type: "job", Data: created}) != nil {
+			return
+		}
+	}
+	_ = followJob(c.Request.Context(), id, lastID, send, nil)
+}
+
+// writeSSE writes one event in text/event-stream framing. The data is the
+// event's payload alone; the event name carries its type.
+func writeSSE(w io.Writer, event streamEvent) error {
+	if event.Type == keepAliveEvent {
+		_, err := io.WriteString(w, ": keep-alive\n\n")
+		return err
+	}
+
+	var payload interface{} = event.Data
+	if event.Error != "" {
+		payload = gin.H{"error": event.Error}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	frame := ""
+	if event.ID > 0 {
+		frame = "id: " + strconv.Itoa(event.ID) + "\n"
+	}
+	frame += "event: " + event.Type + "\ndata: " + string(data) + "\n\n"
+	_, err = io.WriteString(w, frame)
+	return err
+}
+
+// HybridSolveWebSocket carries solver progress over a WebSocket. The client
+// first sends {"type":"start","data":<hybrid solve request>} or
+// {"type":"attach","jobId":...,"lastEventId":...}, then may send
+// {"type":"cancel"} or {"type":"snapshot"} at any time. Runs are jobs, so
+// closing the socket leaves them running.
+func HybridSolveWebSocket(c *gin.Context) {
+	websocket.Server{Handshake: checkSocketOrigin, Handler: serveProgressSocket}.ServeHTTP(c.Writer, c.Request)
+}
+
+// checkSocketOrigin refuses browsers on pages outside AllowedOrigins, which
+// CORS does not cover for WebSockets. Clients that send no Origin (tools,
+// other services) are accepted, as they are by the other endpoints.
+func checkSocketOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+	if origin == nil {
+		return nil
+	}
+	config.Origin = origin
+	for _, allowed := range AllowedOrigins {
+		if origin.Scheme+"://"+origin.Host == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q not allowed", origin)
+}
+
+func serveProgressSocket(ws *websocket.Conn) {
+	controls := make(chan jobControl)
+	done := make(chan struct{})
+	go func() {
+		defer close(controls)
+		for {
+			var control jobControl
+			if err := websocket.JSON.Receive(ws, &control); err != nil {
+				return
+			}
+			select {
+			case controls <- control:
+			case <-done:
+				return
+			}
+		}
+	}()
+	// Closing the socket unblocks the reader when the stream ends first
+	defer ws.Close()
+	defer close(done)
+
+	send := func(event streamEvent) error {
+		if event.Type == keepAliveEvent {
+			return nil
+		}
+		return websocket.JSON.Send(ws, event)
+	}
+	ctx := ws.Request().Context()
+
+	for control := range controls {
+		var id string
+		lastID := 0
+		switch control.Type {
+		case "start":
+			if control.Data == nil {
+				_ = send(streamEvent{Type: "error", Error: "Invalid request body"})
+				continue
+			}
+			req, problem := checkHybridRequest(ctx, *control.Data)
+			if problem != nil {
+				// The same body the HTTP endpoints answer 400 with
+				problem["type"] = "error"
+				_ = websocket.JSON.Send(ws, problem)
+				continue
+			}
+			job, err := defaultJobs().Submit(req.run)
+			if err != nil {
+				_ = send(streamEvent{Type: "error", Error: "Too many queued jobs, try again later"})
+				continue
+			}
+			id = job.ID
+			if send(streamEvent{Type: "job", Data: job}) != nil {
+				return
+			}
+		case "attach":
+			id, lastID = control.JobID, control.LastEventID
+		default:
+			_ = send(streamEvent{Type: "error", Error: "Send start or attach first"})
+			continue
+		}
+		_ = followJob(ctx, id, lastID, send, controls)
+		return
+	}
+}
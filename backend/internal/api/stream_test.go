@@ -0,0 +1,268 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"shipt-route-optimizer/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// testSolveBody is a small hybrid solve that finishes in a few milliseconds.
+func testSolveBody(t *testing.T) []byte {
+	t.Helper()
+	req := models.HybridSolveRequest{Options: models.HybridSolveOptions{Iterations: 30, Workers: 2, EmitIntervalMillis: 1, RandomSeed: 3}}
+	for i := 0; i < 12; i++ {
+		req.Orders = append(req.Orders, models.Order{ID: fmt.Sprintf("O%d", i+1), Lat: 33.45 + float64(i%4)*0.03, Lng: -86.90 + float64(i/4)*0.04, ItemCount: 2})
+	}
+	req.Shoppers = []models.Shopper{{ID: "S1", Lat: 33.50, Lng: -86.85, Capacity: 8}, {ID: "S2", Lat: 33.52, Lng: -86.80, Capacity: 8}}
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func newStreamServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/optimize-hybrid-sse", HybridSolveSSE)
+	router.GET("/api/optimize-hybrid-ws", HybridSolveWebSocket)
+	router.POST("/api/jobs", CreateJob)
+	router.GET("/api/jobs/:id/events", StreamJobEvents)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// sseEvent is one event as an EventSource would dispatch it.
+type sseEvent struct {
+	id    int
+	event string
+	data  string
+}
+
+func readSSE(t *testing.T, body io.Reader) []sseEvent {
+	t.Helper()
+	events := []sseEvent{}
+	var current sseEvent
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		field, value, _ := strings.Cut(scanner.Text(), ": ")
+		switch field {
+		case "":
+			if current.event != "" {
+				events = append(events, current)
+			}
+			current = sseEvent{}
+		case "id":
+			current.id, _ = strconv.Atoi(value)
+		case "event":
+			current.event = value
+		case "data":
+			current.data = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// checkRun fails unless events are progress with rising IDs ending in a
+// completed result, and returns the final event's ID.
+func checkRun(t *testing.T, events []sseEvent, after int) int {
+	t.Helper()
+	if len(events) == 0 {
+		t.Fatal("no events")
+	}
+	for i, event := range events {
+		if event.id <= after {
+			t.Fatalf("event %d has ID %d, not after %d", i, event.id, after)
+		}
+		after = event.id
+		if i < len(events)-1 && event.event != "progress" {
+			t.Fatalf("event %d is %q before the end", i, event.event)
+		}
+	}
+	final := events[len(events)-1]
+	var result models.HybridSolveResponse
+	if final.event != "completed" || json.Unmarshal([]byte(final.data), &result) != nil || len(result.Optimization.Assignments) == 0 {
+		t.Fatalf("final event %q %s, want the completed result", final.event, final.data)
+	}
+	return final.id
+}
+
+func TestWriteSSE(t *testing.T) {
+	tests := []struct {
+		event streamEvent
+		want  string
+	}{
+		{streamEvent{Type: "progress", ID: 3, Data: gin.H{"iteration": 7}}, "id: 3\nevent: progress\ndata: {\"iteration\":7}\n\n"},
+		{streamEvent{Type: "error", ID: 4, Error: "boom"}, "id: 4\nevent: error\ndata: {\"error\":\"boom\"}\n\n"},
+		{streamEvent{Type: "job", Data: gin.H{"id": "j1"}}, "event: job\ndata: {\"id\":\"j1\"}\n\n"},
+		{streamEvent{Type: keepAliveEvent}, ": keep-alive\n\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeSSE(&buf, tt.event); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("writeSSE(%+v) = %q, want %q", tt.event, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestJobEventsResume(t *testing.T) {
+	server := newStreamServer(t)
+	resp, err := http.Post(server.URL+"/api/jobs", "application/json", bytes.NewReader(testSolveBody(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job models.Job
+	err = json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("create job = %d, %v", resp.StatusCode, err)
+	}
+
+	follow := func(lastEventID string, query string) []sseEvent {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/jobs/"+job.ID+"/events"+query, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("events = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		return readSSE(t, resp.Body)
+	}
+
+	events := follow("", "")
+	finalID := checkRun(t, events, 0)
+	if len(events) < 2 {
+		t.Fatalf("only %d events, want progress before the result", len(events))
+	}
+
+	// Reconnecting after a progress event replays only what came later
+	resumeAt := events[len(events)/2-1].id
+	resumed := follow(strconv.Itoa(resumeAt), "")
+	if got := checkRun(t, resumed, resumeAt); got != finalID || len(resumed) != len(events)-len(events)/2 {
+		t.Errorf("resumed after %d: %d events ending at %d, want %d ending at %d", resumeAt, len(resumed), got, len(events)-len(events)/2, finalID)
+	}
+	if byQuery := follow("", fmt.Sprintf("?lastEventId=%d", resumeAt)); len(byQuery) != len(resumed) {
+		t.Errorf("lastEventId query replayed %d events, header %d", len(byQuery), len(resumed))
+	}
+	// A client that saw the result gets nothing more
+	if after := follow(strconv.Itoa(finalID), ""); len(after) != 0 {
+		t.Errorf("after the final event: %d more events", len(after))
+	}
+
+	resp, err = http.Get(server.URL + "/api/jobs/missing/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("events of an unknown job = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestHybridSolveSSE(t *testing.T) {
+	server := newStreamServer(t)
+	resp, err := http.Post(server.URL+"/api/optimize-hybrid-sse", "application/json", bytes.NewReader(testSolveBody(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := readSSE(t, resp.Body)
+
+	if len(events) == 0 || events[0].event != "job" {
+		t.Fatalf("first event %+v, want the queued job", events)
+	}
+	var job models.Job
+	if json.Unmarshal([]byte(events[0].data), &job) != nil || job.ID != resp.Header.Get("X-Job-ID") {
+		t.Errorf("job event %s, X-Job-ID %q", events[0].data, resp.Header.Get("X-Job-ID"))
+	}
+	checkRun(t, events[1:], 0)
+}
+
+func TestHybridSolveWebSocket(t *testing.T) {
+	server := newStreamServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/optimize-hybrid-ws"
+	receive := func(ws *websocket.Conn) []streamEvent {
+		events := []streamEvent{}
+		for {
+			var event streamEvent
+			if err := websocket.JSON.Receive(ws, &event); err != nil {
+				return events // the server closes the socket after the final event
+			}
+			events = append(events, event)
+		}
+	}
+
+	ws, err := websocket.Dial(url, "", AllowedOrigins[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err := websocket.JSON.Send(ws, jobControl{Type: "start"}); err != nil {
+		t.Fatal(err)
+	}
+	var problem streamEvent
+	if err := websocket.JSON.Receive(ws, &problem); err != nil || problem.Type != "error" {
+		t.Errorf("start without a request: %+v, %v; want an error event", problem, err)
+	}
+	var req models.HybridSolveRequest
+	if err := json.Unmarshal(testSolveBody(t), &req); err != nil {
+		t.Fatal(err)
+	}
+	if err := websocket.JSON.Send(ws, jobControl{Type: "start", Data: &req}); err != nil {
+		t.Fatal(err)
+	}
+	events := receive(ws)
+	if len(events) < 2 || events[0].Type != "job" || events[len(events)-1].Type != "completed" {
+		t.Fatalf("got %d events, want the job, progress and the result", len(events))
+	}
+	data, _ := json.Marshal(events[0].Data)
+	var job models.Job
+	if err := json.Unmarshal(data, &job); err != nil || job.ID == "" {
+		t.Fatalf("job event %s", data)
+	}
+
+	// Attaching after the last progress event only sends the result
+	final := events[len(events)-1]
+	attached, err := websocket.Dial(url, "", AllowedOrigins[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer attached.Close()
+	if err := websocket.JSON.Send(attached, jobControl{Type: "attach", JobID: job.ID, LastEventID: events[len(events)-2].ID}); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(attached); len(got) != 1 || got[0].Type != "completed" || got[0].ID != final.ID {
+		t.Errorf("attach got %+v, want only the completed event %d", got, final.ID)
+	}
+
+	if ws, err := websocket.Dial(url, "", "http://elsewhere.example"); err == nil {
+		ws.Close()
+		t.Error("a page on another origin opened the socket")
+	}
+}
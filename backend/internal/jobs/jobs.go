@@ -0,0 +1,308 @@
+// Package jobs runs optimizations in the background on a bounded worker
+// pool, keeping each result for a while after it finishes.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"shipt-route-optimizer/internal/models"
+)
+
+// Job statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// ErrQueueFull is returned by Submit when the queue has no room left.
+var ErrQueueFull = errors.New("jobs: queue is full")
+
+// eventLogSize bounds the progress events kept per job for clients resuming
+// a stream. Each event carries the best distance so far, so a client that
+// falls further behind only misses intermediate steps. Only the events of
+// the latest full solution snapshot and the deltas after it keep their
+// snapshot, and none do once the job finishes and its result holds the plan.
+const eventLogSize = 512
+
+// Event is one entry in a job's event log: a progress snapshot, or the
+// job's final status once it finishes.
+type Event struct {
+	ID       int                    // sequence number, from 1
+	Type     string                 // "progress", or the final job status
+	Progress *models.HybridProgress // for "progress" events
+}
+
+// EventProgress is the Type of progress events.
+const EventProgress = "progress"
+
+// Finished reports whether a job in the status is done for good.
+func Finished(status string) bool {
+	return status == StatusCompleted || status == StatusFailed || status == StatusCancelled
+}
+
+// Config sizes the worker pool and sets how long results are kept.
+type Config struct {
+	Workers   int           // jobs run at once
+	QueueSize int           // jobs waiting for a worker
+	ResultTTL time.Duration // how long a finished job stays readable
+}
+
+// ConfigFromEnv reads JOBS_WORKERS, JOBS_QUEUE_SIZE and JOBS_RESULT_TTL (a
+// Go duration such as "30m"). Each hybrid run already uses every core, so
+// only two run at once by default.
+func ConfigFromEnv() Config {
+	cfg := Config{Workers: 2, QueueSize: 64, ResultTTL: time.Hour}
+	if n, err := strconv.Atoi(os.Getenv("JOBS_WORKERS")); err == nil && n > 0 {
+		cfg.Workers = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("JOBS_QUEUE_SIZE")); err == nil && n > 0 {
+		cfg.QueueSize = n
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("JOBS_RESULT_TTL")); err == nil && ttl > 0 {
+		cfg.ResultTTL = ttl
+	}
+	return cfg
+}
+
+// RunFunc does a job's work under ctx, reporting solver snapshots as it goes.
+type RunFunc func(ctx context.Context, progress func(models.HybridProgress)) (models.HybridSolveResponse, error)
+
+// Manager queues jobs, runs them on its workers and answers status queries.
+type Manager struct {
+	ttl   time.Duration
+	queue chan *job
+
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+type job struct {
+	info   models.Job // guarded by Manager.mu
+	run    RunFunc
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Event log, guarded by Manager.mu. changed is closed and replaced
+	// whenever an event is appended. withSnapshot lists the IDs of events
+	// still carrying a solution snapshot.
+	events       []Event
+	lastID       int
+	changed      chan struct{}
+	withSnapshot []int
+}
+
+// NewManager starts cfg.Workers workers that live as long as the process.
+func NewManager(cfg Config) *Manager {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1
+	}
+	if cfg.ResultTTL <= 0 {
+		cfg.ResultTTL = time.Hour
+	}
+	m := &Manager{
+		ttl:   cfg.ResultTTL,
+		queue: make(chan *job, cfg.QueueSize),
+		jobs:  make(map[string]*job),
+	}
+	for w := 0; w < cfg.Workers; w++ {
+		go m.work()
+	}
+	return m
+}
+
+// Submit queues run and returns the new job. The job's context is detached
+// from the caller's, so it keeps going after the submitting request ends.
+func (m *Manager) Submit(run RunFunc) (models.Job, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		info:    models.Job{ID: newJobID(), Status: StatusQueued, CreatedAt: time.Now()},
+		run:     run,
+		ctx:     ctx,
+		cancel:  cancel,
+		changed: make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+	select {
+	case m.queue <- j:
+	default:
+		cancel()
+		return models.Job{}, ErrQueueFull
+	}
+	m.jobs[j.info.ID] = j
+	return j.info, nil
+}
+
+// Get returns the job's current state.
+func (m *Manager) Get(id string) (models.Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+	j, ok := m.jobs[id]
+	if !ok {
+		return models.Job{}, false
+	}
+	return j.info, true
+}
+
+// Events returns the job's retained events after the given event ID, its
+// current state, and a channel that is closed when the next event arrives.
+func (m *Manager) Events(id string, after int) ([]Event, models.Job, <-chan struct{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, models.Job{}, nil, false
+	}
+	// Event IDs are contiguous, so the first one after `after` is found by offset
+	start := 0
+	if len(j.events) > 0 {
+		start = min(max(after-j.events[0].ID+1, 0), len(j.events))
+	}
+	events := append([]Event(nil), j.events[start:]...)
+	return events, j.info, j.changed, true
+}
+
+// Cancel stops a queued or running job and returns its final state. A
+// finished job is dropped instead, along with its result.
+func (m *Manager) Cancel(id string) (models.Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+	j, ok := m.jobs[id]
+	if !ok {
+		return models.Job{}, false
+	}
+	switch j.info.Status {
+	case StatusQueued, StatusRunning:
+		j.cancel()
+		m.settle(j, StatusCancelled, "cancelled by request")
+	default:
+		delete(m.jobs, id)
+	}
+	return j.info, true
+}
+
+func (m *Manager) work() {
+	for j := range m.queue {
+		m.mu.Lock()
+		if j.info.Status != StatusQueued {
+			// Cancelled while waiting
+			m.mu.Unlock()
+			continue
+		}
+		now := time.Now()
+		j.info.Status = StatusRunning
+		j.info.StartedAt = &now
+		m.mu.Unlock()
+
+		result, err := j.run(j.ctx, func(progress models.HybridProgress) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if j.info.Status != StatusRunning {
+				return
+			}
+			// A delta means nothing on its own, so status queries get the scalars
+			scalar := progress
+			scalar.Snapshot = nil
+			j.info.Progress = &scalar
+			if progress.Snapshot == nil {
+				m.appendEvent(j, Event{Type: EventProgress, Progress: &scalar})
+				return
+			}
+			if progress.Snapshot.Full {
+				m.dropSnapshots(j)
+			}
+			m.appendEvent(j, Event{Type: EventProgress, Progress: &progress})
+			j.withSnapshot = append(j.withSnapshot, j.lastID)
+		})
+
+		m.mu.Lock()
+		switch {
+		case j.info.Status != StatusRunning:
+			// Cancelled while running; the result is discarded
+		case err != nil:
+			m.settle(j, StatusFailed, err.Error())
+		default:
+			j.info.Result = &result
+			m.settle(j, StatusCompleted, "")
+		}
+		m.mu.Unlock()
+		j.cancel()
+	}
+}
+
+// settle records how the job finished and starts its retention clock.
+// Callers hold m.mu.
+func (m *Manager) settle(j *job, status, message string) {
+	now := time.Now()
+	expires := now.Add(m.ttl)
+	j.info.Status = status
+	j.info.Error = message
+	j.info.FinishedAt = &now
+	j.info.ExpiresAt = &expires
+	m.dropSnapshots(j)
+	m.appendEvent(j, Event{Type: status})
+}
+
+// dropSnapshots strips the solution snapshots from the job's logged events,
+// replacing rather than changing the progress streams may still be reading.
+// Callers hold m.mu.
+func (m *Manager) dropSnapshots(j *job) {
+	for _, id := range j.withSnapshot {
+		if len(j.events) == 0 || id < j.events[0].ID {
+			continue // already trimmed from the log
+		}
+		event := &j.events[id-j.events[0].ID]
+		scalar := *event.Progress
+		scalar.Snapshot = nil
+		event.Progress = &scalar
+	}
+	j.withSnapshot = j.withSnapshot[:0]
+}
+
+// appendEvent numbers the event, adds it to the log and wakes waiting
+// streams. Callers hold m.mu.
+func (m *Manager) appendEvent(j *job, event Event) {
+	j.lastID++
+	event.ID = j.lastID
+	j.events = append(j.events, event)
+	if len(j.events) > eventLogSize {
+		// The final status event is always last, so trimming never drops it
+		j.events = j.events[len(j.events)-eventLogSize:]
+	}
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// prune drops finished jobs whose retention has run out. Callers hold m.mu.
+func (m *Manager) prune() {
+	now := time.Now()
+	for id, j := range m.jobs {
+		if j.info.ExpiresAt != nil && now.After(*j.info.ExpiresAt) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return "job-" + hex.EncodeToString(buf)
+}
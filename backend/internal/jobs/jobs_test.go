@@ -0,0 +1,194 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"shipt-route-optimizer/internal/models"
+)
+
+// waitFor waits until the job's state satisfies done, failing the test
+// after a few seconds. Starting a job logs no event, so it also polls.
+func waitFor(t *testing.T, m *Manager, id string, done func(models.Job) bool) models.Job {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		_, job, changed, ok := m.Events(id, 0)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if done(job) {
+			return job
+		}
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Millisecond):
+		case <-timeout:
+			t.Fatalf("job %s stuck in %s", id, job.Status)
+		}
+	}
+}
+
+func hasStatus(status string) func(models.Job) bool {
+	return func(job models.Job) bool { return job.Status == status }
+}
+
+// blockingRun runs until its context is cancelled or release is closed.
+func blockingRun(release <-chan struct{}) RunFunc {
+	return func(ctx context.Context, progress func(models.HybridProgress)) (models.HybridSolveResponse, error) {
+		select {
+		case <-ctx.Done():
+			return models.HybridSolveResponse{}, ctx.Err()
+		case <-release:
+			return models.HybridSolveResponse{}, nil
+		}
+	}
+}
+
+func TestManagerCompletesJob(t *testing.T) {
+	m := NewManager(Config{Workers: 1, QueueSize: 4, ResultTTL: time.Hour})
+	job, err := m.Submit(func(ctx context.Context, progress func(models.HybridProgress)) (models.HybridSolveResponse, error) {
+		progress(models.HybridProgress{Iteration: 1, BestDistance: 12})
+		progress(models.HybridProgress{Iteration: 2, BestDistance: 10})
+		return models.HybridSolveResponse{Optimization: models.OptimizeResponse{TotalDistanceAfter: 10}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := waitFor(t, m, job.ID, hasStatus(StatusCompleted))
+	if done.Result == nil || done.Result.Optimization.TotalDistanceAfter != 10 {
+		t.Errorf("result = %+v", done.Result)
+	}
+	if done.Progress == nil || done.Progress.Iteration != 2 {
+		t.Errorf("progress = %+v, want iteration 2", done.Progress)
+	}
+	events, _, _, _ := m.Events(job.ID, 0)
+	if len(events) != 3 || events[2].Type != StatusCompleted {
+		t.Fatalf("events = %+v, want two progress events and the final status", events)
+	}
+	// Resuming after the first event skips it
+	if after, _, _, _ := m.Events(job.ID, 1); len(after) != 2 || after[0].ID != 2 {
+		t.Errorf("events after 1 = %+v", after)
+	}
+}
+
+func TestManagerCancel(t *testing.T) {
+	m := NewManager(Config{Workers: 1, QueueSize: 4, ResultTTL: time.Hour})
+	release := make(chan struct{})
+	defer close(release)
+
+	running, _ := m.Submit(blockingRun(release))
+	waitFor(t, m, running.ID, hasStatus(StatusRunning))
+	ran := make(chan struct{}, 1)
+	queued, _ := m.Submit(func(ctx context.Context, progress func(models.HybridProgress)) (models.HybridSolveResponse, error) {
+		ran <- struct{}{}
+		return models.HybridSolveResponse{}, nil
+	})
+
+	// A queued job never starts
+	if job, _ := m.Cancel(queued.ID); job.Status != StatusCancelled {
+		t.Errorf("queued job is %s after cancel", job.Status)
+	}
+	// A running job's context is cancelled and its result discarded
+	if job, _ := m.Cancel(running.ID); job.Status != StatusCancelled || job.Error == "" {
+		t.Errorf("running job is %s (%q) after cancel", job.Status, job.Error)
+	}
+
+	// Once the worker is free the cancelled queued job is skipped
+	next, _ := m.Submit(func(ctx context.Context, progress func(models.HybridProgress)) (models.HybridSolveResponse, error) {
+		return models.HybridSolveResponse{}, nil
+	})
+	waitFor(t, m, next.ID, hasStatus(StatusCompleted))
+	select {
+	case <-ran:
+		t.Error("cancelled queued job ran")
+	default:
+	}
+	if job, _ := m.Get(running.ID); job.Status != StatusCancelled || job.Result != nil {
+		t.Errorf("cancelled job ended %s with result %v", job.Status, job.Result)
+	}
+
+	// Cancelling a finished job forgets it
+	m.Cancel(next.ID)
+	if _, ok := m.Get(next.ID); ok {
+		t.Error("finished job still readable after cancel")
+	}
+}
+
+func TestManagerQueueFull(t *testing.T) {
+	m := NewManager(Config{Workers: 1, QueueSize: 1, ResultTTL: time.Hour})
+	release := make(chan struct{})
+	defer close(release)
+
+	running, _ := m.Submit(blockingRun(release))
+	waitFor(t, m, running.ID, hasStatus(StatusRunning))
+	if _, err := m.Submit(blockingRun(release)); err != nil {
+		t.Fatalf("second job: %v", err)
+	}
+	if _, err := m.Submit(blockingRun(release)); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("third job: err = %v, want %v", err, ErrQueueFull)
+	}
+}
+
+func TestManagerExpiresResults(t *testing.T) {
+	m := NewManager(Config{Workers: 1, QueueSize: 1, ResultTTL: 50 * time.Millisecond})
+	job, _ := m.Submit(func(ctx context.Context, progress func(models.HybridProgress)) (models.HybridSolveResponse, error) {
+		return models.HybridSolveResponse{}, errors.New("no shoppers provided")
+	})
+
+	done := waitFor(t, m, job.ID, hasStatus(StatusFailed))
+	if done.Error != "no shoppers provided" || done.ExpiresAt == nil {
+		t.Errorf("failed job = %+v", done)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := m.Get(job.ID); ok {
+		t.Error("job still readable after its TTL")
+	}
+}
+
+func TestManagerKeepsLatestSnapshots(t *testing.T) {
+	m := NewManager(Config{Workers: 1, QueueSize: 1, ResultTTL: time.Hour})
+	release := make(chan struct{})
+	job, _ := m.Submit(func(ctx context.Context, progress func(models.HybridProgress)) (models.HybridSolveResponse, error) {
+		for version := 1; version <= 5; version++ {
+			snapshot := &models.SolutionSnapshot{Version: version, Full: version%3 == 1}
+			if !snapshot.Full {
+				snapshot.BaseVersion = version - 1
+			}
+			progress(models.HybridProgress{Iteration: version})
+			progress(models.HybridProgress{Iteration: version, Snapshot: snapshot})
+		}
+		<-release
+		return models.HybridSolveResponse{}, nil
+	})
+
+	running := waitFor(t, m, job.ID, func(job models.Job) bool {
+		return job.Progress != nil && job.Progress.Iteration == 5
+	})
+	if running.Progress.Snapshot != nil {
+		t.Error("job status carries a snapshot")
+	}
+	// Version 4 is the latest full snapshot; 5 is the delta on top of it
+	events, _, _, _ := m.Events(job.ID, 0)
+	kept := []int{}
+	for _, event := range events {
+		if event.Progress.Snapshot != nil {
+			kept = append(kept, event.Progress.Snapshot.Version)
+		}
+	}
+	if len(kept) != 2 || kept[0] != 4 || kept[1] != 5 {
+		t.Errorf("events keep snapshots %v, want [4 5]", kept)
+	}
+
+	close(release)
+	waitFor(t, m, job.ID, hasStatus(StatusCompleted))
+	events, _, _, _ = m.Events(job.ID, 0)
+	for _, event := range events {
+		if event.Progress != nil && event.Progress.Snapshot != nil {
+			t.Errorf("finished job keeps snapshot %d", event.Progress.Snapshot.Version)
+		}
+	}
+}
@@ -11,6 +11,10 @@ type ShopperAnalytics struct {
 	EstimatedStartTime string  `json:"estimatedStartTime"`
 	EstimatedEndTime   string  `json:"estimatedEndTime"`
 	Efficiency         float64 `json:"efficiency"` // orders per hour
+	DrivingTime        float64 `json:"drivingTime"`  // minutes
+	ServiceTime        float64 `json:"serviceTime"`  // minutes spent at stops
+	WaitingTime        float64 `json:"waitingTime"`  // minutes waiting for delivery windows to open
+	LateStops          int     `json:"lateStops"`    // stops reached after their delivery window
 }
 
 // OrderAnalytics contains insights about order distribution
@@ -36,12 +40,28 @@ type SystemAnalytics struct {
 	OptimizationScore   float64 `json:"optimizationScore"` // 0-100
 	EstimatedFuelCost   float64 `json:"estimatedFuelCost"` // USD
 	CO2Saved            float64 `json:"co2Saved"` // kg
+	RoadLegs            int     `json:"roadLegs"`       // route legs that follow real roads
+	FallbackLegs        int     `json:"fallbackLegs"`   // legs drawn as straight lines after a routing failure
+	FallbackRoutes      int     `json:"fallbackRoutes"` // routes with at least one fallback leg
 }
 
 // RouteGeometry contains the actual road path
 type RouteGeometry struct {
-	ShopperID string      `json:"shopperId"`
-	Points    [][]float64 `json:"points"` // [lat, lng] pairs
+	ShopperID       string         `json:"shopperId"`
+	Points          [][]float64    `json:"points,omitempty"`    // [lat, lng] pairs; omitted for the other geometry formats
+	Polyline        string         `json:"polyline,omitempty"`  // encoded polyline of the points for "polyline" and "polyline6"
+	Precision       int            `json:"precision,omitempty"` // polyline decimal digits: 5 or 6
+	GeoJSON         *LineString    `json:"geojson,omitempty"`   // GeoJSON LineString of the points for "geojson"
+	SimplifiedFrom  int            `json:"simplifiedFrom,omitempty"` // road geometry points before simplification
+	RoadLegs        int            `json:"roadLegs"`     // legs following real roads
+	FallbackLegs    int            `json:"fallbackLegs"` // legs drawn as straight lines because routing failed
+	FallbackReasons map[string]int `json:"fallbackReasons,omitempty"` // fallback legs per reason, e.g. "http-429"
+}
+
+// LineString is a GeoJSON LineString; coordinates are [lng, lat] pairs
+type LineString struct {
+	Type        string      `json:"type"`
+	Coordinates [][]float64 `json:"coordinates"`
 }
 
 // AnalyticsResponse contains all analytics data
@@ -0,0 +1,64 @@
+package models
+
+// GeocodeOptions pick the geocoder for orders given by address and the
+// market their locations are checked against.
+type GeocodeOptions struct {
+	Provider      string  `json:"provider,omitempty"`      // "ors", "nominatim" or "gazetteer"; empty uses GEOCODING_PROVIDER
+	APIKey        string  `json:"apiKey,omitempty"`        // overrides GEOCODING_API_KEY
+	Market        *Market `json:"market,omitempty"`        // omit to center on the shoppers, or the orders when there are none
+	MinConfidence float64 `json:"minConfidence,omitempty"` // matches below this are reported; defaults to 0.6
+	Strict        bool    `json:"strict,omitempty"`        // fail the request when any address is rejected, rather than leave those orders out
+}
+
+// Market is the area a batch of orders is expected to fall in.
+type Market struct {
+	Lat      float64 `json:"lat"`
+	Lng      float64 `json:"lng"`
+	RadiusKm float64 `json:"radiusKm"` // defaults to 50
+}
+
+// GeocodeMatch records how an order's address was placed.
+type GeocodeMatch struct {
+	Label      string  `json:"label"`      // the matched place as the geocoder names it
+	Confidence float64 `json:"confidence"` // 0-1
+	Source     string  `json:"source"`     // geocoder name
+}
+
+// GeocodeRequest geocodes orders without optimizing them, to check a feed.
+type GeocodeRequest struct {
+	Orders    []Order        `json:"orders"`
+	Shoppers  []Shopper      `json:"shoppers"` // optional; centers the market
+	Geocoding GeocodeOptions `json:"geocoding"`
+}
+
+// GeocodeIssue is an order whose address failed to geocode or resolved
+// somewhere doubtful.
+type GeocodeIssue struct {
+	OrderID    string  `json:"orderId"`
+	Address    string  `json:"address"`
+	Problem    string  `json:"problem"` // "not-found", "geocoder-error", "outside-market" or "low-confidence"
+	Detail     string  `json:"detail,omitempty"`
+	Lat        float64 `json:"lat,omitempty"`
+	Lng        float64 `json:"lng,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+	DistanceKm float64 `json:"distanceKm,omitempty"` // from the market center
+}
+
+// GeocodeReport summarizes geocoding a batch of orders. Orders that failed
+// or resolved outside the market are not usable for routing; low-confidence
+// matches are usable but worth a look.
+type GeocodeReport struct {
+	Geocoder string         `json:"geocoder"`
+	Market   Market         `json:"market"`
+	Total    int            `json:"total"`    // orders that needed geocoding
+	Geocoded int            `json:"geocoded"` // resolved inside the market
+	Rejected int            `json:"rejected"` // failed or outside the market
+	Issues   []GeocodeIssue `json:"issues"`
+}
+
+// GeocodeResponse returns the orders with coordinates filled in and the
+// validation report.
+type GeocodeResponse struct {
+	Orders []Order       `json:"orders"`
+	Report GeocodeReport `json:"report"`
+}
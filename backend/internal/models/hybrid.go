@@ -10,30 +10,58 @@ type HybridSolveOptions struct {
 	RandomizedListSize    int     `json:"randomizedListSize"`
 	DestroyRate           float64 `json:"destroyRate"`
 	LocalSearchIterations int     `json:"localSearchIterations"`
+	NeighborListSize      int     `json:"neighborListSize"` // nearest orders/shoppers considered per insertion
 	EmitIntervalMillis    int     `json:"emitIntervalMillis"`
 	RandomSeed            int64   `json:"randomSeed"`
-	UseRealRoutes         bool    `json:"useRealRoutes"`
-	ApiKey                string  `json:"apiKey"`
+	Decomposition         string  `json:"decomposition"`    // "", "auto", "cluster" or "grid"
+	Regions               int     `json:"regions"`          // sub-regions for decomposition; 0 picks by size
+	Snapshots             string  `json:"snapshots"`        // "", "full" or "delta": stream the best plan as it improves
+	SnapshotGeometry      bool    `json:"snapshotGeometry"` // add straight-line geometry to streamed routes
+	RoutingOptions
 }
 
 // HybridSolveRequest is the request payload used by the hybrid solver endpoint.
 type HybridSolveRequest struct {
-	Orders   []Order            `json:"orders"`
-	Shoppers []Shopper          `json:"shoppers"`
-	Options  HybridSolveOptions `json:"options"`
+	Orders    []Order            `json:"orders"`
+	Shoppers  []Shopper          `json:"shoppers"`
+	Options   HybridSolveOptions `json:"options"`
+	Geocoding GeocodeOptions     `json:"geocoding"`
 }
 
 // HybridProgress describes an intermediate solver snapshot.
 type HybridProgress struct {
-	Timestamp           time.Time `json:"timestamp"`
-	Iteration           int       `json:"iteration"`
-	WorkerID            int       `json:"workerId"`
-	BestDistance        float64   `json:"bestDistance"`
-	CandidateDistance   float64   `json:"candidateDistance"`
-	AcceptedImprovement bool      `json:"acceptedImprovement"`
-	ExploredSolutions   int       `json:"exploredSolutions"`
-	ImprovementCount    int       `json:"improvementCount"`
-	Temperature         float64   `json:"temperature"`
+	Timestamp           time.Time         `json:"timestamp"`
+	Iteration           int               `json:"iteration"`
+	WorkerID            int               `json:"workerId"`
+	BestDistance        float64           `json:"bestDistance"`
+	CandidateDistance   float64           `json:"candidateDistance"`
+	AcceptedImprovement bool              `json:"acceptedImprovement"`
+	ExploredSolutions   int               `json:"exploredSolutions"`
+	ImprovementCount    int               `json:"improvementCount"`
+	Temperature         float64           `json:"temperature"`
+	Phase               string            `json:"phase,omitempty"`    // "region" or "boundary" when decomposing
+	Region              int               `json:"region,omitempty"`   // 1-based sub-region during the region phase
+	Snapshot            *SolutionSnapshot `json:"snapshot,omitempty"` // best plan so far when snapshots are requested
+}
+
+// SolutionSnapshot is the best plan at one point of a solve. A delta carries
+// only the routes changed since the snapshot numbered BaseVersion; a full
+// snapshot carries every shopper's route and replaces what the client holds.
+type SolutionSnapshot struct {
+	Version       int             `json:"version"`
+	BaseVersion   int             `json:"baseVersion,omitempty"` // the snapshot a delta applies to
+	Full          bool            `json:"full"`
+	TotalDistance float64         `json:"totalDistance"`
+	Routes        []RouteSnapshot `json:"routes"`
+}
+
+// RouteSnapshot is one shopper's route in a SolutionSnapshot. An empty
+// route means the shopper lost all their orders.
+type RouteSnapshot struct {
+	ShopperID string      `json:"shopperId"`
+	Route     []string    `json:"route"`
+	Distance  float64     `json:"distance"`
+	Geometry  [][]float64 `json:"geometry,omitempty"` // [lat, lng] from the shopper through each order, straight lines
 }
 
 // HybridSolverStats captures summary statistics for a solve run.
@@ -44,6 +72,11 @@ type HybridSolverStats struct {
 	Workers              int           `json:"workers"`
 	ExploredSolutions    int           `json:"exploredSolutions"`
 	AcceptedImprovements int           `json:"acceptedImprovements"`
+	LocalSearchMoves     int           `json:"localSearchMoves"`
+	MovesPerSecond       float64       `json:"movesPerSecond"`          // destroy/repair moves evaluated per second of search
+	DistanceMatrix       string        `json:"distanceMatrix"`          // dense, compact or lazy
+	Regions              int           `json:"regions,omitempty"`       // sub-regions solved when decomposing
+	TimeDependent        bool          `json:"timeDependent,omitempty"` // route durations follow time-of-day traffic
 }
 
 // HybridSolveResponse is returned when the hybrid solver finishes.
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Job is a hybrid optimization run accepted for background processing, so
+// it survives the client disconnecting.
+type Job struct {
+	ID         string               `json:"id"`
+	Status     string               `json:"status"` // "queued", "running", "completed", "failed" or "cancelled"
+	CreatedAt  time.Time            `json:"createdAt"`
+	StartedAt  *time.Time           `json:"startedAt,omitempty"`
+	FinishedAt *time.Time           `json:"finishedAt,omitempty"`
+	ExpiresAt  *time.Time           `json:"expiresAt,omitempty"` // when a finished job and its result are dropped
+	Progress   *HybridProgress      `json:"progress,omitempty"`  // latest solver snapshot
+	Result     *HybridSolveResponse `json:"result,omitempty"`
+	Error      string               `json:"error,omitempty"`
+}
@@ -1,27 +1,47 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // Order represents a delivery order
 type Order struct {
-	ID             string  `json:"id"`
-	Lat            float64 `json:"lat"`
-	Lng            float64 `json:"lng"`
-	ItemCount      int     `json:"itemCount"`
-	DeliveryWindow string  `json:"deliveryWindow"`
+	ID             string        `json:"id"`
+	Lat            float64       `json:"lat"`
+	Lng            float64       `json:"lng"`
+	ItemCount      int           `json:"itemCount"`
+	DeliveryWindow string        `json:"deliveryWindow"`
+	Address        string        `json:"address,omitempty"` // geocoded on ingest when lat/lng are missing
+	Geocode        *GeocodeMatch `json:"geocode,omitempty"` // how the address was placed, if it was geocoded
 }
 
 // Shopper represents an available delivery shopper
 type Shopper struct {
-	ID       string  `json:"id"`
-	Lat      float64 `json:"lat"`
-	Lng      float64 `json:"lng"`
-	Capacity int     `json:"capacity"`
+	ID          string   `json:"id"`
+	Lat         float64  `json:"lat"`
+	Lng         float64  `json:"lng"`
+	Capacity    int      `json:"capacity"`
+	Permissions []string `json:"permissions,omitempty"` // restricted zones the shopper may deliver in, by AvoidArea.Permission
 }
 
 // Assignment represents a shopper's optimized route
 type Assignment struct {
-	ShopperID     string   `json:"shopperId"`
-	Route         []string `json:"route"`
-	TotalDistance float64  `json:"totalDistance"`
+	ShopperID     string         `json:"shopperId"`
+	Route         []string       `json:"route"`
+	TotalDistance float64        `json:"totalDistance"`
+	Stops         []StopSchedule `json:"stops,omitempty"` // planned timing of each order in Route, filled in by analytics
+}
+
+// StopSchedule is the planned timing of one delivery in a shopper's route
+type StopSchedule struct {
+	OrderID      string    `json:"orderId"`
+	Arrival      time.Time `json:"arrival"`
+	ServiceStart time.Time `json:"serviceStart"` // later than arrival when the delivery window has not opened yet
+	Departure    time.Time `json:"departure"`    // service start plus the delivery time
+	LegDistance  float64   `json:"legDistance"`  // km driven from the previous stop
+	LegDuration  float64   `json:"legDuration"`  // minutes driven from the previous stop, with traffic
+	Late         bool      `json:"late,omitempty"` // arrival after the delivery window closed
 }
 
 // SampleDataResponse contains mock data for testing
@@ -30,16 +50,42 @@ type SampleDataResponse struct {
 	Shoppers []Shopper `json:"shoppers"`
 }
 
+// RoutingOptions selects whether and how real road routes are fetched
+type RoutingOptions struct {
+	UseRealRoutes     bool        `json:"useRealRoutes"`
+	ApiKey            string      `json:"apiKey"`               // routing provider API key from frontend
+	Provider          string      `json:"routingProvider"`      // overrides ROUTING_PROVIDER, e.g. "osrm"
+	Metric            string      `json:"routeMetric"`          // "distance" (default) or "duration" to minimize drive time under time-of-day traffic
+	DepartureTime     string      `json:"departureTime"`        // RFC 3339 time routes start; empty means 15 minutes from now
+	GeometryFormat    string      `json:"geometryFormat"`       // route geometries as "points" (default), "polyline", "polyline6" or "geojson"
+	SimplifyTolerance float64     `json:"simplifyTolerance"`    // meters a simplified route geometry may stray from the road; 0 keeps every point
+	SimplifyZoom      int         `json:"simplifyZoom"`         // map zoom level to simplify for when no tolerance is given; 0 means none
+	SimplifyMethod    string      `json:"simplifyMethod"`       // "douglas-peucker" (default) or "visvalingam"
+	AvoidAreas        []AvoidArea `json:"avoidAreas,omitempty"` // regions routes stay out of unless a stop is inside
+}
+
+// AvoidArea is a region routes should not pass through, such as a gated
+// neighborhood or a closed bridge
+type AvoidArea struct {
+	ID         string          `json:"id"`
+	Geometry   json.RawMessage `json:"geometry"`             // GeoJSON Polygon or MultiPolygon
+	Permission string          `json:"permission,omitempty"` // when set, only shoppers holding it may deliver to orders inside
+}
+
 // OptimizeRequest contains data to be optimized
 type OptimizeRequest struct {
-	Orders   []Order   `json:"orders"`
-	Shoppers []Shopper `json:"shoppers"`
+	Orders    []Order        `json:"orders"`
+	Shoppers  []Shopper      `json:"shoppers"`
+	Geocoding GeocodeOptions `json:"geocoding"`
 }
 
 // OptimizeResponse contains optimization results
 type OptimizeResponse struct {
-	Assignments         []Assignment `json:"assignments"`
-	TotalDistanceBefore float64      `json:"totalDistanceBefore"`
-	TotalDistanceAfter  float64      `json:"totalDistanceAfter"`
+	Assignments         []Assignment   `json:"assignments"`
+	TotalDistanceBefore float64        `json:"totalDistanceBefore"`
+	TotalDistanceAfter  float64        `json:"totalDistanceAfter"`
+	CostSource          string         `json:"costSource,omitempty"`    // haversine, calibrated-haversine, estimated-duration, road-distance or road-duration
+	CostFallback        string         `json:"costFallback,omitempty"`  // why road costs were requested but not used
+	GeocodeReport       *GeocodeReport `json:"geocodeReport,omitempty"` // orders given by address, including any left out
 }
 
@@ -0,0 +1,117 @@
+package models
+
+import "time"
+
+// Plan is a published set of shopper routes that can be adjusted in place
+// as orders arrive or drop out during the day.
+type Plan struct {
+	ID          string       `json:"id"`
+	Orders      []Order      `json:"orders"`
+	Shoppers    []Shopper    `json:"shoppers"`
+	Assignments []Assignment `json:"assignments"`
+	AvoidAreas  []AvoidArea  `json:"avoidAreas,omitempty"` // restricted zones insertions and repairs must respect
+}
+
+// InsertOrdersRequest asks for the cheapest feasible placement of new orders
+// into an existing plan.
+type InsertOrdersRequest struct {
+	Plan         *Plan          `json:"plan,omitempty"` // omit to use the stored plan with the path ID
+	Orders       []Order        `json:"orders"`
+	Alternatives int            `json:"alternatives"` // other options per order; defaults to 3
+	Apply        bool           `json:"apply"`        // store the updated plan
+	Geocoding    GeocodeOptions `json:"geocoding"`
+}
+
+// InsertionOption is one candidate position for a new order.
+type InsertionOption struct {
+	ShopperID string  `json:"shopperId"`
+	Position  int     `json:"position"`  // index in the shopper's route
+	CostDelta float64 `json:"costDelta"` // added km
+}
+
+// OrderInsertion reports where a new order was placed and what else was possible.
+type OrderInsertion struct {
+	OrderID      string            `json:"orderId"`
+	Feasible     bool              `json:"feasible"`
+	Best         *InsertionOption  `json:"best,omitempty"`
+	Alternatives []InsertionOption `json:"alternatives"`
+}
+
+// InsertOrdersResponse contains the updated plan and per-order insertion details.
+type InsertOrdersResponse struct {
+	Plan           Plan             `json:"plan"`
+	Insertions     []OrderInsertion `json:"insertions"`
+	TotalCostDelta float64          `json:"totalCostDelta"` // km
+	ElapsedMillis  float64          `json:"elapsedMillis"`
+	GeocodeReport  *GeocodeReport   `json:"geocodeReport,omitempty"` // new orders given by address, including any left out
+}
+
+// RepairPlanRequest removes cancelled orders and unavailable shoppers from a
+// plan and re-homes the orders those shoppers were carrying.
+type RepairPlanRequest struct {
+	Plan                  *Plan    `json:"plan,omitempty"` // omit to use the stored plan with the path ID
+	RemovedOrderIDs       []string `json:"removedOrderIds"`
+	UnavailableShopperIDs []string `json:"unavailableShopperIds"`
+	Apply                 bool     `json:"apply"` // store the repaired plan
+}
+
+// StopChange describes how one stop differs between the original and repaired plan.
+type StopChange struct {
+	OrderID       string `json:"orderId"`
+	Change        string `json:"change"` // "cancelled", "reassigned" or "unassigned"
+	FromShopperID string `json:"fromShopperId,omitempty"`
+	FromPosition  int    `json:"fromPosition"`
+	ToShopperID   string `json:"toShopperId,omitempty"`
+	ToPosition    int    `json:"toPosition"` // -1 when the order is no longer routed
+}
+
+// RepairPlanResponse contains the repaired plan and the stops that moved.
+type RepairPlanResponse struct {
+	Plan          Plan         `json:"plan"`
+	Changes       []StopChange `json:"changes"`
+	Unassigned    []string     `json:"unassigned"` // orphaned orders no shopper could take
+	CostDelta     float64      `json:"costDelta"`  // km, negative when the plan got shorter
+	ElapsedMillis float64      `json:"elapsedMillis"`
+}
+
+// ItineraryRequest asks for turn-by-turn directions along one shopper's route
+// in a plan. Road routes are always fetched; UseRealRoutes is ignored.
+type ItineraryRequest struct {
+	Plan *Plan `json:"plan,omitempty"` // omit to use the stored plan with the path ID
+	RoutingOptions
+}
+
+// Itinerary is a shopper's navigation for their assigned route, one leg per stop.
+type Itinerary struct {
+	PlanID    string         `json:"planId"`
+	ShopperID string         `json:"shopperId"`
+	Departure time.Time      `json:"departure"`
+	Finish    time.Time      `json:"finish"`   // after the last delivery
+	Distance  float64        `json:"distance"` // km
+	Duration  float64        `json:"duration"` // driving minutes at free flow
+	Legs      []ItineraryLeg `json:"legs"`
+}
+
+// ItineraryLeg is the drive from one stop to the next order.
+type ItineraryLeg struct {
+	OrderID        string           `json:"orderId"`
+	Lat            float64          `json:"lat"`
+	Lng            float64          `json:"lng"`
+	Distance       float64          `json:"distance"` // km
+	Duration       float64          `json:"duration"` // minutes at free flow
+	Arrival        time.Time        `json:"arrival"`
+	ServiceStart   time.Time        `json:"serviceStart"` // later than arrival when the delivery window has not opened yet
+	Departure      time.Time        `json:"departure"`
+	Source         string           `json:"source"` // routing provider, or "fallback" for a straight line
+	FallbackReason string           `json:"fallbackReason,omitempty"`
+	Steps          []NavigationStep `json:"steps"`
+}
+
+// NavigationStep is one turn-by-turn instruction.
+type NavigationStep struct {
+	Instruction string  `json:"instruction"`
+	Street      string  `json:"street,omitempty"`
+	Distance    float64 `json:"distance"` // km
+	Duration    float64 `json:"duration"` // minutes
+	Maneuver    string  `json:"maneuver"` // e.g. "depart", "turn-left", "arrive"
+}
@@ -0,0 +1,36 @@
+package optimizer
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"shipt-route-optimizer/internal/models"
+)
+
+func TestShopperAnalyticsUseRoutedLegs(t *testing.T) {
+	second := models.Order{ID: "O2", Lat: 33.55, Lng: -86.77}
+	orders := []models.Order{testOrder, second}
+	// The detour around the avoid area makes the routed legs longer than
+	// the distance the assignment was planned with
+	planned := HaversineDistance(testShopper.Lat, testShopper.Lng, testOrder.Lat, testOrder.Lng) +
+		HaversineDistance(testOrder.Lat, testOrder.Lng, second.Lat, second.Lng)
+	assignments := []models.Assignment{{ShopperID: testShopper.ID, Route: []string{testOrder.ID, second.ID}, TotalDistance: planned}}
+
+	analytics := AnalyticsFromAssignments(context.Background(), orders, []models.Shopper{testShopper}, assignments, testAvoidOptions())
+
+	legs := 0.0
+	for _, stop := range assignments[0].Stops {
+		legs += stop.LegDistance
+	}
+	shopper := analytics.Shoppers[0]
+	if math.Abs(shopper.TotalDistance-legs) > 0.01 {
+		t.Errorf("total distance = %v km, stops' legs sum to %v km", shopper.TotalDistance, legs)
+	}
+	if shopper.TotalDistance <= assignments[0].TotalDistance {
+		t.Errorf("total distance = %v km, want the detour, longer than the planned %v km", shopper.TotalDistance, assignments[0].TotalDistance)
+	}
+	if want := math.Round(shopper.TotalDistance/2*100) / 100; math.Abs(shopper.AverageOrderDistance-want) > 0.01 {
+		t.Errorf("average order distance = %v km, want %v", shopper.AverageOrderDistance, want)
+	}
+}
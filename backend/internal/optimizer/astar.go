@@ -52,7 +52,7 @@ func (pq *PriorityQueue) Pop() interface{} {
 }
 
 // OptimizeRouteAStar uses A* algorithm to find optimal route through orders
-func OptimizeRouteAStar(shopper models.Shopper, orders []models.Order) []models.Order {
+func OptimizeRouteAStar(shopper models.Shopper, orders []models.Order, cost CostFunc) []models.Order {
 	if len(orders) <= 1 {
 		return orders
 	}
@@ -60,13 +60,13 @@ func OptimizeRouteAStar(shopper models.Shopper, orders []models.Order) []models.
 	// For small number of orders, use exhaustive A*
 	// For larger sets, use A* with beam search to limit memory
 	if len(orders) <= 8 {
-		return aStarExhaustive(shopper, orders)
+		return aStarExhaustive(shopper, orders, cost)
 	}
-	return aStarBeamSearch(shopper, orders, 100) // Beam width of 100
+	return aStarBeamSearch(shopper, orders, 100, cost) // Beam width of 100
 }
 
 // aStarExhaustive performs complete A* search for optimal route
-func aStarExhaustive(shopper models.Shopper, orders []models.Order) []models.Order {
+func aStarExhaustive(shopper models.Shopper, orders []models.Order, cost CostFunc) []models.Order {
 	// Initialize priority queue
 	pq := make(PriorityQueue, 0)
 	heap.Init(&pq)
@@ -78,7 +78,7 @@ func aStarExhaustive(shopper models.Shopper, orders []models.Order) []models.Ord
 		currentLat: shopper.Lat,
 		currentLng: shopper.Lng,
 		gCost:      0,
-		hCost:      calculateHeuristic(shopper.Lat, shopper.Lng, orders),
+		hCost:      calculateHeuristic(shopper.Lat, shopper.Lng, orders, cost),
 		fCost:      0,
 	}
 	initialNode.fCost = initialNode.gCost + initialNode.hCost
@@ -112,7 +112,7 @@ func aStarExhaustive(shopper models.Shopper, orders []models.Order) []models.Ord
 		// Expand node: try visiting each remaining order
 		for i, order := range current.orders {
 			// Calculate cost to this order
-			moveCost := HaversineDistance(
+			moveCost := cost(
 				current.currentLat, current.currentLng,
 				order.Lat, order.Lng,
 			)
@@ -129,7 +129,7 @@ func aStarExhaustive(shopper models.Shopper, orders []models.Order) []models.Ord
 
 			// Create child node
 			gCost := current.gCost + moveCost
-			hCost := calculateHeuristic(order.Lat, order.Lng, newOrders)
+			hCost := calculateHeuristic(order.Lat, order.Lng, newOrders, cost)
 			
 			childNode := &AStarNode{
 				orders:     newOrders,
@@ -152,10 +152,10 @@ func aStarExhaustive(shopper models.Shopper, orders []models.Order) []models.Ord
 }
 
 // aStarBeamSearch uses beam search variant of A* for larger problem sizes
-func aStarBeamSearch(shopper models.Shopper, orders []models.Order, beamWidth int) []models.Order {
+func aStarBeamSearch(shopper models.Shopper, orders []models.Order, beamWidth int, cost CostFunc) []models.Order {
 	// Initialize with greedy nearest neighbor as baseline
-	greedyRoute := optimizeShopperRoute(shopper, orders)
-	greedyCost := calculateRouteCost(shopper.Lat, shopper.Lng, greedyRoute)
+	greedyRoute := optimizeShopperRoute(shopper, orders, cost)
+	greedyCost := calculateRouteCost(shopper.Lat, shopper.Lng, greedyRoute, cost)
 
 	// Track best solution
 	bestRoute := greedyRoute
@@ -169,7 +169,7 @@ func aStarBeamSearch(shopper models.Shopper, orders []models.Order, beamWidth in
 			currentLat: shopper.Lat,
 			currentLng: shopper.Lng,
 			gCost:      0,
-			hCost:      calculateHeuristic(shopper.Lat, shopper.Lng, orders),
+			hCost:      calculateHeuristic(shopper.Lat, shopper.Lng, orders, cost),
 			fCost:      0,
 		},
 	}
@@ -192,7 +192,7 @@ func aStarBeamSearch(shopper models.Shopper, orders []models.Order, beamWidth in
 
 			// Generate successors
 			for i, order := range node.orders {
-				moveCost := HaversineDistance(
+				moveCost := cost(
 					node.currentLat, node.currentLng,
 					order.Lat, order.Lng,
 				)
@@ -206,7 +206,7 @@ func aStarBeamSearch(shopper models.Shopper, orders []models.Order, beamWidth in
 				newRoute = append(newRoute, order)
 
 				gCost := node.gCost + moveCost
-				hCost := calculateHeuristic(order.Lat, order.Lng, newOrders)
+				hCost := calculateHeuristic(order.Lat, order.Lng, newOrders, cost)
 
 				childNode := &AStarNode{
 					orders:     newOrders,
@@ -254,7 +254,7 @@ func aStarBeamSearch(shopper models.Shopper, orders []models.Order, beamWidth in
 }
 
 // calculateHeuristic estimates remaining cost using MST lower bound
-func calculateHeuristic(currentLat, currentLng float64, orders []models.Order) float64 {
+func calculateHeuristic(currentLat, currentLng float64, orders []models.Order, cost CostFunc) float64 {
 	if len(orders) == 0 {
 		return 0
 	}
@@ -263,20 +263,20 @@ func calculateHeuristic(currentLat, currentLng float64, orders []models.Order) f
 	// More sophisticated: use MST (Minimum Spanning Tree) of remaining orders
 	minDist := math.MaxFloat64
 	for _, order := range orders {
-		dist := HaversineDistance(currentLat, currentLng, order.Lat, order.Lng)
+		dist := cost(currentLat, currentLng, order.Lat, order.Lng)
 		if dist < minDist {
 			minDist = dist
 		}
 	}
 
 	// Add MST lower bound for remaining orders
-	mstCost := calculateMSTLowerBound(orders)
+	mstCost := calculateMSTLowerBound(orders, cost)
 	
 	return minDist + mstCost
 }
 
 // calculateMSTLowerBound calculates minimum spanning tree cost as lower bound
-func calculateMSTLowerBound(orders []models.Order) float64 {
+func calculateMSTLowerBound(orders []models.Order, cost CostFunc) float64 {
 	if len(orders) <= 1 {
 		return 0
 	}
@@ -299,7 +299,7 @@ func calculateMSTLowerBound(orders []models.Order) float64 {
 				if visited[j] {
 					continue
 				}
-				dist := HaversineDistance(
+				dist := cost(
 					orders[i].Lat, orders[i].Lng,
 					orders[j].Lat, orders[j].Lng,
 				)
@@ -322,7 +322,7 @@ func calculateMSTLowerBound(orders []models.Order) float64 {
 }
 
 // calculateRouteCost calculates total distance of a route
-func calculateRouteCost(startLat, startLng float64, route []models.Order) float64 {
+func calculateRouteCost(startLat, startLng float64, route []models.Order, cost CostFunc) float64 {
 	if len(route) == 0 {
 		return 0
 	}
@@ -331,7 +331,7 @@ func calculateRouteCost(startLat, startLng float64, route []models.Order) float6
 	currentLat, currentLng := startLat, startLng
 
 	for _, order := range route {
-		dist := HaversineDistance(currentLat, currentLng, order.Lat, order.Lng)
+		dist := cost(currentLat, currentLng, order.Lat, order.Lng)
 		totalCost += dist
 		currentLat, currentLng = order.Lat, order.Lng
 	}
@@ -341,6 +341,11 @@ func calculateRouteCost(startLat, startLng float64, route []models.Order) float6
 
 // OptimizeAStar performs full optimization using A* for route planning
 func OptimizeAStar(orders []models.Order, shoppers []models.Shopper) ([]models.Assignment, float64, float64) {
+	return OptimizeAStarWithCosts(orders, shoppers, EstimatedCosts())
+}
+
+// OptimizeAStarWithCosts runs A* optimization against the given travel costs
+func OptimizeAStarWithCosts(orders []models.Order, shoppers []models.Shopper, costs Costs) ([]models.Assignment, float64, float64) {
 	if len(shoppers) == 0 || len(orders) == 0 {
 		return []models.Assignment{}, 0, 0
 	}
@@ -352,7 +357,7 @@ func OptimizeAStar(orders []models.Order, shoppers []models.Shopper) ([]models.A
 	}
 
 	// Calculate baseline distance
-	totalDistanceBefore := calculateRandomDistance(orders, shoppers)
+	totalDistanceBefore := calculateRandomDistance(orders, shoppers, costs.Distance)
 
 	// Assign each order to nearest available shopper (greedy assignment)
 	remainingOrders := make([]models.Order, len(orders))
@@ -367,13 +372,13 @@ func OptimizeAStar(orders []models.Order, shoppers []models.Shopper) ([]models.A
 		minDistance := math.MaxFloat64
 
 		for _, shopper := range shoppers {
-			if len(assignments[shopper.ID]) >= shopper.Capacity {
+			if len(assignments[shopper.ID]) >= shopper.Capacity || !costs.Restrictions.Allows(shopper, order.ID) {
 				continue
 			}
 
-			distance := HaversineDistance(
-				order.Lat, order.Lng,
+			distance := costs.Cost(
 				shopper.Lat, shopper.Lng,
+				order.Lat, order.Lng,
 			)
 
 			if distance < minDistance {
@@ -383,7 +388,7 @@ func OptimizeAStar(orders []models.Order, shoppers []models.Shopper) ([]models.A
 		}
 
 		if bestShopperID == "" {
-			bestShopperID = shoppers[0].ID
+			bestShopperID = firstAllowed(shoppers, costs.Restrictions, order.ID).ID
 		}
 
 		assignments[bestShopperID] = append(assignments[bestShopperID], order)
@@ -400,7 +405,7 @@ func OptimizeAStar(orders []models.Order, shoppers []models.Shopper) ([]models.A
 		}
 
 		// Use A* to optimize route sequence
-		route := OptimizeRouteAStar(shopper, shopperOrders)
+		route := OptimizeRouteAStar(shopper, shopperOrders, costs.Cost)
 		routeIDs := []string{}
 		routeDistance := 0.0
 
@@ -408,7 +413,7 @@ func OptimizeAStar(orders []models.Order, shoppers []models.Shopper) ([]models.A
 		currentLat, currentLng := shopper.Lat, shopper.Lng
 		for _, order := range route {
 			routeIDs = append(routeIDs, order.ID)
-			distance := HaversineDistance(currentLat, currentLng, order.Lat, order.Lng)
+			distance := costs.Distance(currentLat, currentLng, order.Lat, order.Lng)
 			routeDistance += distance
 			currentLat, currentLng = order.Lat, order.Lng
 		}
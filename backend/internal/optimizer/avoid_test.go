@@ -0,0 +1,73 @@
+package optimizer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/routing"
+)
+
+// A square about 2 km across, between the shopper and the order below.
+const testAreaGeometry = `{"type":"Polygon","coordinates":[[[-86.81,33.49],[-86.79,33.49],[-86.79,33.51],[-86.81,33.51],[-86.81,33.49]]]}`
+
+var (
+	testShopper = models.Shopper{ID: "S1", Lat: 33.50, Lng: -86.83, Capacity: 5}
+	testOrder   = models.Order{ID: "O1", Lat: 33.50, Lng: -86.77}
+)
+
+func testAvoidOptions() models.RoutingOptions {
+	return models.RoutingOptions{AvoidAreas: []models.AvoidArea{{ID: "square", Geometry: json.RawMessage(testAreaGeometry)}}}
+}
+
+func TestCostsGoAroundAvoidAreas(t *testing.T) {
+	orders, shoppers := []models.Order{testOrder}, []models.Shopper{testShopper}
+	costs, err := CostsFor(context.Background(), orders, shoppers, testAvoidOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	area, _ := routing.ParseAvoidArea("square", []byte(testAreaGeometry))
+	from := routing.RoutePoint{Lat: testShopper.Lat, Lng: testShopper.Lng}
+	to := routing.RoutePoint{Lat: testOrder.Lat, Lng: testOrder.Lng}
+	detour := routing.NewDetours([]routing.AvoidArea{area}).Around(from, to)
+	if detour == nil {
+		t.Fatal("no detour for a leg through the area")
+	}
+	for name, cost := range map[string]CostFunc{"cost": costs.Cost, "distance": costs.Distance} {
+		if got := cost(from.Lat, from.Lng, to.Lat, to.Lng); got < detour.Distance {
+			t.Errorf("%s through the area = %v km, want at least the %v km detour", name, got, detour.Distance)
+		}
+	}
+	// A leg clear of the area costs what it did
+	if got, want := costs.Cost(33.55, -86.83, 33.55, -86.77), EstimatedCosts().Cost(33.55, -86.83, 33.55, -86.77); got != want {
+		t.Errorf("leg clear of the area = %v km, want %v", got, want)
+	}
+}
+
+func TestAnalyticsDrawRoutesAroundAvoidAreas(t *testing.T) {
+	area, _ := routing.ParseAvoidArea("square", []byte(testAreaGeometry))
+	for _, realRoutes := range []bool{false, true} {
+		opts := testAvoidOptions()
+		opts.UseRealRoutes = realRoutes
+		opts.Provider = "no-such-provider" // only fallback legs, even with real routes
+		assignments := []models.Assignment{{ShopperID: testShopper.ID, Route: []string{testOrder.ID}}}
+
+		analytics := AnalyticsFromAssignments(context.Background(), []models.Order{testOrder}, []models.Shopper{testShopper}, assignments, opts)
+
+		points := analytics.RouteGeometries[0].Points
+		if len(points) < 3 {
+			t.Fatalf("real routes %v: route has %d points, want a detour", realRoutes, len(points))
+		}
+		// Check along each step, since a straight step could cut the area
+		for i := 0; i+1 < len(points); i++ {
+			for f := 0.0; f <= 1; f += 0.05 {
+				point := routing.RoutePoint{Lat: points[i][0] + f*(points[i+1][0]-points[i][0]), Lng: points[i][1] + f*(points[i+1][1]-points[i][1])}
+				if area.Contains(point) {
+					t.Fatalf("real routes %v: step %d enters the area at %+v", realRoutes, i, point)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package optimizer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/routing"
+	"sort"
+	"time"
+)
+
+// CostFunc returns the travel cost between two points
+type CostFunc func(fromLat, fromLng, toLat, toLng float64) float64
+
+// Cost sources reported alongside optimization results
+const (
+	CostHaversine         = "haversine"
+	CostCalibrated        = "calibrated-haversine"
+	CostEstimatedDuration = "estimated-duration"
+	CostRoadDistance      = "road-distance"
+	CostRoadDuration      = "road-duration"
+)
+
+// maxRoadMatrixOrders bounds the memory a road matrix takes; it has
+// (shoppers + orders) × orders cells. The provider's tile size and the
+// request budget usually allow far fewer orders; see roadMatrixBudget.
+const maxRoadMatrixOrders = 2000
+
+// unreachablePenalty multiplies the estimate charged for pairs the provider
+// cannot route between, so solvers avoid them without costs turning infinite.
+const unreachablePenalty = 10
+
+// Costs supplies travel costs to the solvers. Cost is what they minimize and
+// Distance is what they report in kilometers; the two only differ when
+// optimizing duration, from road matrices or estimates. Traffic is set
+// alongside durations: Cost is then the free-flow time, and solvers that
+// schedule routes from Departure stretch each leg by the traffic when it is
+// driven. Distances do not change with the time of day, so they never carry
+// Traffic. Solvers only give restricted orders to shoppers the Restrictions
+// allow.
+type Costs struct {
+	Cost         CostFunc
+	Distance     CostFunc
+	Source       string
+	Traffic      *routing.TrafficModel
+	Departure    time.Time
+	Restrictions Restrictions
+}
+
+// HaversineCosts measures straight-line distance
+var HaversineCosts = Costs{Cost: HaversineDistance, Distance: HaversineDistance, Source: CostHaversine}
+
+// EstimatedCosts scales straight-line distance by the detour factors learned
+// from earlier road routes. Until enough have been seen it is HaversineCosts.
+func EstimatedCosts() Costs {
+	estimator := routing.Estimates()
+	if !estimator.Calibrated() {
+		return HaversineCosts
+	}
+	return Costs{Cost: estimator.Distance, Distance: estimator.Distance, Source: CostCalibrated}
+}
+
+// EstimatedDurationCosts minimizes the free-flow driving time estimated from
+// straight-line distance and the learned detour factors and speeds.
+func EstimatedDurationCosts() Costs {
+	estimator := routing.Estimates()
+	return Costs{Cost: estimator.Duration, Distance: estimator.Distance, Source: CostEstimatedDuration}
+}
+
+// MinimizesDuration reports whether Cost is in minutes rather than kilometers.
+func (c Costs) MinimizesDuration() bool {
+	return c.Source == CostRoadDuration || c.Source == CostEstimatedDuration
+}
+
+// CostsFor returns road-network costs when the request asks for real routes.
+// It always returns usable costs: on any failure it falls back to
+// (calibrated) haversine and reports why.
+func CostsFor(ctx context.Context, orders []models.Order, shoppers []models.Shopper, routingOpts models.RoutingOptions) (Costs, error) {
+	costs, err := travelCostsFor(ctx, orders, shoppers, routingOpts)
+	costs.Restrictions = RestrictionsFor(orders, routingOpts.AvoidAreas)
+	return costs, err
+}
+
+func travelCostsFor(ctx context.Context, orders []models.Order, shoppers []models.Shopper, routingOpts models.RoutingOptions) (Costs, error) {
+	areas := avoidAreas(routingOpts.AvoidAreas)
+	estimated := func() Costs {
+		if routingOpts.Metric == "duration" {
+			return avoidingCosts(timed(EstimatedDurationCosts(), routingOpts), areas)
+		}
+		return avoidingCosts(EstimatedCosts(), areas)
+	}
+	if !routingOpts.UseRealRoutes || len(orders) == 0 {
+		return estimated(), nil
+	}
+	if len(orders) > maxRoadMatrixOrders {
+		return estimated(), fmt.Errorf("%d orders exceed the %d a road matrix is held in memory for", len(orders), maxRoadMatrixOrders)
+	}
+
+	provider, err := routing.ProviderFor(routingOpts.Provider, routingOpts.ApiKey)
+	if err != nil {
+		return estimated(), err
+	}
+
+	// The avoiding provider charges cells through an area the detour around it
+	provider = routing.Avoiding(provider, areas)
+	road := newRoadCosts(orders, shoppers)
+	if err := roadMatrixBudget(provider, road, len(shoppers)); err != nil {
+		return estimated(), err
+	}
+	matrix, err := routing.BatchMatrix(ctx, provider, road.sourcePoints, road.destinationPoints)
+	if err != nil {
+		return estimated(), err
+	}
+	road.matrix = matrix
+
+	costs := Costs{Cost: road.distance, Distance: road.distance, Source: CostRoadDistance}
+	if routingOpts.Metric == "duration" {
+		costs.Cost = road.duration
+		costs.Source = CostRoadDuration
+		costs = timed(costs, routingOpts)
+	}
+	return costs, nil
+}
+
+// roadMatrixBudget checks the road matrix fits in ROUTING_MATRIX_MAX_REQUESTS
+// provider requests, naming how many orders would fit when it does not.
+func roadMatrixBudget(provider routing.Provider, road *roadCosts, shoppers int) error {
+	budget := routing.MatrixMaxRequestsFromEnv()
+	requests := routing.MatrixRequests(provider, len(road.sourcePoints), len(road.destinationPoints))
+	if requests <= budget {
+		return nil
+	}
+	fit := sort.Search(maxRoadMatrixOrders, func(orders int) bool {
+		return routing.MatrixRequests(provider, shoppers+orders+1, orders+1) > budget
+	})
+	return fmt.Errorf("a road matrix for %d orders needs %d %s requests, over the ROUTING_MATRIX_MAX_REQUESTS budget of %d; at most %d orders fit",
+		len(road.destinationPoints), requests, provider.Name(), budget, fit)
+}
+
+// timed applies the traffic model to duration costs from the departure time.
+func timed(costs Costs, routingOpts models.RoutingOptions) Costs {
+	costs.Traffic = routing.Traffic()
+	costs.Departure = departureOrDefault(routingOpts)
+	return costs
+}
+
+// avoidingCosts charges every leg whose straight line crosses an avoid
+// area at least the detour around it, so the solvers plan routes that keep
+// out of the areas rather than only drawing them that way.
+func avoidingCosts(costs Costs, areas []routing.AvoidArea) Costs {
+	if len(areas) == 0 {
+		return costs
+	}
+	detours := routing.NewDetours(areas)
+	around := func(cost CostFunc, minutes bool) CostFunc {
+		return func(fromLat, fromLng, toLat, toLng float64) float64 {
+			value := cost(fromLat, fromLng, toLat, toLng)
+			detour := detours.Around(routing.RoutePoint{Lat: fromLat, Lng: fromLng}, routing.RoutePoint{Lat: toLat, Lng: toLng})
+			switch {
+			case detour == nil:
+			case minutes:
+				value = math.Max(value, detour.Duration)
+			default:
+				value = math.Max(value, detour.Distance)
+			}
+			return value
+		}
+	}
+	costs.Cost = around(costs.Cost, costs.MinimizesDuration())
+	costs.Distance = around(costs.Distance, false)
+	return costs
+}
+
+type coordinate [2]float64
+
+// roadCosts looks up matrix cells by coordinate so the solvers, which work
+// on lat/lng pairs, need no knowledge of matrix indices.
+type roadCosts struct {
+	sources           map[coordinate]int
+	destinations      map[coordinate]int
+	sourcePoints      []routing.RoutePoint
+	destinationPoints []routing.RoutePoint
+	matrix            *routing.Matrix
+	estimator         *routing.Estimator // for points outside the matrix
+}
+
+// newRoadCosts collects the distinct points a route can leave from (shoppers
+// and orders) and arrive at (orders only, since routes do not return).
+func newRoadCosts(orders []models.Order, shoppers []models.Shopper) *roadCosts {
+	rc := &roadCosts{
+		sources:      make(map[coordinate]int),
+		destinations: make(map[coordinate]int),
+		estimator:    routing.Estimates(),
+	}
+	addPoint := func(index map[coordinate]int, points *[]routing.RoutePoint, lat, lng float64) {
+		key := coordinate{lat, lng}
+		if _, ok := index[key]; ok {
+			return
+		}
+		index[key] = len(*points)
+		*points = append(*points, routing.RoutePoint{Lat: lat, Lng: lng})
+	}
+	for _, shopper := range shoppers {
+		addPoint(rc.sources, &rc.sourcePoints, shopper.Lat, shopper.Lng)
+	}
+	for _, order := range orders {
+		addPoint(rc.sources, &rc.sourcePoints, order.Lat, order.Lng)
+		addPoint(rc.destinations, &rc.destinationPoints, order.Lat, order.Lng)
+	}
+	return rc
+}
+
+func (rc *roadCosts) distance(fromLat, fromLng, toLat, toLng float64) float64 {
+	return rc.lookup(rc.matrix.Distances, fromLat, fromLng, toLat, toLng, rc.estimator.Distance)
+}
+
+func (rc *roadCosts) duration(fromLat, fromLng, toLat, toLng float64) float64 {
+	// Same estimate used for fallback routes
+	return rc.lookup(rc.matrix.Durations, fromLat, fromLng, toLat, toLng, rc.estimator.Duration)
+}
+
+// lookup returns the matrix cell for a pair of points, or the fallback for
+// points that were not part of the matrix. Pairs the provider could not
+// route between cost the fallback times unreachablePenalty.
+func (rc *roadCosts) lookup(values [][]float64, fromLat, fromLng, toLat, toLng float64, fallback CostFunc) float64 {
+	i, okFrom := rc.sources[coordinate{fromLat, fromLng}]
+	j, okTo := rc.destinations[coordinate{toLat, toLng}]
+	if !okFrom || !okTo {
+		return fallback(fromLat, fromLng, toLat, toLng)
+	}
+	if math.IsInf(values[i][j], 1) {
+		return unreachablePenalty * fallback(fromLat, fromLng, toLat, toLng)
+	}
+	return values[i][j]
+}
@@ -0,0 +1,95 @@
+package optimizer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/routing"
+)
+
+func TestCostsForMetric(t *testing.T) {
+	orders, shoppers := []models.Order{testOrder}, []models.Shopper{testShopper}
+	from, to := routing.RoutePoint{Lat: testShopper.Lat, Lng: testShopper.Lng}, routing.RoutePoint{Lat: testOrder.Lat, Lng: testOrder.Lng}
+	estimator := routing.Estimates()
+
+	tests := []struct {
+		name        string
+		metric      string
+		wantSource  string
+		wantCost    float64
+		wantTraffic bool
+	}{
+		{"distance", "", EstimatedCosts().Source, estimator.Distance(from.Lat, from.Lng, to.Lat, to.Lng), false},
+		{"duration", "duration", CostEstimatedDuration, estimator.Duration(from.Lat, from.Lng, to.Lat, to.Lng), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			costs, err := CostsFor(context.Background(), orders, shoppers, models.RoutingOptions{Metric: tt.metric})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if costs.Source != tt.wantSource {
+				t.Errorf("source = %q, want %q", costs.Source, tt.wantSource)
+			}
+			if got := costs.Cost(from.Lat, from.Lng, to.Lat, to.Lng); !closeTo(got, tt.wantCost) {
+				t.Errorf("cost = %v, want %v", got, tt.wantCost)
+			}
+			if got, want := costs.Distance(from.Lat, from.Lng, to.Lat, to.Lng), estimator.Distance(from.Lat, from.Lng, to.Lat, to.Lng); !closeTo(got, want) {
+				t.Errorf("distance = %v km, want %v", got, want)
+			}
+			if (costs.Traffic != nil) != (tt.wantTraffic && routing.Traffic() != nil) {
+				t.Errorf("traffic = %v, want it only on durations", costs.Traffic)
+			}
+			if costs.MinimizesDuration() != (tt.metric == "duration") {
+				t.Errorf("minimizes duration = %v", costs.MinimizesDuration())
+			}
+		})
+	}
+}
+
+func closeTo(a, b float64) bool {
+	diff := a - b
+	return diff < 1e-9 && diff > -1e-9
+}
+
+func TestRoadCostsPenalizeUnreachablePairs(t *testing.T) {
+	orders, shoppers := []models.Order{testOrder}, []models.Shopper{testShopper}
+	road := newRoadCosts(orders, shoppers)
+	road.matrix = &routing.Matrix{
+		Distances: [][]float64{{math.Inf(1)}, {0}},
+		Durations: [][]float64{{math.Inf(1)}, {0}},
+	}
+	from, to := testShopper, testOrder
+	if got, want := road.distance(from.Lat, from.Lng, to.Lat, to.Lng), unreachablePenalty*road.estimator.Distance(from.Lat, from.Lng, to.Lat, to.Lng); !closeTo(got, want) {
+		t.Errorf("unreachable distance = %v km, want %v", got, want)
+	}
+	if got := road.duration(from.Lat, from.Lng, to.Lat, to.Lng); math.IsInf(got, 0) || got <= 0 {
+		t.Errorf("unreachable duration = %v min, want a finite penalty", got)
+	}
+	if got := road.distance(to.Lat, to.Lng, to.Lat, to.Lng); got != 0 {
+		t.Errorf("routable distance = %v km, want the matrix cell", got)
+	}
+}
+
+func TestCostsForMatrixBudget(t *testing.T) {
+	t.Setenv("ROUTING_MATRIX_MAX_REQUESTS", "4")
+	orders := make([]models.Order, 60)
+	for i := range orders {
+		orders[i] = testOrder
+		orders[i].ID = fmt.Sprintf("O%d", i)
+		orders[i].Lat += float64(i) * 0.001
+	}
+	opts := models.RoutingOptions{UseRealRoutes: true, Provider: "ors", ApiKey: "test-key"}
+
+	costs, err := CostsFor(context.Background(), orders, []models.Shopper{testShopper}, opts)
+	if err == nil || !strings.Contains(err.Error(), "at most 49 orders fit") {
+		t.Fatalf("err = %v, want the order cap the budget allows", err)
+	}
+	if costs.Source != EstimatedCosts().Source {
+		t.Errorf("source = %q, want the estimate", costs.Source)
+	}
+}
@@ -0,0 +1,141 @@
+package optimizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/routing"
+	"sort"
+)
+
+// Problems reported for orders in a models.GeocodeReport
+const (
+	GeocodeNotFound      = "not-found"
+	GeocodeError         = "geocoder-error"
+	GeocodeOutsideMarket = "outside-market"
+	GeocodeLowConfidence = "low-confidence"
+)
+
+const (
+	defaultMarketRadius  = 50.0 // km
+	defaultMinConfidence = 0.6
+)
+
+// NeedsGeocoding reports whether the order is given by address alone.
+func NeedsGeocoding(order models.Order) bool {
+	return order.Address != "" && order.Lat == 0 && order.Lng == 0
+}
+
+// GeocodeOrders fills in coordinates for orders given by address and reports
+// the ones that could not be placed or landed outside the market. Those keep
+// zero coordinates in the returned copy; every other order is unchanged.
+// Only a geocoder that cannot be built is an error.
+func GeocodeOrders(ctx context.Context, orders []models.Order, shoppers []models.Shopper, opts models.GeocodeOptions) ([]models.Order, models.GeocodeReport, error) {
+	result := append([]models.Order(nil), orders...)
+	report := models.GeocodeReport{Issues: []models.GeocodeIssue{}}
+
+	pending := []int{}
+	addresses := []string{}
+	for i, order := range result {
+		if NeedsGeocoding(order) {
+			pending = append(pending, i)
+			addresses = append(addresses, order.Address)
+		}
+	}
+	report.Total = len(pending)
+	if len(pending) == 0 {
+		return result, report, nil
+	}
+
+	geocoder, err := routing.GeocoderFor(opts.Provider, opts.APIKey)
+	if err != nil {
+		return nil, report, err
+	}
+	report.Geocoder = geocoder.Name()
+	places, errs := routing.GeocodeAll(ctx, geocoder, addresses)
+
+	report.Market = marketFor(opts.Market, shoppers, places)
+	minConfidence := opts.MinConfidence
+	if minConfidence <= 0 {
+		minConfidence = defaultMinConfidence
+	}
+
+	for k, i := range pending {
+		order := result[i]
+		issue := models.GeocodeIssue{OrderID: order.ID, Address: order.Address}
+		place := places[k]
+		switch {
+		case errors.Is(errs[k], routing.ErrNoMatch):
+			issue.Problem = GeocodeNotFound
+		case errs[k] != nil:
+			issue.Problem = GeocodeError
+			issue.Detail = errs[k].Error()
+		}
+		if issue.Problem != "" {
+			report.Rejected++
+			report.Issues = append(report.Issues, issue)
+			continue
+		}
+
+		issue.Lat, issue.Lng, issue.Confidence = place.Lat, place.Lng, place.Confidence
+		issue.DistanceKm = math.Round(HaversineDistance(report.Market.Lat, report.Market.Lng, place.Lat, place.Lng)*100) / 100
+		if issue.DistanceKm > report.Market.RadiusKm {
+			issue.Problem = GeocodeOutsideMarket
+			issue.Detail = fmt.Sprintf("resolved to %s, %.1f km from the market center", place.Label, issue.DistanceKm)
+			report.Rejected++
+			report.Issues = append(report.Issues, issue)
+			continue
+		}
+
+		result[i].Lat, result[i].Lng = place.Lat, place.Lng
+		result[i].Geocode = &models.GeocodeMatch{Label: place.Label, Confidence: place.Confidence, Source: place.Source}
+		report.Geocoded++
+		if place.Confidence < minConfidence {
+			issue.Problem = GeocodeLowConfidence
+			issue.Detail = "matched " + place.Label
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+	return result, report, nil
+}
+
+// marketFor resolves the market to check geocodes against: the one given,
+// else centered on the shoppers, else on the geocoded orders themselves.
+// Medians keep a few stray points from dragging the center away.
+func marketFor(given *models.Market, shoppers []models.Shopper, places []*routing.GeocodeResult) models.Market {
+	market := models.Market{}
+	if given != nil {
+		market = *given
+	} else {
+		lats, lngs := []float64{}, []float64{}
+		for _, shopper := range shoppers {
+			lats, lngs = append(lats, shopper.Lat), append(lngs, shopper.Lng)
+		}
+		if len(lats) == 0 {
+			for _, place := range places {
+				if place != nil {
+					lats, lngs = append(lats, place.Lat), append(lngs, place.Lng)
+				}
+			}
+		}
+		if len(lats) > 0 {
+			market.Lat, market.Lng = median(lats), median(lngs)
+		}
+	}
+	if market.RadiusKm <= 0 {
+		market.RadiusKm = defaultMarketRadius
+	}
+	return market
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,133 @@
+package optimizer
+
+import (
+	"fmt"
+	"math"
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/routing"
+)
+
+// Route geometry formats a request can ask for.
+const (
+	GeometryPoints    = "points"
+	GeometryPolyline  = "polyline"
+	GeometryPolyline6 = "polyline6"
+	GeometryGeoJSON   = "geojson"
+)
+
+// ValidateRoutingOptions reports the first routing option a request got wrong.
+func ValidateRoutingOptions(routingOpts models.RoutingOptions) error {
+	if _, err := DepartureTime(routingOpts); err != nil {
+		return err
+	}
+	switch routingOpts.GeometryFormat {
+	case "", GeometryPoints, GeometryPolyline, GeometryPolyline6, GeometryGeoJSON:
+	default:
+		return fmt.Errorf("invalid geometryFormat %q: want points, polyline, polyline6 or geojson", routingOpts.GeometryFormat)
+	}
+	if routingOpts.SimplifyTolerance < 0 {
+		return fmt.Errorf("invalid simplifyTolerance %g: want meters, 0 or more", routingOpts.SimplifyTolerance)
+	}
+	if routingOpts.SimplifyZoom < 0 || routingOpts.SimplifyZoom > maxZoom {
+		return fmt.Errorf("invalid simplifyZoom %d: want 0 to %d", routingOpts.SimplifyZoom, maxZoom)
+	}
+	switch routingOpts.SimplifyMethod {
+	case "", routing.SimplifyDouglasPeucker, routing.SimplifyVisvalingam:
+	default:
+		return fmt.Errorf("invalid simplifyMethod %q: want douglas-peucker or visvalingam", routingOpts.SimplifyMethod)
+	}
+	return ValidateAvoidAreas(routingOpts.AvoidAreas)
+}
+
+// ValidateAvoidAreas reports the first avoid area whose geometry is not a
+// usable GeoJSON polygon.
+func ValidateAvoidAreas(areas []models.AvoidArea) error {
+	for i, area := range areas {
+		id := area.ID
+		if id == "" {
+			id = fmt.Sprintf("#%d", i+1)
+		}
+		if _, err := routing.ParseAvoidArea(id, area.Geometry); err != nil {
+			return fmt.Errorf("invalid avoidAreas: %w", err)
+		}
+	}
+	return nil
+}
+
+// maxZoom is the deepest map zoom level simplifyZoom accepts.
+const maxZoom = 22
+
+// simplifyRoute returns the segment's geometry simplified to the requested
+// tolerance. Each leg is simplified on its own, so the points where legs
+// meet, at the stops, are kept exactly.
+func simplifyRoute(segment *routing.RouteSegment, routingOpts models.RoutingOptions) []routing.RoutePoint {
+	path := segment.Geometry
+	if len(path) < 3 {
+		return path
+	}
+	tolerance := routingOpts.SimplifyTolerance
+	if tolerance == 0 && routingOpts.SimplifyZoom > 0 {
+		tolerance = routing.ZoomTolerance(routingOpts.SimplifyZoom, path[0].Lat)
+	}
+	if tolerance <= 0 {
+		return path
+	}
+
+	splits := legSplits(segment)
+	simplified := []routing.RoutePoint{path[0]}
+	for l := 1; l < len(splits); l++ {
+		leg := routing.SimplifyPath(path[splits[l-1]:splits[l]+1], tolerance, routingOpts.SimplifyMethod)
+		simplified = append(simplified, leg[1:]...)
+	}
+	return simplified
+}
+
+// legSplits returns the geometry indices where legs meet, including both
+// ends of the route. Legs that do not cover the geometry end to end are
+// ignored and the route is treated as a single leg.
+func legSplits(segment *routing.RouteSegment) []int {
+	last := len(segment.Geometry) - 1
+	whole := []int{0, last}
+	if len(segment.Legs) == 0 || segment.Legs[0].GeometryStart != 0 || segment.Legs[len(segment.Legs)-1].GeometryEnd != last {
+		return whole
+	}
+	splits := []int{0}
+	for l, leg := range segment.Legs {
+		if leg.GeometryStart != splits[l] || leg.GeometryEnd < leg.GeometryStart {
+			return whole
+		}
+		splits = append(splits, leg.GeometryEnd)
+	}
+	return splits
+}
+
+// formatGeometry stores points, given as [lat, lng] pairs, in the geometry
+// using the requested format. Unknown formats keep the raw points.
+func formatGeometry(geometry *models.RouteGeometry, points [][]float64, format string) {
+	switch format {
+	case GeometryPolyline, GeometryPolyline6:
+		precision := 5
+		if format == GeometryPolyline6 {
+			precision = 6
+		}
+		path := make([]routing.RoutePoint, len(points))
+		for i, pt := range points {
+			path[i] = routing.RoutePoint{Lat: pt[0], Lng: pt[1]}
+		}
+		geometry.Polyline = routing.EncodePolyline(path, precision)
+		geometry.Precision = precision
+	case GeometryGeoJSON:
+		// GeoJSON orders coordinates [lng, lat]; 6 decimals is ~10 cm
+		coordinates := make([][]float64, len(points))
+		for i, pt := range points {
+			coordinates[i] = []float64{roundCoordinate(pt[1]), roundCoordinate(pt[0])}
+		}
+		geometry.GeoJSON = &models.LineString{Type: "LineString", Coordinates: coordinates}
+	default:
+		geometry.Points = points
+	}
+}
+
+func roundCoordinate(value float64) float64 {
+	return math.Round(value*1e6) / 1e6
+}
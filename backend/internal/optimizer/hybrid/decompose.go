@@ -0,0 +1,552 @@
+package hybrid
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/optimizer"
+)
+
+const (
+	// autoDecomposeThreshold is the order count above which "auto"
+	// decomposition splits the instance into regions.
+	autoDecomposeThreshold = 3000
+	// ordersPerRegion is the target sub-problem size when no region count is given.
+	ordersPerRegion  = 1000
+	kMeansIterations = 12
+)
+
+func (o normalizedOptions) shouldDecompose(orderCount int) bool {
+	switch o.decomposition {
+	case "cluster", "grid":
+		return o.regionCount(orderCount) > 1
+	case "auto":
+		return orderCount > autoDecomposeThreshold && o.regionCount(orderCount) > 1
+	default:
+		return false
+	}
+}
+
+func (o normalizedOptions) regionCount(orderCount int) int {
+	if o.regions > 0 {
+		return min(o.regions, orderCount)
+	}
+	return int(math.Ceil(float64(orderCount) / ordersPerRegion))
+}
+
+// regionPlan maps each sub-region to the global indices of its orders and shoppers.
+type regionPlan struct {
+	orders   [][]int
+	shoppers [][]int
+	labels   []int // order index -> region
+}
+
+// runDecomposed partitions the instance geographically, solves every region
+// with the hybrid search in parallel, stitches the regional routes together
+// and finally re-optimises orders that sit on region boundaries.
+func runDecomposed(
+	ctx context.Context,
+	orders []models.Order,
+	shoppers []models.Shopper,
+	opts normalizedOptions,
+	costs optimizer.Costs,
+	timeline *timelineRecorder,
+	snapshots *snapshotter,
+) (searchResult, int, error) {
+	start := time.Now()
+	rng := rand.New(rand.NewSource(opts.randomSeed))
+
+	var plan regionPlan
+	if opts.decomposition == "grid" {
+		plan = partitionGrid(orders, opts.regionCount(len(orders)))
+	} else {
+		plan = partitionClusters(orders, opts.regionCount(len(orders)), rng)
+	}
+	plan.assignShoppers(orders, shoppers)
+
+	regionCount := len(plan.orders)
+	parallel := min(regionCount, opts.workers)
+	regionOpts := opts
+	regionOpts.workers = max(1, opts.workers/parallel)
+
+	var (
+		mu         sync.Mutex
+		regionBest = make([]float64, regionCount)
+		results    = make([]searchResult, regionCount)
+		firstErr   error
+		wg         sync.WaitGroup
+	)
+	sem := make(chan struct{}, parallel)
+
+	for r := 0; r < regionCount; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			subOrders := make([]models.Order, len(plan.orders[r]))
+			for i, idx := range plan.orders[r] {
+				subOrders[i] = orders[idx]
+			}
+			subShoppers := make([]models.Shopper, len(plan.shoppers[r]))
+			for i, idx := range plan.shoppers[r] {
+				subShoppers[i] = shoppers[idx]
+			}
+
+			subOpts := regionOpts
+			subOpts.randomSeed = opts.randomSeed + int64(r+1)*104729
+			cache := newDistanceCache(subOrders, subShoppers, opts.neighbors, costs)
+
+			result, err := search(ctx, cache, subOpts, snapshots, func(snapshot models.HybridProgress) {
+				mu.Lock()
+				regionBest[r] = snapshot.BestDistance
+				total := 0.0
+				for _, dist := range regionBest {
+					total += dist
+				}
+				mu.Unlock()
+				snapshot.Phase = "region"
+				snapshot.Region = r + 1
+				snapshot.BestDistance = math.Round(total*100) / 100
+				timeline.record(snapshot)
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			results[r] = result
+		}(r)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return searchResult{}, 0, firstErr
+	}
+
+	cache := newDistanceCache(orders, shoppers, opts.neighbors, costs)
+	merged := newSolution(len(shoppers), len(orders))
+	combined := searchResult{cache: cache}
+	for r, result := range results {
+		for subShopper, route := range result.best.routes {
+			shopperIdx := plan.shoppers[r][subShopper]
+			for _, subOrder := range route {
+				orderIdx := plan.orders[r][subOrder]
+				merged.routes[shopperIdx] = append(merged.routes[shopperIdx], orderIdx)
+				merged.owners.set(orderIdx, shopperIdx)
+			}
+		}
+		combined.explored += result.explored
+		combined.improvements += result.improvements
+		combined.moves += result.moves
+		combined.bestIteration = max(combined.bestIteration, result.bestIteration)
+	}
+	merged.recomputeTotals(cache)
+
+	boundary := boundaryOrders(cache, plan.labels)
+	improved, improvements, moves := improveBoundary(ctx, merged, cache, boundary, opts, rng)
+	if ctx.Err() != nil {
+		return searchResult{}, 0, ctx.Err()
+	}
+	combined.improvements += improvements
+	combined.moves += moves
+	combined.best = improved
+	combined.searchTime = time.Since(start)
+	snapshots.update(cache, improved)
+
+	snapshots.deliver(time.Now(), true, func(snapshot *models.SolutionSnapshot) {
+		timeline.record(models.HybridProgress{
+			Timestamp:           time.Now(),
+			Iteration:           opts.iterations,
+			BestDistance:        math.Round(improved.totalDistance*100) / 100,
+			CandidateDistance:   math.Round(merged.totalDistance*100) / 100,
+			AcceptedImprovement: improvements > 0,
+			ExploredSolutions:   combined.explored,
+			ImprovementCount:    combined.improvements,
+			Temperature:         improved.temperature,
+			Phase:               "boundary",
+			Snapshot:            snapshot,
+		})
+	})
+
+	return combined, regionCount, nil
+}
+
+// partitionClusters groups orders with k-means on a local planar projection.
+func partitionClusters(orders []models.Order, k int, rng *rand.Rand) regionPlan {
+	lats, lngs := orderCoordinates(orders)
+	index := newSpatialIndex(lats, lngs)
+	xs, ys := index.xs, index.ys
+
+	// k-means++ seeding keeps initial centroids spread across the metro.
+	cx := make([]float64, 0, k)
+	cy := make([]float64, 0, k)
+	first := rng.Intn(len(orders))
+	cx, cy = append(cx, xs[first]), append(cy, ys[first])
+	nearest := make([]float64, len(orders))
+	for i := range nearest {
+		nearest[i] = math.Inf(1)
+	}
+	for len(cx) < k {
+		total := 0.0
+		last := len(cx) - 1
+		for i := range xs {
+			dx, dy := xs[i]-cx[last], ys[i]-cy[last]
+			nearest[i] = math.Min(nearest[i], dx*dx+dy*dy)
+			total += nearest[i]
+		}
+		if total == 0 {
+			break
+		}
+		target := rng.Float64() * total
+		pick := len(xs) - 1
+		for i, d := range nearest {
+			target -= d
+			if target <= 0 {
+				pick = i
+				break
+			}
+		}
+		cx, cy = append(cx, xs[pick]), append(cy, ys[pick])
+	}
+
+	labels := make([]int, len(orders))
+	for iter := 0; iter < kMeansIterations; iter++ {
+		changed := false
+		for i := range xs {
+			best, bestDist := 0, math.Inf(1)
+			for c := range cx {
+				dx, dy := xs[i]-cx[c], ys[i]-cy[c]
+				if d := dx*dx + dy*dy; d < bestDist {
+					best, bestDist = c, d
+				}
+			}
+			if labels[i] != best {
+				labels[i] = best
+				changed = true
+			}
+		}
+
+		sumX := make([]float64, len(cx))
+		sumY := make([]float64, len(cx))
+		counts := make([]int, len(cx))
+		for i, label := range labels {
+			sumX[label] += xs[i]
+			sumY[label] += ys[i]
+			counts[label]++
+		}
+		for c := range cx {
+			if counts[c] > 0 {
+				cx[c] = sumX[c] / float64(counts[c])
+				cy[c] = sumY[c] / float64(counts[c])
+			}
+		}
+		if !changed && iter > 0 {
+			break
+		}
+	}
+
+	return planFromLabels(labels, len(cx))
+}
+
+// partitionGrid splits the orders' bounding box into roughly equal cells.
+func partitionGrid(orders []models.Order, regions int) regionPlan {
+	lats, lngs := orderCoordinates(orders)
+	cols := int(math.Ceil(math.Sqrt(float64(regions))))
+	rows := int(math.Ceil(float64(regions) / float64(cols)))
+
+	minLat, maxLat := minMax(lats)
+	minLng, maxLng := minMax(lngs)
+	cellLat := math.Max((maxLat-minLat)/float64(rows), 1e-9)
+	cellLng := math.Max((maxLng-minLng)/float64(cols), 1e-9)
+
+	labels := make([]int, len(orders))
+	for i := range orders {
+		row := min(int((lats[i]-minLat)/cellLat), rows-1)
+		col := min(int((lngs[i]-minLng)/cellLng), cols-1)
+		labels[i] = row*cols + col
+	}
+	return planFromLabels(labels, rows*cols)
+}
+
+// planFromLabels groups order indices by label, dropping empty regions.
+func planFromLabels(labels []int, regions int) regionPlan {
+	grouped := make([][]int, regions)
+	for i, label := range labels {
+		grouped[label] = append(grouped[label], i)
+	}
+	plan := regionPlan{labels: make([]int, len(labels))}
+	for _, members := range grouped {
+		if len(members) == 0 {
+			continue
+		}
+		region := len(plan.orders)
+		for _, orderIdx := range members {
+			plan.labels[orderIdx] = region
+		}
+		plan.orders = append(plan.orders, members)
+	}
+	return plan
+}
+
+// assignShoppers gives every shopper to the region with the nearest order
+// centroid, then moves shoppers into regions that lack capacity. Regions
+// that still lack shoppers or capacity are folded into their nearest
+// neighbour.
+func (p *regionPlan) assignShoppers(orders []models.Order, shoppers []models.Shopper) {
+	regions := len(p.orders)
+	centroidLat := make([]float64, regions)
+	centroidLng := make([]float64, regions)
+	for r, members := range p.orders {
+		for _, idx := range members {
+			centroidLat[r] += orders[idx].Lat
+			centroidLng[r] += orders[idx].Lng
+		}
+		centroidLat[r] /= float64(len(members))
+		centroidLng[r] /= float64(len(members))
+	}
+
+	regionOf := make([]int, len(shoppers))
+	for s, shopper := range shoppers {
+		best, bestDist := 0, math.Inf(1)
+		for r := 0; r < regions; r++ {
+			if d := planarDistance(shopper.Lat, shopper.Lng, centroidLat[r], centroidLng[r]); d < bestDist {
+				best, bestDist = r, d
+			}
+		}
+		regionOf[s] = best
+	}
+
+	staffed := make([]int, regions)
+	capacity := make([]int, regions)
+	unlimited := make([]int, regions)
+	for s, r := range regionOf {
+		staffed[r]++
+		if shoppers[s].Capacity <= 0 {
+			unlimited[r]++
+		} else {
+			capacity[r] += shoppers[s].Capacity
+		}
+	}
+	shortfall := func(r int) bool {
+		return staffed[r] == 0 || (unlimited[r] == 0 && capacity[r] < len(p.orders[r]))
+	}
+	canSpare := func(s int) bool {
+		r := regionOf[s]
+		if staffed[r] <= 1 {
+			return false
+		}
+		if unlimited[r] > 1 || (unlimited[r] == 1 && shoppers[s].Capacity > 0) {
+			return true
+		}
+		return unlimited[r] == 0 && capacity[r]-shoppers[s].Capacity >= len(p.orders[r])
+	}
+
+	for r := 0; r < regions; r++ {
+		for shortfall(r) {
+			donor, donorDist := -1, math.Inf(1)
+			for s := range shoppers {
+				if regionOf[s] == r || !canSpare(s) {
+					continue
+				}
+				if d := planarDistance(shoppers[s].Lat, shoppers[s].Lng, centroidLat[r], centroidLng[r]); d < donorDist {
+					donor, donorDist = s, d
+				}
+			}
+			if donor < 0 {
+				break
+			}
+			from := regionOf[donor]
+			staffed[from]--
+			staffed[r]++
+			if shoppers[donor].Capacity <= 0 {
+				unlimited[from]--
+				unlimited[r]++
+			} else {
+				capacity[from] -= shoppers[donor].Capacity
+				capacity[r] += shoppers[donor].Capacity
+			}
+			regionOf[donor] = r
+		}
+	}
+
+	// Fold regions still without shoppers, or short of capacity the instance
+	// as a whole has, into their nearest neighbour until each can take its
+	// orders.
+	enough := len(orders) == 0
+	totalCapacity := 0
+	for _, shopper := range shoppers {
+		if shopper.Capacity <= 0 {
+			enough = true
+		}
+		totalCapacity += shopper.Capacity
+	}
+	enough = enough || totalCapacity >= len(orders)
+	folded := make([]bool, regions)
+	for {
+		short := -1
+		for r := 0; r < regions; r++ {
+			if !folded[r] && (staffed[r] == 0 || (enough && shortfall(r))) {
+				short = r
+				break
+			}
+		}
+		if short < 0 {
+			break
+		}
+		into, intoDist := -1, math.Inf(1)
+		for other := 0; other < regions; other++ {
+			if other == short || folded[other] {
+				continue
+			}
+			if d := planarDistance(centroidLat[short], centroidLng[short], centroidLat[other], centroidLng[other]); d < intoDist {
+				into, intoDist = other, d
+			}
+		}
+		if into < 0 {
+			break
+		}
+		folded[short] = true
+		p.orders[into] = append(p.orders[into], p.orders[short]...)
+		p.orders[short] = nil
+		staffed[into] += staffed[short]
+		capacity[into] += capacity[short]
+		unlimited[into] += unlimited[short]
+		for s, r := range regionOf {
+			if r == short {
+				regionOf[s] = into
+			}
+		}
+	}
+
+	mergedOrders := p.orders // folded regions are empty
+	mergedShoppers := make([][]int, regions)
+	for s, r := range regionOf {
+		mergedShoppers[r] = append(mergedShoppers[r], s)
+	}
+
+	p.orders, p.shoppers = nil, nil
+	for r := 0; r < regions; r++ {
+		if len(mergedOrders[r]) == 0 || len(mergedShoppers[r]) == 0 {
+			continue
+		}
+		region := len(p.orders)
+		for _, orderIdx := range mergedOrders[r] {
+			p.labels[orderIdx] = region
+		}
+		p.orders = append(p.orders, mergedOrders[r])
+		p.shoppers = append(p.shoppers, mergedShoppers[r])
+	}
+}
+
+// boundaryOrders returns orders whose neighbour list reaches into another region.
+func boundaryOrders(cache *distanceCache, labels []int) []int {
+	boundary := []int{}
+	for orderIdx, neighbors := range cache.orderNeighbors {
+		for _, neighbor := range neighbors {
+			if labels[neighbor] != labels[orderIdx] {
+				boundary = append(boundary, orderIdx)
+				break
+			}
+		}
+	}
+	return boundary
+}
+
+// improveBoundary repeatedly removes a random subset of boundary orders and
+// reinserts them with the granular repair operator, keeping only moves that
+// shorten the plan so the stitched solution never gets worse.
+func improveBoundary(
+	ctx context.Context,
+	base *solution,
+	cache *distanceCache,
+	boundary []int,
+	opts normalizedOptions,
+	rng *rand.Rand,
+) (*solution, int, int) {
+	if len(boundary) == 0 {
+		return base, 0, 0
+	}
+
+	best := base
+	improvements := 0
+	moves := 0
+	removeCount := max(1, int(math.Ceil(opts.destroyRate*float64(len(boundary)))))
+	passes := opts.iterations
+
+	for pass := 0; pass < passes; pass++ {
+		if ctx.Err() != nil {
+			break
+		}
+		neighbor := best.clone()
+		removed := neighbor.removeOrders(boundary, removeCount, rng)
+		neighbor.repair(removed, cache, opts, rng)
+		neighbor.updateTotals(cache)
+		moves++
+		if neighbor.totalDistance < best.totalDistance {
+			best = neighbor
+			improvements++
+		}
+	}
+	return best, improvements, moves
+}
+
+// removeOrders unassigns up to count orders drawn at random from candidates.
+func (s *solution) removeOrders(candidates []int, count int, rng *rand.Rand) []int {
+	pool := make([]int, len(candidates))
+	copy(pool, candidates)
+	count = min(count, len(pool))
+
+	removed := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		j := i + rng.Intn(len(pool)-i)
+		pool[i], pool[j] = pool[j], pool[i]
+		orderIdx := pool[i]
+		shopperIdx := s.owners.get(orderIdx)
+		if shopperIdx < 0 {
+			continue
+		}
+		pos := indexOf(s.routes[shopperIdx], orderIdx)
+		if pos < 0 {
+			continue
+		}
+		route := s.mutableRoute(shopperIdx)
+		s.routes[shopperIdx] = append(route[:pos], route[pos+1:]...)
+		s.owners.set(orderIdx, -1)
+		removed = append(removed, orderIdx)
+	}
+	return removed
+}
+
+func orderCoordinates(orders []models.Order) ([]float64, []float64) {
+	lats, lngs := make([]float64, len(orders)), make([]float64, len(orders))
+	for i, order := range orders {
+		lats[i], lngs[i] = order.Lat, order.Lng
+	}
+	return lats, lngs
+}
+
+func minMax(values []float64) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	return lo, hi
+}
+
+// planarDistance is an equirectangular approximation in km, adequate for
+// ranking candidates within a metro area.
+func planarDistance(lat1, lng1, lat2, lng2 float64) float64 {
+	dx := (lng2 - lng1) * kmPerDegreeLat * math.Cos((lat1+lat2)/2*math.Pi/180)
+	dy := (lat2 - lat1) * kmPerDegreeLat
+	return math.Sqrt(dx*dx + dy*dy)
+}
@@ -0,0 +1,47 @@
+package hybrid
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"shipt-route-optimizer/internal/models"
+)
+
+func TestDecomposedRunAssignsEveryOrderOnce(t *testing.T) {
+	tests := []struct {
+		mode     string
+		shoppers int
+	}{
+		{"cluster", 9},
+		{"grid", 9},
+		{"grid", 4}, // regions with a single shopper
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d shoppers", tt.mode, tt.shoppers), func(t *testing.T) {
+			orders, shoppers := testProblem(150, tt.shoppers, 6)
+			for i := range shoppers {
+				shoppers[i].Capacity = 180 / tt.shoppers
+			}
+			response, err := Run(context.Background(), orders, shoppers, models.HybridSolveOptions{
+				Iterations:    40,
+				Workers:       3,
+				RandomSeed:    11,
+				Decomposition: tt.mode,
+				Regions:       4,
+			}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Regions left without shoppers are folded into a neighbour
+			if regions := response.Stats.Regions; regions < 2 || regions > 4 {
+				t.Errorf("solved %d regions, want 2 to 4", regions)
+			}
+			plan := models.Plan{Orders: orders, Shoppers: shoppers, Assignments: response.Optimization.Assignments}
+			if routed := len(owners(t, plan)); routed != len(orders) {
+				t.Errorf("%d of %d orders routed", routed, len(orders))
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package hybrid
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/optimizer"
+)
+
+// InsertOrders places new orders into an existing plan one at a time using
+// the cheapest feasible insertion, without re-solving the rest of the plan.
+// Orders that cannot be placed within shopper capacity are reported as
+// infeasible and left out of the returned plan.
+func InsertOrders(plan models.Plan, newOrders []models.Order, alternatives int) (models.InsertOrdersResponse, error) {
+	start := time.Now()
+
+	if len(plan.Shoppers) == 0 {
+		return models.InsertOrdersResponse{}, fmt.Errorf("plan has no shoppers")
+	}
+	if alternatives < 0 {
+		alternatives = 0
+	}
+
+	orders := make([]models.Order, 0, len(plan.Orders)+len(newOrders))
+	orders = append(orders, plan.Orders...)
+	known := make(map[string]bool, len(orders))
+	for _, order := range orders {
+		known[order.ID] = true
+	}
+	for _, order := range newOrders {
+		if order.ID == "" {
+			return models.InsertOrdersResponse{}, fmt.Errorf("new order is missing an id")
+		}
+		if known[order.ID] {
+			return models.InsertOrdersResponse{}, fmt.Errorf("order %s is already in the plan", order.ID)
+		}
+		known[order.ID] = true
+		orders = append(orders, order)
+	}
+
+	cache := newLazyDistanceCache(orders, plan.Shoppers, plan.AvoidAreas)
+	current, err := solutionFromAssignments(cache, plan.Assignments)
+	if err != nil {
+		return models.InsertOrdersResponse{}, err
+	}
+
+	insertions := make([]models.OrderInsertion, 0, len(newOrders))
+	totalDelta := 0.0
+	for i := range newOrders {
+		orderIdx := len(plan.Orders) + i
+		options := current.allInsertionOptions(cache, orderIdx)
+		sort.Slice(options, func(a, b int) bool { return options[a].delta < options[b].delta })
+
+		insertion := models.OrderInsertion{
+			OrderID:      orders[orderIdx].ID,
+			Alternatives: []models.InsertionOption{},
+		}
+		if len(options) > 0 {
+			best := options[0]
+			current.insertAt(best.shopper, best.pos, orderIdx)
+			totalDelta += best.delta
+
+			insertion.Feasible = true
+			insertion.Best = toInsertionOption(cache, best)
+			insertion.Alternatives = alternativeOptions(cache, options[1:], best.shopper, alternatives)
+		}
+		insertions = append(insertions, insertion)
+	}
+	current.updateTotals(cache)
+
+	updated := models.Plan{
+		ID:          plan.ID,
+		Orders:      orders,
+		Shoppers:    plan.Shoppers,
+		Assignments: current.toAssignments(orders, plan.Shoppers, cache),
+		AvoidAreas:  plan.AvoidAreas,
+	}
+	optimizer.SortAssignmentsByShopper(updated.Assignments)
+
+	return models.InsertOrdersResponse{
+		Plan:           updated,
+		Insertions:     insertions,
+		TotalCostDelta: math.Round(totalDelta*1000) / 1000,
+		ElapsedMillis:  float64(time.Since(start).Microseconds()) / 1000,
+	}, nil
+}
+
+// alternativeOptions picks the cheapest remaining options, at most one per
+// shopper and never the shopper that received the order.
+func alternativeOptions(cache *distanceCache, options []insertionOption, chosenShopper int, limit int) []models.InsertionOption {
+	result := []models.InsertionOption{}
+	used := map[int]bool{chosenShopper: true}
+	for _, option := range options {
+		if len(result) >= limit {
+			break
+		}
+		if used[option.shopper] {
+			continue
+		}
+		used[option.shopper] = true
+		result = append(result, *toInsertionOption(cache, option))
+	}
+	return result
+}
+
+func toInsertionOption(cache *distanceCache, option insertionOption) *models.InsertionOption {
+	return &models.InsertionOption{
+		ShopperID: cache.shoppers[option.shopper].ID,
+		Position:  option.pos,
+		CostDelta: math.Round(option.delta*1000) / 1000,
+	}
+}
+
+// newLazyDistanceCache builds a cache that computes every distance on demand
+// and skips neighbour lists, for callers that only evaluate a handful of
+// insertions and cannot afford to precompute full matrices. Restricted zones
+// among the plan's avoid areas still limit who may take each order.
+func newLazyDistanceCache(orders []models.Order, shoppers []models.Shopper, areas []models.AvoidArea) *distanceCache {
+	capacities := make([]int, len(shoppers))
+	for i, shopper := range shoppers {
+		if shopper.Capacity <= 0 {
+			capacities[i] = -1
+		} else {
+			capacities[i] = shopper.Capacity
+		}
+	}
+	costs := optimizer.EstimatedCosts()
+	costs.Restrictions = optimizer.RestrictionsFor(orders, areas)
+	return &distanceCache{
+		shopperToOrder: newLazyMatrix(func(i, j int) float64 {
+			return costs.Cost(shoppers[i].Lat, shoppers[i].Lng, orders[j].Lat, orders[j].Lng)
+		}),
+		orderToOrder: newLazyMatrix(func(i, j int) float64 {
+			if i == j {
+				return 0
+			}
+			return costs.Cost(orders[i].Lat, orders[i].Lng, orders[j].Lat, orders[j].Lng)
+		}),
+		orderNeighbors:   make([][]int32, len(orders)),
+		shopperNeighbors: make([][]int32, len(orders)),
+		orders:           orders,
+		shoppers:         shoppers,
+		totalOrders:      len(orders),
+		capacities:       capacities,
+		costs:            costs,
+	}
+}
+
+// solutionFromAssignments rebuilds solver state from published assignments.
+func solutionFromAssignments(cache *distanceCache, assignments []models.Assignment) (*solution, error) {
+	orderIndex := make(map[string]int, len(cache.orders))
+	for i, order := range cache.orders {
+		orderIndex[order.ID] = i
+	}
+	shopperIndex := make(map[string]int, len(cache.shoppers))
+	for i, shopper := range cache.shoppers {
+		shopperIndex[shopper.ID] = i
+	}
+
+	result := newSolution(len(cache.shoppers), len(cache.orders))
+	for _, assignment := range assignments {
+		shopperIdx, ok := shopperIndex[assignment.ShopperID]
+		if !ok {
+			return nil, fmt.Errorf("assignment references unknown shopper %s", assignment.ShopperID)
+		}
+		for _, orderID := range assignment.Route {
+			orderIdx, ok := orderIndex[orderID]
+			if !ok {
+				return nil, fmt.Errorf("assignment references unknown order %s", orderID)
+			}
+			if result.owners.get(orderIdx) >= 0 {
+				return nil, fmt.Errorf("order %s is assigned more than once", orderID)
+			}
+			result.routes[shopperIdx] = append(result.routes[shopperIdx], orderIdx)
+			result.owners.set(orderIdx, shopperIdx)
+		}
+	}
+	result.recomputeTotals(cache)
+	return result, nil
+}
+
+// ValidatePlan reports the first order listed twice in the plan, or the first
+// assignment naming a shopper or order the plan does not have or assigning
+// an order twice, so stored plans can always be rebuilt for later changes.
+func ValidatePlan(plan models.Plan) error {
+	shoppers := make(map[string]bool, len(plan.Shoppers))
+	for _, shopper := range plan.Shoppers {
+		shoppers[shopper.ID] = true
+	}
+	orders := make(map[string]bool, len(plan.Orders))
+	for _, order := range plan.Orders {
+		if orders[order.ID] {
+			return fmt.Errorf("order %s appears more than once", order.ID)
+		}
+		orders[order.ID] = true
+	}
+	assigned := make(map[string]bool, len(plan.Orders))
+	for _, assignment := range plan.Assignments {
+		if !shoppers[assignment.ShopperID] {
+			return fmt.Errorf("assignment references unknown shopper %s", assignment.ShopperID)
+		}
+		for _, orderID := range assignment.Route {
+			if !orders[orderID] {
+				return fmt.Errorf("assignment references unknown order %s", orderID)
+			}
+			if assigned[orderID] {
+				return fmt.Errorf("order %s is assigned more than once", orderID)
+			}
+			assigned[orderID] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package hybrid
+
+import (
+	"math"
+	"testing"
+
+	"shipt-route-optimizer/internal/models"
+)
+
+// testPlan assigns the orders round-robin to shoppers of the given capacity.
+func testPlan(orderCount, shopperCount, capacity int) models.Plan {
+	orders, shoppers := testProblem(orderCount, shopperCount, 3)
+	plan := models.Plan{ID: "plan-test", Orders: orders, Shoppers: shoppers}
+	for i := range shoppers {
+		plan.Shoppers[i].Capacity = capacity
+		plan.Assignments = append(plan.Assignments, models.Assignment{ShopperID: shoppers[i].ID})
+	}
+	for i, order := range orders {
+		assignment := &plan.Assignments[i%shopperCount]
+		assignment.Route = append(assignment.Route, order.ID)
+	}
+	return plan
+}
+
+// owners maps each routed order to its shopper, failing on orders routed
+// twice and on shoppers over capacity.
+func owners(t *testing.T, plan models.Plan) map[string]string {
+	t.Helper()
+	capacity := map[string]int{}
+	for _, shopper := range plan.Shoppers {
+		capacity[shopper.ID] = shopper.Capacity
+	}
+	owner := map[string]string{}
+	for _, assignment := range plan.Assignments {
+		if limit := capacity[assignment.ShopperID]; limit > 0 && len(assignment.Route) > limit {
+			t.Errorf("shopper %s carries %d orders, capacity %d", assignment.ShopperID, len(assignment.Route), limit)
+		}
+		for _, orderID := range assignment.Route {
+			if previous, ok := owner[orderID]; ok {
+				t.Errorf("order %s routed by %s and %s", orderID, previous, assignment.ShopperID)
+			}
+			owner[orderID] = assignment.ShopperID
+		}
+	}
+	return owner
+}
+
+func TestInsertOrdersRespectsCapacity(t *testing.T) {
+	plan := testPlan(4, 2, 3) // two free slots
+	extra, _ := testProblem(3, 0, 4)
+	for i := range extra {
+		extra[i].ID = "N" + extra[i].ID
+	}
+
+	response, err := InsertOrders(plan, extra, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner := owners(t, response.Plan)
+	for _, order := range plan.Orders {
+		if owner[order.ID] == "" {
+			t.Errorf("existing order %s lost its shopper", order.ID)
+		}
+	}
+	feasible, delta := 0, 0.0
+	for _, insertion := range response.Insertions {
+		if !insertion.Feasible {
+			if _, ok := owner[insertion.OrderID]; ok {
+				t.Errorf("infeasible order %s was routed", insertion.OrderID)
+			}
+			continue
+		}
+		feasible++
+		delta += insertion.Best.CostDelta
+		if owner[insertion.OrderID] != insertion.Best.ShopperID {
+			t.Errorf("order %s routed by %q, best option was %s", insertion.OrderID, owner[insertion.OrderID], insertion.Best.ShopperID)
+		}
+		for _, alternative := range insertion.Alternatives {
+			if alternative.ShopperID == insertion.Best.ShopperID {
+				t.Errorf("order %s: alternative repeats the chosen shopper", insertion.OrderID)
+			}
+		}
+	}
+	if feasible != 2 {
+		t.Errorf("%d orders inserted, want the 2 free slots filled", feasible)
+	}
+	if math.Abs(delta-response.TotalCostDelta) > 0.01 {
+		t.Errorf("total cost delta %v, insertions add up to %v", response.TotalCostDelta, delta)
+	}
+}
+
+func TestInsertOrdersRejectsKnownOrders(t *testing.T) {
+	plan := testPlan(4, 2, 3)
+	if _, err := InsertOrders(plan, plan.Orders[:1], 0); err == nil {
+		t.Error("inserting an order already in the plan succeeded")
+	}
+}
@@ -0,0 +1,121 @@
+package hybrid
+
+import (
+	"runtime"
+	"sync"
+)
+
+const (
+	// denseMatrixMaxBytes bounds matrices stored as flat float64 values.
+	denseMatrixMaxBytes = 64 << 20
+	// compactMatrixMaxBytes bounds matrices stored as flat float32 values.
+	// Anything larger is computed on demand.
+	compactMatrixMaxBytes = 256 << 20
+)
+
+// distanceMatrix is a read-only rows x cols table of travel costs in km.
+// Implementations must be safe for concurrent use by solver workers.
+type distanceMatrix interface {
+	at(row, col int) float64
+	kind() string
+}
+
+// costFunc computes the travel cost between a row and a column entity.
+type costFunc func(row, col int) float64
+
+// newDistanceMatrix picks a storage strategy by instance size: flat float64
+// for small instances, flat float32 when that would be too large, and an
+// on-demand matrix beyond that.
+func newDistanceMatrix(rows, cols int, cost costFunc) distanceMatrix {
+	cells := int64(rows) * int64(cols)
+	switch {
+	case cells*8 <= denseMatrixMaxBytes:
+		return newDenseMatrix(rows, cols, cost)
+	case cells*4 <= compactMatrixMaxBytes:
+		return newCompactMatrix(rows, cols, cost)
+	default:
+		return newLazyMatrix(cost)
+	}
+}
+
+// denseMatrix stores every entry as a float64 in one contiguous slice.
+type denseMatrix struct {
+	cols   int
+	values []float64
+}
+
+func newDenseMatrix(rows, cols int, cost costFunc) *denseMatrix {
+	m := &denseMatrix{cols: cols, values: make([]float64, rows*cols)}
+	fillRows(rows, func(row int) {
+		base := row * cols
+		for col := 0; col < cols; col++ {
+			m.values[base+col] = cost(row, col)
+		}
+	})
+	return m
+}
+
+func (m *denseMatrix) at(row, col int) float64 { return m.values[row*m.cols+col] }
+func (m *denseMatrix) kind() string            { return "dense" }
+
+// compactMatrix halves memory by storing entries as float32, which keeps
+// metre-level precision for metro-scale distances.
+type compactMatrix struct {
+	cols   int
+	values []float32
+}
+
+func newCompactMatrix(rows, cols int, cost costFunc) *compactMatrix {
+	m := &compactMatrix{cols: cols, values: make([]float32, rows*cols)}
+	fillRows(rows, func(row int) {
+		base := row * cols
+		for col := 0; col < cols; col++ {
+			m.values[base+col] = float32(cost(row, col))
+		}
+	})
+	return m
+}
+
+func (m *compactMatrix) at(row, col int) float64 { return float64(m.values[row*m.cols+col]) }
+func (m *compactMatrix) kind() string            { return "compact" }
+
+// fillRows runs fill for every row, spreading rows across CPUs.
+func fillRows(rows int, fill func(row int)) {
+	workers := runtime.NumCPU()
+	if workers > rows {
+		workers = rows
+	}
+	if workers <= 1 {
+		for row := 0; row < rows; row++ {
+			fill(row)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			for row := offset; row < rows; row += workers {
+				fill(row)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// lazyMatrix computes entries on use, so no memory proportional to
+// rows x cols is allocated up front. Every cost source (haversine, the
+// calibrated estimate, road matrix lookups) is cheaper than a locked cache
+// lookup, so entries are not memoised.
+type lazyMatrix struct {
+	cost costFunc
+}
+
+func newLazyMatrix(cost costFunc) *lazyMatrix {
+	return &lazyMatrix{cost: cost}
+}
+
+func (m *lazyMatrix) at(row, col int) float64 { return m.cost(row, col) }
+func (m *lazyMatrix) kind() string            { return "lazy" }
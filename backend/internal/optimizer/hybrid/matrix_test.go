@@ -0,0 +1,54 @@
+package hybrid
+
+import (
+	"math"
+	"testing"
+
+	"shipt-route-optimizer/internal/optimizer"
+)
+
+func TestDistanceMatricesMatchCosts(t *testing.T) {
+	orders, _ := testProblem(60, 0, 9)
+	cost := func(row, col int) float64 {
+		return optimizer.HaversineDistance(orders[row].Lat, orders[row].Lng, orders[col].Lat, orders[col].Lng)
+	}
+	n := len(orders)
+
+	tests := []struct {
+		matrix    distanceMatrix
+		tolerance float64 // relative
+	}{
+		{newDenseMatrix(n, n, cost), 0},
+		{newCompactMatrix(n, n, cost), 1e-6},
+		{newLazyMatrix(cost), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.matrix.kind(), func(t *testing.T) {
+			for row := 0; row < n; row++ {
+				for col := 0; col < n; col++ {
+					want := cost(row, col)
+					if got := tt.matrix.at(row, col); math.Abs(got-want) > tt.tolerance*want {
+						t.Fatalf("at(%d, %d) = %v, want %v", row, col, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewDistanceMatrixStorage(t *testing.T) {
+	zero := func(row, col int) float64 { return 0 }
+	tests := []struct {
+		rows, cols int
+		want       string
+	}{
+		{100, 100, "dense"},
+		{4096, 4096, "compact"}, // 128 MB as float64, 64 MB as float32
+		{10000, 10000, "lazy"},
+	}
+	for _, tt := range tests {
+		if got := newDistanceMatrix(tt.rows, tt.cols, zero).kind(); got != tt.want {
+			t.Errorf("%d x %d matrix is %s, want %s", tt.rows, tt.cols, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package hybrid
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/optimizer"
+)
+
+// RepairPlan drops cancelled orders and unavailable shoppers from a plan and
+// re-inserts the orders those shoppers were carrying at their cheapest
+// feasible positions. Every other stop keeps its shopper and relative order,
+// so the published plan changes as little as possible.
+func RepairPlan(plan models.Plan, removedOrderIDs []string, unavailableShopperIDs []string) (models.RepairPlanResponse, error) {
+	start := time.Now()
+
+	if len(plan.Shoppers) == 0 {
+		return models.RepairPlanResponse{}, fmt.Errorf("plan has no shoppers")
+	}
+
+	cache := newLazyDistanceCache(plan.Orders, plan.Shoppers, plan.AvoidAreas)
+	current, err := solutionFromAssignments(cache, plan.Assignments)
+	if err != nil {
+		return models.RepairPlanResponse{}, err
+	}
+	before := current.totalDistance
+	original := stopPositions(current)
+
+	orderIndex := make(map[string]int, len(plan.Orders))
+	for i, order := range plan.Orders {
+		orderIndex[order.ID] = i
+	}
+	shopperIndex := make(map[string]int, len(plan.Shoppers))
+	for i, shopper := range plan.Shoppers {
+		shopperIndex[shopper.ID] = i
+	}
+
+	cancelled := make([]bool, len(plan.Orders))
+	for _, id := range removedOrderIDs {
+		orderIdx, ok := orderIndex[id]
+		if !ok {
+			return models.RepairPlanResponse{}, fmt.Errorf("unknown order %s", id)
+		}
+		cancelled[orderIdx] = true
+		if shopperIdx := current.owners.get(orderIdx); shopperIdx >= 0 {
+			route := current.mutableRoute(shopperIdx)
+			pos := indexOf(route, orderIdx)
+			current.routes[shopperIdx] = append(route[:pos], route[pos+1:]...)
+			current.owners.set(orderIdx, -1)
+		}
+	}
+
+	orphans := []int{}
+	for _, id := range unavailableShopperIDs {
+		shopperIdx, ok := shopperIndex[id]
+		if !ok {
+			return models.RepairPlanResponse{}, fmt.Errorf("unknown shopper %s", id)
+		}
+		// A zero capacity keeps the shopper out of every insertion option.
+		cache.capacities[shopperIdx] = 0
+		for _, orderIdx := range current.mutableRoute(shopperIdx) {
+			current.owners.set(orderIdx, -1)
+			orphans = append(orphans, orderIdx)
+		}
+		current.routes[shopperIdx] = nil
+	}
+
+	unassigned := []string{}
+	for _, orderIdx := range orphans {
+		options := current.allInsertionOptions(cache, orderIdx)
+		if len(options) == 0 {
+			unassigned = append(unassigned, plan.Orders[orderIdx].ID)
+			continue
+		}
+		sort.Slice(options, func(a, b int) bool { return options[a].delta < options[b].delta })
+		current.insertAt(options[0].shopper, options[0].pos, orderIdx)
+	}
+	current.updateTotals(cache)
+
+	remaining := make([]models.Order, 0, len(plan.Orders))
+	for orderIdx, order := range plan.Orders {
+		if !cancelled[orderIdx] {
+			remaining = append(remaining, order)
+		}
+	}
+
+	repaired := models.Plan{
+		ID:          plan.ID,
+		Orders:      remaining,
+		Shoppers:    plan.Shoppers,
+		Assignments: current.toAssignments(plan.Orders, plan.Shoppers, cache),
+		AvoidAreas:  plan.AvoidAreas,
+	}
+	optimizer.SortAssignmentsByShopper(repaired.Assignments)
+
+	return models.RepairPlanResponse{
+		Plan:          repaired,
+		Changes:       planChanges(plan, original, stopPositions(current), cancelled),
+		Unassigned:    unassigned,
+		CostDelta:     math.Round((current.totalDistance-before)*1000) / 1000,
+		ElapsedMillis: float64(time.Since(start).Microseconds()) / 1000,
+	}, nil
+}
+
+// stopPosition locates an order within a solution.
+type stopPosition struct {
+	shopper int
+	pos     int
+}
+
+func stopPositions(s *solution) []stopPosition {
+	positions := make([]stopPosition, s.owners.len())
+	for i := range positions {
+		positions[i] = stopPosition{shopper: -1, pos: -1}
+	}
+	for shopperIdx, route := range s.routes {
+		for pos, orderIdx := range route {
+			positions[orderIdx] = stopPosition{shopper: shopperIdx, pos: pos}
+		}
+	}
+	return positions
+}
+
+// planChanges lists cancelled orders and orders whose shopper changed.
+// Stops that only shifted index because a neighbour was added or removed
+// are not reported.
+func planChanges(plan models.Plan, before, after []stopPosition, cancelled []bool) []models.StopChange {
+	shopperID := func(idx int) string {
+		if idx < 0 {
+			return ""
+		}
+		return plan.Shoppers[idx].ID
+	}
+
+	changes := []models.StopChange{}
+	for orderIdx := range before {
+		from, to := before[orderIdx], after[orderIdx]
+		change := ""
+		switch {
+		case cancelled[orderIdx]:
+			change = "cancelled"
+		case from.shopper == to.shopper:
+			continue
+		case to.shopper < 0:
+			change = "unassigned"
+		default:
+			change = "reassigned"
+		}
+		changes = append(changes, models.StopChange{
+			OrderID:       plan.Orders[orderIdx].ID,
+			Change:        change,
+			FromShopperID: shopperID(from.shopper),
+			FromPosition:  from.pos,
+			ToShopperID:   shopperID(to.shopper),
+			ToPosition:    to.pos,
+		})
+	}
+	return changes
+}
@@ -0,0 +1,62 @@
+package hybrid
+
+import (
+	"slices"
+	"testing"
+
+	"shipt-route-optimizer/internal/models"
+)
+
+func TestRepairPlanRehomesOrphansWithinCapacity(t *testing.T) {
+	tests := []struct {
+		name       string
+		capacity   int
+		unassigned int
+	}{
+		{"spare capacity", 3, 0},
+		{"only the cancelled slot free", 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := testPlan(6, 3, tt.capacity) // S1 routes O1 and O4
+			response, err := RepairPlan(plan, []string{"O2"}, []string{"S1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			owner := owners(t, response.Plan)
+			if _, ok := owner["O2"]; ok {
+				t.Error("cancelled order O2 is still routed")
+			}
+			if slices.ContainsFunc(response.Plan.Orders, func(order models.Order) bool { return order.ID == "O2" }) {
+				t.Error("cancelled order O2 is still in the plan")
+			}
+			for orderID, shopperID := range owner {
+				if shopperID == "S1" {
+					t.Errorf("order %s left with unavailable shopper S1", orderID)
+				}
+			}
+			if len(response.Unassigned) != tt.unassigned {
+				t.Errorf("unassigned = %v, want %d orders", response.Unassigned, tt.unassigned)
+			}
+			for _, orderID := range response.Unassigned {
+				if _, ok := owner[orderID]; ok {
+					t.Errorf("unassigned order %s is routed", orderID)
+				}
+			}
+			if routed := len(owner) + len(response.Unassigned); routed != len(plan.Orders)-1 {
+				t.Errorf("%d orders routed or unassigned, want %d", routed, len(plan.Orders)-1)
+			}
+		})
+	}
+}
+
+func TestRepairPlanRejectsUnknownIDs(t *testing.T) {
+	plan := testPlan(4, 2, 3)
+	if _, err := RepairPlan(plan, []string{"O9"}, nil); err == nil {
+		t.Error("repairing with an unknown order succeeded")
+	}
+	if _, err := RepairPlan(plan, nil, []string{"S9"}); err == nil {
+		t.Error("repairing with an unknown shopper succeeded")
+	}
+}
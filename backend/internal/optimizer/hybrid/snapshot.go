@@ -0,0 +1,237 @@
+package hybrid
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"shipt-route-optimizer/internal/models"
+)
+
+// Snapshot modes for models.HybridSolveOptions.Snapshots
+const (
+	SnapshotsFull  = "full"
+	SnapshotsDelta = "delta"
+)
+
+// snapshotKeyframe is how often delta mode sends a full snapshot anyway, so
+// a client that missed a delta, or resumed a stream midway, catches up.
+const snapshotKeyframe = 10
+
+// snapshotQueueSize bounds the snapshots waiting for a slow client. Past it,
+// each new snapshot is merged into the last one waiting.
+const snapshotQueueSize = 16
+
+// snapshotter turns the improving best solution into throttled snapshots.
+// Routes are keyed by shopper ID, so the region searches of a decomposed
+// solve share one snapshotter and together stream the whole plan.
+type snapshotter struct {
+	delta    bool
+	geometry bool
+	interval time.Duration
+
+	// Snapshots are taken and queued under deliverMu, so they queue in
+	// version order, and one goroutine hands them on. A slow client then
+	// never holds up the search.
+	deliverMu sync.Mutex
+	pending   []queuedSnapshot // guarded by deliverMu
+	closed    bool             // guarded by deliverMu
+	wake      chan struct{}
+	done      chan struct{}
+
+	mu      sync.Mutex
+	current map[string]models.RouteSnapshot // latest best route per shopper
+	order   []string                        // shopper IDs in first-seen order
+	sent    map[string][]string             // routes as of the last snapshot
+	dirty   bool
+	last    time.Time
+	version int
+}
+
+// queuedSnapshot is a snapshot waiting to be handed to its send callback.
+type queuedSnapshot struct {
+	snapshot *models.SolutionSnapshot
+	send     func(*models.SolutionSnapshot)
+}
+
+// newSnapshotter returns nil when snapshots are off; a nil snapshotter
+// ignores every call. Otherwise it starts the goroutine delivering its
+// snapshots, which runs until close.
+func newSnapshotter(opts normalizedOptions) *snapshotter {
+	if opts.snapshots != SnapshotsFull && opts.snapshots != SnapshotsDelta {
+		return nil
+	}
+	s := &snapshotter{
+		delta:    opts.snapshots == SnapshotsDelta,
+		geometry: opts.snapshotGeometry,
+		interval: opts.emitInterval,
+		current:  map[string]models.RouteSnapshot{},
+		sent:     map[string][]string{},
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go s.sendQueued()
+	return s
+}
+
+// update records a new best solution over the cache's shoppers.
+func (s *snapshotter) update(cache *distanceCache, best *solution) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for shopperIdx, route := range best.routes {
+		shopper := cache.shoppers[shopperIdx]
+		snapshot := models.RouteSnapshot{
+			ShopperID: shopper.ID,
+			Route:     make([]string, len(route)),
+			Distance:  math.Round(cache.reportedDistance(shopperIdx, route)*100) / 100,
+		}
+		if s.geometry {
+			snapshot.Geometry = make([][]float64, 0, len(route)+1)
+			snapshot.Geometry = append(snapshot.Geometry, []float64{shopper.Lat, shopper.Lng})
+		}
+		for i, orderIdx := range route {
+			order := cache.orders[orderIdx]
+			snapshot.Route[i] = order.ID
+			if s.geometry {
+				snapshot.Geometry = append(snapshot.Geometry, []float64{order.Lat, order.Lng})
+			}
+		}
+		if _, ok := s.current[shopper.ID]; !ok {
+			s.order = append(s.order, shopper.ID)
+		}
+		s.current[shopper.ID] = snapshot
+	}
+	s.dirty = true
+}
+
+// deliver takes a snapshot and queues it for send, nil if there is none.
+// send runs later on the delivery goroutine, after every snapshot taken
+// before it. A nil snapshotter calls send(nil) straight away.
+func (s *snapshotter) deliver(now time.Time, force bool, send func(*models.SolutionSnapshot)) {
+	if s == nil {
+		send(nil)
+		return
+	}
+	s.deliverMu.Lock()
+	defer s.deliverMu.Unlock()
+	queued := queuedSnapshot{snapshot: s.take(now, force), send: send}
+	if s.closed {
+		send(queued.snapshot)
+		return
+	}
+	if n := len(s.pending); n >= snapshotQueueSize {
+		last := &s.pending[n-1]
+		last.snapshot = mergeSnapshots(last.snapshot, queued.snapshot)
+		last.send = queued.send
+	} else {
+		s.pending = append(s.pending, queued)
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default: // the delivery goroutine is already due to look
+	}
+}
+
+// sendQueued hands queued snapshots to their send callbacks in order until
+// close, outside deliverMu.
+func (s *snapshotter) sendQueued() {
+	defer close(s.done)
+	for range s.wake {
+		for {
+			// One at a time, so snapshots queued behind a slow send can
+			// still be coalesced
+			s.deliverMu.Lock()
+			if len(s.pending) == 0 {
+				s.deliverMu.Unlock()
+				break
+			}
+			queued := s.pending[0]
+			s.pending = s.pending[1:]
+			s.deliverMu.Unlock()
+			queued.send(queued.snapshot)
+		}
+	}
+}
+
+// close waits for the queued snapshots to be sent and stops the delivery
+// goroutine. Later deliveries are sent straight away.
+func (s *snapshotter) close() {
+	if s == nil {
+		return
+	}
+	s.deliverMu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.wake)
+	}
+	s.deliverMu.Unlock()
+	<-s.done
+}
+
+// mergeSnapshots folds next into prev, the last snapshot still waiting to
+// be sent, so the merged snapshot takes a client from where prev would have
+// to where next would.
+func mergeSnapshots(prev, next *models.SolutionSnapshot) *models.SolutionSnapshot {
+	if prev == nil || next == nil || next.Full {
+		if next == nil {
+			return prev
+		}
+		return next
+	}
+	merged := *prev
+	merged.Version = next.Version
+	merged.TotalDistance = next.TotalDistance
+	merged.Routes = slices.Clone(prev.Routes)
+	for _, route := range next.Routes {
+		i := slices.IndexFunc(merged.Routes, func(r models.RouteSnapshot) bool { return r.ShopperID == route.ShopperID })
+		if i < 0 {
+			merged.Routes = append(merged.Routes, route)
+			continue
+		}
+		merged.Routes[i] = route
+	}
+	return &merged
+}
+
+// take returns a snapshot of the best plan if it changed since the last one
+// and the emit interval has passed, else nil. force skips the interval.
+func (s *snapshotter) take(now time.Time, force bool) *models.SolutionSnapshot {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty || !force && !s.last.IsZero() && now.Sub(s.last) < s.interval {
+		return nil
+	}
+
+	s.version++
+	snapshot := &models.SolutionSnapshot{
+		Version: s.version,
+		Full:    !s.delta || (s.version-1)%snapshotKeyframe == 0,
+		Routes:  []models.RouteSnapshot{},
+	}
+	if !snapshot.Full {
+		snapshot.BaseVersion = s.version - 1
+	}
+	total := 0.0
+	for _, id := range s.order {
+		route := s.current[id]
+		total += route.Distance
+		sent, ok := s.sent[id]
+		if !snapshot.Full && ok && slices.Equal(sent, route.Route) {
+			continue
+		}
+		snapshot.Routes = append(snapshot.Routes, route)
+		s.sent[id] = route.Route
+	}
+	snapshot.TotalDistance = math.Round(total*100) / 100
+
+	s.dirty = false
+	s.last = now
+	return snapshot
+}
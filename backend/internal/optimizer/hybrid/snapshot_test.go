@@ -0,0 +1,153 @@
+package hybrid
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/optimizer"
+)
+
+// testProblem scatters orders and shoppers around Birmingham, AL.
+func testProblem(orderCount, shopperCount int, seed int64) ([]models.Order, []models.Shopper) {
+	rng := rand.New(rand.NewSource(seed))
+	orders := make([]models.Order, orderCount)
+	for i := range orders {
+		orders[i] = models.Order{ID: fmt.Sprintf("O%d", i+1), Lat: 33.45 + rng.Float64()*0.15, Lng: -86.90 + rng.Float64()*0.15, ItemCount: 5}
+	}
+	shoppers := make([]models.Shopper, shopperCount)
+	for i := range shoppers {
+		shoppers[i] = models.Shopper{ID: fmt.Sprintf("S%d", i+1), Lat: 33.45 + rng.Float64()*0.15, Lng: -86.90 + rng.Float64()*0.15, Capacity: orderCount}
+	}
+	return orders, shoppers
+}
+
+// replayer rebuilds a plan from streamed snapshots the way a client does.
+type replayer struct {
+	t       *testing.T
+	version int
+	routes  map[string][]string
+}
+
+func (r *replayer) apply(snapshot *models.SolutionSnapshot) {
+	r.t.Helper()
+	if snapshot == nil {
+		return
+	}
+	if snapshot.Version <= r.version {
+		r.t.Fatalf("snapshot %d arrived after %d", snapshot.Version, r.version)
+	}
+	if snapshot.Full {
+		r.routes = map[string][]string{}
+	} else if snapshot.BaseVersion != r.version {
+		r.t.Fatalf("delta %d applies to %d, but the client is at %d", snapshot.Version, snapshot.BaseVersion, r.version)
+	}
+	for _, route := range snapshot.Routes {
+		r.routes[route.ShopperID] = route.Route
+	}
+	r.version = snapshot.Version
+}
+
+func TestSnapshotDeltasRebuildFinalPlan(t *testing.T) {
+	for _, mode := range []string{SnapshotsFull, SnapshotsDelta} {
+		t.Run(mode, func(t *testing.T) {
+			orders, shoppers := testProblem(40, 4, 1)
+			var (
+				mu       sync.Mutex
+				client   = &replayer{t: t}
+				keyframe int
+			)
+			response, err := Run(context.Background(), orders, shoppers, models.HybridSolveOptions{
+				Iterations:         60,
+				Workers:            4,
+				EmitIntervalMillis: 1,
+				RandomSeed:         7,
+				Snapshots:          mode,
+			}, func(progress models.HybridProgress) {
+				mu.Lock()
+				defer mu.Unlock()
+				if progress.Snapshot != nil && progress.Snapshot.Full {
+					keyframe++
+				}
+				client.apply(progress.Snapshot)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if client.version == 0 {
+				t.Fatal("no snapshots streamed")
+			}
+			if mode == SnapshotsDelta && client.version > snapshotKeyframe && keyframe >= client.version {
+				t.Errorf("%d of %d snapshots were full, want deltas between keyframes", keyframe, client.version)
+			}
+			for _, assignment := range response.Optimization.Assignments {
+				if got := client.routes[assignment.ShopperID]; !slices.Equal(got, assignment.Route) {
+					t.Errorf("shopper %s: streamed route %v, final route %v", assignment.ShopperID, got, assignment.Route)
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotterCoalescesForSlowClients(t *testing.T) {
+	orders, shoppers := testProblem(6, 2, 2)
+	cache := newDistanceCache(orders, shoppers, 5, optimizer.HaversineCosts)
+	snapshots := newSnapshotter(normalizedOptions{snapshots: SnapshotsDelta})
+	defer snapshots.close()
+
+	release := make(chan struct{})
+	client := &replayer{t: t}
+	var received int
+	send := func(snapshot *models.SolutionSnapshot) {
+		<-release
+		received++
+		client.apply(snapshot)
+	}
+
+	// Move one order at a time between the shoppers while the client is stuck
+	const updates = 4 * snapshotQueueSize
+	best := newSolution(len(shoppers), len(orders))
+	for i := 0; i < updates; i++ {
+		best.routes[0], best.routes[1] = nil, nil
+		for order := range orders {
+			shopper := (order + i) % 2
+			best.routes[shopper] = append(best.routes[shopper], order)
+		}
+		snapshots.update(cache, best)
+
+		delivered := make(chan struct{})
+		go func() {
+			snapshots.deliver(time.Now(), true, send)
+			close(delivered)
+		}()
+		select {
+		case <-delivered:
+		case <-time.After(time.Second):
+			t.Fatalf("deliver %d blocked on a slow client", i+1)
+		}
+	}
+	close(release)
+	snapshots.close()
+
+	if received > snapshotQueueSize+1 {
+		t.Errorf("client received %d snapshots, want at most %d once coalesced", received, snapshotQueueSize+1)
+	}
+	if client.version != updates {
+		t.Errorf("client reached version %d, want %d", client.version, updates)
+	}
+	for shopperIdx, shopper := range shoppers {
+		want := make([]string, 0, len(best.routes[shopperIdx]))
+		for _, order := range best.routes[shopperIdx] {
+			want = append(want, orders[order].ID)
+		}
+		if got := client.routes[shopper.ID]; !slices.Equal(got, want) {
+			t.Errorf("shopper %s: rebuilt route %v, want %v", shopper.ID, got, want)
+		}
+	}
+}
@@ -4,49 +4,136 @@ import (
 	"math"
 	"math/rand"
 	"sort"
+	"time"
 
 	"shipt-route-optimizer/internal/models"
 	"shipt-route-optimizer/internal/optimizer"
+	"shipt-route-optimizer/internal/routing"
 )
 
+// solution holds one assignment of orders to shopper routes. Route slices and
+// owner pages are copy-on-write: clones share them until one side mutates
+// them, so a destroy/repair move only copies what it actually touches. Routes
+// touched since the last updateTotals call are tracked so totals can be
+// refreshed without re-walking every route.
 type solution struct {
 	routes         [][]int
 	routeDistances []float64
+	owners         ownerTable // order index -> shopper index, -1 when unassigned
+	shared         []bool     // route slice may be referenced by another solution
+	dirty          []int      // routes changed since the last updateTotals
+	isDirty        []bool
 	totalDistance  float64
 	temperature    float64
 }
 
-func newSolution(shoppersCount int) *solution {
+func newSolution(shoppersCount int, ordersCount int) *solution {
 	routes := make([][]int, shoppersCount)
 	routeDistances := make([]float64, shoppersCount)
 	return &solution{
 		routes:         routes,
 		routeDistances: routeDistances,
+		owners:         newOwnerTable(ordersCount),
+		shared:         make([]bool, shoppersCount),
+		isDirty:        make([]bool, shoppersCount),
 		totalDistance:  0,
 		temperature:    1.0,
 	}
 }
 
+// clone returns a copy that shares route and owner storage with s, costing
+// O(shoppers + orders/ownerPageSize). Cloning also marks all of s's storage
+// shared, so s copies a route or owner page before its own next write to
+// it; s must therefore not be cloned while another goroutine uses it.
 func (s *solution) clone() *solution {
 	copyRoutes := make([][]int, len(s.routes))
-	for i, route := range s.routes {
-		if len(route) == 0 {
-			continue
-		}
-		cp := make([]int, len(route))
-		copy(cp, route)
-		copyRoutes[i] = cp
+	copy(copyRoutes, s.routes)
+	shared := make([]bool, len(s.routes))
+	for i := range shared {
+		shared[i] = true
+		s.shared[i] = true
 	}
 	copyDistances := make([]float64, len(s.routeDistances))
 	copy(copyDistances, s.routeDistances)
 	return &solution{
 		routes:         copyRoutes,
 		routeDistances: copyDistances,
+		owners:         s.owners.clone(),
+		shared:         shared,
+		isDirty:        make([]bool, len(s.routes)),
 		totalDistance:  s.totalDistance,
 		temperature:    s.temperature,
 	}
 }
 
+// mutableRoute returns a route that is safe to modify in place, copying it
+// first if it is still shared, and marks it as changed.
+func (s *solution) mutableRoute(shopperIdx int) []int {
+	if s.shared[shopperIdx] {
+		route := s.routes[shopperIdx]
+		cp := make([]int, len(route), len(route)+1)
+		copy(cp, route)
+		s.routes[shopperIdx] = cp
+		s.shared[shopperIdx] = false
+	}
+	if !s.isDirty[shopperIdx] {
+		s.isDirty[shopperIdx] = true
+		s.dirty = append(s.dirty, shopperIdx)
+	}
+	return s.routes[shopperIdx]
+}
+
+// ownerPageSize is how many orders share one copy-on-write owner page.
+const ownerPageSize = 256
+
+// ownerTable maps orders to shoppers in fixed-size pages that clones share
+// until one side writes to a page, the same copy-on-write scheme as routes.
+type ownerTable struct {
+	pages  [][]int
+	shared []bool
+	size   int
+}
+
+func newOwnerTable(size int) ownerTable {
+	count := (size + ownerPageSize - 1) / ownerPageSize
+	table := ownerTable{pages: make([][]int, count), shared: make([]bool, count), size: size}
+	for p := range table.pages {
+		page := make([]int, min(ownerPageSize, size-p*ownerPageSize))
+		for i := range page {
+			page[i] = -1
+		}
+		table.pages[p] = page
+	}
+	return table
+}
+
+func (t ownerTable) len() int { return t.size }
+
+func (t ownerTable) get(orderIdx int) int {
+	return t.pages[orderIdx/ownerPageSize][orderIdx%ownerPageSize]
+}
+
+func (t ownerTable) set(orderIdx int, shopperIdx int) {
+	p := orderIdx / ownerPageSize
+	if t.shared[p] {
+		t.pages[p] = append([]int(nil), t.pages[p]...)
+		t.shared[p] = false
+	}
+	t.pages[p][orderIdx%ownerPageSize] = shopperIdx
+}
+
+// clone shares every page with t and marks them shared on both sides.
+func (t ownerTable) clone() ownerTable {
+	pages := make([][]int, len(t.pages))
+	copy(pages, t.pages)
+	shared := make([]bool, len(t.shared))
+	for p := range shared {
+		shared[p] = true
+		t.shared[p] = true
+	}
+	return ownerTable{pages: pages, shared: shared, size: t.size}
+}
+
 func (s *solution) recomputeTotals(cache *distanceCache) {
 	total := 0.0
 	for shopperIdx := range s.routes {
@@ -54,6 +141,25 @@ func (s *solution) recomputeTotals(cache *distanceCache) {
 		total += s.routeDistances[shopperIdx]
 	}
 	s.totalDistance = total
+	s.clearDirty()
+}
+
+// updateTotals refreshes distances for the routes changed since the last
+// call and adjusts the total by their difference.
+func (s *solution) updateTotals(cache *distanceCache) {
+	for _, shopperIdx := range s.dirty {
+		updated := cache.routeDistance(shopperIdx, s.routes[shopperIdx])
+		s.totalDistance += updated - s.routeDistances[shopperIdx]
+		s.routeDistances[shopperIdx] = updated
+	}
+	s.clearDirty()
+}
+
+func (s *solution) clearDirty() {
+	for _, shopperIdx := range s.dirty {
+		s.isDirty[shopperIdx] = false
+	}
+	s.dirty = s.dirty[:0]
 }
 
 func (s *solution) orderCount() int {
@@ -81,14 +187,14 @@ func (s *solution) toAssignments(
 		assignments = append(assignments, models.Assignment{
 			ShopperID:     shoppers[shopperIdx].ID,
 			Route:         orderIDs,
-			TotalDistance: math.Round(cache.routeDistance(shopperIdx, route)*100) / 100,
+			TotalDistance: math.Round(cache.reportedDistance(shopperIdx, route)*100) / 100,
 		})
 	}
 	return assignments
 }
 
 func buildInitialSolution(cache *distanceCache, opts normalizedOptions, rng *rand.Rand) *solution {
-	result := newSolution(len(cache.shoppers))
+	result := newSolution(len(cache.shoppers), len(cache.orders))
 	orderIndices := rng.Perm(len(cache.orders))
 	rclSize := opts.rclSize
 	if rclSize < 1 {
@@ -97,50 +203,34 @@ func buildInitialSolution(cache *distanceCache, opts normalizedOptions, rng *ran
 	loads := make([]int, len(cache.shoppers))
 
 	for _, orderIdx := range orderIndices {
-		type candidate struct {
-			shopper int
-			dist    float64
-		}
-
-		candidates := make([]candidate, len(cache.shoppers))
-		for shopperIdx := range cache.shoppers {
-			candidates[shopperIdx] = candidate{
-				shopper: shopperIdx,
-				dist:    cache.shopperToOrder[shopperIdx][orderIdx],
-			}
-		}
-
-		sort.Slice(candidates, func(i, j int) bool {
-			return candidates[i].dist < candidates[j].dist
-		})
+		// Nearby shoppers are already sorted by distance; only fall back to a
+		// full scan when every one in the candidate list is full or barred.
+		nearby := cache.shopperNeighbors[orderIdx]
 
 		rclLimit := rclSize
-		if rclLimit > len(candidates) {
-			rclLimit = len(candidates)
+		if rclLimit > len(nearby) {
+			rclLimit = len(nearby)
 		}
 		selectedShopper := -1
 		for i := 0; i < rclLimit; i++ {
-			c := candidates[i]
-			if cache.hasCapacity(c.shopper, loads[c.shopper]) {
-				selectedShopper = c.shopper
+			shopperIdx := int(nearby[i])
+			if cache.canServe(shopperIdx, orderIdx, loads[shopperIdx]) {
+				selectedShopper = shopperIdx
 				break
 			}
 		}
 
 		if selectedShopper == -1 {
-			for _, c := range candidates {
-				if cache.hasCapacity(c.shopper, loads[c.shopper]) {
-					selectedShopper = c.shopper
-					break
-				}
-			}
+			selectedShopper = nearestShopperWithCapacity(cache, orderIdx, loads)
 		}
 
 		if selectedShopper == -1 {
-			selectedShopper = candidates[0].shopper
+			// Everyone allowed is full; overload the nearest of them
+			selectedShopper = nearestAllowedShopper(cache, orderIdx)
 		}
 
 		result.routes[selectedShopper] = append(result.routes[selectedShopper], orderIdx)
+		result.owners.set(orderIdx, selectedShopper)
 		loads[selectedShopper]++
 	}
 
@@ -164,6 +254,43 @@ func buildInitialSolution(cache *distanceCache, opts normalizedOptions, rng *ran
 	return result
 }
 
+// nearestShopperWithCapacity scans every shopper for the closest one that can
+// still take the order, returning -1 when all are full or not allowed.
+func nearestShopperWithCapacity(cache *distanceCache, orderIdx int, loads []int) int {
+	selected := -1
+	best := math.MaxFloat64
+	for shopperIdx := range cache.shoppers {
+		if !cache.canServe(shopperIdx, orderIdx, loads[shopperIdx]) {
+			continue
+		}
+		if dist := cache.shopperDistance(shopperIdx, orderIdx); dist < best {
+			best = dist
+			selected = shopperIdx
+		}
+	}
+	return selected
+}
+
+// nearestAllowedShopper returns the closest shopper allowed to serve the
+// order regardless of load, or the closest shopper when none is allowed.
+func nearestAllowedShopper(cache *distanceCache, orderIdx int) int {
+	selected := -1
+	best := math.MaxFloat64
+	for shopperIdx := range cache.shoppers {
+		if !cache.allows(shopperIdx, orderIdx) {
+			continue
+		}
+		if dist := cache.shopperDistance(shopperIdx, orderIdx); dist < best {
+			best = dist
+			selected = shopperIdx
+		}
+	}
+	if selected == -1 {
+		return int(cache.shopperNeighbors[orderIdx][0])
+	}
+	return selected
+}
+
 func randomizedNearestNeighbor(cache *distanceCache, shopperIdx int, orders []int, rng *rand.Rand) []int {
 	remaining := make([]int, len(orders))
 	copy(remaining, orders)
@@ -180,9 +307,9 @@ func randomizedNearestNeighbor(cache *distanceCache, shopperIdx int, orders []in
 		for i, orderIdx := range remaining {
 			var dist float64
 			if currentIndex == -1 {
-				dist = cache.shopperToOrder[shopperIdx][orderIdx]
+				dist = cache.shopperDistance(shopperIdx, orderIdx)
 			} else {
-				dist = cache.orderToOrder[currentIndex][orderIdx]
+				dist = cache.orderDistance(currentIndex, orderIdx)
 			}
 			// Inject slight randomness to promote exploration.
 			dist *= 1 + rng.Float64()*0.1
@@ -203,7 +330,7 @@ func randomizedNearestNeighbor(cache *distanceCache, shopperIdx int, orders []in
 	return route
 }
 
-func runLocalSearch(base *solution, cache *distanceCache, opts normalizedOptions, rng *rand.Rand) (*solution, int) {
+func runLocalSearch(base *solution, cache *distanceCache, opts normalizedOptions, rng *rand.Rand) (*solution, int, int) {
 	best := base.clone()
 	temperature := best.temperature
 	if temperature <= 0 {
@@ -211,6 +338,7 @@ func runLocalSearch(base *solution, cache *distanceCache, opts normalizedOptions
 	}
 
 	improvements := 0
+	moves := 0
 
 	for iter := 0; iter < opts.localSearch; iter++ {
 		neighbor := best.clone()
@@ -224,7 +352,8 @@ func runLocalSearch(base *solution, cache *distanceCache, opts normalizedOptions
 		}
 		removed := neighbor.destroy(removeCount, rng)
 		neighbor.repair(removed, cache, opts, rng)
-		neighbor.recomputeTotals(cache)
+		neighbor.updateTotals(cache)
+		moves++
 
 		delta := neighbor.totalDistance - best.totalDistance
 		accept := false
@@ -251,7 +380,7 @@ func runLocalSearch(base *solution, cache *distanceCache, opts normalizedOptions
 		best.temperature = temperature
 	}
 
-	return best, improvements
+	return best, improvements, moves
 }
 
 func (s *solution) destroy(count int, rng *rand.Rand) []int {
@@ -273,53 +402,37 @@ func (s *solution) destroy(count int, rng *rand.Rand) []int {
 			continue
 		}
 		orderPos := rng.Intn(len(s.routes[shopperIdx]))
-		orderID := s.routes[shopperIdx][orderPos]
-		s.routes[shopperIdx] = append(s.routes[shopperIdx][:orderPos], s.routes[shopperIdx][orderPos+1:]...)
+		route := s.mutableRoute(shopperIdx)
+		orderID := route[orderPos]
+		s.routes[shopperIdx] = append(route[:orderPos], route[orderPos+1:]...)
+		s.owners.set(orderID, -1)
 		removed = append(removed, orderID)
 	}
 
 	return removed
 }
 
+type insertionOption struct {
+	shopper int
+	pos     int
+	delta   float64
+}
+
 func (s *solution) repair(removed []int, cache *distanceCache, opts normalizedOptions, rng *rand.Rand) {
 	if len(removed) == 0 {
 		return
 	}
 
+	seen := make(map[int64]struct{})
 	for _, orderIdx := range removed {
-		type insertionOption struct {
-			shopper int
-			pos     int
-			delta   float64
-		}
-
-		options := make([]insertionOption, 0, len(cache.shoppers)*2)
-
-		for shopperIdx := range s.routes {
-			route := s.routes[shopperIdx]
-			if !cache.hasCapacity(shopperIdx, len(route)) {
-				continue
-			}
-			if len(route) == 0 {
-				delta := cache.shopperToOrder[shopperIdx][orderIdx]
-				options = append(options, insertionOption{shopper: shopperIdx, pos: 0, delta: delta})
-				continue
-			}
-			for pos := 0; pos <= len(route); pos++ {
-				delta := insertionDelta(cache, shopperIdx, route, orderIdx, pos)
-				options = append(options, insertionOption{
-					shopper: shopperIdx,
-					pos:     pos,
-					delta:   delta,
-				})
-			}
+		options := s.granularInsertionOptions(cache, orderIdx, seen)
+		if len(options) == 0 {
+			options = s.allInsertionOptions(cache, orderIdx)
 		}
 
 		if len(options) == 0 {
-			fallbackShopper := rng.Intn(len(s.routes))
-			route := s.routes[fallbackShopper]
-			route = append(route, orderIdx)
-			s.routes[fallbackShopper] = route
+			fallbackShopper := nearestAllowedShopper(cache, orderIdx)
+			s.insertAt(fallbackShopper, len(s.routes[fallbackShopper]), orderIdx)
 			continue
 		}
 
@@ -332,84 +445,164 @@ func (s *solution) repair(removed []int, cache *distanceCache, opts normalizedOp
 			rcl = len(options)
 		}
 		choice := options[rng.Intn(rcl)]
-		route := s.routes[choice.shopper]
-		if choice.pos >= len(route) {
-			route = append(route, orderIdx)
-		} else {
-			route = append(route[:choice.pos], append([]int{orderIdx}, route[choice.pos:]...)...)
+		s.insertAt(choice.shopper, choice.pos, orderIdx)
+	}
+}
+
+// insertAt places orderIdx into a shopper's route at the given position.
+func (s *solution) insertAt(shopperIdx int, pos int, orderIdx int) {
+	route := s.mutableRoute(shopperIdx)
+	if pos >= len(route) {
+		route = append(route, orderIdx)
+	} else {
+		route = append(route, 0)
+		copy(route[pos+1:], route[pos:])
+		route[pos] = orderIdx
+	}
+	s.routes[shopperIdx] = route
+	s.owners.set(orderIdx, shopperIdx)
+}
+
+// granularInsertionOptions only evaluates positions adjacent to the order's
+// nearest assigned neighbours plus the start of its nearest shoppers' routes.
+// With complete neighbour lists this is equivalent to a full scan.
+func (s *solution) granularInsertionOptions(cache *distanceCache, orderIdx int, seen map[int64]struct{}) []insertionOption {
+	clear(seen)
+	options := make([]insertionOption, 0, len(cache.orderNeighbors[orderIdx])*2+len(cache.shopperNeighbors[orderIdx]))
+
+	add := func(shopperIdx int, pos int) {
+		key := int64(shopperIdx)<<32 | int64(pos)
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		options = append(options, insertionOption{
+			shopper: shopperIdx,
+			pos:     pos,
+			delta:   insertionDelta(cache, shopperIdx, s.routes[shopperIdx], orderIdx, pos),
+		})
+	}
+
+	for _, neighbor := range cache.orderNeighbors[orderIdx] {
+		shopperIdx := s.owners.get(int(neighbor))
+		if shopperIdx < 0 || !cache.canServe(shopperIdx, orderIdx, len(s.routes[shopperIdx])) {
+			continue
+		}
+		pos := indexOf(s.routes[shopperIdx], int(neighbor))
+		if pos < 0 {
+			continue
+		}
+		add(shopperIdx, pos)
+		add(shopperIdx, pos+1)
+	}
+
+	for _, shopper := range cache.shopperNeighbors[orderIdx] {
+		shopperIdx := int(shopper)
+		if !cache.canServe(shopperIdx, orderIdx, len(s.routes[shopperIdx])) {
+			continue
+		}
+		add(shopperIdx, 0)
+	}
+
+	return options
+}
+
+// allInsertionOptions evaluates every feasible position in every route.
+func (s *solution) allInsertionOptions(cache *distanceCache, orderIdx int) []insertionOption {
+	options := make([]insertionOption, 0, len(cache.shoppers)*2)
+	for shopperIdx := range s.routes {
+		route := s.routes[shopperIdx]
+		if !cache.canServe(shopperIdx, orderIdx, len(route)) {
+			continue
+		}
+		if len(route) == 0 {
+			delta := cache.shopperDistance(shopperIdx, orderIdx)
+			options = append(options, insertionOption{shopper: shopperIdx, pos: 0, delta: delta})
+			continue
+		}
+		for pos := 0; pos <= len(route); pos++ {
+			delta := insertionDelta(cache, shopperIdx, route, orderIdx, pos)
+			options = append(options, insertionOption{
+				shopper: shopperIdx,
+				pos:     pos,
+				delta:   delta,
+			})
+		}
+	}
+	return options
+}
+
+func indexOf(route []int, orderIdx int) int {
+	for i, idx := range route {
+		if idx == orderIdx {
+			return i
 		}
-		s.routes[choice.shopper] = route
 	}
+	return -1
 }
 
 func insertionDelta(cache *distanceCache, shopperIdx int, route []int, orderIdx int, pos int) float64 {
 	prevToOrder := 0.0
 	if pos == 0 {
-		prevToOrder = cache.shopperToOrder[shopperIdx][orderIdx]
+		prevToOrder = cache.shopperDistance(shopperIdx, orderIdx)
 	} else {
-		prevToOrder = cache.orderToOrder[route[pos-1]][orderIdx]
+		prevToOrder = cache.orderDistance(route[pos-1], orderIdx)
 	}
 
 	orderToNext := 0.0
 	if pos == len(route) {
 		orderToNext = 0
 	} else {
-		orderToNext = cache.orderToOrder[orderIdx][route[pos]]
+		orderToNext = cache.orderDistance(orderIdx, route[pos])
 	}
 
 	previousToNext := 0.0
 	if len(route) == 0 {
 		previousToNext = 0
 	} else if pos == 0 {
-		previousToNext = cache.shopperToOrder[shopperIdx][route[0]]
+		previousToNext = cache.shopperDistance(shopperIdx, route[0])
 	} else if pos == len(route) {
 		previousToNext = 0
 	} else {
-		previousToNext = cache.orderToOrder[route[pos-1]][route[pos]]
+		previousToNext = cache.orderDistance(route[pos-1], route[pos])
 	}
 
 	return prevToOrder + orderToNext - previousToNext
 }
 
 type distanceCache struct {
-	shopperToOrder  [][]float64
-	orderToOrder    [][]float64
-	orders          []models.Order
-	shoppers        []models.Shopper
-	totalOrders     int
-	capacities      []int
-	randomReference float64
+	shopperToOrder   distanceMatrix
+	orderToOrder     distanceMatrix
+	orderNeighbors   [][]int32 // nearest orders per order
+	shopperNeighbors [][]int32 // nearest shoppers per order
+	orders           []models.Order
+	shoppers         []models.Shopper
+	totalOrders      int
+	capacities       []int
+	randomReference  float64
+	costs            optimizer.Costs
 }
 
-func newDistanceCache(orders []models.Order, shoppers []models.Shopper) *distanceCache {
+func newDistanceCache(orders []models.Order, shoppers []models.Shopper, neighbors int, costs optimizer.Costs) *distanceCache {
 	orderCount := len(orders)
 	shopperCount := len(shoppers)
 
-	shopperToOrder := make([][]float64, shopperCount)
-	for i := range shopperToOrder {
-		shopperToOrder[i] = make([]float64, orderCount)
-		for j := range orders {
-			shopperToOrder[i][j] = optimizer.HaversineDistance(
-				shoppers[i].Lat, shoppers[i].Lng,
-				orders[j].Lat, orders[j].Lng,
-			)
-		}
-	}
+	shopperToOrder := newDistanceMatrix(shopperCount, orderCount, func(i, j int) float64 {
+		return costs.Cost(
+			shoppers[i].Lat, shoppers[i].Lng,
+			orders[j].Lat, orders[j].Lng,
+		)
+	})
 
-	orderToOrder := make([][]float64, orderCount)
-	for i := range orderToOrder {
-		orderToOrder[i] = make([]float64, orderCount)
-		for j := range orders {
-			if i == j {
-				orderToOrder[i][j] = 0
-			} else {
-				orderToOrder[i][j] = optimizer.HaversineDistance(
-					orders[i].Lat, orders[i].Lng,
-					orders[j].Lat, orders[j].Lng,
-				)
-			}
+	orderToOrder := newDistanceMatrix(orderCount, orderCount, func(i, j int) float64 {
+		if i == j {
+			return 0
 		}
-	}
+		return costs.Cost(
+			orders[i].Lat, orders[i].Lng,
+			orders[j].Lat, orders[j].Lng,
+		)
+	})
 
 	capacities := make([]int, shopperCount)
 	for i, shopper := range shoppers {
@@ -420,26 +613,96 @@ func newDistanceCache(orders []models.Order, shoppers []models.Shopper) *distanc
 		}
 	}
 
-	randomReference := computeBaselineDistance(orders, shoppers)
+	orderLats, orderLngs := make([]float64, orderCount), make([]float64, orderCount)
+	for i, order := range orders {
+		orderLats[i], orderLngs[i] = order.Lat, order.Lng
+	}
+	shopperLats, shopperLngs := make([]float64, shopperCount), make([]float64, shopperCount)
+	for i, shopper := range shoppers {
+		shopperLats[i], shopperLngs[i] = shopper.Lat, shopper.Lng
+	}
+	orderIndex := newSpatialIndex(orderLats, orderLngs)
+	shopperIndex := newSpatialIndex(shopperLats, shopperLngs)
+
+	randomReference := computeBaselineDistance(orders, shoppers, costs.Distance)
 
 	return &distanceCache{
-		shopperToOrder:  shopperToOrder,
-		orderToOrder:    orderToOrder,
-		orders:          orders,
-		shoppers:        shoppers,
-		totalOrders:     orderCount,
-		capacities:      capacities,
-		randomReference: randomReference,
+		shopperToOrder:   shopperToOrder,
+		orderToOrder:     orderToOrder,
+		orderNeighbors:   buildNeighborLists(orderIndex, orderLats, orderLngs, min(neighbors, orderCount-1), true),
+		shopperNeighbors: buildNeighborLists(shopperIndex, orderLats, orderLngs, min(neighbors, shopperCount), false),
+		orders:           orders,
+		shoppers:         shoppers,
+		totalOrders:      orderCount,
+		capacities:       capacities,
+		randomReference:  randomReference,
+		costs:            costs,
 	}
 }
 
+func (dc *distanceCache) orderDistance(from, to int) float64 {
+	return dc.orderToOrder.at(from, to)
+}
+
+func (dc *distanceCache) shopperDistance(shopperIdx, orderIdx int) float64 {
+	return dc.shopperToOrder.at(shopperIdx, orderIdx)
+}
+
 func (dc *distanceCache) routeDistance(shopperIdx int, route []int) float64 {
 	if len(route) == 0 {
 		return 0
 	}
-	total := dc.shopperToOrder[shopperIdx][route[0]]
+	if dc.costs.Traffic != nil {
+		return dc.timedRouteDuration(shopperIdx, route)
+	}
+	total := dc.shopperDistance(shopperIdx, route[0])
 	for i := 0; i < len(route)-1; i++ {
-		total += dc.orderToOrder[route[i]][route[i+1]]
+		total += dc.orderDistance(route[i], route[i+1])
+	}
+	return total
+}
+
+// timedRouteDuration is the driving time of a route in minutes when it
+// leaves at the cost's departure time. The cache holds free-flow durations;
+// each leg is stretched by the traffic at the moment the shopper starts it,
+// after the deliveries before it. Insertion deltas still use the free-flow
+// values as a cheap estimate, and moves are accepted on this exact cost.
+func (dc *distanceCache) timedRouteDuration(shopperIdx int, route []int) float64 {
+	traffic := dc.costs.Traffic
+	clock := dc.costs.Departure
+	shopper := dc.shoppers[shopperIdx]
+	from := routing.RoutePoint{Lat: shopper.Lat, Lng: shopper.Lng}
+	total := 0.0
+	for i, orderIdx := range route {
+		freeFlow := 0.0
+		if i == 0 {
+			freeFlow = dc.shopperDistance(shopperIdx, orderIdx)
+		} else {
+			freeFlow = dc.orderDistance(route[i-1], orderIdx)
+		}
+		order := dc.orders[orderIdx]
+		distance := dc.costs.Distance(from.Lat, from.Lng, order.Lat, order.Lng)
+		minutes := traffic.TravelTime(from, distance, freeFlow, clock)
+		total += minutes
+		clock = clock.Add(time.Duration(minutes*float64(time.Minute)) + optimizer.DeliveryTime)
+		from = routing.RoutePoint{Lat: order.Lat, Lng: order.Lng}
+	}
+	return total
+}
+
+// reportedDistance is the route length in kilometers. It equals
+// routeDistance unless the solver is minimizing duration.
+func (dc *distanceCache) reportedDistance(shopperIdx int, route []int) float64 {
+	if !dc.costs.MinimizesDuration() || len(route) == 0 {
+		return dc.routeDistance(shopperIdx, route)
+	}
+	shopper := dc.shoppers[shopperIdx]
+	lat, lng := shopper.Lat, shopper.Lng
+	total := 0.0
+	for _, orderIdx := range route {
+		order := dc.orders[orderIdx]
+		total += dc.costs.Distance(lat, lng, order.Lat, order.Lng)
+		lat, lng = order.Lat, order.Lng
 	}
 	return total
 }
@@ -449,7 +712,18 @@ func (dc *distanceCache) hasCapacity(shopperIdx int, currentLoad int) bool {
 	return capacity < 0 || currentLoad < capacity
 }
 
-func computeBaselineDistance(orders []models.Order, shoppers []models.Shopper) float64 {
+// allows reports whether the shopper may serve the order under the
+// restricted zones.
+func (dc *distanceCache) allows(shopperIdx, orderIdx int) bool {
+	return dc.costs.Restrictions.Allows(dc.shoppers[shopperIdx], dc.orders[orderIdx].ID)
+}
+
+// canServe reports whether the shopper, carrying currentLoad orders, may take the order.
+func (dc *distanceCache) canServe(shopperIdx, orderIdx, currentLoad int) bool {
+	return dc.hasCapacity(shopperIdx, currentLoad) && dc.allows(shopperIdx, orderIdx)
+}
+
+func computeBaselineDistance(orders []models.Order, shoppers []models.Shopper, distance optimizer.CostFunc) float64 {
 	if len(orders) == 0 || len(shoppers) == 0 {
 		return 0
 	}
@@ -467,11 +741,11 @@ func computeBaselineDistance(orders []models.Order, shoppers []models.Shopper) f
 		}
 
 		shopper := shoppers[shopperIdx]
-		totalDist += optimizer.HaversineDistance(shopper.Lat, shopper.Lng, order.Lat, order.Lng)
+		totalDist += distance(shopper.Lat, shopper.Lng, order.Lat, order.Lng)
 
 		if i > 0 && (i-1)/ordersPerShopper == shopperIdx {
 			prevOrder := orders[i-1]
-			totalDist += optimizer.HaversineDistance(prevOrder.Lat, prevOrder.Lng, order.Lat, order.Lng)
+			totalDist += distance(prevOrder.Lat, prevOrder.Lng, order.Lat, order.Lng)
 		}
 	}
 
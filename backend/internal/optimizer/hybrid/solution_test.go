@@ -0,0 +1,99 @@
+package hybrid
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"shipt-route-optimizer/internal/optimizer"
+)
+
+// frozen is a deep copy of a solution's routes and owners.
+type frozen struct {
+	routes [][]int
+	owners []int
+}
+
+func freeze(s *solution) frozen {
+	f := frozen{owners: make([]int, s.owners.len())}
+	for _, route := range s.routes {
+		f.routes = append(f.routes, slices.Clone(route))
+	}
+	for orderIdx := range f.owners {
+		f.owners[orderIdx] = s.owners.get(orderIdx)
+	}
+	return f
+}
+
+func (f frozen) check(t *testing.T, name string, s *solution) {
+	t.Helper()
+	for shopperIdx, route := range f.routes {
+		if !slices.Equal(s.routes[shopperIdx], route) {
+			t.Fatalf("%s: route %d changed from %v to %v", name, shopperIdx, route, s.routes[shopperIdx])
+		}
+	}
+	for orderIdx, owner := range f.owners {
+		if got := s.owners.get(orderIdx); got != owner {
+			t.Fatalf("%s: order %d owner changed from %d to %d", name, orderIdx, owner, got)
+		}
+	}
+}
+
+// checkConsistent fails unless every order is routed once by its owner and
+// the incremental totals match a full recomputation.
+func checkConsistent(t *testing.T, s *solution, cache *distanceCache) {
+	t.Helper()
+	seen := make([]bool, s.owners.len())
+	for shopperIdx, route := range s.routes {
+		for _, orderIdx := range route {
+			if seen[orderIdx] {
+				t.Fatalf("order %d routed twice", orderIdx)
+			}
+			seen[orderIdx] = true
+			if owner := s.owners.get(orderIdx); owner != shopperIdx {
+				t.Fatalf("order %d routed by %d but owned by %d", orderIdx, shopperIdx, owner)
+			}
+		}
+	}
+	total := s.totalDistance
+	s.recomputeTotals(cache)
+	if math.Abs(total-s.totalDistance) > 1e-6 {
+		t.Fatalf("incremental total %v, recomputed %v", total, s.totalDistance)
+	}
+}
+
+func TestSolutionCloneIsolation(t *testing.T) {
+	// More orders than one owner page, so pages are shared and copied apart
+	orders, shoppers := testProblem(3*ownerPageSize/2, 6, 8)
+	cache := newDistanceCache(orders, shoppers, 10, optimizer.HaversineCosts)
+	opts := normalizedOptions{rclSize: 3}
+	rng := rand.New(rand.NewSource(1))
+
+	base := newSolution(len(shoppers), len(orders))
+	for orderIdx := range orders {
+		base.insertAt(orderIdx%len(shoppers), 0, orderIdx)
+	}
+	base.recomputeTotals(cache)
+
+	move := func(s *solution) {
+		s.repair(s.destroy(20, rng), cache, opts, rng)
+		s.updateTotals(cache)
+	}
+
+	for round := 0; round < 50; round++ {
+		before := freeze(base)
+		clone := base.clone()
+		move(clone)
+		before.check(t, "source after the clone moved", base)
+		checkConsistent(t, clone, cache)
+
+		// The source writing after a clone must leave the clone alone too
+		cloned := freeze(clone)
+		move(base)
+		cloned.check(t, "clone after the source moved", clone)
+		checkConsistent(t, base, cache)
+
+		base = clone
+	}
+}
@@ -32,7 +32,112 @@ func Run(
 		return models.HybridSolveResponse{}, errors.New("no shoppers provided")
 	}
 
-	dcache := newDistanceCache(orders, shoppers)
+	start := time.Now()
+	timeline := newTimelineRecorder(opts.candidatePool, emit)
+	snapshots := newSnapshotter(opts)
+	defer snapshots.close()
+
+	// Road matrices replace haversine when real routes are requested; any
+	// failure falls back to haversine, which the response reports.
+	costs, costErr := optimizer.CostsFor(ctx, orders, shoppers, opts.routing)
+
+	var (
+		result  searchResult
+		regions int
+		err     error
+	)
+	// Regions pool shoppers by proximity alone, which could strand a
+	// restricted order in a region without a permitted shopper.
+	if opts.shouldDecompose(len(orders)) && costs.Restrictions.Empty() {
+		result, regions, err = runDecomposed(ctx, orders, shoppers, opts, costs, timeline, snapshots)
+	} else {
+		dcache := newDistanceCache(orders, shoppers, opts.neighbors, costs)
+		result, err = search(ctx, dcache, opts, snapshots, timeline.record)
+	}
+	// The timeline below must include every snapshot delivered
+	snapshots.close()
+	if err != nil {
+		return models.HybridSolveResponse{}, err
+	}
+
+	movesPerSecond := 0.0
+	if result.searchTime > 0 {
+		movesPerSecond = float64(result.moves) / result.searchTime.Seconds()
+	}
+
+	dcache := result.cache
+	assignments := result.best.toAssignments(orders, shoppers, dcache)
+	optimizer.SortAssignmentsByShopper(assignments)
+
+	totalAfter := result.best.totalDistance
+	if costs.MinimizesDuration() {
+		// The search minimized minutes; report kilometers like the other solvers
+		totalAfter = 0
+		for _, assignment := range assignments {
+			totalAfter += assignment.TotalDistance
+		}
+	}
+
+	analytics := optimizer.AnalyticsFromAssignments(
+		ctx,
+		orders,
+		shoppers,
+		assignments,
+		opts.routing,
+	)
+
+	response := models.HybridSolveResponse{
+		Optimization: models.OptimizeResponse{
+			Assignments:         assignments,
+			TotalDistanceBefore: math.Round(dcache.randomReference*100) / 100,
+			TotalDistanceAfter:  math.Round(totalAfter*100) / 100,
+			CostSource:          costs.Source,
+		},
+		Analytics: analytics,
+		Stats: models.HybridSolverStats{
+			Runtime:              time.Since(start),
+			Iterations:           opts.iterations,
+			BestIteration:        result.bestIteration,
+			Workers:              opts.workers,
+			ExploredSolutions:    result.explored,
+			AcceptedImprovements: result.improvements,
+			LocalSearchMoves:     result.moves,
+			MovesPerSecond:       math.Round(movesPerSecond),
+			DistanceMatrix:       dcache.orderToOrder.kind(),
+			Regions:              regions,
+			TimeDependent:        costs.Traffic != nil,
+		},
+		Timeline: timeline.snapshots(),
+	}
+	if costErr != nil {
+		response.Optimization.CostFallback = costErr.Error()
+	}
+
+	return response, nil
+}
+
+// searchResult is the outcome of one GRASP + ALNS search over a distance cache.
+type searchResult struct {
+	best          *solution
+	cache         *distanceCache
+	bestIteration int
+	explored      int
+	improvements  int
+	moves         int
+	searchTime    time.Duration
+}
+
+// search runs opts.iterations GRASP constructions, each followed by ALNS
+// local search, across opts.workers goroutines and returns the best solution.
+// onProgress receives throttled snapshots and every new best; those carry
+// the best plan itself when snapshots is not nil.
+func search(
+	ctx context.Context,
+	dcache *distanceCache,
+	opts normalizedOptions,
+	snapshots *snapshotter,
+	onProgress func(models.HybridProgress),
+) (searchResult, error) {
 	start := time.Now()
 
 	var (
@@ -42,25 +147,9 @@ func Run(
 		bestImprovement   int64
 		exploredSolutions atomic.Int64
 		acceptedImproves  atomic.Int64
-		timelineMu        sync.Mutex
-		timeline          []models.HybridProgress
+		localSearchMoves  atomic.Int64
 	)
 
-	appendTimeline := func(snapshot models.HybridProgress) {
-		timelineMu.Lock()
-		defer timelineMu.Unlock()
-		timeline = append(timeline, snapshot)
-		if opts.candidatePool > 0 && len(timeline) > opts.candidatePool {
-			start := len(timeline) - opts.candidatePool
-			cp := make([]models.HybridProgress, opts.candidatePool)
-			copy(cp, timeline[start:])
-			timeline = cp
-		}
-		if emit != nil {
-			emit(snapshot)
-		}
-	}
-
 	iterationCh := make(chan iterationTask)
 	var wg sync.WaitGroup
 
@@ -78,7 +167,8 @@ func Run(
 				}
 
 				initial := buildInitialSolution(dcache, opts, rng)
-				improved, improvementsMade := runLocalSearch(initial, dcache, opts, rng)
+				improved, improvementsMade, moves := runLocalSearch(initial, dcache, opts, rng)
+				localSearchMoves.Add(int64(moves))
 
 				explored := int(exploredSolutions.Add(1))
 				if improvementsMade > 0 {
@@ -92,15 +182,16 @@ func Run(
 					bestIteration = task.iteration
 					bestImprovement = acceptedImproves.Load()
 					accepted = true
+					snapshots.update(dcache, bestSolution)
 				}
 				currentBest := bestSolution.totalDistance
 				bestMu.Unlock()
 
 				now := time.Now()
 				shouldEmit := accepted || lastEmit.IsZero() || now.Sub(lastEmit) >= opts.emitInterval
-				if shouldEmit {
+				if shouldEmit && onProgress != nil {
 					lastEmit = now
-					snapshot := models.HybridProgress{
+					progress := models.HybridProgress{
 						Timestamp:           now,
 						Iteration:           task.iteration,
 						WorkerID:            id,
@@ -111,7 +202,10 @@ func Run(
 						ImprovementCount:    int(acceptedImproves.Load()),
 						Temperature:         improved.temperature,
 					}
-					appendTimeline(snapshot)
+					snapshots.deliver(now, false, func(snapshot *models.SolutionSnapshot) {
+						progress.Snapshot = snapshot
+						onProgress(progress)
+					})
 				}
 			}
 		}(workerID)
@@ -130,43 +224,79 @@ func Run(
 	wg.Wait()
 
 	if ctx.Err() != nil {
-		return models.HybridSolveResponse{}, ctx.Err()
+		return searchResult{}, ctx.Err()
 	}
 
 	if bestSolution == nil {
-		return models.HybridSolveResponse{}, errors.New("solver failed to find a solution")
+		return searchResult{}, errors.New("solver failed to find a solution")
 	}
 
-	assignments := bestSolution.toAssignments(orders, shoppers, dcache)
-	optimizer.SortAssignmentsByShopper(assignments)
+	// A throttled last improvement would otherwise never reach the client
+	snapshots.deliver(time.Now(), true, func(final *models.SolutionSnapshot) {
+		if final == nil || onProgress == nil {
+			return
+		}
+		onProgress(models.HybridProgress{
+			Timestamp:         time.Now(),
+			Iteration:         bestIteration,
+			BestDistance:      math.Round(bestSolution.totalDistance*100) / 100,
+			CandidateDistance: math.Round(bestSolution.totalDistance*100) / 100,
+			ExploredSolutions: int(exploredSolutions.Load()),
+			ImprovementCount:  int(acceptedImproves.Load()),
+			Temperature:       bestSolution.temperature,
+			Snapshot:          final,
+		})
+	})
 
-	analytics := optimizer.AnalyticsFromAssignments(
-		orders,
-		shoppers,
-		assignments,
-		opts.useRealRoutes,
-		opts.apiKey,
-	)
+	return searchResult{
+		best:          bestSolution,
+		cache:         dcache,
+		bestIteration: bestIteration,
+		explored:      int(exploredSolutions.Load()),
+		improvements:  int(bestImprovement),
+		moves:         int(localSearchMoves.Load()),
+		searchTime:    time.Since(start),
+	}, nil
+}
 
-	response := models.HybridSolveResponse{
-		Optimization: models.OptimizeResponse{
-			Assignments:         assignments,
-			TotalDistanceBefore: math.Round(dcache.randomReference*100) / 100,
-			TotalDistanceAfter:  math.Round(bestSolution.totalDistance*100) / 100,
-		},
-		Analytics: analytics,
-		Stats: models.HybridSolverStats{
-			Runtime:              time.Since(start),
-			Iterations:           opts.iterations,
-			BestIteration:        bestIteration,
-			Workers:              opts.workers,
-			ExploredSolutions:    int(exploredSolutions.Load()),
-			AcceptedImprovements: int(bestImprovement),
-		},
-		Timeline: timeline,
+// timelineRecorder keeps the most recent progress snapshots and forwards
+// each one to the caller's emit callback. Solution snapshots are only
+// streamed; the response carries the final plan instead.
+type timelineRecorder struct {
+	mu       sync.Mutex
+	limit    int
+	timeline []models.HybridProgress
+	emit     func(models.HybridProgress)
+}
+
+func newTimelineRecorder(limit int, emit func(models.HybridProgress)) *timelineRecorder {
+	return &timelineRecorder{limit: limit, emit: emit}
+}
+
+func (t *timelineRecorder) record(snapshot models.HybridProgress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stored := snapshot
+	stored.Snapshot = nil
+	t.timeline = append(t.timeline, stored)
+	if t.limit > 0 && len(t.timeline) > t.limit {
+		start := len(t.timeline) - t.limit
+		cp := make([]models.HybridProgress, t.limit)
+		copy(cp, t.timeline[start:])
+		t.timeline = cp
+	}
+	if t.emit != nil {
+		t.emit(snapshot)
 	}
+}
 
-	return response, nil
+func (t *timelineRecorder) snapshots() []models.HybridProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timeline == nil {
+		return []models.HybridProgress{}
+	}
+	return t.timeline
 }
 
 type iterationTask struct {
@@ -180,10 +310,15 @@ type normalizedOptions struct {
 	rclSize       int
 	destroyRate   float64
 	localSearch   int
+	neighbors     int
 	emitInterval  time.Duration
 	randomSeed    int64
-	useRealRoutes bool
-	apiKey        string
+	routing       models.RoutingOptions
+	decomposition string
+	regions       int
+
+	snapshots        string
+	snapshotGeometry bool
 }
 
 func normalizeOptions(req models.HybridSolveOptions) normalizedOptions {
@@ -194,10 +329,15 @@ func normalizeOptions(req models.HybridSolveOptions) normalizedOptions {
 		rclSize:       req.RandomizedListSize,
 		destroyRate:   req.DestroyRate,
 		localSearch:   req.LocalSearchIterations,
+		neighbors:     req.NeighborListSize,
 		emitInterval:  time.Duration(req.EmitIntervalMillis) * time.Millisecond,
 		randomSeed:    req.RandomSeed,
-		useRealRoutes: req.UseRealRoutes,
-		apiKey:        req.ApiKey,
+		routing:       req.RoutingOptions,
+		decomposition: req.Decomposition,
+		regions:       req.Regions,
+
+		snapshots:        req.Snapshots,
+		snapshotGeometry: req.SnapshotGeometry,
 	}
 
 	if opts.iterations <= 0 {
@@ -227,6 +367,9 @@ func normalizeOptions(req models.HybridSolveOptions) normalizedOptions {
 	if opts.localSearch <= 0 {
 		opts.localSearch = 50
 	}
+	if opts.neighbors <= 0 {
+		opts.neighbors = 20
+	}
 	if opts.emitInterval <= 0 {
 		opts.emitInterval = 250 * time.Millisecond
 	}
@@ -0,0 +1,165 @@
+package hybrid
+
+import (
+	"math"
+	"sort"
+)
+
+const kmPerDegreeLat = 111.32
+
+// spatialIndex is a uniform grid over points projected onto a local
+// equirectangular plane. It answers k-nearest-neighbour queries without
+// touching every point, which keeps neighbour list construction close to
+// linear for metro-sized instances.
+type spatialIndex struct {
+	kmPerDegreeLng float64
+	cellSize       float64
+	minX, minY     float64
+	cols, rows     int
+	cells          [][]int32
+	xs, ys         []float64
+}
+
+// spatialNeighbor is a point returned from a nearest-neighbour query together
+// with its planar distance (km) to the query location.
+type spatialNeighbor struct {
+	index int
+	dist  float64
+}
+
+func newSpatialIndex(lats, lngs []float64) *spatialIndex {
+	count := len(lats)
+	idx := &spatialIndex{
+		kmPerDegreeLng: kmPerDegreeLat * math.Cos(meanLatitude(lats)*math.Pi/180),
+		xs:             make([]float64, count),
+		ys:             make([]float64, count),
+	}
+	if count == 0 {
+		idx.cellSize = 1
+		idx.cols, idx.rows = 1, 1
+		idx.cells = make([][]int32, 1)
+		return idx
+	}
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i := range lats {
+		x, y := idx.project(lats[i], lngs[i])
+		idx.xs[i], idx.ys[i] = x, y
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+
+	// Aim for roughly two points per cell.
+	width := math.Max(maxX-minX, 1e-6)
+	height := math.Max(maxY-minY, 1e-6)
+	cellSize := math.Sqrt(width * height / math.Max(float64(count)/2, 1))
+	if cellSize <= 0 || math.IsNaN(cellSize) {
+		cellSize = 1
+	}
+	cols := int(width/cellSize) + 1
+	rows := int(height/cellSize) + 1
+
+	idx.cellSize = cellSize
+	idx.minX, idx.minY = minX, minY
+	idx.cols, idx.rows = cols, rows
+	idx.cells = make([][]int32, cols*rows)
+	for i := range lats {
+		cx, cy := idx.cellOf(idx.xs[i], idx.ys[i])
+		cell := cy*cols + cx
+		idx.cells[cell] = append(idx.cells[cell], int32(i))
+	}
+	return idx
+}
+
+func meanLatitude(lats []float64) float64 {
+	if len(lats) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, lat := range lats {
+		total += lat
+	}
+	return total / float64(len(lats))
+}
+
+func (si *spatialIndex) project(lat, lng float64) (float64, float64) {
+	return lng * si.kmPerDegreeLng, lat * kmPerDegreeLat
+}
+
+// cellOf returns the (unclamped) grid cell containing a projected point.
+func (si *spatialIndex) cellOf(x, y float64) (int, int) {
+	return int(math.Floor((x - si.minX) / si.cellSize)), int(math.Floor((y - si.minY) / si.cellSize))
+}
+
+// nearest returns up to k indexed points closest to (lat, lng), sorted by
+// distance. The point at index exclude is skipped; pass -1 to keep all.
+func (si *spatialIndex) nearest(lat, lng float64, k int, exclude int) []spatialNeighbor {
+	if k <= 0 || len(si.xs) == 0 {
+		return nil
+	}
+	qx, qy := si.project(lat, lng)
+	// Searching from the nearest cell of the grid keeps queries outside it
+	// from walking empty rings; cells more than ring away are still at least
+	// ring*cellSize from the query.
+	cx, cy := si.cellOf(qx, qy)
+	cx, cy = min(max(cx, 0), si.cols-1), min(max(cy, 0), si.rows-1)
+
+	// The furthest ring that can still intersect the grid.
+	maxRing := max(cx, si.cols-1-cx, cy, si.rows-1-cy)
+
+	found := make([]spatialNeighbor, 0, k*2)
+	for ring := 0; ring <= maxRing; ring++ {
+		for y := max(cy-ring, 0); y <= min(cy+ring, si.rows-1); y++ {
+			onEdgeRow := y == cy-ring || y == cy+ring
+			for x := max(cx-ring, 0); x <= min(cx+ring, si.cols-1); x++ {
+				if !onEdgeRow && x != cx-ring && x != cx+ring {
+					continue
+				}
+				for _, pointIdx := range si.cells[y*si.cols+x] {
+					p := int(pointIdx)
+					if p == exclude {
+						continue
+					}
+					dx, dy := si.xs[p]-qx, si.ys[p]-qy
+					found = append(found, spatialNeighbor{index: p, dist: math.Sqrt(dx*dx + dy*dy)})
+				}
+			}
+		}
+
+		// Anything outside the rings searched so far is at least ring*cellSize away.
+		if len(found) >= k {
+			sort.Slice(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+			found = found[:k]
+			if found[k-1].dist <= float64(ring)*si.cellSize {
+				break
+			}
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+	if len(found) > k {
+		found = found[:k]
+	}
+	return found
+}
+
+// buildNeighborLists returns, for every query point, the indices of the k
+// nearest indexed points. When selfIndexed is set the query and indexed sets
+// are the same and each point is excluded from its own list.
+func buildNeighborLists(index *spatialIndex, lats, lngs []float64, k int, selfIndexed bool) [][]int32 {
+	lists := make([][]int32, len(lats))
+	for i := range lats {
+		exclude := -1
+		if selfIndexed {
+			exclude = i
+		}
+		nearest := index.nearest(lats[i], lngs[i], k, exclude)
+		list := make([]int32, len(nearest))
+		for j, n := range nearest {
+			list[j] = int32(n.index)
+		}
+		lists[i] = list
+	}
+	return lists
+}
@@ -0,0 +1,68 @@
+package hybrid
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// bruteNearest is nearest by scanning every point.
+func bruteNearest(si *spatialIndex, lat, lng float64, k, exclude int) []spatialNeighbor {
+	qx, qy := si.project(lat, lng)
+	all := []spatialNeighbor{}
+	for p := range si.xs {
+		if p != exclude {
+			all = append(all, spatialNeighbor{index: p, dist: math.Hypot(si.xs[p]-qx, si.ys[p]-qy)})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].dist < all[j].dist })
+	return all[:min(k, len(all))]
+}
+
+func TestSpatialIndexNearest(t *testing.T) {
+	tests := []struct {
+		name   string
+		points int
+		spread float64 // degrees
+		query  float64 // degrees from the points' corner
+	}{
+		{"metro", 500, 0.3, 0.15},
+		{"clustered", 200, 0.001, 0.0005},
+		{"query outside", 100, 0.1, 2},
+		{"one point", 1, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(5))
+			lats, lngs := make([]float64, tt.points), make([]float64, tt.points)
+			for i := range lats {
+				lats[i] = 33.4 + rng.Float64()*tt.spread
+				lngs[i] = -86.9 + rng.Float64()*tt.spread
+			}
+			index := newSpatialIndex(lats, lngs)
+
+			for q := 0; q < 50; q++ {
+				lat := 33.4 + rng.Float64()*tt.query
+				lng := -86.9 - rng.Float64()*tt.query
+				exclude := -1
+				if q%2 == 1 {
+					exclude = rng.Intn(tt.points)
+				}
+				for _, k := range []int{1, 8, tt.points + 1} {
+					got := index.nearest(lat, lng, k, exclude)
+					want := bruteNearest(index, lat, lng, k, exclude)
+					if len(got) != len(want) {
+						t.Fatalf("query %d, k=%d: %d neighbours, want %d", q, k, len(got), len(want))
+					}
+					for i := range want {
+						// Equidistant points may come in either order
+						if math.Abs(got[i].dist-want[i].dist) > 1e-9 {
+							t.Fatalf("query %d, k=%d: neighbour %d at %v km, want %v km", q, k, i, got[i].dist, want[i].dist)
+						}
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package optimizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/routing"
+)
+
+// ErrShopperNotFound is returned when a plan has no shopper with the requested ID.
+var ErrShopperNotFound = errors.New("shopper not found in plan")
+
+// BuildItinerary fetches the road route through a shopper's stops in plan
+// and returns it as turn-by-turn directions, timed from the requested
+// departure. Legs the provider cannot route are straight lines with a single
+// instruction to drive to the stop. The request's avoid areas replace the
+// plan's when it has any.
+func BuildItinerary(ctx context.Context, plan models.Plan, shopperID string, routingOpts models.RoutingOptions) (*models.Itinerary, error) {
+	var shopper *models.Shopper
+	for i := range plan.Shoppers {
+		if plan.Shoppers[i].ID == shopperID {
+			shopper = &plan.Shoppers[i]
+			break
+		}
+	}
+	if shopper == nil {
+		return nil, ErrShopperNotFound
+	}
+	departure, err := DepartureTime(routingOpts)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := routing.ProviderFor(routingOpts.Provider, routingOpts.ApiKey)
+	if err != nil {
+		return nil, err
+	}
+	areas := routingOpts.AvoidAreas
+	if len(areas) == 0 {
+		areas = plan.AvoidAreas
+	}
+	provider = routing.Avoiding(provider, avoidAreas(areas))
+
+	orderMap := make(map[string]models.Order)
+	for _, order := range plan.Orders {
+		orderMap[order.ID] = order
+	}
+	var route []string
+	for _, assignment := range plan.Assignments {
+		if assignment.ShopperID == shopperID {
+			route = assignment.Route
+			break
+		}
+	}
+
+	waypoints := []routing.RoutePoint{{Lat: shopper.Lat, Lng: shopper.Lng}}
+	for _, orderID := range route {
+		order, ok := orderMap[orderID]
+		if !ok {
+			return nil, fmt.Errorf("order %s in shopper %s's route is not in the plan", orderID, shopperID)
+		}
+		waypoints = append(waypoints, routing.RoutePoint{Lat: order.Lat, Lng: order.Lng})
+	}
+
+	itinerary := &models.Itinerary{
+		PlanID:    plan.ID,
+		ShopperID: shopperID,
+		Departure: departure,
+		Finish:    departure,
+		Legs:      []models.ItineraryLeg{},
+	}
+	if len(route) == 0 {
+		return itinerary, nil
+	}
+
+	segment := routing.GetRouteThrough(ctx, provider, waypoints)
+	legs := routeLegs(waypoints, segment)
+	stops := scheduleStops(route, orderMap, waypoints, legs, departure)
+	for l, leg := range legs {
+		itinerary.Distance += leg.Distance
+		itinerary.Duration += leg.Duration
+		itinerary.Legs = append(itinerary.Legs, models.ItineraryLeg{
+			OrderID:        route[l],
+			Lat:            waypoints[l+1].Lat,
+			Lng:            waypoints[l+1].Lng,
+			Distance:       math.Round(leg.Distance*100) / 100,
+			Duration:       math.Round(leg.Duration*10) / 10,
+			Arrival:        stops[l].Arrival,
+			ServiceStart:   stops[l].ServiceStart,
+			Departure:      stops[l].Departure,
+			Source:         leg.Source,
+			FallbackReason: leg.FallbackReason,
+			Steps:          navigationSteps(leg, route[l]),
+		})
+	}
+	itinerary.Distance = math.Round(itinerary.Distance*100) / 100
+	itinerary.Duration = math.Round(itinerary.Duration*10) / 10
+	itinerary.Finish = stops[len(stops)-1].Departure
+	return itinerary, nil
+}
+
+// navigationSteps converts a leg's provider steps, or describes the whole
+// leg as one drive when the provider reported none.
+func navigationSteps(leg routing.RouteLeg, orderID string) []models.NavigationStep {
+	if len(leg.Steps) == 0 {
+		return []models.NavigationStep{
+			{
+				Instruction: fmt.Sprintf("Drive %.1f km to order %s", leg.Distance, orderID),
+				Distance:    math.Round(leg.Distance*100) / 100,
+				Duration:    math.Round(leg.Duration*10) / 10,
+				Maneuver:    routing.ManeuverDepart,
+			},
+			{Instruction: "Arrive at order " + orderID, Maneuver: routing.ManeuverArrive},
+		}
+	}
+	steps := make([]models.NavigationStep, len(leg.Steps))
+	for i, step := range leg.Steps {
+		steps[i] = models.NavigationStep{
+			Instruction: step.Instruction,
+			Street:      step.Street,
+			Distance:    math.Round(step.Distance*100) / 100,
+			Duration:    math.Round(step.Duration*10) / 10,
+			Maneuver:    step.Maneuver,
+		}
+	}
+	return steps
+}
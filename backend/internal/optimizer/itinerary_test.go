@@ -0,0 +1,54 @@
+package optimizer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/routing"
+)
+
+func TestBuildItinerary(t *testing.T) {
+	second := models.Order{ID: "O2", Lat: 33.55, Lng: -86.77}
+	plan := models.Plan{
+		ID:          "plan-1",
+		Orders:      []models.Order{testOrder, second},
+		Shoppers:    []models.Shopper{testShopper, {ID: "S2", Lat: 33.52, Lng: -86.80, Capacity: 5}},
+		Assignments: []models.Assignment{{ShopperID: testShopper.ID, Route: []string{testOrder.ID, second.ID}}},
+	}
+	routingOpts := models.RoutingOptions{Provider: "fake"}
+
+	itinerary, err := BuildItinerary(context.Background(), plan, testShopper.ID, routingOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(itinerary.Legs) != 2 || itinerary.Legs[0].OrderID != testOrder.ID || itinerary.Legs[1].OrderID != second.ID {
+		t.Fatalf("legs %+v, want one to each order in route order", itinerary.Legs)
+	}
+	previous := itinerary.Departure
+	for i, leg := range itinerary.Legs {
+		if leg.Source != "fake" {
+			t.Errorf("leg %d source = %q, want the provider", i, leg.Source)
+		}
+		if len(leg.Steps) < 2 || leg.Steps[0].Maneuver != routing.ManeuverDepart || leg.Steps[len(leg.Steps)-1].Maneuver != routing.ManeuverArrive {
+			t.Errorf("leg %d steps %+v, want depart to arrive", i, leg.Steps)
+		}
+		if leg.Arrival.Before(previous) || leg.ServiceStart.Before(leg.Arrival) || leg.Departure.Before(leg.ServiceStart) {
+			t.Errorf("leg %d times out of order: left %s, arrival %s, service %s, departure %s",
+				i, previous, leg.Arrival, leg.ServiceStart, leg.Departure)
+		}
+		previous = leg.Departure
+	}
+	if !itinerary.Finish.Equal(previous) {
+		t.Errorf("finish %s, want the last departure %s", itinerary.Finish, previous)
+	}
+
+	idle, err := BuildItinerary(context.Background(), plan, "S2", routingOpts)
+	if err != nil || len(idle.Legs) != 0 || !idle.Finish.Equal(idle.Departure) {
+		t.Errorf("shopper without orders: %+v, %v; want no legs finishing at departure", idle, err)
+	}
+	if _, err := BuildItinerary(context.Background(), plan, "S9", routingOpts); !errors.Is(err, ErrShopperNotFound) {
+		t.Errorf("unknown shopper: err %v, want ErrShopperNotFound", err)
+	}
+}
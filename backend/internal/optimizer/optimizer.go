@@ -33,6 +33,11 @@ type OrderDistance struct {
 
 // Optimize assigns orders to shoppers using nearest-neighbor clustering
 func Optimize(orders []models.Order, shoppers []models.Shopper) ([]models.Assignment, float64, float64) {
+	return OptimizeWithCosts(orders, shoppers, EstimatedCosts())
+}
+
+// OptimizeWithCosts runs nearest-neighbor optimization against the given travel costs
+func OptimizeWithCosts(orders []models.Order, shoppers []models.Shopper, costs Costs) ([]models.Assignment, float64, float64) {
 	if len(shoppers) == 0 || len(orders) == 0 {
 		return []models.Assignment{}, 0, 0
 	}
@@ -44,7 +49,7 @@ func Optimize(orders []models.Order, shoppers []models.Shopper) ([]models.Assign
 	}
 
 	// Calculate total distance before optimization (random assignment)
-	totalDistanceBefore := calculateRandomDistance(orders, shoppers)
+	totalDistanceBefore := calculateRandomDistance(orders, shoppers, costs.Distance)
 
 	// Assign each order to nearest available shopper
 	remainingOrders := make([]models.Order, len(orders))
@@ -59,13 +64,13 @@ func Optimize(orders []models.Order, shoppers []models.Shopper) ([]models.Assign
 		minDistance := math.MaxFloat64
 
 		for _, shopper := range shoppers {
-			if len(assignments[shopper.ID]) >= shopper.Capacity {
+			if len(assignments[shopper.ID]) >= shopper.Capacity || !costs.Restrictions.Allows(shopper, order.ID) {
 				continue // Shopper at capacity
 			}
 
-			distance := HaversineDistance(
-				order.Lat, order.Lng,
+			distance := costs.Cost(
 				shopper.Lat, shopper.Lng,
+				order.Lat, order.Lng,
 			)
 
 			if distance < minDistance {
@@ -74,9 +79,9 @@ func Optimize(orders []models.Order, shoppers []models.Shopper) ([]models.Assign
 			}
 		}
 
-		// If no shopper available, assign to first shopper (overflow)
+		// If no shopper available, assign to the first allowed shopper (overflow)
 		if bestShopperID == "" {
-			bestShopperID = shoppers[0].ID
+			bestShopperID = firstAllowed(shoppers, costs.Restrictions, order.ID).ID
 		}
 
 		assignments[bestShopperID] = append(assignments[bestShopperID], order)
@@ -93,7 +98,7 @@ func Optimize(orders []models.Order, shoppers []models.Shopper) ([]models.Assign
 		}
 
 		// Sort orders by proximity for efficient routing (nearest neighbor)
-		route := optimizeShopperRoute(shopper, shopperOrders)
+		route := optimizeShopperRoute(shopper, shopperOrders, costs.Cost)
 		routeIDs := []string{}
 		routeDistance := 0.0
 
@@ -101,7 +106,7 @@ func Optimize(orders []models.Order, shoppers []models.Shopper) ([]models.Assign
 		currentLat, currentLng := shopper.Lat, shopper.Lng
 		for _, order := range route {
 			routeIDs = append(routeIDs, order.ID)
-			distance := HaversineDistance(currentLat, currentLng, order.Lat, order.Lng)
+			distance := costs.Distance(currentLat, currentLng, order.Lat, order.Lng)
 			routeDistance += distance
 			currentLat, currentLng = order.Lat, order.Lng
 		}
@@ -119,7 +124,7 @@ func Optimize(orders []models.Order, shoppers []models.Shopper) ([]models.Assign
 }
 
 // optimizeShopperRoute sorts orders by nearest neighbor from shopper location
-func optimizeShopperRoute(shopper models.Shopper, orders []models.Order) []models.Order {
+func optimizeShopperRoute(shopper models.Shopper, orders []models.Order, cost CostFunc) []models.Order {
 	if len(orders) <= 1 {
 		return orders
 	}
@@ -134,10 +139,10 @@ func optimizeShopperRoute(shopper models.Shopper, orders []models.Order) []model
 	for len(remaining) > 0 {
 		// Find nearest order
 		nearestIdx := 0
-		minDist := HaversineDistance(currentLat, currentLng, remaining[0].Lat, remaining[0].Lng)
+		minDist := cost(currentLat, currentLng, remaining[0].Lat, remaining[0].Lng)
 
 		for i := 1; i < len(remaining); i++ {
-			dist := HaversineDistance(currentLat, currentLng, remaining[i].Lat, remaining[i].Lng)
+			dist := cost(currentLat, currentLng, remaining[i].Lat, remaining[i].Lng)
 			if dist < minDist {
 				minDist = dist
 				nearestIdx = i
@@ -156,7 +161,7 @@ func optimizeShopperRoute(shopper models.Shopper, orders []models.Order) []model
 }
 
 // calculateRandomDistance simulates random assignment for comparison
-func calculateRandomDistance(orders []models.Order, shoppers []models.Shopper) float64 {
+func calculateRandomDistance(orders []models.Order, shoppers []models.Shopper, distance CostFunc) float64 {
 	if len(shoppers) == 0 || len(orders) == 0 {
 		return 0
 	}
@@ -174,13 +179,13 @@ func calculateRandomDistance(orders []models.Order, shoppers []models.Shopper) f
 		}
 
 		shopper := shoppers[shopperIdx]
-		dist := HaversineDistance(shopper.Lat, shopper.Lng, order.Lat, order.Lng)
+		dist := distance(shopper.Lat, shopper.Lng, order.Lat, order.Lng)
 		totalDist += dist
 
 		// Add distance between orders (simplified)
 		if i > 0 && (i-1)/ordersPerShopper == shopperIdx {
 			prevOrder := orders[i-1]
-			totalDist += HaversineDistance(prevOrder.Lat, prevOrder.Lng, order.Lat, order.Lng)
+			totalDist += distance(prevOrder.Lat, prevOrder.Lng, order.Lat, order.Lng)
 		}
 	}
 
@@ -1,7 +1,9 @@
 package optimizer
 
 import (
+	"context"
 	"math"
+	"math/rand"
 	"shipt-route-optimizer/internal/models"
 	"shipt-route-optimizer/internal/routing"
 	"sort"
@@ -9,36 +11,55 @@ import (
 )
 
 // OptimizeWithAnalytics performs route optimization and calculates detailed analytics
-func OptimizeWithAnalytics(orders []models.Order, shoppers []models.Shopper, useRealRoutes bool, algorithm string, apiKey string) (*models.OptimizeResponse, *models.AnalyticsResponse) {
+func OptimizeWithAnalytics(ctx context.Context, orders []models.Order, shoppers []models.Shopper, algorithm string, routingOpts models.RoutingOptions) (*models.OptimizeResponse, *models.AnalyticsResponse) {
 	var assignments []models.Assignment
 	var totalBefore, totalAfter float64
 
+	// Optimize on road costs when real routes are requested; falls back to haversine
+	costs, costErr := CostsFor(ctx, orders, shoppers, routingOpts)
+
 	// Choose algorithm
 	switch algorithm {
 	case "astar":
-		assignments, totalBefore, totalAfter = OptimizeAStar(orders, shoppers)
+		assignments, totalBefore, totalAfter = OptimizeAStarWithCosts(orders, shoppers, costs)
 	default: // "nearest-neighbor" or empty
-		assignments, totalBefore, totalAfter = Optimize(orders, shoppers)
+		assignments, totalBefore, totalAfter = OptimizeWithCosts(orders, shoppers, costs)
 	}
 
-	// Calculate analytics (pass API key)
-	analytics := calculateAnalytics(orders, shoppers, assignments, useRealRoutes, apiKey)
+	// Calculate analytics (pass routing options)
+	analytics := calculateAnalytics(ctx, orders, shoppers, assignments, routingOpts)
 
 	response := &models.OptimizeResponse{
 		Assignments:         assignments,
 		TotalDistanceBefore: totalBefore,
 		TotalDistanceAfter:  totalAfter,
+		CostSource:          costs.Source,
+	}
+	if costErr != nil {
+		response.CostFallback = costErr.Error()
 	}
 
 	return response, analytics
 }
 
 // calculateAnalytics generates comprehensive analytics
-func calculateAnalytics(orders []models.Order, shoppers []models.Shopper, assignments []models.Assignment, useRealRoutes bool, apiKey string) *models.AnalyticsResponse {
-	shopperAnalytics := calculateShopperAnalytics(orders, shoppers, assignments, useRealRoutes)
+func calculateAnalytics(ctx context.Context, orders []models.Order, shoppers []models.Shopper, assignments []models.Assignment, routingOpts models.RoutingOptions) *models.AnalyticsResponse {
+	routes := fetchRoutes(ctx, orders, shoppers, assignments, routingOpts)
+	departure := departureOrDefault(routingOpts)
+	scheduleAssignments(orders, assignments, routes, departure)
+	shopperAnalytics := calculateShopperAnalytics(shoppers, assignments, departure)
 	orderAnalytics := calculateOrderAnalytics(orders, assignments)
 	systemAnalytics := calculateSystemAnalytics(shoppers, orders, assignments, shopperAnalytics)
-	routeGeometries := calculateRouteGeometries(orders, shoppers, assignments, useRealRoutes, apiKey)
+	routeGeometries := calculateRouteGeometries(assignments, routes, routingOpts)
+
+	// Surface how much of the map is drawn from real roads
+	for _, geometry := range routeGeometries {
+		systemAnalytics.RoadLegs += geometry.RoadLegs
+		systemAnalytics.FallbackLegs += geometry.FallbackLegs
+		if geometry.FallbackLegs > 0 {
+			systemAnalytics.FallbackRoutes++
+		}
+	}
 
 	return &models.AnalyticsResponse{
 		System:          systemAnalytics,
@@ -49,22 +70,30 @@ func calculateAnalytics(orders []models.Order, shoppers []models.Shopper, assign
 }
 
 // AnalyticsFromAssignments is a helper to compute analytics for externally generated assignments.
-func AnalyticsFromAssignments(orders []models.Order, shoppers []models.Shopper, assignments []models.Assignment, useRealRoutes bool, apiKey string) *models.AnalyticsResponse {
+// Like OptimizeWithAnalytics, it fills in each assignment's Stops.
+func AnalyticsFromAssignments(ctx context.Context, orders []models.Order, shoppers []models.Shopper, assignments []models.Assignment, routingOpts models.RoutingOptions) *models.AnalyticsResponse {
 	if len(orders) == 0 || len(shoppers) == 0 {
 		return &models.AnalyticsResponse{}
 	}
-	return calculateAnalytics(orders, shoppers, assignments, useRealRoutes, apiKey)
+	return calculateAnalytics(ctx, orders, shoppers, assignments, routingOpts)
 }
 
-// calculateShopperAnalytics generates per-shopper metrics
-func calculateShopperAnalytics(orders []models.Order, shoppers []models.Shopper, assignments []models.Assignment, useRealRoutes bool) []models.ShopperAnalytics {
-	analytics := []models.ShopperAnalytics{}
-
-	// Create order map for quick lookup
+// scheduleAssignments fills in each assignment's Stops from its route's legs.
+func scheduleAssignments(orders []models.Order, assignments []models.Assignment, routes []plannedRoute, departure time.Time) {
 	orderMap := make(map[string]models.Order)
 	for _, order := range orders {
 		orderMap[order.ID] = order
 	}
+	for a := range assignments {
+		route := routes[a]
+		legs := routeLegs(route.waypoints, route.segment)
+		assignments[a].Stops = scheduleStops(assignments[a].Route, orderMap, route.waypoints, legs, departure)
+	}
+}
+
+// calculateShopperAnalytics generates per-shopper metrics from the stop schedules
+func calculateShopperAnalytics(shoppers []models.Shopper, assignments []models.Assignment, departure time.Time) []models.ShopperAnalytics {
+	analytics := []models.ShopperAnalytics{}
 
 	// Create shopper map
 	shopperMap := make(map[string]models.Shopper)
@@ -72,26 +101,34 @@ func calculateShopperAnalytics(orders []models.Order, shoppers []models.Shopper,
 		shopperMap[shopper.ID] = shopper
 	}
 
-	currentTime := time.Now()
-
 	for _, assignment := range assignments {
 		shopper := shopperMap[assignment.ShopperID]
 		ordersAssigned := len(assignment.Route)
-
-		// Calculate total distance and duration
+		// The distance driven is that of the legs the stops are timed on,
+		// which with real routes is not the solver's cost distance
 		totalDistance := assignment.TotalDistance
-		totalDuration := 0.0
-
-		if useRealRoutes {
-			// Estimate duration based on distance (avg 40 km/h)
-			totalDuration = (totalDistance / 40.0) * 60.0
-		} else {
-			// Fallback estimation
-			totalDuration = (totalDistance / 40.0) * 60.0
+		if len(assignment.Stops) > 0 {
+			totalDistance = 0
+			for _, stop := range assignment.Stops {
+				totalDistance += stop.LegDistance
+			}
+			totalDistance = math.Round(totalDistance*100) / 100
 		}
 
-		// Add time for each delivery (assume 10 min per delivery)
-		totalDuration += float64(ordersAssigned) * 10.0
+		// The day ends when the shopper leaves the last stop
+		startTime := departure
+		endTime := startTime
+		drivingTime, waitingTime, lateStops := 0.0, 0.0, 0
+		for _, stop := range assignment.Stops {
+			drivingTime += stop.LegDuration
+			waitingTime += stop.ServiceStart.Sub(stop.Arrival).Minutes()
+			if stop.Late {
+				lateStops++
+			}
+			endTime = stop.Departure
+		}
+		totalDuration := endTime.Sub(startTime).Minutes()
+		serviceTime := float64(len(assignment.Stops)) * DeliveryTime.Minutes()
 
 		// Calculate capacity utilization
 		capacityUtil := 0.0
@@ -111,10 +148,6 @@ func calculateShopperAnalytics(orders []models.Order, shoppers []models.Shopper,
 			efficiency = (float64(ordersAssigned) / totalDuration) * 60.0
 		}
 
-		// Time estimates
-		startTime := currentTime.Add(15 * time.Minute) // 15 min prep time
-		endTime := startTime.Add(time.Duration(totalDuration) * time.Minute)
-
 		analytics = append(analytics, models.ShopperAnalytics{
 			ShopperID:            assignment.ShopperID,
 			OrdersAssigned:       ordersAssigned,
@@ -125,6 +158,10 @@ func calculateShopperAnalytics(orders []models.Order, shoppers []models.Shopper,
 			EstimatedStartTime:   startTime.Format("3:04 PM"),
 			EstimatedEndTime:     endTime.Format("3:04 PM"),
 			Efficiency:           math.Round(efficiency*100) / 100,
+			DrivingTime:          math.Round(drivingTime*10) / 10,
+			ServiceTime:          serviceTime,
+			WaitingTime:          math.Round(waitingTime*10) / 10,
+			LateStops:            lateStops,
 		})
 	}
 
@@ -161,7 +198,9 @@ func calculateOrderAnalytics(orders []models.Order, assignments []models.Assignm
 
 	// Calculate average distance between orders
 	avgDistance := 0.0
-	if len(orders) > 1 {
+	if len(orders) > pairwiseAverageLimit {
+		avgDistance = sampledAverageDistance(orders, pairwiseSampleSize)
+	} else if len(orders) > 1 {
 		totalDist := 0.0
 		count := 0
 		for i := 0; i < len(orders)-1; i++ {
@@ -190,6 +229,29 @@ func calculateOrderAnalytics(orders []models.Order, assignments []models.Assignm
 	}
 }
 
+const (
+	// pairwiseAverageLimit is the largest order count for which the average
+	// inter-order distance is computed over every pair.
+	pairwiseAverageLimit = 2000
+	pairwiseSampleSize   = 200000
+)
+
+// sampledAverageDistance estimates the average inter-order distance from a
+// fixed-seed random sample of pairs so results are stable between calls.
+func sampledAverageDistance(orders []models.Order, samples int) float64 {
+	rng := rand.New(rand.NewSource(1))
+	total := 0.0
+	for n := 0; n < samples; n++ {
+		i := rng.Intn(len(orders))
+		j := rng.Intn(len(orders) - 1)
+		if j >= i {
+			j++
+		}
+		total += HaversineDistance(orders[i].Lat, orders[i].Lng, orders[j].Lat, orders[j].Lng)
+	}
+	return total / float64(samples)
+}
+
 // calculateSystemAnalytics generates system-wide metrics
 func calculateSystemAnalytics(shoppers []models.Shopper, orders []models.Order, assignments []models.Assignment, shopperAnalytics []models.ShopperAnalytics) models.SystemAnalytics {
 	totalDistance := 0.0
@@ -233,9 +295,29 @@ func calculateSystemAnalytics(shoppers []models.Shopper, orders []models.Order,
 	}
 }
 
-// calculateRouteGeometries generates actual road paths for each route
-func calculateRouteGeometries(orders []models.Order, shoppers []models.Shopper, assignments []models.Assignment, useRealRoutes bool, apiKey string) []models.RouteGeometry {
-	geometries := []models.RouteGeometry{}
+// plannedRoute is an assignment's stops in visiting order, starting at the
+// shopper, with the road route through them when real routes are requested.
+type plannedRoute struct {
+	waypoints []routing.RoutePoint
+	segment   *routing.RouteSegment
+}
+
+// fetchRoutes builds every assignment's waypoints and, with real routes or
+// avoid areas, fetches the routes through them concurrently. Without real
+// routes the avoiding provider only draws fallback legs around the areas.
+func fetchRoutes(ctx context.Context, orders []models.Order, shoppers []models.Shopper, assignments []models.Assignment, routingOpts models.RoutingOptions) []plannedRoute {
+	var provider routing.Provider
+	if routingOpts.UseRealRoutes {
+		var err error
+		provider, err = routing.ProviderFor(routingOpts.Provider, routingOpts.ApiKey)
+		if err != nil {
+			// Unknown provider - every leg falls back and reports why
+			provider = nil
+		}
+	}
+	areas := avoidAreas(routingOpts.AvoidAreas)
+	provider = routing.Avoiding(provider, areas)
+	routed := routingOpts.UseRealRoutes || len(areas) > 0
 
 	// Create order map
 	orderMap := make(map[string]models.Order)
@@ -249,35 +331,63 @@ func calculateRouteGeometries(orders []models.Order, shoppers []models.Shopper,
 		shopperMap[shopper.ID] = shopper
 	}
 
-	for _, assignment := range assignments {
+	// Build waypoints for every route first so routes can be fetched concurrently
+	routeWaypoints := make([][]routing.RoutePoint, len(assignments))
+	for a, assignment := range assignments {
 		shopper := shopperMap[assignment.ShopperID]
-		points := [][]float64{}
-
-		// Build waypoints
 		waypoints := []routing.RoutePoint{{Lat: shopper.Lat, Lng: shopper.Lng}}
 		for _, orderID := range assignment.Route {
 			order := orderMap[orderID]
 			waypoints = append(waypoints, routing.RoutePoint{Lat: order.Lat, Lng: order.Lng})
 		}
+		routeWaypoints[a] = waypoints
+	}
 
-		if useRealRoutes && len(waypoints) > 1 {
-			// Get real route (with fallback to straight lines)
-			for i := 0; i < len(waypoints)-1; i++ {
-				segment, err := routing.GetRouteWithKey(
-					waypoints[i].Lat, waypoints[i].Lng,
-					waypoints[i+1].Lat, waypoints[i+1].Lng,
-					apiKey,
-				)
+	routes := make([]plannedRoute, len(assignments))
+	var segments []*routing.RouteSegment
+	if routed {
+		// One request per route (chunked by the provider's waypoint limit);
+		// failed chunks fall back to straight legs on their own
+		segments = routing.GetRoutesThrough(ctx, provider, routeWaypoints)
+	}
+	for a, waypoints := range routeWaypoints {
+		routes[a].waypoints = waypoints
+		if routed && len(waypoints) > 1 {
+			routes[a].segment = segments[a]
+		}
+	}
+	return routes
+}
 
-				if err == nil && segment != nil {
-					// Add route geometry points
-					for _, pt := range segment.Geometry {
-						points = append(points, []float64{pt.Lat, pt.Lng})
+// calculateRouteGeometries generates actual road paths for each route,
+// simplified and encoded as the routing options ask
+func calculateRouteGeometries(assignments []models.Assignment, routes []plannedRoute, routingOpts models.RoutingOptions) []models.RouteGeometry {
+	geometries := []models.RouteGeometry{}
+
+	for a, assignment := range assignments {
+		waypoints := routes[a].waypoints
+		points := [][]float64{}
+		geometry := models.RouteGeometry{ShopperID: assignment.ShopperID}
+
+		if segment := routes[a].segment; segment != nil {
+			// Add route geometry points
+			path := simplifyRoute(segment, routingOpts)
+			if len(path) < len(segment.Geometry) {
+				geometry.SimplifiedFrom = len(segment.Geometry)
+			}
+			for _, pt := range path {
+				points = append(points, []float64{pt.Lat, pt.Lng})
+			}
+
+			for _, leg := range segment.Legs {
+				if leg.Source == routing.SourceFallback {
+					geometry.FallbackLegs++
+					if geometry.FallbackReasons == nil {
+						geometry.FallbackReasons = map[string]int{}
 					}
+					geometry.FallbackReasons[leg.FallbackReason]++
 				} else {
-					// Fallback to straight line
-					points = append(points, []float64{waypoints[i].Lat, waypoints[i].Lng})
-					points = append(points, []float64{waypoints[i+1].Lat, waypoints[i+1].Lng})
+					geometry.RoadLegs++
 				}
 			}
 		} else {
@@ -287,10 +397,8 @@ func calculateRouteGeometries(orders []models.Order, shoppers []models.Shopper,
 			}
 		}
 
-		geometries = append(geometries, models.RouteGeometry{
-			ShopperID: assignment.ShopperID,
-			Points:    points,
-		})
+		formatGeometry(&geometry, points, routingOpts.GeometryFormat)
+		geometries = append(geometries, geometry)
 	}
 
 	return geometries
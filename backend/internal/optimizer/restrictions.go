@@ -0,0 +1,105 @@
+package optimizer
+
+import (
+	"fmt"
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/routing"
+	"strings"
+)
+
+// Restrictions limit which shoppers may serve orders inside restricted
+// zones, the avoid areas that carry a permission. The zero value restricts
+// nothing.
+type Restrictions struct {
+	required map[string][]string // order ID -> permissions a shopper needs
+}
+
+// RestrictionsFor finds the orders inside avoid areas that carry a
+// permission. Areas that do not parse are skipped; requests are validated
+// before they get here.
+func RestrictionsFor(orders []models.Order, areas []models.AvoidArea) Restrictions {
+	restrictions := Restrictions{}
+	for _, area := range areas {
+		if area.Permission == "" {
+			continue
+		}
+		zone, err := routing.ParseAvoidArea(area.ID, area.Geometry)
+		if err != nil {
+			continue
+		}
+		for _, order := range orders {
+			if !zone.Contains(routing.RoutePoint{Lat: order.Lat, Lng: order.Lng}) {
+				continue
+			}
+			if restrictions.required == nil {
+				restrictions.required = make(map[string][]string)
+			}
+			restrictions.required[order.ID] = append(restrictions.required[order.ID], area.Permission)
+		}
+	}
+	return restrictions
+}
+
+// Empty reports whether no order is restricted.
+func (r Restrictions) Empty() bool {
+	return len(r.required) == 0
+}
+
+// Allows reports whether the shopper holds every permission the order needs.
+func (r Restrictions) Allows(shopper models.Shopper, orderID string) bool {
+	for _, permission := range r.required[orderID] {
+		held := false
+		for _, p := range shopper.Permissions {
+			if p == permission {
+				held = true
+				break
+			}
+		}
+		if !held {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckRestrictions reports the first restricted order that none of the
+// shoppers is allowed to serve.
+func CheckRestrictions(orders []models.Order, shoppers []models.Shopper, routingOpts models.RoutingOptions) error {
+	restrictions := RestrictionsFor(orders, routingOpts.AvoidAreas)
+	for _, order := range orders {
+		allowed := false
+		for _, shopper := range shoppers {
+			if restrictions.Allows(shopper, order.ID) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("order %s is in a restricted zone and no shopper has permission %s", order.ID, strings.Join(restrictions.required[order.ID], " and "))
+		}
+	}
+	return nil
+}
+
+// avoidAreas converts the request's avoid areas for routing, skipping any
+// that do not parse.
+func avoidAreas(areas []models.AvoidArea) []routing.AvoidArea {
+	zones := make([]routing.AvoidArea, 0, len(areas))
+	for _, area := range areas {
+		if zone, err := routing.ParseAvoidArea(area.ID, area.Geometry); err == nil {
+			zones = append(zones, zone)
+		}
+	}
+	return zones
+}
+
+// firstAllowed returns the first shopper allowed to serve the order, or the
+// first shopper when none is.
+func firstAllowed(shoppers []models.Shopper, restrictions Restrictions, orderID string) models.Shopper {
+	for _, shopper := range shoppers {
+		if restrictions.Allows(shopper, orderID) {
+			return shopper
+		}
+	}
+	return shoppers[0]
+}
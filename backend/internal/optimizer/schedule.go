@@ -0,0 +1,152 @@
+package optimizer
+
+import (
+	"fmt"
+	"math"
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/routing"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DeliveryTime is spent at every stop handing over the order.
+	DeliveryTime = 10 * time.Minute
+	// prepTime is how long after a request routes start when it names no departure.
+	prepTime = 15 * time.Minute
+)
+
+// DepartureTime returns when the request's routes start: its RFC 3339
+// departureTime, or 15 minutes from now when none is given.
+func DepartureTime(routingOpts models.RoutingOptions) (time.Time, error) {
+	if routingOpts.DepartureTime == "" {
+		return time.Now().Add(prepTime), nil
+	}
+	departure, err := time.Parse(time.RFC3339, routingOpts.DepartureTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid departureTime %q: want RFC 3339, e.g. 2024-05-01T17:00:00-05:00", routingOpts.DepartureTime)
+	}
+	return departure, nil
+}
+
+// departureOrDefault is DepartureTime for callers past request validation,
+// where a malformed time falls back to the default.
+func departureOrDefault(routingOpts models.RoutingOptions) time.Time {
+	departure, err := DepartureTime(routingOpts)
+	if err != nil {
+		return time.Now().Add(prepTime)
+	}
+	return departure
+}
+
+// routeLegs returns a route's legs: the road legs when the segment has one
+// per stop, otherwise calibrated straight-line estimates.
+func routeLegs(waypoints []routing.RoutePoint, segment *routing.RouteSegment) []routing.RouteLeg {
+	if len(waypoints) < 2 {
+		return nil
+	}
+	if segment != nil && len(segment.Legs) == len(waypoints)-1 {
+		return segment.Legs
+	}
+	estimator := routing.Estimates()
+	legs := make([]routing.RouteLeg, len(waypoints)-1)
+	for i := range legs {
+		from, to := waypoints[i], waypoints[i+1]
+		legs[i] = routing.RouteLeg{
+			Distance: estimator.Distance(from.Lat, from.Lng, to.Lat, to.Lng),
+			Duration: estimator.Duration(from.Lat, from.Lng, to.Lat, to.Lng),
+			Source:   routing.SourceFallback,
+		}
+	}
+	return legs
+}
+
+// scheduleStops plans each delivery of a route leaving at departure. Legs
+// are driven at the traffic speed of the hour they start in, service waits
+// for the order's delivery window to open, and every stop takes DeliveryTime.
+func scheduleStops(route []string, orders map[string]models.Order, waypoints []routing.RoutePoint, legs []routing.RouteLeg, departure time.Time) []models.StopSchedule {
+	traffic := routing.Traffic()
+	zone := departure.Location()
+	if traffic != nil && traffic.Location != nil {
+		zone = traffic.Location
+	}
+
+	stops := make([]models.StopSchedule, 0, len(route))
+	clock := departure
+	for i, leg := range legs {
+		if i >= len(route) {
+			break
+		}
+		arrival := traffic.Arrival(waypoints[i], leg.Distance, leg.Duration, clock).Round(time.Second)
+		stop := models.StopSchedule{
+			OrderID:      route[i],
+			Arrival:      arrival,
+			ServiceStart: arrival,
+			LegDistance:  math.Round(leg.Distance*100) / 100,
+			LegDuration:  math.Round(arrival.Sub(clock).Minutes()*10) / 10,
+		}
+		if opens, closes, ok := deliveryWindow(orders[route[i]].DeliveryWindow, arrival.In(zone)); ok {
+			if arrival.Before(opens) {
+				stop.ServiceStart = opens
+			}
+			stop.Late = arrival.After(closes)
+		}
+		stop.Departure = stop.ServiceStart.Add(DeliveryTime)
+		clock = stop.Departure
+		stops = append(stops, stop)
+	}
+	return stops
+}
+
+// deliveryWindow parses a window such as "9-11 AM" or "11 AM-1 PM" into its
+// opening and closing times on day's date, in day's location. The start
+// takes the end's AM/PM when it has none of its own.
+func deliveryWindow(window string, day time.Time) (opens, closes time.Time, ok bool) {
+	start, end, found := strings.Cut(window, "-")
+	if !found {
+		return time.Time{}, time.Time{}, false
+	}
+	endMinutes, meridiem, ok := parseClock(end, "")
+	if !ok || meridiem == "" {
+		return time.Time{}, time.Time{}, false
+	}
+	startMinutes, _, ok := parseClock(start, meridiem)
+	if !ok || startMinutes >= endMinutes {
+		return time.Time{}, time.Time{}, false
+	}
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	return midnight.Add(time.Duration(startMinutes) * time.Minute), midnight.Add(time.Duration(endMinutes) * time.Minute), true
+}
+
+// parseClock reads "9", "9 AM" or "9:30 PM" as minutes after midnight, using
+// meridiem when the text has no AM/PM. It returns the AM/PM it applied.
+func parseClock(text, meridiem string) (int, string, bool) {
+	text = strings.ToUpper(strings.TrimSpace(text))
+	for _, suffix := range []string{"AM", "PM"} {
+		if strings.HasSuffix(text, suffix) {
+			text, meridiem = strings.TrimSpace(strings.TrimSuffix(text, suffix)), suffix
+		}
+	}
+	hourText, minuteText, hasMinutes := strings.Cut(text, ":")
+	hour, err := strconv.Atoi(hourText)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, "", false
+	}
+	minute := 0
+	if hasMinutes {
+		if minute, err = strconv.Atoi(minuteText); err != nil || minute < 0 || minute > 59 {
+			return 0, "", false
+		}
+	}
+	if meridiem != "" {
+		if hour < 1 || hour > 12 {
+			return 0, "", false
+		}
+		hour %= 12
+		if meridiem == "PM" {
+			hour += 12
+		}
+	}
+	return hour*60 + minute, meridiem, true
+}
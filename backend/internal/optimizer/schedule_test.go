@@ -0,0 +1,77 @@
+package optimizer
+
+import (
+	"testing"
+	"time"
+
+	"shipt-route-optimizer/internal/models"
+	"shipt-route-optimizer/internal/routing"
+)
+
+func TestDeliveryWindow(t *testing.T) {
+	day := time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC)
+	at := func(hour, minute int) time.Time { return time.Date(2024, 3, 5, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		window        string
+		opens, closes time.Time
+		ok            bool
+	}{
+		{"9-11 AM", at(9, 0), at(11, 0), true},
+		{"11 AM-1 PM", at(11, 0), at(13, 0), true},
+		{"12-2 PM", at(12, 0), at(14, 0), true},
+		{"5:30-7:15 pm", at(17, 30), at(19, 15), true},
+		{"9-11", time.Time{}, time.Time{}, false}, // no AM/PM
+		{"2-1 PM", time.Time{}, time.Time{}, false},
+		{"", time.Time{}, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		opens, closes, ok := deliveryWindow(tt.window, day)
+		if ok != tt.ok || !opens.Equal(tt.opens) || !closes.Equal(tt.closes) {
+			t.Errorf("deliveryWindow(%q) = %s, %s, %v; want %s, %s, %v", tt.window, opens, closes, ok, tt.opens, tt.closes, tt.ok)
+		}
+	}
+}
+
+func TestScheduleStops(t *testing.T) {
+	location := time.UTC
+	if traffic := routing.Traffic(); traffic != nil && traffic.Location != nil {
+		location = traffic.Location
+	}
+	// Overnight traffic runs at free flow under every profile
+	departure := time.Date(2024, 3, 5, 1, 0, 0, 0, location)
+	orders := map[string]models.Order{
+		"O1": {ID: "O1", DeliveryWindow: "1-3 AM"},
+		"O2": {ID: "O2", DeliveryWindow: "3-5 AM"},
+		"O3": {ID: "O3", DeliveryWindow: "12-1 AM"},
+	}
+	route := []string{"O1", "O2", "O3"}
+	waypoints := make([]routing.RoutePoint, 4)
+	legs := []routing.RouteLeg{{Distance: 5, Duration: 12}, {Distance: 2, Duration: 6}, {Distance: 3, Duration: 9}}
+
+	stops := scheduleStops(route, orders, waypoints, legs, departure)
+
+	if len(stops) != len(route) {
+		t.Fatalf("%d stops, want %d", len(stops), len(route))
+	}
+	at := func(hour, minute int) time.Time { return time.Date(2024, 3, 5, hour, minute, 0, 0, location) }
+	want := []struct {
+		arrival, serviceStart time.Time
+		late                  bool
+	}{
+		{at(1, 12), at(1, 12), false},
+		{at(1, 28), at(3, 0), false}, // waits for the window to open
+		{at(3, 19), at(3, 19), true},
+	}
+	for i, stop := range stops {
+		if !stop.Arrival.Equal(want[i].arrival) || !stop.ServiceStart.Equal(want[i].serviceStart) || stop.Late != want[i].late {
+			t.Errorf("stop %d: arrival %s, service %s, late %v; want %s, %s, %v",
+				i, stop.Arrival, stop.ServiceStart, stop.Late, want[i].arrival, want[i].serviceStart, want[i].late)
+		}
+		if !stop.Departure.Equal(stop.ServiceStart.Add(DeliveryTime)) {
+			t.Errorf("stop %d departs at %s, want %s after service starts", i, stop.Departure, DeliveryTime)
+		}
+		if stop.LegDuration != legs[i].Duration {
+			t.Errorf("stop %d leg took %v min, want the free-flow %v", i, stop.LegDuration, legs[i].Duration)
+		}
+	}
+}
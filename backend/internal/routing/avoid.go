@@ -0,0 +1,548 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// ErrAvoidArea is returned when a provider's route crosses an area the
+// request asked to avoid.
+var ErrAvoidArea = errors.New("routing: route crosses an avoided area")
+
+// detourClearance is how far, in meters, fallback detours keep from the
+// corners of the areas they go around.
+const detourClearance = 25.0
+
+// AvoidArea is a region routes must not pass through, such as a gated
+// neighbourhood or a closed bridge. Each polygon is an outer ring followed by
+// any holes; routes may use the holes.
+type AvoidArea struct {
+	ID       string
+	Polygons [][][]RoutePoint
+	bounds   *[4]float64 // min lat, min lng, max lat, max lng; set by ParseAvoidArea
+}
+
+// ParseAvoidArea reads a GeoJSON Polygon or MultiPolygon geometry, whose
+// positions are [lng, lat] pairs.
+func ParseAvoidArea(id string, geometry []byte) (AvoidArea, error) {
+	var raw struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal(geometry, &raw); err != nil {
+		return AvoidArea{}, fmt.Errorf("avoid area %s: geometry is not GeoJSON", id)
+	}
+
+	var polygons [][][][]float64
+	switch raw.Type {
+	case "Polygon":
+		var polygon [][][]float64
+		if err := json.Unmarshal(raw.Coordinates, &polygon); err != nil {
+			return AvoidArea{}, fmt.Errorf("avoid area %s: bad Polygon coordinates", id)
+		}
+		polygons = [][][][]float64{polygon}
+	case "MultiPolygon":
+		if err := json.Unmarshal(raw.Coordinates, &polygons); err != nil {
+			return AvoidArea{}, fmt.Errorf("avoid area %s: bad MultiPolygon coordinates", id)
+		}
+	default:
+		return AvoidArea{}, fmt.Errorf("avoid area %s: geometry type %q is not Polygon or MultiPolygon", id, raw.Type)
+	}
+
+	area := AvoidArea{ID: id}
+	for _, polygon := range polygons {
+		if len(polygon) == 0 {
+			return AvoidArea{}, fmt.Errorf("avoid area %s: polygon has no rings", id)
+		}
+		rings := make([][]RoutePoint, 0, len(polygon))
+		for _, positions := range polygon {
+			ring := make([]RoutePoint, 0, len(positions))
+			for _, position := range positions {
+				if len(position) < 2 {
+					return AvoidArea{}, fmt.Errorf("avoid area %s: position needs a longitude and latitude", id)
+				}
+				ring = append(ring, RoutePoint{Lat: position[1], Lng: position[0]})
+			}
+			// GeoJSON rings repeat their first position at the end
+			if len(ring) > 1 && ring[0] == ring[len(ring)-1] {
+				ring = ring[:len(ring)-1]
+			}
+			if len(ring) < 3 {
+				return AvoidArea{}, fmt.Errorf("avoid area %s: ring needs at least 3 distinct positions", id)
+			}
+			rings = append(rings, ring)
+		}
+		area.Polygons = append(area.Polygons, rings)
+	}
+
+	bounds := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, polygon := range area.Polygons {
+		for _, point := range polygon[0] {
+			bounds[0], bounds[1] = math.Min(bounds[0], point.Lat), math.Min(bounds[1], point.Lng)
+			bounds[2], bounds[3] = math.Max(bounds[2], point.Lat), math.Max(bounds[3], point.Lng)
+		}
+	}
+	area.bounds = &bounds
+	return area, nil
+}
+
+// Contains reports whether the point is inside the area and not in a hole.
+func (a AvoidArea) Contains(point RoutePoint) bool {
+	for _, polygon := range a.Polygons {
+		if !ringContains(polygon[0], point) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if ringContains(hole, point) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// crosses reports whether the straight segment between two points enters
+// the area. Only outer rings need checking: a segment that leaves a hole
+// for the area itself ends inside the area or crosses the outer ring.
+func (a AvoidArea) crosses(from, to RoutePoint) bool {
+	if !a.near(from, to) {
+		return false
+	}
+	if a.Contains(from) || a.Contains(to) {
+		return true
+	}
+	for _, polygon := range a.Polygons {
+		outer := polygon[0]
+		for i := range outer {
+			if segmentsIntersect(from, to, outer[i], outer[(i+1)%len(outer)]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// near reports whether the segment's bounding box meets the area's, which
+// most legs' do not. Areas built without ParseAvoidArea are always near.
+func (a AvoidArea) near(from, to RoutePoint) bool {
+	b := a.bounds
+	return b == nil || !(math.Max(from.Lat, to.Lat) < b[0] || math.Max(from.Lng, to.Lng) < b[1] ||
+		math.Min(from.Lat, to.Lat) > b[2] || math.Min(from.Lng, to.Lng) > b[3])
+}
+
+// ringContains is the even-odd rule in longitude/latitude, which is exact
+// for the straight edges drawn in that space.
+func ringContains(ring []RoutePoint, point RoutePoint) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Lat > point.Lat) != (b.Lat > point.Lat) &&
+			point.Lng < (b.Lng-a.Lng)*(point.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// segmentsIntersect reports whether segments p1-p2 and q1-q2 touch or cross.
+func segmentsIntersect(p1, p2, q1, q2 RoutePoint) bool {
+	d1 := orientation(q1, q2, p1)
+	d2 := orientation(q1, q2, p2)
+	d3 := orientation(p1, p2, q1)
+	d4 := orientation(p1, p2, q2)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+	return (d1 == 0 && onSegment(q1, q2, p1)) || (d2 == 0 && onSegment(q1, q2, p2)) ||
+		(d3 == 0 && onSegment(p1, p2, q1)) || (d4 == 0 && onSegment(p1, p2, q2))
+}
+
+func orientation(a, b, c RoutePoint) float64 {
+	return (b.Lng-a.Lng)*(c.Lat-a.Lat) - (b.Lat-a.Lat)*(c.Lng-a.Lng)
+}
+
+func onSegment(a, b, p RoutePoint) bool {
+	return math.Min(a.Lng, b.Lng) <= p.Lng && p.Lng <= math.Max(a.Lng, b.Lng) &&
+		math.Min(a.Lat, b.Lat) <= p.Lat && p.Lat <= math.Max(a.Lat, b.Lat)
+}
+
+// activeAreas drops areas that contain one of the waypoints: a stop inside
+// an area has to be reached through it.
+func activeAreas(areas []AvoidArea, waypoints []RoutePoint) []AvoidArea {
+	active := make([]AvoidArea, 0, len(areas))
+	for _, area := range areas {
+		reached := false
+		for _, waypoint := range waypoints {
+			if area.Contains(waypoint) {
+				reached = true
+				break
+			}
+		}
+		if !reached {
+			active = append(active, area)
+		}
+	}
+	return active
+}
+
+// pathCrosses reports whether any step of the path enters one of the areas.
+func pathCrosses(areas []AvoidArea, path []RoutePoint) bool {
+	for i := 0; i+1 < len(path); i++ {
+		for _, area := range areas {
+			if area.crosses(path[i], path[i+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// detour finds the shortest path from one point to another that goes around
+// the areas, turning only just outside their convex corners. It returns nil
+// when the areas leave no way through.
+func detour(areas []AvoidArea, from, to RoutePoint) []RoutePoint {
+	scale := math.Cos(from.Lat * math.Pi / 180)
+	nodes := []RoutePoint{from, to}
+	for _, area := range areas {
+		for _, polygon := range area.Polygons {
+			nodes = append(nodes, cornersAround(polygon[0], scale)...)
+		}
+	}
+	// Corners pushed into a neighbouring area are no use
+	usable := nodes[:2]
+	for _, node := range nodes[2:] {
+		inside := false
+		for _, area := range areas {
+			if area.Contains(node) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			usable = append(usable, node)
+		}
+	}
+	nodes = usable
+
+	// Dijkstra over the visibility graph; it is dense, so a plain scan for
+	// the closest unvisited node is as fast as a heap
+	dist := make([]float64, len(nodes))
+	prev := make([]int, len(nodes))
+	done := make([]bool, len(nodes))
+	for i := range dist {
+		dist[i], prev[i] = math.Inf(1), -1
+	}
+	dist[0] = 0
+	for {
+		current := -1
+		for i := range nodes {
+			if !done[i] && !math.IsInf(dist[i], 1) && (current < 0 || dist[i] < dist[current]) {
+				current = i
+			}
+		}
+		if current < 0 {
+			return nil
+		}
+		if current == 1 {
+			break
+		}
+		done[current] = true
+		for next := range nodes {
+			if done[next] || next == current {
+				continue
+			}
+			step := haversineDistance(nodes[current].Lat, nodes[current].Lng, nodes[next].Lat, nodes[next].Lng)
+			if dist[current]+step >= dist[next] || pathCrosses(areas, []RoutePoint{nodes[current], nodes[next]}) {
+				continue
+			}
+			dist[next], prev[next] = dist[current]+step, current
+		}
+	}
+
+	path := []RoutePoint{}
+	for node := 1; node >= 0; node = prev[node] {
+		path = append([]RoutePoint{nodes[node]}, path...)
+	}
+	return path
+}
+
+// cornersAround returns points just outside the ring's convex corners,
+// pushed out along each corner's bisector. Shortest paths around a polygon
+// only ever bend at convex corners.
+func cornersAround(ring []RoutePoint, scale float64) []RoutePoint {
+	const metersPerDegree = 6371000.0 * math.Pi / 180
+
+	// Work in meters so the bisector is not skewed by longitude shrinking
+	xy := make([]planar, len(ring))
+	for i, p := range ring {
+		xy[i] = planar{x: p.Lng * scale * metersPerDegree, y: p.Lat * metersPerDegree}
+	}
+	signedArea := 0.0
+	for i := range xy {
+		j := (i + 1) % len(xy)
+		signedArea += xy[i].x*xy[j].y - xy[j].x*xy[i].y
+	}
+
+	corners := []RoutePoint{}
+	for i := range xy {
+		before, at, after := xy[(i+len(xy)-1)%len(xy)], xy[i], xy[(i+1)%len(xy)]
+		turn := (at.x-before.x)*(after.y-at.y) - (at.y-before.y)*(after.x-at.x)
+		if turn == 0 || (turn > 0) != (signedArea > 0) {
+			continue // straight or reflex corner
+		}
+		inX, inY := unit(before.x-at.x, before.y-at.y)
+		outX, outY := unit(after.x-at.x, after.y-at.y)
+		dirX, dirY := unit(-(inX + outX), -(inY + outY))
+		if dirX == 0 && dirY == 0 {
+			continue
+		}
+		x := at.x + dirX*detourClearance
+		y := at.y + dirY*detourClearance
+		corners = append(corners, RoutePoint{Lat: y / metersPerDegree, Lng: x / (scale * metersPerDegree)})
+	}
+	return corners
+}
+
+func unit(x, y float64) (float64, float64) {
+	length := math.Hypot(x, y)
+	if length == 0 {
+		return 0, 0
+	}
+	return x / length, y / length
+}
+
+// areaAvoider is implemented by providers whose API can route around
+// polygons itself.
+type areaAvoider interface {
+	routeAvoiding(ctx context.Context, waypoints []RoutePoint, areas []AvoidArea) (*RouteSegment, error)
+}
+
+// fallbackRouter is implemented by providers that draw their own fallback
+// legs instead of plain straight lines.
+type fallbackRouter interface {
+	fallbackRoute(from, to RoutePoint, reason string) *RouteSegment
+}
+
+// fallbackLeg is the leg drawn between two points when the provider cannot
+// route them.
+func fallbackLeg(provider Provider, from, to RoutePoint, reason string) *RouteSegment {
+	if router, ok := provider.(fallbackRouter); ok {
+		return router.fallbackRoute(from, to, reason)
+	}
+	return getFallbackRoute(from.Lat, from.Lng, to.Lat, to.Lng, reason)
+}
+
+// errNoProvider is returned by an avoiding wrapper around no provider, so
+// every leg falls back, around the areas.
+var errNoProvider = errors.New("routing: no provider")
+
+// avoidingProvider keeps routes out of avoid areas. It asks providers that
+// support it to route around the areas, rejects any route that still
+// crosses one, and steers fallback legs and matrix cells around them.
+type avoidingProvider struct {
+	Provider
+	areas   []AvoidArea
+	detours *Detours
+}
+
+// Avoiding wraps provider so its routes stay out of the areas, except for
+// areas containing one of the route's own stops. It returns provider itself
+// when there is nothing to avoid. A nil provider is wrapped too: its routes
+// all fall back and its matrices are estimated, both going around the areas.
+func Avoiding(provider Provider, areas []AvoidArea) Provider {
+	if len(areas) == 0 {
+		return provider
+	}
+	return &avoidingProvider{Provider: provider, areas: areas, detours: NewDetours(areas)}
+}
+
+func (p *avoidingProvider) Name() string {
+	if p.Provider == nil {
+		return SourceFallback
+	}
+	return p.Provider.Name()
+}
+
+func (p *avoidingProvider) Health(ctx context.Context) error {
+	if p.Provider == nil {
+		return errNoProvider
+	}
+	return p.Provider.Health(ctx)
+}
+
+func (p *avoidingProvider) matrixLimit() int {
+	if p.Provider == nil {
+		return 0 // estimated in process
+	}
+	if limiter, ok := p.Provider.(matrixLimiter); ok {
+		return limiter.matrixLimit()
+	}
+	return defaultMatrixLimit
+}
+
+func (p *avoidingProvider) waypointLimit() int {
+	if limiter, ok := p.Provider.(waypointLimiter); ok {
+		return limiter.waypointLimit()
+	}
+	return defaultWaypointLimit
+}
+
+func (p *avoidingProvider) Route(ctx context.Context, waypoints []RoutePoint) (*RouteSegment, error) {
+	if p.Provider == nil {
+		return nil, errNoProvider
+	}
+	active := activeAreas(p.areas, waypoints)
+	if len(active) == 0 {
+		return p.Provider.Route(ctx, waypoints)
+	}
+
+	var segment *RouteSegment
+	var err error
+	if avoider, ok := p.Provider.(areaAvoider); ok {
+		segment, err = avoider.routeAvoiding(ctx, waypoints, active)
+	} else {
+		segment, err = p.Provider.Route(ctx, waypoints)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pathCrosses(active, segment.Geometry) {
+		return nil, ErrAvoidArea
+	}
+	return segment, nil
+}
+
+// Matrix charges every cell whose straight line crosses an area at least
+// the detour around it: a road matrix knows nothing of the areas, so its
+// cell may be the way through them.
+func (p *avoidingProvider) Matrix(ctx context.Context, sources, destinations []RoutePoint) (*Matrix, error) {
+	var matrix *Matrix
+	if p.Provider != nil {
+		var err error
+		if matrix, err = p.Provider.Matrix(ctx, sources, destinations); err != nil {
+			return nil, err
+		}
+	} else {
+		matrix = estimatedMatrix(sources, destinations)
+	}
+	for i, from := range sources {
+		for j, to := range destinations {
+			if detour := p.detours.Around(from, to); detour != nil {
+				matrix.Distances[i][j] = math.Max(matrix.Distances[i][j], detour.Distance)
+				matrix.Durations[i][j] = math.Max(matrix.Durations[i][j], detour.Duration)
+			}
+		}
+	}
+	return matrix, nil
+}
+
+// estimatedMatrix fills a matrix from the learned estimates.
+func estimatedMatrix(sources, destinations []RoutePoint) *Matrix {
+	estimator := Estimates()
+	matrix := &Matrix{Distances: make([][]float64, len(sources)), Durations: make([][]float64, len(sources))}
+	for i, from := range sources {
+		matrix.Distances[i] = make([]float64, len(destinations))
+		matrix.Durations[i] = make([]float64, len(destinations))
+		for j, to := range destinations {
+			matrix.Distances[i][j] = estimator.Distance(from.Lat, from.Lng, to.Lat, to.Lng)
+			matrix.Durations[i][j] = estimator.Duration(from.Lat, from.Lng, to.Lat, to.Lng)
+		}
+	}
+	return matrix
+}
+
+// fallbackRoute draws the straight line between the points, or the shortest
+// detour around the areas it would cross.
+func (p *avoidingProvider) fallbackRoute(from, to RoutePoint, reason string) *RouteSegment {
+	if detour := detourRoute(p.areas, from, to, reason); detour != nil {
+		return detour
+	}
+	return getFallbackRoute(from.Lat, from.Lng, to.Lat, to.Lng, reason)
+}
+
+// Detours finds the legs around a set of avoid areas and remembers those
+// near an area, for cost functions that ask for the same legs many times.
+type Detours struct {
+	areas []AvoidArea
+	legs  sync.Map // [4]float64 from and to → *RouteSegment, nil for a leg crossing no area
+}
+
+// NewDetours returns Detours for the areas.
+func NewDetours(areas []AvoidArea) *Detours {
+	return &Detours{areas: areas}
+}
+
+// Around returns the estimated leg around the areas between two points, or
+// nil when the straight line between them crosses none. Areas containing
+// either point are not avoided, as with Avoiding. The leg is shared; callers
+// must not modify it.
+func (d *Detours) Around(from, to RoutePoint) *RouteSegment {
+	near := false
+	for _, area := range d.areas {
+		if area.near(from, to) {
+			near = true
+			break
+		}
+	}
+	if !near {
+		return nil
+	}
+	key := [4]float64{from.Lat, from.Lng, to.Lat, to.Lng}
+	if leg, ok := d.legs.Load(key); ok {
+		return leg.(*RouteSegment)
+	}
+	leg := detourRoute(d.areas, from, to, "")
+	d.legs.Store(key, leg)
+	return leg
+}
+
+// detourRoute is the fallback leg around the areas between two points, or
+// nil when the straight line crosses none of them.
+func detourRoute(areas []AvoidArea, from, to RoutePoint, reason string) *RouteSegment {
+	if !pathCrosses(areas, []RoutePoint{from, to}) {
+		return nil
+	}
+	active := activeAreas(areas, []RoutePoint{from, to})
+	if !pathCrosses(active, []RoutePoint{from, to}) {
+		return nil
+	}
+	path := detour(active, from, to)
+	if path == nil {
+		// Boxed in: the straight line is all there is, flagged as such
+		return getFallbackRoute(from.Lat, from.Lng, to.Lat, to.Lng, ReasonAvoidArea)
+	}
+
+	estimator := Estimates()
+	segment := &RouteSegment{Geometry: path, Source: SourceFallback, FallbackReason: reason}
+	for i := 0; i+1 < len(path); i++ {
+		a, b := path[i], path[i+1]
+		segment.Distance += estimator.Distance(a.Lat, a.Lng, b.Lat, b.Lng)
+		segment.Duration += estimator.Duration(a.Lat, a.Lng, b.Lat, b.Lng)
+	}
+	return segment
+}
+
+// areasKey identifies a set of areas in cache keys.
+func areasKey(areas []AvoidArea) string {
+	var b strings.Builder
+	for _, area := range areas {
+		for _, polygon := range area.Polygons {
+			for _, ring := range polygon {
+				b.WriteString(pointsKey(ring))
+				b.WriteByte(';')
+			}
+		}
+		b.WriteByte('|')
+	}
+	return b.String()
+}
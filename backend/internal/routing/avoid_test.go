@@ -0,0 +1,90 @@
+package routing
+
+import (
+	"context"
+	"testing"
+)
+
+// testArea is a square about 2 km across between testFrom and testTo.
+var (
+	testFrom = RoutePoint{Lat: 33.50, Lng: -86.83}
+	testTo   = RoutePoint{Lat: 33.50, Lng: -86.77}
+	testSide = RoutePoint{Lat: 33.55, Lng: -86.83} // due north of testFrom, clear of the area
+)
+
+func testArea(t *testing.T) AvoidArea {
+	t.Helper()
+	area, err := ParseAvoidArea("square", []byte(`{"type":"Polygon","coordinates":[[[-86.81,33.49],[-86.79,33.49],[-86.79,33.51],[-86.81,33.51],[-86.81,33.49]]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return area
+}
+
+func TestAvoidingFallbackDetours(t *testing.T) {
+	area := testArea(t)
+	straight := Estimates().Distance(testFrom.Lat, testFrom.Lng, testTo.Lat, testTo.Lng)
+
+	// Without a provider every leg falls back, around the area
+	route := GetRouteThrough(context.Background(), Avoiding(nil, []AvoidArea{area}), []RoutePoint{testFrom, testTo, testSide})
+	if len(route.Legs) != 2 {
+		t.Fatalf("got %d legs, want 2", len(route.Legs))
+	}
+	for i, leg := range route.Legs {
+		if leg.Source != SourceFallback || leg.FallbackReason != ReasonNoProvider {
+			t.Errorf("leg %d is %s/%s, want %s/%s", i, leg.Source, leg.FallbackReason, SourceFallback, ReasonNoProvider)
+		}
+	}
+	first := route.Geometry[route.Legs[0].GeometryStart : route.Legs[0].GeometryEnd+1]
+	if len(first) < 3 {
+		t.Errorf("first leg has %d points, want a detour", len(first))
+	}
+	if pathCrosses([]AvoidArea{area}, route.Geometry) {
+		t.Error("route crosses the avoided area")
+	}
+	if route.Legs[0].Distance <= straight {
+		t.Errorf("detour is %v km, straight line %v km", route.Legs[0].Distance, straight)
+	}
+
+	// An area holding a stop has to be entered
+	inside := RoutePoint{Lat: 33.50, Lng: -86.80}
+	leg := fallbackLeg(Avoiding(nil, []AvoidArea{area}), testFrom, inside, ReasonNoProvider)
+	if len(leg.Geometry) != 2 {
+		t.Errorf("leg to a stop inside the area has %d points, want a straight line", len(leg.Geometry))
+	}
+}
+
+func TestAvoidingMatrix(t *testing.T) {
+	area := testArea(t)
+	detour := NewDetours([]AvoidArea{area}).Around(testFrom, testTo)
+	if detour == nil {
+		t.Fatal("no detour for a leg through the area")
+	}
+	sources, destinations := []RoutePoint{testFrom, testSide}, []RoutePoint{testTo, testSide}
+
+	fake := NewFakeProvider()
+	backend, _ := newStubProvider(t, "osrm", fake, nil)
+	for name, provider := range map[string]Provider{"estimated": nil, "road": backend} {
+		t.Run(name, func(t *testing.T) {
+			plain := estimatedMatrix(sources, destinations)
+			if provider != nil {
+				plain, _ = fake.Matrix(context.Background(), sources, destinations)
+			}
+
+			got, err := Avoiding(provider, []AvoidArea{area}).Matrix(context.Background(), sources, destinations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Distances[0][0] < detour.Distance || got.Durations[0][0] < detour.Duration {
+				t.Errorf("crossing cell = %v km, %v min; want at least the detour's %v km, %v min",
+					got.Distances[0][0], got.Durations[0][0], detour.Distance, detour.Duration)
+			}
+			for _, cell := range [][2]int{{0, 1}, {1, 0}, {1, 1}} {
+				i, j := cell[0], cell[1]
+				if !closeTo(got.Distances[i][j], plain.Distances[i][j]) {
+					t.Errorf("cell %d,%d = %v km, want the unchanged %v", i, j, got.Distances[i][j], plain.Distances[i][j])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,488 @@
+package routing
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCacheEntries = 50000
+	// defaultMatrixCells is about 45 MB of matrix cells, enough for the
+	// largest matrix the default request budget allows (100 OSRM tiles of
+	// 50 × 50) with room for the next one.
+	defaultMatrixCells = 300000
+	defaultCacheTTL    = 7 * 24 * time.Hour
+	// coordinatePrecision rounds cache keys to about a metre, so the same
+	// stop geocoded twice still hits the cache.
+	coordinatePrecision = 5
+)
+
+// CacheConfig configures the shared route cache.
+type CacheConfig struct {
+	Entries     int           // in-memory LRU capacity for routes and places
+	MatrixCells int           // in-memory LRU capacity for matrix cells, which are never persisted
+	TTL         time.Duration // how long routes stay valid
+	Path        string        // on-disk store; empty keeps the cache in memory only
+}
+
+// CacheStats reports how well the route cache is saving provider calls.
+type CacheStats struct {
+	Entries  int         `json:"entries"`
+	Hits     int64       `json:"hits"`
+	Misses   int64       `json:"misses"`
+	HitRate  float64     `json:"hitRate"` // percent of lookups served from cache
+	DiskPath string      `json:"diskPath,omitempty"`
+	Matrix   *CacheStats `json:"matrix,omitempty"` // the separate matrix cell cache
+}
+
+// CacheConfigFromEnv reads ROUTING_CACHE_SIZE, ROUTING_MATRIX_CACHE_SIZE,
+// ROUTING_CACHE_TTL (a Go duration such as "72h") and ROUTING_CACHE_PATH.
+// The store defaults to the user cache directory; set ROUTING_CACHE_PATH=off
+// to keep it in memory.
+func CacheConfigFromEnv() CacheConfig {
+	cfg := CacheConfig{Entries: defaultCacheEntries, MatrixCells: defaultMatrixCells, TTL: defaultCacheTTL}
+	if n, err := strconv.Atoi(os.Getenv("ROUTING_CACHE_SIZE")); err == nil && n > 0 {
+		cfg.Entries = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("ROUTING_MATRIX_CACHE_SIZE")); err == nil && n > 0 {
+		cfg.MatrixCells = n
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("ROUTING_CACHE_TTL")); err == nil && ttl > 0 {
+		cfg.TTL = ttl
+	}
+	switch path := os.Getenv("ROUTING_CACHE_PATH"); path {
+	case "off", "none":
+	case "":
+		if dir, err := os.UserCacheDir(); err == nil {
+			cfg.Path = filepath.Join(dir, "shipt-route-optimizer", "routes.jsonl")
+		}
+	default:
+		cfg.Path = path
+	}
+	return cfg
+}
+
+var (
+	sharedCacheOnce sync.Once
+	sharedCache     *routeCache
+	sharedCells     *routeCache
+)
+
+func openSharedCaches() {
+	sharedCacheOnce.Do(func() {
+		cfg := CacheConfigFromEnv()
+		sharedCache = newRouteCache(cfg)
+		// A road matrix has millions of cells; kept with the routes they
+		// would evict them and flood the store, so they stay in memory.
+		sharedCells = newRouteCache(CacheConfig{Entries: cfg.MatrixCells, TTL: cfg.TTL})
+	})
+}
+
+// defaultCache returns the process-wide route and place cache, opening it
+// on first use.
+func defaultCache() *routeCache {
+	openSharedCaches()
+	return sharedCache
+}
+
+// defaultCellCache returns the process-wide matrix cell cache.
+func defaultCellCache() *routeCache {
+	openSharedCaches()
+	return sharedCells
+}
+
+// GetCacheStats returns hit rates for the shared route cache and, under
+// Matrix, for the matrix cell cache.
+func GetCacheStats() CacheStats {
+	stats := defaultCache().stats()
+	cells := defaultCellCache().stats()
+	stats.Matrix = &cells
+	return stats
+}
+
+// cacheEntry is one cached route, matrix cell or geocoded address. It is
+// also the line format of the on-disk store.
+type cacheEntry struct {
+	Key     string         `json:"k"`
+	Route   *RouteSegment  `json:"r,omitempty"`
+	Cell    *[2]float64    `json:"c,omitempty"` // distance km, duration minutes
+	Place   *GeocodeResult `json:"g,omitempty"`
+	NoMatch bool           `json:"n,omitempty"` // the geocoder knows no place for the address
+	Expires time.Time      `json:"e"`
+}
+
+// routeCache is an LRU of cache entries, optionally written through to an
+// append-only JSON lines file so it survives restarts. The file is
+// rewritten from the LRU whenever as many lines have been appended as the
+// LRU holds, so it stays under about twice the LRU's size.
+type routeCache struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List // front is most recently used
+	capacity int
+	ttl      time.Duration
+	path     string
+	file     *os.File
+	appended int // lines written since the store was last rewritten
+	hits     atomic.Int64
+	misses   atomic.Int64
+}
+
+func newRouteCache(cfg CacheConfig) *routeCache {
+	c := &routeCache{
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		capacity: cfg.Entries,
+		ttl:      cfg.TTL,
+	}
+	if c.capacity <= 0 {
+		c.capacity = defaultCacheEntries
+	}
+	if c.ttl <= 0 {
+		c.ttl = defaultCacheTTL
+	}
+	if cfg.Path != "" {
+		// A broken store only costs us persistence, never routing.
+		if err := c.open(cfg.Path); err != nil {
+			c.path = ""
+		}
+	}
+	return c
+}
+
+// open loads unexpired entries from the store, rewrites it without stale or
+// superseded lines, and keeps it open for appends.
+func (c *routeCache) open(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	loaded := []cacheEntry{}
+	latest := map[string]int{}
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var entry cacheEntry
+			if json.Unmarshal(scanner.Bytes(), &entry) != nil || entry.Expires.Before(now) {
+				continue
+			}
+			if idx, ok := latest[entry.Key]; ok {
+				loaded[idx] = entry
+				continue
+			}
+			latest[entry.Key] = len(loaded)
+			loaded = append(loaded, entry)
+		}
+		f.Close()
+	}
+	// The most recently written entries win when the store outgrows the LRU.
+	if len(loaded) > c.capacity {
+		loaded = loaded[len(loaded)-c.capacity:]
+	}
+	for i := range loaded {
+		c.entries[loaded[i].Key] = c.order.PushFront(&loaded[i])
+	}
+
+	c.path = path
+	return c.compact()
+}
+
+// compact rewrites the store with the unexpired entries in the LRU, least
+// recently used first so they are the first dropped on the next open, and
+// reopens it for appends. The caller holds c.mu or owns c. On failure the
+// old store stays in use.
+func (c *routeCache) compact() error {
+	c.appended = 0
+	now := time.Now()
+	tmp := c.path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(out)
+	encoder := json.NewEncoder(writer)
+	for elem := c.order.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*cacheEntry)
+		if entry.Expires.Before(now) {
+			continue
+		}
+		if err := encoder.Encode(entry); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	out.Close()
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(c.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if c.file != nil {
+		c.file.Close()
+	}
+	c.file = file
+	return nil
+}
+
+func (c *routeCache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.Expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	c.hits.Add(1)
+	return entry, true
+}
+
+func (c *routeCache) put(entries ...cacheEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	expires := time.Now().Add(c.ttl)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var lines []byte
+	for i := range entries {
+		entry := entries[i]
+		entry.Expires = expires
+		if elem, ok := c.entries[entry.Key]; ok {
+			elem.Value = &entry
+			c.order.MoveToFront(elem)
+		} else {
+			c.entries[entry.Key] = c.order.PushFront(&entry)
+		}
+		if c.file != nil {
+			if line, err := json.Marshal(&entry); err == nil {
+				lines = append(append(lines, line...), '\n')
+			}
+		}
+	}
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).Key)
+	}
+	if len(lines) > 0 {
+		_, _ = c.file.Write(lines)
+		c.appended += len(entries)
+		if c.appended >= c.capacity {
+			_ = c.compact()
+		}
+	}
+}
+
+func (c *routeCache) stats() CacheStats {
+	c.mu.Lock()
+	entries := c.order.Len()
+	c.mu.Unlock()
+
+	hits, misses := c.hits.Load(), c.misses.Load()
+	rate := 0.0
+	if hits+misses > 0 {
+		rate = float64(hits) / float64(hits+misses) * 100
+	}
+	return CacheStats{
+		Entries:  entries,
+		Hits:     hits,
+		Misses:   misses,
+		HitRate:  float64(int(rate*10)) / 10,
+		DiskPath: c.path,
+	}
+}
+
+// cachedProvider answers routes and matrix cells from the caches and only
+// asks the wrapped provider for what is missing.
+type cachedProvider struct {
+	Provider
+	cache  *routeCache
+	cells  *routeCache
+	prefix string // provider, profile and endpoint, so backends never share entries
+}
+
+func withCache(provider Provider, cfg Config, cache, cells *routeCache) Provider {
+	return &cachedProvider{
+		Provider: provider,
+		cache:    cache,
+		cells:    cells,
+		prefix:   provider.Name() + "|" + cfg.Profile + "|" + cfg.BaseURL + "|",
+	}
+}
+
+func (p *cachedProvider) matrixLimit() int {
+	if limiter, ok := p.Provider.(matrixLimiter); ok {
+		return limiter.matrixLimit()
+	}
+	return defaultMatrixLimit
+}
+
+func (p *cachedProvider) waypointLimit() int {
+	if limiter, ok := p.Provider.(waypointLimiter); ok {
+		return limiter.waypointLimit()
+	}
+	return defaultWaypointLimit
+}
+
+func (p *cachedProvider) Route(ctx context.Context, waypoints []RoutePoint) (*RouteSegment, error) {
+	return p.cachedRoute(p.prefix+"route|"+pointsKey(waypoints), func() (*RouteSegment, error) {
+		return p.Provider.Route(ctx, waypoints)
+	})
+}
+
+// routeAvoiding caches routes around areas apart from plain routes. Backends
+// that cannot avoid areas get a plain route, which the caller checks.
+func (p *cachedProvider) routeAvoiding(ctx context.Context, waypoints []RoutePoint, areas []AvoidArea) (*RouteSegment, error) {
+	avoider, ok := p.Provider.(areaAvoider)
+	if !ok {
+		return p.Route(ctx, waypoints)
+	}
+	return p.cachedRoute(p.prefix+"route|"+pointsKey(waypoints)+"|avoid|"+areasKey(areas), func() (*RouteSegment, error) {
+		return avoider.routeAvoiding(ctx, waypoints, areas)
+	})
+}
+
+// cachedRoute answers from the cache entry under key, or fetches and stores it.
+func (p *cachedProvider) cachedRoute(key string, fetch func() (*RouteSegment, error)) (*RouteSegment, error) {
+	if entry, ok := p.cache.get(key); ok && entry.Route != nil {
+		route := *entry.Route
+		route.Geometry = append([]RoutePoint(nil), route.Geometry...)
+		route.Legs = append([]RouteLeg(nil), route.Legs...)
+		return &route, nil
+	}
+
+	route, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	stored := *route
+	stored.Geometry = append([]RoutePoint(nil), route.Geometry...)
+	stored.Legs = append([]RouteLeg(nil), route.Legs...)
+	p.cache.put(cacheEntry{Key: key, Route: &stored})
+	return route, nil
+}
+
+// Matrix fills cached cells first and fetches only the rows and columns
+// that still have gaps. A matrix with more cells than the cache holds would
+// evict its own first tiles while storing its last, so it skips the cache.
+func (p *cachedProvider) Matrix(ctx context.Context, sources, destinations []RoutePoint) (*Matrix, error) {
+	if matrixCells(ctx, len(sources), len(destinations)) > p.cells.capacity {
+		return p.Provider.Matrix(ctx, sources, destinations)
+	}
+
+	result := &Matrix{
+		Distances: make([][]float64, len(sources)),
+		Durations: make([][]float64, len(sources)),
+	}
+	sourceKeys := make([]string, len(sources))
+	for i, point := range sources {
+		sourceKeys[i] = pointKey(point)
+	}
+	destinationKeys := make([]string, len(destinations))
+	for j, point := range destinations {
+		destinationKeys[j] = pointKey(point)
+	}
+
+	missingRows := []int{}
+	missingCols := map[int]bool{}
+	for i := range sources {
+		result.Distances[i] = make([]float64, len(destinations))
+		result.Durations[i] = make([]float64, len(destinations))
+		rowMissing := false
+		for j := range destinations {
+			if entry, ok := p.cells.get(p.cellKey(sourceKeys[i], destinationKeys[j])); ok && entry.Cell != nil {
+				result.Distances[i][j], result.Durations[i][j] = entry.Cell[0], entry.Cell[1]
+				continue
+			}
+			rowMissing = true
+			missingCols[j] = true
+		}
+		if rowMissing {
+			missingRows = append(missingRows, i)
+		}
+	}
+	if len(missingRows) == 0 {
+		return result, nil
+	}
+
+	cols := make([]int, 0, len(missingCols))
+	for j := range destinations {
+		if missingCols[j] {
+			cols = append(cols, j)
+		}
+	}
+	fetched, err := p.Provider.Matrix(ctx, pick(sources, missingRows), pick(destinations, cols))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]cacheEntry, 0, len(missingRows)*len(cols))
+	for a, i := range missingRows {
+		for b, j := range cols {
+			dist, dur := fetched.Distances[a][b], fetched.Durations[a][b]
+			result.Distances[i][j], result.Durations[i][j] = dist, dur
+			entries = append(entries, cacheEntry{Key: p.cellKey(sourceKeys[i], destinationKeys[j]), Cell: &[2]float64{dist, dur}})
+		}
+	}
+	p.cells.put(entries...)
+	return result, nil
+}
+
+func (p *cachedProvider) cellKey(from, to string) string {
+	return p.prefix + "cell|" + from + ";" + to
+}
+
+func pointKey(point RoutePoint) string {
+	return strconv.FormatFloat(point.Lat, 'f', coordinatePrecision, 64) + "," +
+		strconv.FormatFloat(point.Lng, 'f', coordinatePrecision, 64)
+}
+
+func pointsKey(points []RoutePoint) string {
+	keys := make([]string, len(points))
+	for i, point := range points {
+		keys[i] = pointKey(point)
+	}
+	return strings.Join(keys, ";")
+}
+
+// pick returns the points at the given indices, or all of them when indices
+// is nil. Out-of-range indices are skipped.
+func pick(points []RoutePoint, indices []int) []RoutePoint {
+	if indices == nil {
+		return points
+	}
+	picked := make([]RoutePoint, 0, len(indices))
+	for _, idx := range indices {
+		if idx >= 0 && idx < len(points) {
+			picked = append(picked, points[idx])
+		}
+	}
+	return picked
+}
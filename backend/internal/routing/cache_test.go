@@ -0,0 +1,112 @@
+package routing
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// storeLines counts the entries in an on-disk cache store.
+func storeLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
+
+func TestRouteCacheCompactsStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.jsonl")
+	cache := newRouteCache(CacheConfig{Entries: 10, TTL: time.Hour, Path: path})
+
+	for i := 0; i < 100; i++ {
+		cache.put(cacheEntry{Key: "route|" + strconv.Itoa(i), Route: &RouteSegment{Distance: float64(i)}})
+		if lines := storeLines(t, path); lines >= 2*10 {
+			t.Fatalf("store has %d lines after %d puts, want under %d", lines, i+1, 2*10)
+		}
+	}
+
+	reopened := newRouteCache(CacheConfig{Entries: 10, TTL: time.Hour, Path: path})
+	for i := 90; i < 100; i++ {
+		entry, ok := reopened.get("route|" + strconv.Itoa(i))
+		if !ok || entry.Route.Distance != float64(i) {
+			t.Errorf("route %d lost across restart", i)
+		}
+	}
+	if _, ok := reopened.get("route|0"); ok {
+		t.Error("evicted route came back after restart")
+	}
+}
+
+func TestCachedMatrixKeepsCellsApart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.jsonl")
+	routes := newRouteCache(CacheConfig{Entries: 100, TTL: time.Hour, Path: path})
+	cells := newRouteCache(CacheConfig{Entries: 100, TTL: time.Hour})
+	backend, stub := newStubProvider(t, "osrm", NewFakeProvider(), nil)
+	provider := withCache(backend, Config{}, routes, cells)
+	points := waypointsAlong(5)
+
+	for i := 0; i < 2; i++ {
+		if _, err := provider.Matrix(context.Background(), points, points); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := stub.calls.Load(); got != 1 {
+		t.Errorf("made %d requests, want 1", got)
+	}
+	if stats := cells.stats(); stats.Entries != 25 || stats.Hits != 25 || stats.Misses != 25 {
+		t.Errorf("cell cache stats = %+v, want 25 entries, hits and misses", stats)
+	}
+	if stats := routes.stats(); stats.Entries != 0 || stats.Hits+stats.Misses != 0 {
+		t.Errorf("route cache stats = %+v, want it untouched", stats)
+	}
+	if lines := storeLines(t, path); lines != 0 {
+		t.Errorf("store has %d lines, want matrix cells kept out of it", lines)
+	}
+}
+
+func TestCachedMatrixSkipsMatricesLargerThanCache(t *testing.T) {
+	points := waypointsAlong(60) // 4 OSRM tiles of 50 × 50
+	tests := []struct {
+		name      string
+		capacity  int
+		wantCalls int64
+		wantCells int
+	}{
+		{"fits", 5000, 4, 3600},
+		{"too large", 3000, 8, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := newRouteCache(CacheConfig{Entries: 10, TTL: time.Hour})
+			cells := newRouteCache(CacheConfig{Entries: tt.capacity, TTL: time.Hour})
+			backend, stub := newStubProvider(t, "osrm", NewFakeProvider(), nil)
+			provider := withCache(backend, Config{}, routes, cells)
+
+			for i := 0; i < 2; i++ {
+				if _, err := BatchMatrix(context.Background(), provider, points, points); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := stub.calls.Load(); got != tt.wantCalls {
+				t.Errorf("made %d requests, want %d", got, tt.wantCalls)
+			}
+			if stats := cells.stats(); stats.Entries != tt.wantCells {
+				t.Errorf("cached %d cells, want %d", stats.Entries, tt.wantCells)
+			}
+		})
+	}
+}
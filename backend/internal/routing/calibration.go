@@ -0,0 +1,388 @@
+package routing
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Straight lines understate road distance by an amount that depends on the
+// street network, so straight-line estimates are scaled by detour factors
+// learned from the road routes providers return. Legs are binned into grid
+// zones by their midpoint; a zone's own figures are blended with the
+// all-zone ones until it has enough samples, and before anything has been
+// learned estimates stay uncorrected.
+const (
+	calibrationCellDegrees = 0.05 // zone size, about 5.5 km north-south
+	minGlobalSamples       = 20   // legs needed before any correction is applied
+	zoneSampleWeight       = 10   // samples at which a zone's own figures count half
+	minCalibrationKm       = 0.3  // shorter legs are dominated by snapping noise
+	maxDetourFactor        = 4.0  // larger ratios are ferries, closures or bad snaps
+	maxSeenLegs            = 1 << 20
+	calibrationSaveEvery   = 30 * time.Second
+	calibrationFileVersion = 1
+)
+
+// CalibrationZone is what has been learned about one grid zone.
+type CalibrationZone struct {
+	Lat          float64 `json:"lat"` // zone centre
+	Lng          float64 `json:"lng"`
+	Samples      int     `json:"samples"`
+	StraightKm   float64 `json:"straightKm"`
+	RoadKm       float64 `json:"roadKm"`
+	Minutes      float64 `json:"minutes"`
+	DetourFactor float64 `json:"detourFactor"` // road km per straight-line km, blended with the global factor
+	SpeedKmh     float64 `json:"speedKmh"`     // free-flow road speed, blended with the global speed
+}
+
+// CalibrationStats reports the learned factors for the calibration endpoint.
+type CalibrationStats struct {
+	Calibrated   bool              `json:"calibrated"` // false until enough legs have been seen
+	Samples      int               `json:"samples"`
+	DetourFactor float64           `json:"detourFactor"`
+	SpeedKmh     float64           `json:"speedKmh"`
+	Zones        []CalibrationZone `json:"zones"`
+	Path         string            `json:"path,omitempty"`
+}
+
+type zoneKey [2]int32
+
+type zoneTotals struct {
+	Samples    int     `json:"samples"`
+	StraightKm float64 `json:"straightKm"`
+	RoadKm     float64 `json:"roadKm"`
+	Minutes    float64 `json:"minutes"`
+}
+
+func (t *zoneTotals) add(o zoneTotals) {
+	t.Samples += o.Samples
+	t.StraightKm += o.StraightKm
+	t.RoadKm += o.RoadKm
+	t.Minutes += o.Minutes
+}
+
+func zoneFor(lat, lng float64) zoneKey {
+	return zoneKey{int32(math.Floor(lat / calibrationCellDegrees)), int32(math.Floor(lng / calibrationCellDegrees))}
+}
+
+func (k zoneKey) centre() (float64, float64) {
+	return (float64(k[0]) + 0.5) * calibrationCellDegrees, (float64(k[1]) + 0.5) * calibrationCellDegrees
+}
+
+// Estimator turns straight-line distances into road estimates. It is an
+// immutable snapshot, so solvers can call it from many goroutines; a nil
+// Estimator applies no correction.
+type Estimator struct {
+	detour float64
+	speed  float64
+	zones  map[zoneKey][2]float64 // detour factor, speed
+}
+
+// Calibrated reports whether the estimator corrects straight-line distances.
+func (e *Estimator) Calibrated() bool { return e != nil }
+
+func (e *Estimator) factors(fromLat, fromLng, toLat, toLng float64) (detour, speed float64) {
+	if e == nil {
+		return 1, FallbackSpeedKmh
+	}
+	if zone, ok := e.zones[zoneFor((fromLat+toLat)/2, (fromLng+toLng)/2)]; ok {
+		return zone[0], zone[1]
+	}
+	return e.detour, e.speed
+}
+
+// Distance estimates the road distance in kilometers between two points.
+func (e *Estimator) Distance(fromLat, fromLng, toLat, toLng float64) float64 {
+	detour, _ := e.factors(fromLat, fromLng, toLat, toLng)
+	return haversineDistance(fromLat, fromLng, toLat, toLng) * detour
+}
+
+// Duration estimates the free-flow driving time in minutes between two points.
+func (e *Estimator) Duration(fromLat, fromLng, toLat, toLng float64) float64 {
+	detour, speed := e.factors(fromLat, fromLng, toLat, toLng)
+	return haversineDistance(fromLat, fromLng, toLat, toLng) * detour / speed * 60.0
+}
+
+// calibration accumulates road legs per zone and publishes an Estimator
+// after every change.
+type calibration struct {
+	mu        sync.Mutex
+	zones     map[zoneKey]*zoneTotals
+	seen      map[[4]int32]struct{}
+	path      string
+	dirty     bool
+	scheduled bool // a save is pending
+	saveMu    sync.Mutex
+	estimator atomic.Pointer[Estimator]
+}
+
+// CalibrationPathFromEnv reads ROUTING_CALIBRATION_PATH. It defaults to the
+// user cache directory; "off" keeps calibration in memory only.
+func CalibrationPathFromEnv() string {
+	switch path := os.Getenv("ROUTING_CALIBRATION_PATH"); path {
+	case "off", "none":
+		return ""
+	case "":
+		if dir, err := os.UserCacheDir(); err == nil {
+			return filepath.Join(dir, "shipt-route-optimizer", "calibration.json")
+		}
+		return ""
+	default:
+		return path
+	}
+}
+
+var (
+	sharedCalibrationOnce sync.Once
+	sharedCalibration     *calibration
+)
+
+func defaultCalibration() *calibration {
+	sharedCalibrationOnce.Do(func() {
+		sharedCalibration = newCalibration(CalibrationPathFromEnv())
+	})
+	return sharedCalibration
+}
+
+// Estimates returns the current straight-line estimator, learned from every
+// road route fetched so far (including earlier runs when persisted).
+func Estimates() *Estimator {
+	return defaultCalibration().estimator.Load()
+}
+
+// CalibrationStatus returns the learned detour factors and speeds.
+func CalibrationStatus() CalibrationStats {
+	return defaultCalibration().stats()
+}
+
+func newCalibration(path string) *calibration {
+	c := &calibration{
+		zones: make(map[zoneKey]*zoneTotals),
+		seen:  make(map[[4]int32]struct{}),
+		path:  path,
+	}
+	if path != "" {
+		c.load()
+	}
+	c.publish()
+	return c
+}
+
+// observeRoute learns from the road legs of a route through waypoints. The
+// same leg is only counted once per process, however often it is fetched.
+// The fake provider's detour is whatever it was configured with, so its
+// routes teach nothing.
+func (c *calibration) observeRoute(provider string, waypoints []RoutePoint, segment *RouteSegment) {
+	if provider == "fake" || segment == nil {
+		return
+	}
+	legs := segment.Legs
+	if len(legs) == 0 && len(waypoints) == 2 {
+		legs = []RouteLeg{{Distance: segment.Distance, Duration: segment.Duration, Source: segment.Source}}
+	}
+	if len(legs) != len(waypoints)-1 {
+		return
+	}
+
+	c.mu.Lock()
+	changed := false
+	for i, leg := range legs {
+		from, to := waypoints[i], waypoints[i+1]
+		straight := haversineDistance(from.Lat, from.Lng, to.Lat, to.Lng)
+		if leg.Source == SourceFallback || straight < minCalibrationKm || leg.Duration <= 0 ||
+			leg.Distance < straight || leg.Distance > straight*maxDetourFactor {
+			continue
+		}
+		key := [4]int32{int32(math.Round(from.Lat * 1e5)), int32(math.Round(from.Lng * 1e5)), int32(math.Round(to.Lat * 1e5)), int32(math.Round(to.Lng * 1e5))}
+		if _, ok := c.seen[key]; ok {
+			continue
+		}
+		if len(c.seen) >= maxSeenLegs {
+			clear(c.seen)
+		}
+		c.seen[key] = struct{}{}
+
+		zone := zoneFor((from.Lat+to.Lat)/2, (from.Lng+to.Lng)/2)
+		totals, ok := c.zones[zone]
+		if !ok {
+			totals = &zoneTotals{}
+			c.zones[zone] = totals
+		}
+		totals.add(zoneTotals{Samples: 1, StraightKm: straight, RoadKm: leg.Distance, Minutes: leg.Duration})
+		changed = true
+	}
+	if changed {
+		c.dirty = true
+		c.publishLocked()
+		// Batch writes: everything learned in the next interval goes in one save
+		if c.path != "" && !c.scheduled {
+			c.scheduled = true
+			time.AfterFunc(calibrationSaveEvery, c.save)
+		}
+	}
+	c.mu.Unlock()
+}
+
+func (c *calibration) publish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.publishLocked()
+}
+
+// publishLocked rebuilds the estimator; callers hold c.mu.
+func (c *calibration) publishLocked() {
+	var global zoneTotals
+	for _, totals := range c.zones {
+		global.add(*totals)
+	}
+	if global.Samples < minGlobalSamples {
+		c.estimator.Store(nil)
+		return
+	}
+
+	estimator := &Estimator{
+		detour: global.RoadKm / global.StraightKm,
+		speed:  global.RoadKm / global.Minutes * 60.0,
+		zones:  make(map[zoneKey][2]float64, len(c.zones)),
+	}
+	for key, totals := range c.zones {
+		estimator.zones[key] = blendZone(*totals, estimator.detour, estimator.speed)
+	}
+	c.estimator.Store(estimator)
+}
+
+// blendZone weighs a zone's own detour factor and speed against the global
+// ones by how many samples back them.
+func blendZone(totals zoneTotals, detour, speed float64) [2]float64 {
+	weight := float64(totals.Samples) / float64(totals.Samples+zoneSampleWeight)
+	zoneDetour := totals.RoadKm / totals.StraightKm
+	zoneSpeed := totals.RoadKm / totals.Minutes * 60.0
+	return [2]float64{
+		weight*zoneDetour + (1-weight)*detour,
+		weight*zoneSpeed + (1-weight)*speed,
+	}
+}
+
+func (c *calibration) stats() CalibrationStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CalibrationStats{DetourFactor: 1, SpeedKmh: FallbackSpeedKmh, Zones: []CalibrationZone{}, Path: c.path}
+	var global zoneTotals
+	for _, totals := range c.zones {
+		global.add(*totals)
+	}
+	stats.Samples = global.Samples
+	if estimator := c.estimator.Load(); estimator != nil {
+		stats.Calibrated = true
+		stats.DetourFactor = math.Round(estimator.detour*1000) / 1000
+		stats.SpeedKmh = math.Round(estimator.speed*10) / 10
+	}
+
+	for key, totals := range c.zones {
+		lat, lng := key.centre()
+		zone := CalibrationZone{
+			Lat:        math.Round(lat*1e4) / 1e4,
+			Lng:        math.Round(lng*1e4) / 1e4,
+			Samples:    totals.Samples,
+			StraightKm: math.Round(totals.StraightKm*100) / 100,
+			RoadKm:     math.Round(totals.RoadKm*100) / 100,
+			Minutes:    math.Round(totals.Minutes*10) / 10,
+		}
+		detour, speed := 1.0, FallbackSpeedKmh
+		if estimator := c.estimator.Load(); estimator != nil {
+			factors := estimator.zones[key]
+			detour, speed = factors[0], factors[1]
+		}
+		zone.DetourFactor = math.Round(detour*1000) / 1000
+		zone.SpeedKmh = math.Round(speed*10) / 10
+		stats.Zones = append(stats.Zones, zone)
+	}
+	sort.Slice(stats.Zones, func(i, j int) bool {
+		a, b := stats.Zones[i], stats.Zones[j]
+		if a.Samples != b.Samples {
+			return a.Samples > b.Samples
+		}
+		if a.Lat != b.Lat {
+			return a.Lat < b.Lat
+		}
+		return a.Lng < b.Lng
+	})
+	return stats
+}
+
+// calibrationFile is the persisted form: raw totals per zone, so learning
+// carries on where it left off.
+type calibrationFile struct {
+	Version int                   `json:"version"`
+	Zones   []calibrationFileZone `json:"zones"`
+}
+
+type calibrationFileZone struct {
+	Zone zoneKey `json:"zone"` // grid cell row and column
+	zoneTotals
+}
+
+func (c *calibration) load() {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return
+	}
+	var file calibrationFile
+	if json.Unmarshal(data, &file) != nil || file.Version != calibrationFileVersion {
+		return
+	}
+	for _, zone := range file.Zones {
+		if zone.Samples <= 0 || zone.StraightKm <= 0 || zone.Minutes <= 0 {
+			continue
+		}
+		totals := zone.zoneTotals
+		c.zones[zone.Zone] = &totals
+	}
+}
+
+// save writes the totals to disk if they changed since the last save.
+func (c *calibration) save() {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	c.mu.Lock()
+	c.scheduled = false
+	if !c.dirty {
+		c.mu.Unlock()
+		return
+	}
+	file := calibrationFile{Version: calibrationFileVersion, Zones: make([]calibrationFileZone, 0, len(c.zones))}
+	for key, totals := range c.zones {
+		file.Zones = append(file.Zones, calibrationFileZone{Zone: key, zoneTotals: *totals})
+	}
+	c.dirty = false
+	c.mu.Unlock()
+
+	if err := writeCalibration(c.path, file); err != nil {
+		// Keep the totals marked unsaved so the next change retries
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+	}
+}
+
+func writeCalibration(path string, file calibrationFile) error {
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
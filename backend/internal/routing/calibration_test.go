@@ -0,0 +1,83 @@
+package routing
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// roadLeg is a leg about 1 km north from (lat, lng) whose road route is
+// detour times longer than the straight line, driven at speed km/h.
+func roadLeg(lat, lng, detour, speed float64) ([]RoutePoint, *RouteSegment) {
+	from, to := RoutePoint{Lat: lat, Lng: lng}, RoutePoint{Lat: lat + 0.009, Lng: lng}
+	distance := haversineDistance(from.Lat, from.Lng, to.Lat, to.Lng) * detour
+	leg := RouteLeg{Distance: distance, Duration: distance / speed * 60, Source: "ors"}
+	return []RoutePoint{from, to}, &RouteSegment{Distance: leg.Distance, Duration: leg.Duration, Legs: []RouteLeg{leg}}
+}
+
+func TestCalibrationLearnsDetours(t *testing.T) {
+	c := newCalibration("")
+	observe := func(lat, lng, detour, speed float64) {
+		waypoints, segment := roadLeg(lat, lng, detour, speed)
+		c.observeRoute("ors", waypoints, segment)
+	}
+	// Downtown Birmingham and a zone 15 km north east of it
+	const downtownLat, downtownLng, northLat, northLng = 33.505, -86.815, 33.605, -86.665
+
+	for i := 0; i < minGlobalSamples-1; i++ {
+		observe(downtownLat+float64(i)*0.001, downtownLng, 1.3, 36)
+	}
+	// Repeats, fallbacks, implausible detours and short legs teach nothing
+	observe(downtownLat, downtownLng, 1.3, 36)
+	observe(downtownLat, downtownLng+0.001, maxDetourFactor+1, 36)
+	waypoints, segment := roadLeg(downtownLat, downtownLng+0.002, 1.3, 36)
+	segment.Legs[0].Source = SourceFallback
+	c.observeRoute("ors", waypoints, segment)
+	c.observeRoute("ors", []RoutePoint{{Lat: downtownLat, Lng: downtownLng}, {Lat: downtownLat + 0.001, Lng: downtownLng}},
+		&RouteSegment{Distance: 0.2, Duration: 1})
+	waypoints, segment = roadLeg(downtownLat, downtownLng+0.003, 1.3, 36)
+	c.observeRoute("fake", waypoints, segment)
+
+	if stats := c.stats(); stats.Calibrated || stats.Samples != minGlobalSamples-1 {
+		t.Fatalf("after %d legs: calibrated %v with %d samples, want uncalibrated with %d", minGlobalSamples-1, stats.Calibrated, stats.Samples, minGlobalSamples-1)
+	}
+	if got, want := c.estimator.Load().Distance(33.5, -86.8, 33.6, -86.7), haversineDistance(33.5, -86.8, 33.6, -86.7); got != want {
+		t.Errorf("uncalibrated distance = %v, want the straight line %v", got, want)
+	}
+
+	observe(downtownLat+0.05*0.4, downtownLng, 1.3, 36)
+	estimator := c.estimator.Load()
+	if !estimator.Calibrated() || !closeTo(estimator.detour, 1.3) || !closeTo(estimator.speed, 36) {
+		t.Fatalf("after %d legs: estimator %+v, want detour 1.3 at 36 km/h", minGlobalSamples, estimator)
+	}
+
+	for i := 0; i < zoneSampleWeight; i++ {
+		observe(northLat+float64(i)*0.001, northLng, 1.8, 24)
+	}
+	estimator = c.estimator.Load()
+	ratio := func(lat, lng float64) float64 {
+		return estimator.Distance(lat, lng, lat+0.01, lng) / haversineDistance(lat, lng, lat+0.01, lng)
+	}
+	// The north zone has zoneSampleWeight samples, so its own factor counts half
+	if got, want := ratio(northLat, northLng), (1.8+estimator.detour)/2; !closeTo(got, want) {
+		t.Errorf("north zone detour = %v, want %v", got, want)
+	}
+	if got := ratio(downtownLat, downtownLng); got < 1.3 || got > estimator.detour {
+		t.Errorf("downtown detour = %v, want between its own 1.3 and the global %v", got, estimator.detour)
+	}
+	if got := ratio(34.5, -87.5); !closeTo(got, estimator.detour) {
+		t.Errorf("unseen zone detour = %v, want the global %v", got, estimator.detour)
+	}
+	minutes := estimator.Duration(northLat, northLng, northLat+0.01, northLng)
+	if speed := estimator.Distance(northLat, northLng, northLat+0.01, northLng) / minutes * 60; speed <= 24 || speed >= estimator.speed {
+		t.Errorf("north zone speed = %v km/h, want between its own 24 and the global %v", speed, estimator.speed)
+	}
+
+	// Saved totals carry on where they left off
+	c.path = filepath.Join(t.TempDir(), "calibration.json")
+	c.save()
+	reloaded := newCalibration(c.path)
+	if got, want := reloaded.stats(), c.stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("reloaded stats %+v, want %+v", got, want)
+	}
+}
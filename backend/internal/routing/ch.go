@@ -0,0 +1,470 @@
+package routing
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"sync"
+)
+
+const (
+	// witnessSettleLimit bounds each witness search during contraction. A
+	// search that gives up early only adds a shortcut that was not strictly
+	// needed, so queries stay correct, just slightly slower.
+	witnessSettleLimit = 500
+	// estimateSettleLimit is the cheaper bound used to estimate the initial
+	// contraction order.
+	estimateSettleLimit = 50
+)
+
+// hierarchy is a contraction hierarchy over a RoadGraph's vertices. Vertices
+// are ranked by contraction order; up holds arcs to higher-ranked vertices
+// and down holds arcs arriving from higher-ranked vertices (with to set to
+// the tail), so both query directions only ever climb the hierarchy.
+type hierarchy struct {
+	upFirst   []int32
+	up        []chArc
+	downFirst []int32
+	down      []chArc
+}
+
+// chArc is an original edge or a shortcut. Shortcuts record the vertex
+// they bypass so paths can be unpacked back into road geometry.
+type chArc struct {
+	to       int32
+	duration float64 // in minutes
+	distance float64 // in kilometers
+	middle   int32   // bypassed vertex, or -1 for an original edge
+}
+
+// Contract preprocesses the graph into a contraction hierarchy, after which
+// routes and matrices use bidirectional and bucket-based CH queries instead
+// of plain Dijkstra. It takes seconds for a city and minutes for a metro,
+// so the result is normally saved with WriteRoadGraph and reloaded.
+func (g *RoadGraph) Contract() {
+	g.ch = newContractor(g).run()
+}
+
+// Contracted reports whether the graph has a contraction hierarchy.
+func (g *RoadGraph) Contracted() bool {
+	return g.ch != nil
+}
+
+// contractor holds the shrinking overlay graph while vertices are contracted.
+type contractor struct {
+	out, in [][]chArc // in arcs have to set to their tail
+	deleted []int32   // contracted neighbours, spreads contraction evenly
+
+	// witness search state, reset through touched after every search
+	time    []float64
+	target  []bool
+	touched []int32
+	queue   priorityQueue
+}
+
+func newContractor(g *RoadGraph) *contractor {
+	n := len(g.points)
+	c := &contractor{
+		out:     make([][]chArc, n),
+		in:      make([][]chArc, n),
+		deleted: make([]int32, n),
+		time:    make([]float64, n),
+		target:  make([]bool, n),
+	}
+	for i := range c.time {
+		c.time[i] = math.Inf(1)
+	}
+	for v := 0; v < n; v++ {
+		for _, e := range g.edges[g.first[v]:g.first[v+1]] {
+			c.addArc(int32(v), e.to, e.duration, e.distance, -1)
+		}
+	}
+	return c
+}
+
+// addArc adds u→w, or shortens an existing u→w arc.
+func (c *contractor) addArc(u, w int32, duration, distance float64, middle int32) {
+	if u == w {
+		return
+	}
+	for i := range c.out[u] {
+		if c.out[u][i].to != w {
+			continue
+		}
+		if duration < c.out[u][i].duration {
+			c.out[u][i] = chArc{to: w, duration: duration, distance: distance, middle: middle}
+			for j := range c.in[w] {
+				if c.in[w][j].to == u {
+					c.in[w][j] = chArc{to: u, duration: duration, distance: distance, middle: middle}
+				}
+			}
+		}
+		return
+	}
+	c.out[u] = append(c.out[u], chArc{to: w, duration: duration, distance: distance, middle: middle})
+	c.in[w] = append(c.in[w], chArc{to: u, duration: duration, distance: distance, middle: middle})
+}
+
+// shortcut is an arc contraction of a vertex must add to keep distances.
+type shortcut struct {
+	from, to           int32
+	duration, distance float64
+}
+
+// shortcuts finds the arcs needed to bypass v: u→v→w becomes a shortcut
+// unless a witness path from u to w avoiding v is at least as fast.
+func (c *contractor) shortcuts(v int32, settleLimit int) []shortcut {
+	needed := []shortcut{}
+	for _, in := range c.in[v] {
+		u := in.to
+		limit, targets := 0.0, 0
+		for _, out := range c.out[v] {
+			if out.to != u {
+				limit = math.Max(limit, in.duration+out.duration)
+				if !c.target[out.to] {
+					c.target[out.to] = true
+					targets++
+				}
+			}
+		}
+		if targets == 0 {
+			continue
+		}
+		c.witness(u, v, limit, targets, settleLimit)
+		for _, out := range c.out[v] {
+			c.target[out.to] = false
+		}
+		for _, out := range c.out[v] {
+			if out.to == u {
+				continue
+			}
+			via := in.duration + out.duration
+			if c.time[out.to] > via {
+				needed = append(needed, shortcut{from: u, to: out.to, duration: via, distance: in.distance + out.distance})
+			}
+		}
+		c.reset()
+	}
+	return needed
+}
+
+// witness runs a bounded Dijkstra from u that never passes through v,
+// stopping once every target is settled or nothing closer than limit is left.
+func (c *contractor) witness(u, v int32, limit float64, targets, settleLimit int) {
+	c.time[u] = 0
+	c.touched = append(c.touched, u)
+	c.queue = append(c.queue[:0], queueItem{vertex: u})
+	for settled := 0; c.queue.Len() > 0 && settled < settleLimit; {
+		item := c.queue.pop()
+		if item.key > c.time[item.vertex] {
+			continue
+		}
+		if item.key > limit {
+			return
+		}
+		settled++
+		if c.target[item.vertex] {
+			if targets--; targets == 0 {
+				return
+			}
+		}
+		for _, arc := range c.out[item.vertex] {
+			if arc.to == v {
+				continue
+			}
+			if t := item.key + arc.duration; t < c.time[arc.to] {
+				if math.IsInf(c.time[arc.to], 1) {
+					c.touched = append(c.touched, arc.to)
+				}
+				c.time[arc.to] = t
+				c.queue.push(queueItem{vertex: arc.to, key: t})
+			}
+		}
+	}
+}
+
+func (c *contractor) reset() {
+	for _, v := range c.touched {
+		c.time[v] = math.Inf(1)
+	}
+	c.touched = c.touched[:0]
+}
+
+// priority orders contraction: vertices whose removal adds few shortcuts
+// (edge difference) and whose neighbours are not yet thinned out go first.
+func (c *contractor) priority(v int32, shortcuts int) float64 {
+	return float64(shortcuts-len(c.in[v])-len(c.out[v])) + float64(c.deleted[v])
+}
+
+func (c *contractor) run() *hierarchy {
+	n := int32(len(c.out))
+	order := make(priorityQueue, 0, n)
+	for v := int32(0); v < n; v++ {
+		order.push(queueItem{vertex: v, key: c.priority(v, len(c.shortcuts(v, estimateSettleLimit)))})
+	}
+
+	for order.Len() > 0 {
+		item := order.pop()
+		// Lazy updates: re-queue if the priority went stale and is no longer the minimum
+		if p := c.priority(item.vertex, len(c.shortcuts(item.vertex, estimateSettleLimit))); order.Len() > 0 && p > order[0].key {
+			order.push(queueItem{vertex: item.vertex, key: p})
+			continue
+		}
+		c.contract(item.vertex, c.shortcuts(item.vertex, witnessSettleLimit))
+	}
+	return c.hierarchy()
+}
+
+// contract removes v from the overlay graph, adding the shortcuts it needs.
+// v keeps its own arcs, which all lead to higher-ranked vertices from now on.
+func (c *contractor) contract(v int32, needed []shortcut) {
+	for _, s := range needed {
+		c.addArc(s.from, s.to, s.duration, s.distance, v)
+	}
+	for _, in := range c.in[v] {
+		c.out[in.to] = removeArc(c.out[in.to], v)
+		c.deleted[in.to]++
+	}
+	for _, out := range c.out[v] {
+		c.in[out.to] = removeArc(c.in[out.to], v)
+		c.deleted[out.to]++
+	}
+}
+
+func removeArc(arcs []chArc, to int32) []chArc {
+	for i := range arcs {
+		if arcs[i].to == to {
+			arcs[i] = arcs[len(arcs)-1]
+			return arcs[:len(arcs)-1]
+		}
+	}
+	return arcs
+}
+
+func (c *contractor) hierarchy() *hierarchy {
+	h := &hierarchy{}
+	h.upFirst, h.up = flattenArcs(c.out)
+	h.downFirst, h.down = flattenArcs(c.in)
+	return h
+}
+
+func flattenArcs(lists [][]chArc) ([]int32, []chArc) {
+	first := make([]int32, len(lists)+1)
+	for v, arcs := range lists {
+		first[v+1] = first[v] + int32(len(arcs))
+	}
+	flat := make([]chArc, 0, first[len(lists)])
+	for _, arcs := range lists {
+		flat = append(flat, arcs...)
+	}
+	return first, flat
+}
+
+// chLabel is a vertex reached by a CH search.
+type chLabel struct {
+	duration, distance float64
+	parent             int32 // previous vertex, or -1 for a search seed
+	middle             int32 // middle of the arc from parent, -1 if original
+	settled            bool
+}
+
+// chSearch is one direction of a CH query. Search spaces are small, so
+// labels live in a map rather than graph-sized arrays.
+type chSearch struct {
+	labels map[int32]*chLabel
+	queue  priorityQueue
+}
+
+func newCHSearch(seeds []access) *chSearch {
+	s := &chSearch{labels: map[int32]*chLabel{}}
+	for _, seed := range seeds {
+		s.relax(seed.vertex, -1, -1, seed.duration, seed.distance)
+	}
+	return s
+}
+
+func (s *chSearch) relax(v, parent, middle int32, duration, distance float64) {
+	label, ok := s.labels[v]
+	if ok && (label.settled || duration >= label.duration) {
+		return
+	}
+	s.labels[v] = &chLabel{duration: duration, distance: distance, parent: parent, middle: middle}
+	s.queue.push(queueItem{vertex: v, key: duration})
+}
+
+// step settles the next vertex and relaxes its arcs, returning -1 once the
+// search is exhausted.
+func (s *chSearch) step(first []int32, arcs []chArc) int32 {
+	for s.queue.Len() > 0 {
+		v := s.queue.pop().vertex
+		label := s.labels[v]
+		if label.settled {
+			continue
+		}
+		label.settled = true
+		for _, arc := range arcs[first[v]:first[v+1]] {
+			s.relax(arc.to, v, arc.middle, label.duration+arc.duration, label.distance+arc.distance)
+		}
+		return v
+	}
+	return -1
+}
+
+func (s *chSearch) minKey() float64 {
+	if s.queue.Len() == 0 {
+		return math.Inf(1)
+	}
+	return s.queue[0].key
+}
+
+// route answers a point-to-point query with a bidirectional search: forward
+// up from the origin, backward up from the destination, meeting at the
+// highest vertex of the fastest path.
+func (h *hierarchy) route(ctx context.Context, g *RoadGraph, from, to snap) (graphPath, bool) {
+	best, found := g.direct(from, to)
+	bestDuration, meet := math.Inf(1), int32(-1)
+	if found {
+		bestDuration = best.duration
+	}
+
+	forward := newCHSearch(g.departures(from))
+	backward := newCHSearch(g.arrivals(to))
+	for math.Min(forward.minKey(), backward.minKey()) < bestDuration {
+		if ctx.Err() != nil {
+			return graphPath{}, false
+		}
+		search, other, first, arcs := forward, backward, h.upFirst, h.up
+		if backward.minKey() < forward.minKey() {
+			search, other, first, arcs = backward, forward, h.downFirst, h.down
+		}
+		v := search.step(first, arcs)
+		if v < 0 {
+			continue // only stale entries were left; the other direction may still improve
+		}
+		if o, ok := other.labels[v]; ok {
+			if total := search.labels[v].duration + o.duration; total < bestDuration {
+				bestDuration, meet = total, v
+			}
+		}
+	}
+	if meet < 0 {
+		return best, found
+	}
+
+	path := graphPath{
+		distance: forward.labels[meet].distance + backward.labels[meet].distance,
+		duration: bestDuration,
+	}
+	// Walk the forward half back from the meeting vertex, then unpack it in order
+	type hop struct{ from, to, middle int32 }
+	hops := []hop{}
+	for v := meet; forward.labels[v].parent >= 0; v = forward.labels[v].parent {
+		label := forward.labels[v]
+		hops = append(hops, hop{label.parent, v, label.middle})
+	}
+	start := meet
+	if len(hops) > 0 {
+		start = hops[len(hops)-1].from
+	}
+	path.vertices = []int32{start}
+	for i := len(hops) - 1; i >= 0; i-- {
+		path.vertices = h.unpack(hops[i].from, hops[i].to, hops[i].middle, path.vertices)
+	}
+	// Backward labels point towards the destination already
+	for v := meet; backward.labels[v].parent >= 0; v = backward.labels[v].parent {
+		label := backward.labels[v]
+		path.vertices = h.unpack(v, label.parent, label.middle, path.vertices)
+	}
+	return path, true
+}
+
+// unpack appends the original vertices after u on the arc u→w, ending
+// with w, expanding shortcuts recursively.
+func (h *hierarchy) unpack(u, w, middle int32, out []int32) []int32 {
+	if middle < 0 {
+		return append(out, w)
+	}
+	// middle ranks below both ends: u→middle is stored in down[middle] and
+	// middle→w in up[middle]
+	first := h.arc(h.downFirst, h.down, middle, u)
+	second := h.arc(h.upFirst, h.up, middle, w)
+	out = h.unpack(u, middle, first.middle, out)
+	return h.unpack(middle, w, second.middle, out)
+}
+
+func (h *hierarchy) arc(first []int32, arcs []chArc, v, to int32) chArc {
+	for _, arc := range arcs[first[v]:first[v+1]] {
+		if arc.to == to {
+			return arc
+		}
+	}
+	return chArc{to: to, middle: -1}
+}
+
+// bucketEntry records that destination target is reachable from a vertex
+// going up the hierarchy at the given cost.
+type bucketEntry struct {
+	target             int32
+	duration, distance float64
+}
+
+// table computes a many-to-many matrix with the bucket algorithm: one
+// backward search per destination fills buckets on the vertices it
+// settles, then one forward search per source scans the buckets it meets.
+func (h *hierarchy) table(ctx context.Context, g *RoadGraph, sources, destinations []snap) ([][]float64, [][]float64) {
+	buckets := map[int32][]bucketEntry{}
+	for j, to := range destinations {
+		search := newCHSearch(g.arrivals(to))
+		for v := search.step(h.downFirst, h.down); v >= 0; v = search.step(h.downFirst, h.down) {
+			label := search.labels[v]
+			buckets[v] = append(buckets[v], bucketEntry{target: int32(j), duration: label.duration, distance: label.distance})
+		}
+	}
+
+	distances := make([][]float64, len(sources))
+	durations := make([][]float64, len(sources))
+	rows := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rows {
+				distances[i], durations[i] = h.row(g, sources[i], destinations, buckets)
+			}
+		}()
+	}
+	for i := range sources {
+		if ctx.Err() != nil {
+			break
+		}
+		rows <- i
+	}
+	close(rows)
+	wg.Wait()
+	return distances, durations
+}
+
+// row runs the forward search for one source against the filled buckets.
+func (h *hierarchy) row(g *RoadGraph, from snap, destinations []snap, buckets map[int32][]bucketEntry) ([]float64, []float64) {
+	distances := make([]float64, len(destinations))
+	durations := make([]float64, len(destinations))
+	for j, to := range destinations {
+		distances[j], durations[j] = math.Inf(1), math.Inf(1)
+		if direct, ok := g.direct(from, to); ok {
+			distances[j], durations[j] = direct.distance, direct.duration
+		}
+	}
+
+	search := newCHSearch(g.departures(from))
+	for v := search.step(h.upFirst, h.up); v >= 0; v = search.step(h.upFirst, h.up) {
+		label := search.labels[v]
+		for _, entry := range buckets[v] {
+			if total := label.duration + entry.duration; total < durations[entry.target] {
+				durations[entry.target] = total
+				distances[entry.target] = label.distance + entry.distance
+			}
+		}
+	}
+	return distances, durations
+}
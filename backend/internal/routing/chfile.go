@@ -0,0 +1,311 @@
+package routing
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Preprocessed graphs are stored next to their extract as <extract>.ch: a
+// small header followed by little-endian columns (all vertex latitudes,
+// then all longitudes, and so on) so they load with a few large reads.
+const (
+	graphFileMagic   = "SRCH"
+	graphFileVersion = 1
+	// maxGraphFileItems rejects corrupt lengths before allocating for them.
+	maxGraphFileItems = 1 << 30
+)
+
+var errBadGraphFile = errors.New("malformed road graph file")
+
+// PrepareRoadGraph loads an extract, contracts it and writes the result to
+// <extract>.ch, which graphFor picks up instead of the extract from then
+// on. It returns the path written.
+func PrepareRoadGraph(extract string) (string, error) {
+	g, err := LoadRoadGraph(extract)
+	if err != nil {
+		return "", err
+	}
+	g.Contract()
+	out := extract + ".ch"
+	return out, WriteRoadGraph(g, out)
+}
+
+// loadPreparedGraph returns the contracted graph for path, reading
+// <path>.ch when it is newer than the extract and otherwise contracting the
+// extract and saving the result for next time.
+func loadPreparedGraph(path string) (*RoadGraph, error) {
+	prepared := path + ".ch"
+	if !isGraphFile(path) && newerThan(prepared, path) {
+		if g, err := readRoadGraph(prepared); err == nil && g.Contracted() {
+			return g, nil
+		}
+	}
+
+	g, err := LoadRoadGraph(path)
+	if err != nil {
+		return nil, err
+	}
+	if !g.Contracted() {
+		g.Contract()
+		if !isGraphFile(path) {
+			// Failing to save only costs the contraction again next start
+			_ = WriteRoadGraph(g, prepared)
+		}
+	}
+	return g, nil
+}
+
+func newerThan(path, source string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	sourceInfo, err := os.Stat(source)
+	return err == nil && !info.ModTime().Before(sourceInfo.ModTime())
+}
+
+// WriteRoadGraph saves the graph, including its contraction hierarchy if it
+// has one, in the preprocessed format LoadRoadGraph recognises.
+func WriteRoadGraph(g *RoadGraph, path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := &graphWriter{w: bufio.NewWriterSize(f, 1<<20)}
+
+	w.write([]byte(graphFileMagic))
+	w.write(uint32(graphFileVersion))
+	w.write(g.maxSpeed)
+
+	lats, lngs := make([]float64, len(g.points)), make([]float64, len(g.points))
+	for i, p := range g.points {
+		lats[i], lngs[i] = p.Lat, p.Lng
+	}
+	w.floats(lats)
+	w.floats(lngs)
+
+	from, to := make([]int32, len(g.segments)), make([]int32, len(g.segments))
+	directions := make([]uint8, len(g.segments))
+	distances, durations := make([]float64, len(g.segments)), make([]float64, len(g.segments))
+	for i, s := range g.segments {
+		from[i], to[i], distances[i], durations[i] = s.from, s.to, s.distance, s.duration
+		if s.forward {
+			directions[i] |= 1
+		}
+		if s.backward {
+			directions[i] |= 2
+		}
+	}
+	w.ints(from)
+	w.ints(to)
+	w.bytes(directions)
+	w.floats(distances)
+	w.floats(durations)
+
+	if g.ch == nil {
+		w.write(uint8(0))
+	} else {
+		w.write(uint8(1))
+		w.arcs(g.ch.upFirst, g.ch.up)
+		w.arcs(g.ch.downFirst, g.ch.down)
+	}
+
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	if closeErr := f.Close(); w.err == nil {
+		w.err = closeErr
+	}
+	if w.err != nil {
+		os.Remove(tmp)
+		return w.err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readRoadGraph(path string) (*RoadGraph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := &graphReader{r: bufio.NewReaderSize(f, 1<<20)}
+
+	magic := make([]byte, len(graphFileMagic))
+	var version uint32
+	r.read(magic)
+	r.read(&version)
+	if r.err == nil && (string(magic) != graphFileMagic || version != graphFileVersion) {
+		return nil, fmt.Errorf("%w: unsupported format", errBadGraphFile)
+	}
+
+	builder := newGraphBuilder()
+	r.read(&builder.maxSpeed)
+	lats, lngs := r.floats(), r.floats()
+	if len(lats) != len(lngs) {
+		return nil, errBadGraphFile
+	}
+	builder.points = make([]RoutePoint, len(lats))
+	for i := range lats {
+		builder.points[i] = RoutePoint{Lat: lats[i], Lng: lngs[i]}
+	}
+
+	from, to, directions, distances, durations := r.ints(), r.ints(), r.bytes(), r.floats(), r.floats()
+	n := len(from)
+	if len(to) != n || len(directions) != n || len(distances) != n || len(durations) != n {
+		return nil, errBadGraphFile
+	}
+	builder.segments = make([]roadSegment, n)
+	for i := range builder.segments {
+		if from[i] < 0 || to[i] < 0 || int(from[i]) >= len(lats) || int(to[i]) >= len(lats) {
+			return nil, errBadGraphFile
+		}
+		builder.segments[i] = roadSegment{
+			from:     from[i],
+			to:       to[i],
+			forward:  directions[i]&1 != 0,
+			backward: directions[i]&2 != 0,
+			distance: distances[i],
+			duration: durations[i],
+		}
+	}
+	g := builder.build()
+
+	var contracted uint8
+	r.read(&contracted)
+	if contracted == 1 {
+		h := &hierarchy{}
+		h.upFirst, h.up = r.arcs(len(g.points))
+		h.downFirst, h.down = r.arcs(len(g.points))
+		g.ch = h
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return g, nil
+}
+
+func isGraphFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, len(graphFileMagic))
+	_, err = io.ReadFull(f, magic)
+	return err == nil && string(magic) == graphFileMagic
+}
+
+// graphWriter writes length-prefixed columns, remembering the first error.
+type graphWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (w *graphWriter) write(v interface{}) {
+	if w.err == nil {
+		w.err = binary.Write(w.w, binary.LittleEndian, v)
+	}
+}
+
+func (w *graphWriter) floats(v []float64) {
+	w.write(uint32(len(v)))
+	w.write(v)
+}
+
+func (w *graphWriter) ints(v []int32) {
+	w.write(uint32(len(v)))
+	w.write(v)
+}
+
+func (w *graphWriter) bytes(v []uint8) {
+	w.write(uint32(len(v)))
+	w.write(v)
+}
+
+func (w *graphWriter) arcs(first []int32, arcs []chArc) {
+	to, middle := make([]int32, len(arcs)), make([]int32, len(arcs))
+	durations, distances := make([]float64, len(arcs)), make([]float64, len(arcs))
+	for i, a := range arcs {
+		to[i], middle[i], durations[i], distances[i] = a.to, a.middle, a.duration, a.distance
+	}
+	w.ints(first)
+	w.ints(to)
+	w.ints(middle)
+	w.floats(durations)
+	w.floats(distances)
+}
+
+// graphReader mirrors graphWriter.
+type graphReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (r *graphReader) read(v interface{}) {
+	if r.err == nil {
+		r.err = binary.Read(r.r, binary.LittleEndian, v)
+	}
+}
+
+func (r *graphReader) length() int {
+	var n uint32
+	r.read(&n)
+	if r.err == nil && n > maxGraphFileItems {
+		r.err = errBadGraphFile
+	}
+	if r.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (r *graphReader) floats() []float64 {
+	v := make([]float64, r.length())
+	r.read(v)
+	return v
+}
+
+func (r *graphReader) ints() []int32 {
+	v := make([]int32, r.length())
+	r.read(v)
+	return v
+}
+
+func (r *graphReader) bytes() []uint8 {
+	v := make([]uint8, r.length())
+	r.read(v)
+	return v
+}
+
+func (r *graphReader) arcs(vertices int) ([]int32, []chArc) {
+	first, to, middle, durations, distances := r.ints(), r.ints(), r.ints(), r.floats(), r.floats()
+	if r.err != nil {
+		return nil, nil
+	}
+	n := len(to)
+	if len(first) != vertices+1 || first[vertices] != int32(n) || len(middle) != n || len(durations) != n || len(distances) != n {
+		r.err = errBadGraphFile
+		return nil, nil
+	}
+	for v := 0; v < vertices; v++ {
+		if first[v] < 0 || first[v] > first[v+1] {
+			r.err = errBadGraphFile
+			return nil, nil
+		}
+	}
+	arcs := make([]chArc, n)
+	for i := range arcs {
+		if to[i] < 0 || int(to[i]) >= vertices || middle[i] >= int32(vertices) {
+			r.err = errBadGraphFile
+			return nil, nil
+		}
+		arcs[i] = chArc{to: to[i], middle: middle[i], duration: durations[i], distance: distances[i]}
+	}
+	return first, arcs
+}
@@ -0,0 +1,98 @@
+package routing
+
+import (
+	"context"
+	"math"
+)
+
+// FakeProvider computes routes in process without any network access. Legs
+// follow the great-circle line, stretched by a detour factor and sampled at
+// a fixed spacing so they look like real road geometry to callers. It is
+// intended for offline development and for backing the tests' HTTP stubs.
+type FakeProvider struct {
+	DetourFactor   float64 // road distance / straight-line distance
+	SpeedKmh       float64 // average driving speed
+	PointSpacingKm float64 // distance between generated geometry points
+}
+
+// NewFakeProvider returns a fake provider with city-driving defaults.
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{DetourFactor: 1.3, SpeedKmh: 30, PointSpacingKm: 0.25}
+}
+
+func (p *FakeProvider) Name() string { return "fake" }
+
+// Matrices are computed in process, so there is no request size to respect.
+func (p *FakeProvider) matrixLimit() int { return 0 }
+
+func (p *FakeProvider) waypointLimit() int { return 0 }
+
+func (p *FakeProvider) Route(ctx context.Context, waypoints []RoutePoint) (*RouteSegment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(waypoints) < 2 {
+		return nil, ErrNoRoute
+	}
+
+	segment := &RouteSegment{Geometry: []RoutePoint{waypoints[0]}}
+	for i := 0; i < len(waypoints)-1; i++ {
+		from, to := waypoints[i], waypoints[i+1]
+		straight := haversineDistance(from.Lat, from.Lng, to.Lat, to.Lng)
+		steps := int(math.Ceil(straight / p.PointSpacingKm))
+		if steps < 2 {
+			steps = 2
+		}
+		start := len(segment.Geometry) - 1
+		for s := 1; s <= steps; s++ {
+			t := float64(s) / float64(steps)
+			segment.Geometry = append(segment.Geometry, RoutePoint{
+				Lat: from.Lat + (to.Lat-from.Lat)*t,
+				Lng: from.Lng + (to.Lng-from.Lng)*t,
+			})
+		}
+		distance, duration := p.leg(from, to)
+		segment.Distance += distance
+		segment.Duration += duration
+		end := len(segment.Geometry) - 1
+		segment.Legs = append(segment.Legs, RouteLeg{
+			Distance:      distance,
+			Duration:      duration,
+			GeometryStart: start,
+			GeometryEnd:   end,
+			Steps: []Step{
+				{Instruction: "Head " + compassDirection(from, to), Distance: distance, Duration: duration, Maneuver: ManeuverDepart, GeometryStart: start, GeometryEnd: end},
+				{Instruction: "Arrive at your destination", Maneuver: ManeuverArrive, GeometryStart: end, GeometryEnd: end},
+			},
+		})
+	}
+	return segment, nil
+}
+
+func (p *FakeProvider) Matrix(ctx context.Context, sources, destinations []RoutePoint) (*Matrix, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return buildMatrix(len(sources), len(destinations), func(i, j int) (float64, float64, bool) {
+		distance, duration := p.leg(sources[i], destinations[j])
+		return distance, duration, true
+	})
+}
+
+func (p *FakeProvider) Health(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// leg returns the fake road distance (km) and duration (minutes) between two points.
+func (p *FakeProvider) leg(from, to RoutePoint) (float64, float64) {
+	distance := haversineDistance(from.Lat, from.Lng, to.Lat, to.Lng) * p.DetourFactor
+	return distance, distance / p.SpeedKmh * 60.0
+}
+
+// compassDirection names the eight-point compass heading from one point to another.
+func compassDirection(from, to RoutePoint) string {
+	directions := []string{"north", "northeast", "east", "southeast", "south", "southwest", "west", "northwest"}
+	dLng := (to.Lng - from.Lng) * math.Cos(from.Lat*math.Pi/180)
+	bearing := math.Atan2(dLng, to.Lat-from.Lat) * 180 / math.Pi
+	return directions[int(math.Round((bearing+360)/45))%8]
+}
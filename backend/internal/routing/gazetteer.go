@@ -0,0 +1,189 @@
+package routing
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minGazetteerMatch is the word overlap below which the gazetteer reports no
+// match rather than a poor guess.
+const minGazetteerMatch = 0.5
+
+// Gazetteer geocodes addresses offline from a list of known places, a
+// stand-in for a real geocoder in development and tests.
+type Gazetteer struct {
+	exact   map[string]int // normalized address -> place index
+	places  []gazetteerPlace
+	byToken map[string][]int // word -> places containing it
+}
+
+type gazetteerPlace struct {
+	label  string
+	lat    float64
+	lng    float64
+	tokens []string
+}
+
+var (
+	gazetteersMu sync.Mutex
+	gazetteers   = map[string]*Gazetteer{}
+)
+
+// loadGazetteer returns the gazetteer for the CSV at path, reading it on
+// first use.
+func loadGazetteer(path string) (*Gazetteer, error) {
+	if path == "" {
+		return nil, errors.New("routing: the gazetteer geocoder needs GEOCODING_GAZETTEER_PATH")
+	}
+	gazetteersMu.Lock()
+	defer gazetteersMu.Unlock()
+	if g, ok := gazetteers[path]; ok {
+		return g, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	g, err := ReadGazetteer(f)
+	if err != nil {
+		return nil, fmt.Errorf("routing: gazetteer %s: %w", path, err)
+	}
+	gazetteers[path] = g
+	return g, nil
+}
+
+// ReadGazetteer reads places from CSV with a header row naming an address
+// column and lat and lng (or latitude and longitude) columns.
+func ReadGazetteer(r io.Reader) (*Gazetteer, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	column := func(names ...string) int {
+		for _, name := range names {
+			if i, ok := columns[name]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	addressCol, latCol, lngCol := column("address"), column("lat", "latitude"), column("lng", "lon", "longitude")
+	if addressCol < 0 || latCol < 0 || lngCol < 0 {
+		return nil, errors.New("header needs address, lat and lng columns")
+	}
+
+	g := &Gazetteer{exact: map[string]int{}, byToken: map[string][]int{}}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		lat, errLat := strconv.ParseFloat(record[latCol], 64)
+		lng, errLng := strconv.ParseFloat(record[lngCol], 64)
+		if errLat != nil || errLng != nil {
+			return nil, fmt.Errorf("line %d: invalid coordinates", line)
+		}
+		g.Add(record[addressCol], lat, lng)
+	}
+	return g, nil
+}
+
+// Add records a place. A later place with the same normalized address
+// replaces the earlier one for exact lookups.
+func (g *Gazetteer) Add(address string, lat, lng float64) {
+	normalized := NormalizeAddress(address)
+	tokens := strings.Fields(normalized)
+	idx := len(g.places)
+	g.places = append(g.places, gazetteerPlace{label: address, lat: lat, lng: lng, tokens: tokens})
+	g.exact[normalized] = idx
+	seen := map[string]bool{}
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			g.byToken[token] = append(g.byToken[token], idx)
+		}
+	}
+}
+
+func (g *Gazetteer) Name() string { return "gazetteer" }
+
+// Geocode matches the address exactly after normalization, with confidence
+// 1, or else picks the place sharing the most words with it and scores the
+// overlap. A house number, when both have one, must agree.
+func (g *Gazetteer) Geocode(ctx context.Context, address string) (*GeocodeResult, error) {
+	normalized := NormalizeAddress(address)
+	if idx, ok := g.exact[normalized]; ok {
+		return g.result(idx, 1), nil
+	}
+
+	tokens := strings.Fields(normalized)
+	if len(tokens) == 0 {
+		return nil, ErrNoMatch
+	}
+	query := map[string]bool{}
+	for _, token := range tokens {
+		query[token] = true
+	}
+	shared := map[int]int{}
+	for token := range query {
+		for _, idx := range g.byToken[token] {
+			shared[idx]++
+		}
+	}
+
+	best, bestScore := -1, 0.0
+	for idx, common := range shared {
+		place := g.places[idx]
+		if houseNumber(tokens) != "" && houseNumber(place.tokens) != "" && houseNumber(tokens) != houseNumber(place.tokens) {
+			continue
+		}
+		union := len(query) + distinct(place.tokens) - common
+		score := float64(common) / float64(union)
+		if score > bestScore || score == bestScore && best >= 0 && idx < best {
+			best, bestScore = idx, score
+		}
+	}
+	if best < 0 || bestScore < minGazetteerMatch {
+		return nil, ErrNoMatch
+	}
+	return g.result(best, math.Round(bestScore*100)/100), nil
+}
+
+func (g *Gazetteer) result(idx int, confidence float64) *GeocodeResult {
+	place := g.places[idx]
+	return &GeocodeResult{Lat: place.lat, Lng: place.lng, Confidence: confidence, Label: place.label, Source: g.Name()}
+}
+
+// houseNumber is the leading number of an address, if it has one.
+func houseNumber(tokens []string) string {
+	if len(tokens) > 0 && tokens[0][0] >= '0' && tokens[0][0] <= '9' {
+		return tokens[0]
+	}
+	return ""
+}
+
+func distinct(tokens []string) int {
+	seen := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		seen[token] = true
+	}
+	return len(seen)
+}
@@ -0,0 +1,191 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Geocoder turns street addresses into coordinates. Like providers,
+// implementations talk to a specific HTTP API (or look addresses up in
+// process) and report failures as errors.
+type Geocoder interface {
+	// Name identifies the geocoder, e.g. "ors" or "nominatim".
+	Name() string
+	// Geocode returns the best match for the address.
+	Geocode(ctx context.Context, address string) (*GeocodeResult, error)
+}
+
+// GeocodeResult is a geocoder's best match for an address.
+type GeocodeResult struct {
+	Lat        float64 `json:"lat"`
+	Lng        float64 `json:"lng"`
+	Confidence float64 `json:"confidence"` // 0-1, how sure the geocoder is of the match
+	Label      string  `json:"label"`      // the matched place as the geocoder names it
+	Source     string  `json:"source"`     // geocoder name
+}
+
+// ErrNoMatch is returned when the geocoder knows no place for the address.
+var ErrNoMatch = errors.New("routing: geocoder found no match for the address")
+
+// GeocoderConfig selects and configures a geocoder.
+type GeocoderConfig struct {
+	Provider      string        // "ors", "nominatim" or "gazetteer"
+	BaseURL       string        // API root; empty uses the geocoder's public endpoint
+	APIKey        string        // required by ORS
+	GazetteerPath string        // CSV of address,lat,lng for the offline "gazetteer" geocoder
+	Timeout       time.Duration // per-request timeout
+}
+
+// GeocoderNames lists the geocoders accepted by NewGeocoder.
+func GeocoderNames() []string {
+	return []string{"ors", "nominatim", "gazetteer"}
+}
+
+// GeocoderConfigFromEnv reads geocoder settings from GEOCODING_PROVIDER,
+// GEOCODING_BASE_URL, GEOCODING_API_KEY and GEOCODING_GAZETTEER_PATH. With
+// no provider set, a configured gazetteer wins over ORS, and ORS reuses the
+// routing key.
+func GeocoderConfigFromEnv() GeocoderConfig {
+	cfg := GeocoderConfig{
+		Provider:      strings.ToLower(os.Getenv("GEOCODING_PROVIDER")),
+		BaseURL:       os.Getenv("GEOCODING_BASE_URL"),
+		APIKey:        os.Getenv("GEOCODING_API_KEY"),
+		GazetteerPath: os.Getenv("GEOCODING_GAZETTEER_PATH"),
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = "ors"
+		if cfg.GazetteerPath != "" {
+			cfg.Provider = "gazetteer"
+		}
+	}
+	if cfg.APIKey == "" && cfg.Provider == "ors" {
+		cfg.APIKey = orDefault(os.Getenv("OPENROUTE_API_KEY"), os.Getenv("ROUTING_API_KEY"))
+	}
+	return cfg
+}
+
+// GeocoderFor builds a geocoder from the environment configuration, letting
+// a request override the geocoder name and API key the way ProviderFor does.
+func GeocoderFor(name, apiKey string) (Geocoder, error) {
+	cfg := GeocoderConfigFromEnv()
+	name = strings.ToLower(name)
+	if name != "" && name != cfg.Provider {
+		cfg = GeocoderConfig{Provider: name, GazetteerPath: cfg.GazetteerPath}
+	}
+	if apiKey != "" {
+		cfg.APIKey = apiKey
+	}
+	return NewGeocoder(cfg)
+}
+
+// NewGeocoder returns the geocoder described by cfg.
+func NewGeocoder(cfg GeocoderConfig) (Geocoder, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	client := &http.Client{Timeout: cfg.Timeout, Transport: sharedTransport}
+
+	var geocoder Geocoder
+	switch strings.ToLower(cfg.Provider) {
+	case "", "ors", "openrouteservice":
+		geocoder = newORSGeocoder(cfg, client)
+	case "nominatim":
+		geocoder = newNominatimGeocoder(cfg, client)
+	case "gazetteer":
+		// Looked up in process; nothing worth caching
+		return loadGazetteer(cfg.GazetteerPath)
+	default:
+		return nil, fmt.Errorf("routing: unknown geocoder %q", cfg.Provider)
+	}
+	return &cachedGeocoder{
+		Geocoder: geocoder,
+		cache:    defaultCache(),
+		prefix:   "geocode|" + geocoder.Name() + "|" + cfg.BaseURL + "|",
+	}, nil
+}
+
+// GeocodeAll geocodes many addresses concurrently, bounded by the
+// configured routing concurrency. Each address succeeds or fails on its own.
+func GeocodeAll(ctx context.Context, geocoder Geocoder, addresses []string) ([]*GeocodeResult, []error) {
+	results := make([]*GeocodeResult, len(addresses))
+	errs := make([]error, len(addresses))
+	forEachConcurrently(len(addresses), func(i int) {
+		results[i], errs[i] = geocoder.Geocode(ctx, addresses[i])
+	})
+	return results, errs
+}
+
+// cachedGeocoder answers repeat addresses, including ones the geocoder could
+// not place, from the shared route cache.
+type cachedGeocoder struct {
+	Geocoder
+	cache  *routeCache
+	prefix string
+}
+
+func (g *cachedGeocoder) Geocode(ctx context.Context, address string) (*GeocodeResult, error) {
+	key := g.prefix + NormalizeAddress(address)
+	if entry, ok := g.cache.get(key); ok {
+		if entry.NoMatch {
+			return nil, ErrNoMatch
+		}
+		if entry.Place != nil {
+			place := *entry.Place
+			return &place, nil
+		}
+	}
+
+	place, err := g.Geocoder.Geocode(ctx, address)
+	if errors.Is(err, ErrNoMatch) {
+		g.cache.put(cacheEntry{Key: key, NoMatch: true})
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	stored := *place
+	g.cache.put(cacheEntry{Key: key, Place: &stored})
+	return place, nil
+}
+
+// addressAbbreviations folds the spelled-out forms of common address words
+// into the USPS abbreviations, so "123 Main Street" and "123 main st." match.
+var addressAbbreviations = map[string]string{
+	"street":    "st",
+	"avenue":    "ave",
+	"road":      "rd",
+	"drive":     "dr",
+	"boulevard": "blvd",
+	"lane":      "ln",
+	"court":     "ct",
+	"place":     "pl",
+	"parkway":   "pkwy",
+	"highway":   "hwy",
+	"circle":    "cir",
+	"terrace":   "ter",
+	"suite":     "ste",
+	"apartment": "apt",
+	"north":     "n",
+	"south":     "s",
+	"east":      "e",
+	"west":      "w",
+}
+
+// NormalizeAddress lowercases an address, drops punctuation and abbreviates
+// common words, for cache keys and gazetteer lookups.
+func NormalizeAddress(address string) string {
+	fields := strings.FieldsFunc(strings.ToLower(address), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '#')
+	})
+	for i, field := range fields {
+		if short, ok := addressAbbreviations[field]; ok {
+			fields[i] = short
+		}
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,509 @@
+package routing
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"sync"
+)
+
+const (
+	// snapCellDegrees is the size of a spatial index cell (about 500m).
+	snapCellDegrees = 0.005
+	// maxSnapKm is how far a coordinate may be from the nearest road before
+	// we give up on routing it.
+	maxSnapKm = 2.0
+)
+
+// RoadGraph is a directed road network with travel distances and times on
+// every edge, plus a spatial index for snapping coordinates onto roads.
+type RoadGraph struct {
+	points   []RoutePoint  // vertex coordinates
+	first    []int32       // edges of vertex v are edges[first[v]:first[v+1]]
+	edges    []graphEdge   // directed edges, grouped by tail vertex
+	segments []roadSegment // undirected road pieces, used for snapping
+	cells    map[[2]int32][]int32
+	maxSpeed float64    // fastest edge in km/h, bounds the A* heuristic
+	ch       *hierarchy // set by Contract; queries fall back to Dijkstra without it
+}
+
+type graphEdge struct {
+	to       int32
+	distance float64 // in kilometers
+	duration float64 // in minutes
+}
+
+// roadSegment is one piece of road between two vertices. forward and
+// backward record which directions may be driven.
+type roadSegment struct {
+	from, to          int32
+	forward, backward bool
+	distance          float64 // in kilometers
+	duration          float64 // in minutes
+}
+
+// RoadGraphStats describes a loaded road graph.
+type RoadGraphStats struct {
+	Vertices int `json:"vertices"`
+	Edges    int `json:"edges"`
+}
+
+// Stats reports the size of the graph.
+func (g *RoadGraph) Stats() RoadGraphStats {
+	return RoadGraphStats{Vertices: len(g.points), Edges: len(g.edges)}
+}
+
+// graphBuilder collects road pieces and turns them into a RoadGraph.
+type graphBuilder struct {
+	vertices map[int64]int32
+	points   []RoutePoint
+	segments []roadSegment
+	maxSpeed float64
+}
+
+func newGraphBuilder() *graphBuilder {
+	return &graphBuilder{vertices: map[int64]int32{}}
+}
+
+// vertex returns the vertex for key, creating it at point on first use.
+// Ways that share a key share the vertex, which is what connects them.
+func (b *graphBuilder) vertex(key int64, point RoutePoint) int32 {
+	if v, ok := b.vertices[key]; ok {
+		return v
+	}
+	v := int32(len(b.points))
+	b.vertices[key] = v
+	b.points = append(b.points, point)
+	return v
+}
+
+// addWay adds the road through vertices, drivable forward (in vertex
+// order), backward, or both, at speedKmh.
+func (b *graphBuilder) addWay(vertices []int32, speedKmh float64, forward, backward bool) {
+	if speedKmh <= 0 || (!forward && !backward) {
+		return
+	}
+	b.maxSpeed = math.Max(b.maxSpeed, speedKmh)
+	for i := 0; i < len(vertices)-1; i++ {
+		from, to := vertices[i], vertices[i+1]
+		if from == to {
+			continue
+		}
+		a, c := b.points[from], b.points[to]
+		distance := haversineDistance(a.Lat, a.Lng, c.Lat, c.Lng)
+		b.segments = append(b.segments, roadSegment{
+			from:     from,
+			to:       to,
+			forward:  forward,
+			backward: backward,
+			distance: distance,
+			duration: distance / speedKmh * 60.0,
+		})
+	}
+}
+
+func (b *graphBuilder) build() *RoadGraph {
+	g := &RoadGraph{
+		points:   b.points,
+		first:    make([]int32, len(b.points)+1),
+		segments: b.segments,
+		cells:    map[[2]int32][]int32{},
+		maxSpeed: b.maxSpeed,
+	}
+
+	// Count out-degrees, then lay edges out grouped by tail vertex.
+	for _, s := range b.segments {
+		if s.forward {
+			g.first[s.from+1]++
+		}
+		if s.backward {
+			g.first[s.to+1]++
+		}
+	}
+	for v := 1; v < len(g.first); v++ {
+		g.first[v] += g.first[v-1]
+	}
+	g.edges = make([]graphEdge, g.first[len(g.first)-1])
+	next := append([]int32(nil), g.first[:len(g.points)]...)
+	for _, s := range b.segments {
+		if s.forward {
+			g.edges[next[s.from]] = graphEdge{to: s.to, distance: s.distance, duration: s.duration}
+			next[s.from]++
+		}
+		if s.backward {
+			g.edges[next[s.to]] = graphEdge{to: s.from, distance: s.distance, duration: s.duration}
+			next[s.to]++
+		}
+	}
+
+	for i, s := range g.segments {
+		a, c := g.points[s.from], g.points[s.to]
+		minCell, maxCell := cellOf(math.Min(a.Lat, c.Lat), math.Min(a.Lng, c.Lng)), cellOf(math.Max(a.Lat, c.Lat), math.Max(a.Lng, c.Lng))
+		for x := minCell[0]; x <= maxCell[0]; x++ {
+			for y := minCell[1]; y <= maxCell[1]; y++ {
+				g.cells[[2]int32{x, y}] = append(g.cells[[2]int32{x, y}], int32(i))
+			}
+		}
+	}
+	return g
+}
+
+func cellOf(lat, lng float64) [2]int32 {
+	return [2]int32{int32(math.Floor(lat / snapCellDegrees)), int32(math.Floor(lng / snapCellDegrees))}
+}
+
+// snap is a coordinate projected onto the nearest road segment.
+type snap struct {
+	segment  int32
+	t        float64 // position along the segment, 0 at from and 1 at to
+	point    RoutePoint
+	distance float64 // from the original coordinate, in kilometers
+}
+
+// nearest snaps point onto the closest road segment within maxSnapKm,
+// searching outwards ring by ring through the spatial index.
+func (g *RoadGraph) nearest(point RoutePoint) (snap, bool) {
+	best := snap{segment: -1, distance: math.Inf(1)}
+	center := cellOf(point.Lat, point.Lng)
+	// The narrowest side of a cell bounds how far unsearched rings can be
+	cellKm := snapCellDegrees * 111.32 * math.Cos(point.Lat*math.Pi/180)
+	maxRing := int32(math.Ceil(maxSnapKm/cellKm)) + 1
+
+	for ring := int32(0); ring <= maxRing; ring++ {
+		if best.segment >= 0 && float64(ring-1)*cellKm > best.distance {
+			break
+		}
+		for x := center[0] - ring; x <= center[0]+ring; x++ {
+			for y := center[1] - ring; y <= center[1]+ring; y++ {
+				if x != center[0]-ring && x != center[0]+ring && y != center[1]-ring && y != center[1]+ring {
+					continue // inside the ring, already searched
+				}
+				for _, i := range g.cells[[2]int32{x, y}] {
+					if s := g.project(point, i); s.distance < best.distance {
+						best = s
+					}
+				}
+			}
+		}
+	}
+	return best, best.segment >= 0 && best.distance <= maxSnapKm
+}
+
+// project finds the closest point to point on segment i, working in a local
+// flat approximation that is accurate over the length of one road piece.
+func (g *RoadGraph) project(point RoutePoint, i int32) snap {
+	s := g.segments[i]
+	a, b := g.points[s.from], g.points[s.to]
+	kx := 111.32 * math.Cos(point.Lat*math.Pi/180)
+	const ky = 110.574
+	ax, ay := (a.Lng-point.Lng)*kx, (a.Lat-point.Lat)*ky
+	bx, by := (b.Lng-point.Lng)*kx, (b.Lat-point.Lat)*ky
+	dx, dy := bx-ax, by-ay
+
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/length))
+	}
+	px, py := ax+dx*t, ay+dy*t
+	return snap{
+		segment:  i,
+		t:        t,
+		point:    RoutePoint{Lat: a.Lat + (b.Lat-a.Lat)*t, Lng: a.Lng + (b.Lng-a.Lng)*t},
+		distance: math.Hypot(px, py),
+	}
+}
+
+// graphPath is the fastest way between two snapped points.
+type graphPath struct {
+	vertices []int32 // graph vertices passed through, in order
+	distance float64 // in kilometers
+	duration float64 // in minutes
+}
+
+// access is a way onto or off the graph from a snapped point: the vertex
+// at one end of its segment and the partial cost of reaching it.
+type access struct {
+	vertex   int32
+	distance float64
+	duration float64
+}
+
+// departures lists the vertices a trip starting at s can drive to first.
+func (g *RoadGraph) departures(s snap) []access {
+	seg := g.segments[s.segment]
+	out := []access{}
+	if seg.forward {
+		out = append(out, access{seg.to, seg.distance * (1 - s.t), seg.duration * (1 - s.t)})
+	}
+	if seg.backward {
+		out = append(out, access{seg.from, seg.distance * s.t, seg.duration * s.t})
+	}
+	return out
+}
+
+// arrivals lists the vertices a trip ending at s can arrive from.
+func (g *RoadGraph) arrivals(s snap) []access {
+	seg := g.segments[s.segment]
+	out := []access{}
+	if seg.forward {
+		out = append(out, access{seg.from, seg.distance * s.t, seg.duration * s.t})
+	}
+	if seg.backward {
+		out = append(out, access{seg.to, seg.distance * (1 - s.t), seg.duration * (1 - s.t)})
+	}
+	return out
+}
+
+// direct returns the cost of driving straight along a shared segment from
+// one snapped point to another, if the segment allows that direction.
+func (g *RoadGraph) direct(from, to snap) (graphPath, bool) {
+	if from.segment != to.segment {
+		return graphPath{}, false
+	}
+	seg := g.segments[from.segment]
+	if (to.t >= from.t && seg.forward) || (to.t <= from.t && seg.backward) {
+		share := math.Abs(to.t - from.t)
+		return graphPath{distance: seg.distance * share, duration: seg.duration * share}, true
+	}
+	return graphPath{}, false
+}
+
+// shortestPath runs A* on travel time between two snapped points. The
+// heuristic is the straight-line time at the graph's top speed, which
+// never overestimates.
+func (g *RoadGraph) shortestPath(ctx context.Context, from, to snap) (graphPath, bool) {
+	n := int32(len(g.points))
+	target := n // virtual vertex standing for the snapped destination
+	best, found := g.direct(from, to)
+
+	goal := map[int32]access{}
+	for _, a := range g.arrivals(to) {
+		goal[a.vertex] = a
+	}
+	heuristic := func(v int32) float64 {
+		if g.maxSpeed <= 0 {
+			return 0
+		}
+		p := g.points[v]
+		return haversineDistance(p.Lat, p.Lng, to.point.Lat, to.point.Lng) / g.maxSpeed * 60.0
+	}
+
+	search := newSearch(int(n) + 1)
+	for _, d := range g.departures(from) {
+		search.relax(d.vertex, -1, d.duration, d.distance, heuristic(d.vertex))
+	}
+	if found {
+		search.relax(target, -1, best.duration, best.distance, 0)
+	}
+
+	for search.queue.Len() > 0 {
+		if ctx.Err() != nil {
+			return graphPath{}, false
+		}
+		v := search.queue.pop().vertex
+		if search.settled[v] {
+			continue
+		}
+		search.settled[v] = true
+		if v == target {
+			break
+		}
+		if a, ok := goal[v]; ok {
+			search.relax(target, v, search.time[v]+a.duration, search.dist[v]+a.distance, 0)
+		}
+		for _, e := range g.edges[g.first[v]:g.first[v+1]] {
+			if !search.settled[e.to] {
+				search.relax(e.to, v, search.time[v]+e.duration, search.dist[v]+e.distance, heuristic(e.to))
+			}
+		}
+	}
+	if !search.settled[target] {
+		return graphPath{}, false
+	}
+
+	path := graphPath{distance: search.dist[target], duration: search.time[target]}
+	for v := search.parent[target]; v >= 0; v = search.parent[v] {
+		path.vertices = append(path.vertices, v)
+	}
+	for i, j := 0, len(path.vertices)-1; i < j; i, j = i+1, j-1 {
+		path.vertices[i], path.vertices[j] = path.vertices[j], path.vertices[i]
+	}
+	return path, true
+}
+
+// route finds the fastest path between two snapped points, through the
+// contraction hierarchy when there is one.
+func (g *RoadGraph) route(ctx context.Context, from, to snap) (graphPath, bool) {
+	if g.ch != nil {
+		return g.ch.route(ctx, g, from, to)
+	}
+	return g.shortestPath(ctx, from, to)
+}
+
+// table computes distances and durations from every source to every
+// destination; unreachable pairs are +Inf.
+func (g *RoadGraph) table(ctx context.Context, sources, destinations []snap) ([][]float64, [][]float64) {
+	if g.ch != nil {
+		return g.ch.table(ctx, g, sources, destinations)
+	}
+
+	// One Dijkstra per source, spread across the available CPUs
+	distances := make([][]float64, len(sources))
+	durations := make([][]float64, len(sources))
+	rows := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rows {
+				distances[i], durations[i] = g.oneToMany(ctx, sources[i], destinations)
+			}
+		}()
+	}
+	for i := range sources {
+		rows <- i
+	}
+	close(rows)
+	wg.Wait()
+	return distances, durations
+}
+
+// oneToMany runs Dijkstra from one snapped point until every destination
+// is settled, returning the distance and duration to each; unreachable
+// destinations are +Inf.
+func (g *RoadGraph) oneToMany(ctx context.Context, from snap, destinations []snap) ([]float64, []float64) {
+	n := int32(len(g.points))
+	distances := make([]float64, len(destinations))
+	durations := make([]float64, len(destinations))
+	for j := range destinations {
+		distances[j], durations[j] = math.Inf(1), math.Inf(1)
+	}
+
+	// Destinations are virtual vertices n..n+len(destinations)-1
+	search := newSearch(int(n) + len(destinations))
+	goals := map[int32][]int32{}
+	arrivals := map[int32][]access{}
+	for j, to := range destinations {
+		target := n + int32(j)
+		if direct, ok := g.direct(from, to); ok {
+			search.relax(target, -1, direct.duration, direct.distance, 0)
+		}
+		for _, a := range g.arrivals(to) {
+			goals[a.vertex] = append(goals[a.vertex], target)
+			arrivals[a.vertex] = append(arrivals[a.vertex], a)
+		}
+	}
+	for _, d := range g.departures(from) {
+		search.relax(d.vertex, -1, d.duration, d.distance, 0)
+	}
+
+	remaining := len(destinations)
+	for search.queue.Len() > 0 && remaining > 0 {
+		if ctx.Err() != nil {
+			break
+		}
+		v := search.queue.pop().vertex
+		if search.settled[v] {
+			continue
+		}
+		search.settled[v] = true
+		if v >= n {
+			j := v - n
+			distances[j], durations[j] = search.dist[v], search.time[v]
+			remaining--
+			continue
+		}
+		for k, target := range goals[v] {
+			a := arrivals[v][k]
+			search.relax(target, v, search.time[v]+a.duration, search.dist[v]+a.distance, 0)
+		}
+		for _, e := range g.edges[g.first[v]:g.first[v+1]] {
+			if !search.settled[e.to] {
+				search.relax(e.to, v, search.time[v]+e.duration, search.dist[v]+e.distance, 0)
+			}
+		}
+	}
+	return distances, durations
+}
+
+// search holds the per-query state of Dijkstra and A*.
+type search struct {
+	time    []float64
+	dist    []float64
+	parent  []int32
+	settled []bool
+	queue   priorityQueue
+}
+
+func newSearch(n int) *search {
+	s := &search{
+		time:    make([]float64, n),
+		dist:    make([]float64, n),
+		parent:  make([]int32, n),
+		settled: make([]bool, n),
+	}
+	for i := range s.time {
+		s.time[i] = math.Inf(1)
+	}
+	return s
+}
+
+// relax records a better arrival at v and queues it, keyed by time plus
+// the remaining estimate.
+func (s *search) relax(v, parent int32, time, dist, estimate float64) {
+	if time >= s.time[v] {
+		return
+	}
+	s.time[v], s.dist[v], s.parent[v] = time, dist, parent
+	s.queue.push(queueItem{vertex: v, key: time + estimate})
+}
+
+type queueItem struct {
+	vertex int32
+	key    float64
+}
+
+// priorityQueue is a binary min-heap of queue items. Stale entries are left
+// in place and skipped once their vertex is settled. It is hand-rolled
+// rather than built on container/heap to avoid boxing every item.
+type priorityQueue []queueItem
+
+func (q priorityQueue) Len() int { return len(q) }
+
+func (q *priorityQueue) push(item queueItem) {
+	*q = append(*q, item)
+	h := *q
+	for i := len(h) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if h[parent].key <= h[i].key {
+			break
+		}
+		h[parent], h[i] = h[i], h[parent]
+		i = parent
+	}
+}
+
+func (q *priorityQueue) pop() queueItem {
+	h := *q
+	top := h[0]
+	last := len(h) - 1
+	h[0] = h[last]
+	h = h[:last]
+	for i := 0; ; {
+		smallest, left, right := i, 2*i+1, 2*i+2
+		if left < len(h) && h[left].key < h[smallest].key {
+			smallest = left
+		}
+		if right < len(h) && h[right].key < h[smallest].key {
+			smallest = right
+		}
+		if smallest == i {
+			break
+		}
+		h[i], h[smallest] = h[smallest], h[i]
+		i = smallest
+	}
+	*q = h
+	return top
+}
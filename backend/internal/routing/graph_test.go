@@ -0,0 +1,155 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeGridExtract writes a GeoJSON street grid of n by n intersections
+// 0.004° apart: every third street is a primary road, every fourth avenue
+// is one way and a footway cuts across that cars may not use.
+func writeGridExtract(t *testing.T, n int) string {
+	t.Helper()
+	const spacing = 0.004
+	type feature struct {
+		Type       string                 `json:"type"`
+		Geometry   map[string]interface{} `json:"geometry"`
+		Properties map[string]string      `json:"properties"`
+	}
+	line := func(coordinates [][]float64, tags map[string]string) feature {
+		return feature{Type: "Feature", Geometry: map[string]interface{}{"type": "LineString", "coordinates": coordinates}, Properties: tags}
+	}
+	features := []feature{}
+	for i := 0; i < n; i++ {
+		street, avenue := [][]float64{}, [][]float64{}
+		for j := 0; j < n; j++ {
+			street = append(street, []float64{-86.85 + float64(j)*spacing, 33.48 + float64(i)*spacing})
+			avenue = append(avenue, []float64{-86.85 + float64(i)*spacing, 33.48 + float64(j)*spacing})
+		}
+		streetTags := map[string]string{"highway": "residential"}
+		if i%3 == 0 {
+			streetTags["highway"] = "primary"
+		}
+		avenueTags := map[string]string{"highway": "residential"}
+		if i%4 == 1 {
+			avenueTags["oneway"] = "yes"
+		}
+		features = append(features, line(street, streetTags), line(avenue, avenueTags))
+	}
+	diagonal := [][]float64{{-86.85, 33.48}, {-86.85 + float64(n-1)*spacing, 33.48 + float64(n-1)*spacing}}
+	features = append(features, line(diagonal, map[string]string{"highway": "footway"}))
+
+	data, err := json.Marshal(map[string]interface{}{"type": "FeatureCollection", "features": features})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "grid.geojson")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// snapsInGrid snaps random points inside the grid onto its roads.
+func snapsInGrid(t *testing.T, g *RoadGraph, n, count int) []snap {
+	t.Helper()
+	rng := rand.New(rand.NewSource(3))
+	snaps := make([]snap, count)
+	for i := range snaps {
+		point := RoutePoint{Lat: 33.48 + rng.Float64()*float64(n-1)*0.004, Lng: -86.85 + rng.Float64()*float64(n-1)*0.004}
+		s, ok := g.nearest(point)
+		if !ok {
+			t.Fatalf("%+v did not snap to a road", point)
+		}
+		snaps[i] = s
+	}
+	return snaps
+}
+
+func TestRoadGraphContractionMatchesDijkstra(t *testing.T) {
+	const n = 12
+	path := writeGridExtract(t, n)
+	plain, err := LoadRoadGraph(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contracted, err := LoadRoadGraph(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contracted.Contract()
+	if plain.Contracted() || !contracted.Contracted() {
+		t.Fatal("only the contracted graph should have a hierarchy")
+	}
+	if stats := plain.Stats(); stats.Vertices != n*n {
+		t.Errorf("%d vertices, want the %d intersections without the footway's", stats.Vertices, n*n)
+	}
+
+	ctx := context.Background()
+	snaps := snapsInGrid(t, plain, n, 15)
+	wantDistances, wantDurations := plain.table(ctx, snaps, snaps)
+	_, gotDurations := contracted.table(ctx, snaps, snaps)
+	asymmetric := false
+	for i := range snaps {
+		for j := range snaps {
+			// Paths of equal duration may differ in length, so only
+			// durations must agree exactly
+			if !closeTo(gotDurations[i][j], wantDurations[i][j]) {
+				t.Errorf("CH table %d→%d takes %v min, Dijkstra %v min", i, j, gotDurations[i][j], wantDurations[i][j])
+			}
+			if !closeTo(wantDurations[i][j], wantDurations[j][i]) {
+				asymmetric = true
+			}
+
+			want, okWant := plain.route(ctx, snaps[i], snaps[j])
+			got, okGot := contracted.route(ctx, snaps[i], snaps[j])
+			if okWant != okGot || !closeTo(got.duration, want.duration) {
+				t.Errorf("CH route %d→%d takes %v min, Dijkstra %v min", i, j, got.duration, want.duration)
+			}
+			if !closeTo(want.duration, wantDurations[i][j]) || !closeTo(want.distance, wantDistances[i][j]) {
+				t.Errorf("route %d→%d (%v km, %v min) disagrees with the table (%v km, %v min)",
+					i, j, want.distance, want.duration, wantDistances[i][j], wantDurations[i][j])
+			}
+		}
+	}
+	if !asymmetric {
+		t.Error("one-way avenues should make some trips longer one way than the other")
+	}
+}
+
+func TestRoadGraphFileRoundTrip(t *testing.T) {
+	const n = 8
+	g, err := LoadRoadGraph(writeGridExtract(t, n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Contract()
+	path := filepath.Join(t.TempDir(), "grid.graph")
+	if err := WriteRoadGraph(g, path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadRoadGraph(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Contracted() || loaded.Stats() != g.Stats() {
+		t.Fatalf("reloaded graph %+v (contracted %v), want %+v contracted", loaded.Stats(), loaded.Contracted(), g.Stats())
+	}
+
+	ctx := context.Background()
+	snaps := snapsInGrid(t, g, n, 10)
+	wantDistances, wantDurations := g.table(ctx, snaps, snaps)
+	gotDistances, gotDurations := loaded.table(ctx, snaps, snaps)
+	for i := range snaps {
+		for j := range snaps {
+			if gotDistances[i][j] != wantDistances[i][j] || gotDurations[i][j] != wantDurations[i][j] {
+				t.Errorf("%d→%d: reloaded %v km %v min, saved %v km %v min",
+					i, j, gotDistances[i][j], gotDurations[i][j], wantDistances[i][j], wantDurations[i][j])
+			}
+		}
+	}
+}
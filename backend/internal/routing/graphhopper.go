@@ -0,0 +1,113 @@
+package routing
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// graphHopperProvider talks to the GraphHopper routing and matrix APIs.
+type graphHopperProvider struct {
+	baseURL string
+	apiKey  string
+	profile string
+	client  *http.Client
+}
+
+func newGraphHopperProvider(cfg Config, client *http.Client) *graphHopperProvider {
+	return &graphHopperProvider{
+		baseURL: orDefault(cfg.BaseURL, "https://graphhopper.com/api/1"),
+		apiKey:  cfg.APIKey,
+		profile: orDefault(cfg.Profile, "car"),
+		client:  client,
+	}
+}
+
+type graphHopperRouteResponse struct {
+	Paths []struct {
+		Distance float64     `json:"distance"` // in meters
+		Time     float64     `json:"time"`     // in milliseconds
+		Points   interface{} `json:"points"`
+	} `json:"paths"`
+}
+
+type graphHopperMatrixResponse struct {
+	Distances [][]*float64 `json:"distances"` // in meters
+	Times     [][]*float64 `json:"times"`     // in seconds
+}
+
+func (p *graphHopperProvider) Name() string { return "graphhopper" }
+
+// The hosted GraphHopper matrix API allows 80 locations on the free plan.
+func (p *graphHopperProvider) matrixLimit() int { return 80 }
+
+// The hosted free plan allows 5 points per route request. Legs are split
+// from the geometry, since GraphHopper only reports route totals.
+func (p *graphHopperProvider) waypointLimit() int { return 5 }
+
+// withKey appends the API key query parameter when one is configured;
+// self-hosted GraphHopper instances do not need one.
+func (p *graphHopperProvider) withKey(query url.Values) string {
+	if p.apiKey != "" {
+		query.Set("key", p.apiKey)
+	}
+	return query.Encode()
+}
+
+func (p *graphHopperProvider) Route(ctx context.Context, waypoints []RoutePoint) (*RouteSegment, error) {
+	query := url.Values{}
+	for _, wp := range waypoints {
+		query.Add("point", strconv.FormatFloat(wp.Lat, 'f', 6, 64)+","+strconv.FormatFloat(wp.Lng, 'f', 6, 64))
+	}
+	query.Set("profile", p.profile)
+	query.Set("points_encoded", "false")
+
+	var resp graphHopperRouteResponse
+	if err := doJSON(ctx, p.client, p.Name(), http.MethodGet, p.baseURL+"/route?"+p.withKey(query), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Paths) == 0 {
+		return nil, ErrNoRoute
+	}
+
+	path := resp.Paths[0]
+	geometry, ok := parseGeometry(path.Points, 5)
+	if !ok {
+		return nil, ErrBadResponse
+	}
+	return &RouteSegment{
+		Distance: path.Distance / 1000.0,
+		Duration: path.Time / 60000.0,
+		Geometry: geometry,
+	}, nil
+}
+
+func (p *graphHopperProvider) Matrix(ctx context.Context, sources, destinations []RoutePoint) (*Matrix, error) {
+	body := map[string]interface{}{
+		"from_points": lngLatPairs(sources),
+		"to_points":   lngLatPairs(destinations),
+		"out_arrays":  []string{"distances", "times"},
+		"profile":     p.profile,
+	}
+
+	var resp graphHopperMatrixResponse
+	if err := doJSON(ctx, p.client, p.Name(), http.MethodPost, p.baseURL+"/matrix?"+p.withKey(url.Values{}), nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return buildMatrix(len(sources), len(destinations), func(i, j int) (float64, float64, bool) {
+		if i >= len(resp.Distances) || j >= len(resp.Distances[i]) || i >= len(resp.Times) || j >= len(resp.Times[i]) {
+			return 0, 0, false
+		}
+		dist, dur := resp.Distances[i][j], resp.Times[i][j]
+		if dist == nil || dur == nil {
+			return math.Inf(1), math.Inf(1), true // unreachable
+		}
+		return *dist / 1000.0, *dur / 60.0, true
+	})
+}
+
+func (p *graphHopperProvider) Health(ctx context.Context) error {
+	return doJSON(ctx, p.client, p.Name(), http.MethodGet, p.baseURL+"/health", nil, nil, nil)
+}
@@ -0,0 +1,264 @@
+package routing
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultWaypointLimit applies to providers that do not declare a limit.
+const defaultWaypointLimit = 25
+
+// RouteLeg is the part of a multi-waypoint route between two consecutive
+// waypoints. Consecutive legs share their joining point, so one leg's
+// GeometryEnd is the next leg's GeometryStart.
+type RouteLeg struct {
+	Distance       float64 `json:"distance"`                 // in kilometers
+	Duration       float64 `json:"duration"`                 // in minutes
+	GeometryStart  int     `json:"geometryStart"`            // index of the leg's first point in the route geometry
+	GeometryEnd    int     `json:"geometryEnd"`              // index of the leg's last point
+	Source         string  `json:"source"`                   // provider name, or "fallback" for a straight line
+	FallbackReason string  `json:"fallbackReason,omitempty"` // why the provider route was not used
+	Steps          []Step  `json:"steps,omitempty"`          // turn-by-turn directions, for providers that report them
+}
+
+// Step is one maneuver of a leg's turn-by-turn directions.
+type Step struct {
+	Instruction   string  `json:"instruction"`      // e.g. "Turn left onto 5th Avenue North"
+	Street        string  `json:"street,omitempty"` // street the step drives along
+	Distance      float64 `json:"distance"`         // in kilometers
+	Duration      float64 `json:"duration"`         // in minutes
+	Maneuver      string  `json:"maneuver"`         // one of the Maneuver constants
+	GeometryStart int     `json:"geometryStart"`    // index of the step's first point in the route geometry
+	GeometryEnd   int     `json:"geometryEnd"`      // index of the step's last point
+}
+
+// Maneuvers a Step can report.
+const (
+	ManeuverDepart          = "depart"
+	ManeuverArrive          = "arrive"
+	ManeuverStraight        = "straight"
+	ManeuverTurnLeft        = "turn-left"
+	ManeuverTurnRight       = "turn-right"
+	ManeuverSharpLeft       = "sharp-left"
+	ManeuverSharpRight      = "sharp-right"
+	ManeuverSlightLeft      = "slight-left"
+	ManeuverSlightRight     = "slight-right"
+	ManeuverKeepLeft        = "keep-left"
+	ManeuverKeepRight       = "keep-right"
+	ManeuverUTurn           = "u-turn"
+	ManeuverEnterRoundabout = "enter-roundabout"
+	ManeuverExitRoundabout  = "exit-roundabout"
+)
+
+// waypointLimiter is implemented by providers whose directions endpoint caps
+// the number of waypoints per request. A limit of zero or less means no cap.
+type waypointLimiter interface {
+	waypointLimit() int
+}
+
+// GetRouteThrough routes through all waypoints with as few provider requests
+// as the provider's waypoint limit allows, instead of one request per leg.
+// Chunks that fail fall back to straight legs, so the result always has one
+// leg per consecutive waypoint pair and never an error.
+func GetRouteThrough(ctx context.Context, provider Provider, waypoints []RoutePoint) *RouteSegment {
+	result := &RouteSegment{Geometry: []RoutePoint{}, Legs: []RouteLeg{}}
+	if len(waypoints) < 2 {
+		result.Geometry = append(result.Geometry, waypoints...)
+		return result
+	}
+
+	limit := defaultWaypointLimit
+	if limiter, ok := provider.(waypointLimiter); ok {
+		limit = limiter.waypointLimit()
+	}
+	if limit <= 1 || limit > len(waypoints) {
+		limit = len(waypoints)
+	}
+
+	// Chunks overlap by one waypoint so every leg belongs to exactly one chunk
+	for start := 0; start < len(waypoints)-1; start += limit - 1 {
+		end := min(start+limit-1, len(waypoints)-1)
+		chunk := routeChunk(ctx, provider, waypoints[start:end+1])
+		appendSegment(result, chunk)
+	}
+
+	result.Source = SourceFallback
+	for _, leg := range result.Legs {
+		if leg.Source != SourceFallback {
+			result.Source = leg.Source
+			break
+		}
+	}
+	if result.Source == SourceFallback {
+		result.FallbackReason = result.Legs[0].FallbackReason
+	}
+	return result
+}
+
+// GetRoutesThrough routes many waypoint lists concurrently, bounded by the
+// configured routing concurrency.
+func GetRoutesThrough(ctx context.Context, provider Provider, routes [][]RoutePoint) []*RouteSegment {
+	results := make([]*RouteSegment, len(routes))
+	forEachConcurrently(len(routes), func(i int) {
+		results[i] = GetRouteThrough(ctx, provider, routes[i])
+	})
+	return results
+}
+
+// routeChunk fetches one chunk and makes sure it carries one leg per
+// waypoint pair, falling back leg by leg when the provider fails.
+func routeChunk(ctx context.Context, provider Provider, waypoints []RoutePoint) *RouteSegment {
+	reason := ReasonNoProvider
+	if provider != nil {
+		segment, err := provider.Route(ctx, waypoints)
+		if err == nil && len(segment.Geometry) > 0 {
+			name := provider.Name()
+			if len(segment.Legs) != len(waypoints)-1 {
+				segment.Legs = proportionalLegs(segment, splitGeometry(segment.Geometry, waypoints))
+			}
+			for i := range segment.Legs {
+				segment.Legs[i].Source = name
+			}
+			defaultCalibration().observeRoute(name, waypoints, segment)
+			return segment
+		}
+		reason = ReasonEmptyRoute
+		if err != nil {
+			reason = fallbackReason(err)
+		}
+	}
+
+	chunk := &RouteSegment{}
+	for i := 0; i < len(waypoints)-1; i++ {
+		from, to := waypoints[i], waypoints[i+1]
+		appendSegment(chunk, fallbackLeg(provider, from, to, reason))
+	}
+	return chunk
+}
+
+// appendSegment joins next onto route, dropping the duplicated junction
+// point and shifting next's leg indices into route's geometry.
+func appendSegment(route, next *RouteSegment) {
+	offset := 0
+	geometry := next.Geometry
+	if len(route.Geometry) > 0 && len(geometry) > 0 {
+		offset = len(route.Geometry) - 1
+		geometry = geometry[1:]
+	}
+	route.Geometry = append(route.Geometry, geometry...)
+	route.Distance += next.Distance
+	route.Duration += next.Duration
+
+	legs := next.Legs
+	if len(legs) == 0 {
+		// A plain two-point segment is a single leg
+		legs = []RouteLeg{{
+			Distance:       next.Distance,
+			Duration:       next.Duration,
+			GeometryStart:  0,
+			GeometryEnd:    len(next.Geometry) - 1,
+			Source:         next.Source,
+			FallbackReason: next.FallbackReason,
+		}}
+	}
+	for _, leg := range legs {
+		leg.GeometryStart += offset
+		leg.GeometryEnd += offset
+		if offset > 0 && len(leg.Steps) > 0 {
+			// Copy so cached routes keep their own indices
+			steps := make([]Step, len(leg.Steps))
+			for i, step := range leg.Steps {
+				step.GeometryStart += offset
+				step.GeometryEnd += offset
+				steps[i] = step
+			}
+			leg.Steps = steps
+		}
+		route.Legs = append(route.Legs, leg)
+	}
+}
+
+// splitGeometry finds, for each waypoint, the index of the closest geometry
+// point at or after the previous waypoint's, for providers that do not
+// report where each leg starts.
+func splitGeometry(geometry []RoutePoint, waypoints []RoutePoint) []int {
+	splits := make([]int, len(waypoints))
+	splits[len(splits)-1] = len(geometry) - 1
+	from := 0
+	for w := 1; w < len(waypoints)-1; w++ {
+		best, bestDist := from, -1.0
+		for i := from; i < len(geometry); i++ {
+			d := haversineDistance(geometry[i].Lat, geometry[i].Lng, waypoints[w].Lat, waypoints[w].Lng)
+			if bestDist < 0 || d < bestDist {
+				best, bestDist = i, d
+			}
+		}
+		splits[w] = best
+		from = best
+	}
+	return splits
+}
+
+// proportionalLegs builds legs from split indices, sharing the route's
+// distance and duration out by each leg's share of the geometry length.
+func proportionalLegs(segment *RouteSegment, splits []int) []RouteLeg {
+	lengths := make([]float64, len(splits)-1)
+	total := 0.0
+	for l := range lengths {
+		for i := splits[l]; i < splits[l+1]; i++ {
+			lengths[l] += haversineDistance(segment.Geometry[i].Lat, segment.Geometry[i].Lng, segment.Geometry[i+1].Lat, segment.Geometry[i+1].Lng)
+		}
+		total += lengths[l]
+	}
+
+	legs := make([]RouteLeg, len(lengths))
+	for l := range legs {
+		share := 1.0 / float64(len(legs))
+		if total > 0 {
+			share = lengths[l] / total
+		}
+		legs[l] = RouteLeg{
+			Distance:      segment.Distance * share,
+			Duration:      segment.Duration * share,
+			GeometryStart: splits[l],
+			GeometryEnd:   splits[l+1],
+		}
+	}
+	return legs
+}
+
+// legsFromSplits builds legs from per-leg totals reported by the provider
+// and the geometry index where each waypoint falls.
+func legsFromSplits(splits []int, distances, durations []float64) []RouteLeg {
+	legs := make([]RouteLeg, len(distances))
+	for l := range legs {
+		legs[l] = RouteLeg{
+			Distance:      distances[l],
+			Duration:      durations[l],
+			GeometryStart: splits[l],
+			GeometryEnd:   splits[l+1],
+		}
+	}
+	return legs
+}
+
+// forEachConcurrently calls fn for 0..n-1 on a pool sized by the configured
+// routing concurrency.
+func forEachConcurrently(n int, fn func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < ResilienceConfigFromEnv().Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,136 @@
+package routing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// waypointsAlong returns n points on a line heading northeast.
+func waypointsAlong(n int) []RoutePoint {
+	points := make([]RoutePoint, n)
+	for i := range points {
+		points[i] = RoutePoint{Lat: 33.50 + float64(i)*0.002, Lng: -86.82 + float64(i)*0.003}
+	}
+	return points
+}
+
+func TestGetRouteThroughChunks(t *testing.T) {
+	tests := []struct {
+		name         string
+		flavor       string
+		waypoints    int
+		failCall     int64 // request answered with HTTP 500, 0 for none
+		wantRequests int64
+	}{
+		{"fits one request", "valhalla", 20, 0, 1},
+		{"graphhopper limit 5", "graphhopper", 12, 0, 3}, // 11 legs, 4 per chunk
+		{"valhalla limit 20", "valhalla", 40, 0, 3},      // 39 legs, 19 per chunk
+		{"osrm limit 100", "osrm", 100, 0, 1},            // exactly at the limit
+		{"ors limit 50", "ors", 120, 0, 3},               // 119 legs, 49 per chunk
+		{"failed chunk", "graphhopper", 12, 2, 3 + 1},    // the failed chunk is retried once
+		{"two waypoints", "ors", 2, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeProvider()
+			var before func(http.ResponseWriter, *http.Request, int64) bool
+			if tt.failCall > 0 {
+				// Fail the chunk's first attempt and its retry
+				before = func(w http.ResponseWriter, r *http.Request, call int64) bool {
+					if call == tt.failCall || call == tt.failCall+1 {
+						w.WriteHeader(http.StatusInternalServerError)
+						return true
+					}
+					return false
+				}
+			}
+			provider, stub := newStubProvider(t, tt.flavor, fake, before)
+			waypoints := waypointsAlong(tt.waypoints)
+
+			route := GetRouteThrough(context.Background(), provider, waypoints)
+
+			if got := stub.calls.Load(); got != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", got, tt.wantRequests)
+			}
+			if len(route.Legs) != len(waypoints)-1 {
+				t.Fatalf("got %d legs, want %d", len(route.Legs), len(waypoints)-1)
+			}
+
+			fallbacks := 0
+			distance := 0.0
+			for i, leg := range route.Legs {
+				if leg.Source == SourceFallback {
+					fallbacks++
+					if leg.FallbackReason != "http-500" {
+						t.Errorf("leg %d fallback reason = %q", i, leg.FallbackReason)
+					}
+				} else if leg.Source != provider.Name() {
+					t.Errorf("leg %d source = %q", i, leg.Source)
+				}
+				if i > 0 && leg.GeometryStart != route.Legs[i-1].GeometryEnd {
+					t.Errorf("leg %d starts at %d, previous ends at %d", i, leg.GeometryStart, route.Legs[i-1].GeometryEnd)
+				}
+				start, end := route.Geometry[leg.GeometryStart], route.Geometry[leg.GeometryEnd]
+				if !samePoint(start, waypoints[i]) || !samePoint(end, waypoints[i+1]) {
+					t.Errorf("leg %d runs %+v to %+v, want %+v to %+v", i, start, end, waypoints[i], waypoints[i+1])
+				}
+				distance += leg.Distance
+			}
+			if route.Legs[len(route.Legs)-1].GeometryEnd != len(route.Geometry)-1 {
+				t.Errorf("last leg ends at %d of %d points", route.Legs[len(route.Legs)-1].GeometryEnd, len(route.Geometry))
+			}
+			if !closeTo(distance, route.Distance) {
+				t.Errorf("legs sum to %v km, route is %v km", distance, route.Distance)
+			}
+
+			wantFallbacks := 0
+			if tt.failCall > 0 {
+				wantFallbacks = 4 // the second chunk of 4 legs
+			}
+			if fallbacks != wantFallbacks {
+				t.Errorf("%d fallback legs, want %d", fallbacks, wantFallbacks)
+			}
+			if wantFallbacks == 0 {
+				want, _ := fake.Route(context.Background(), waypoints)
+				if !closeTo(route.Distance, want.Distance) {
+					t.Errorf("distance = %v km, want %v", route.Distance, want.Distance)
+				}
+			}
+		})
+	}
+}
+
+// samePoint compares points to the precision the providers send.
+func samePoint(a, b RoutePoint) bool {
+	return closeTo(a.Lat, b.Lat) && closeTo(a.Lng, b.Lng)
+}
+
+func TestGetRouteThroughKeepsSteps(t *testing.T) {
+	provider, _ := newStubProvider(t, "ors", NewFakeProvider(), nil)
+	waypoints := waypointsAlong(120) // three requests
+
+	route := GetRouteThrough(context.Background(), provider, waypoints)
+
+	for i, leg := range route.Legs {
+		if len(leg.Steps) == 0 {
+			t.Fatalf("leg %d has no steps", i)
+		}
+		if first, last := leg.Steps[0], leg.Steps[len(leg.Steps)-1]; first.Maneuver != ManeuverDepart || last.Maneuver != ManeuverArrive {
+			t.Errorf("leg %d runs %q to %q, want depart to arrive", i, first.Maneuver, last.Maneuver)
+		}
+		distance := 0.0
+		for j, step := range leg.Steps {
+			// Steps index the whole route's geometry, not their request's
+			if step.GeometryStart < leg.GeometryStart || step.GeometryEnd > leg.GeometryEnd || step.GeometryStart > step.GeometryEnd {
+				t.Errorf("leg %d step %d covers points %d-%d, outside the leg's %d-%d",
+					i, j, step.GeometryStart, step.GeometryEnd, leg.GeometryStart, leg.GeometryEnd)
+			}
+			distance += step.Distance
+		}
+		if !closeTo(distance, leg.Distance) {
+			t.Errorf("leg %d steps sum to %v km, leg is %v km", i, distance, leg.Distance)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	// defaultMatrixLimit applies to providers that do not declare a limit.
+	defaultMatrixLimit = 50
+	// matrixConcurrency bounds how many matrix blocks are requested at once.
+	matrixConcurrency = 4
+	// defaultMatrixMaxRequests keeps one matrix to about 20 seconds of the
+	// public ORS plan's 5 requests per second, which fits about 240 orders.
+	defaultMatrixMaxRequests = 100
+)
+
+// ErrMatrixTooLarge is returned, before any request is made, when a matrix
+// would take more provider requests than the budget allows.
+var ErrMatrixTooLarge = errors.New("routing: matrix needs too many provider requests")
+
+// MatrixMaxRequestsFromEnv reads ROUTING_MATRIX_MAX_REQUESTS, the most
+// provider requests one batched matrix may make.
+func MatrixMaxRequestsFromEnv() int {
+	if v, err := strconv.Atoi(os.Getenv("ROUTING_MATRIX_MAX_REQUESTS")); err == nil && v > 0 {
+		return v
+	}
+	return defaultMatrixMaxRequests
+}
+
+// matrixCellsKey carries the size of the whole matrix BatchMatrix is fetching
+// to the providers answering its tiles.
+type matrixCellsKey struct{}
+
+// matrixCells is the number of cells in the whole matrix a sources ×
+// destinations request belongs to.
+func matrixCells(ctx context.Context, sources, destinations int) int {
+	if cells, ok := ctx.Value(matrixCellsKey{}).(int); ok {
+		return cells
+	}
+	return sources * destinations
+}
+
+// matrixBlock is the side of the square tiles BatchMatrix requests, or 0
+// when the whole matrix fits in one request.
+func matrixBlock(provider Provider, sources, destinations int) int {
+	limit := defaultMatrixLimit
+	if limiter, ok := provider.(matrixLimiter); ok {
+		limit = limiter.matrixLimit()
+	}
+	if limit <= 0 || sources+destinations <= limit {
+		return 0
+	}
+	return max(limit/2, 1)
+}
+
+// MatrixRequests is how many provider requests BatchMatrix makes for a
+// sources × destinations matrix.
+func MatrixRequests(provider Provider, sources, destinations int) int {
+	block := matrixBlock(provider, sources, destinations)
+	if block == 0 {
+		return 1
+	}
+	return ((sources + block - 1) / block) * ((destinations + block - 1) / block)
+}
+
+// matrixLimiter is implemented by providers whose matrix endpoint caps the
+// number of locations (sources plus destinations) per request. A limit of
+// zero or less means no cap.
+type matrixLimiter interface {
+	matrixLimit() int
+}
+
+// BatchMatrix fetches a sources × destinations matrix in blocks small enough
+// for the provider's request limits and stitches them back together. Any
+// failed block fails the whole matrix, so a matrix needing more requests
+// than MatrixMaxRequestsFromEnv allows fails with ErrMatrixTooLarge up front.
+func BatchMatrix(ctx context.Context, provider Provider, sources, destinations []RoutePoint) (*Matrix, error) {
+	block := matrixBlock(provider, len(sources), len(destinations))
+	if block == 0 {
+		return provider.Matrix(ctx, sources, destinations)
+	}
+	if requests, budget := MatrixRequests(provider, len(sources), len(destinations)), MatrixMaxRequestsFromEnv(); requests > budget {
+		return nil, fmt.Errorf("%w: %d for %d×%d locations, budget %d", ErrMatrixTooLarge, requests, len(sources), len(destinations), budget)
+	}
+
+	result := &Matrix{
+		Distances: make([][]float64, len(sources)),
+		Durations: make([][]float64, len(sources)),
+	}
+	for i := range sources {
+		result.Distances[i] = make([]float64, len(destinations))
+		result.Durations[i] = make([]float64, len(destinations))
+	}
+
+	type tile struct{ row, col int }
+	tiles := make(chan tile)
+	ctx = context.WithValue(ctx, matrixCellsKey{}, len(sources)*len(destinations))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for w := 0; w < matrixConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tiles {
+				rowEnd := min(t.row+block, len(sources))
+				colEnd := min(t.col+block, len(destinations))
+				part, err := provider.Matrix(ctx, sources[t.row:rowEnd], destinations[t.col:colEnd])
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				// Tiles never overlap, so rows can be written without locking.
+				for i := range part.Distances {
+					copy(result.Distances[t.row+i][t.col:colEnd], part.Distances[i])
+					copy(result.Durations[t.row+i][t.col:colEnd], part.Durations[i])
+				}
+			}
+		}()
+	}
+
+feed:
+	for row := 0; row < len(sources); row += block {
+		for col := 0; col < len(destinations); col += block {
+			select {
+			case tiles <- tile{row, col}:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+	}
+	close(tiles)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
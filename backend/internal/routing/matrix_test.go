@@ -0,0 +1,59 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestBatchMatrix(t *testing.T) {
+	tests := []struct {
+		name         string
+		flavor       string
+		sources      int
+		destinations int
+		budget       int
+		wantRequests int64
+		wantErr      error
+	}{
+		{"one request", "ors", 10, 40, 100, 1, nil},
+		{"ors tiles of 25", "ors", 60, 50, 100, 3 * 2, nil},
+		{"osrm tiles of 50", "osrm", 60, 50, 100, 2 * 1, nil},
+		{"over budget", "ors", 60, 50, 5, 0, ErrMatrixTooLarge},
+		{"at budget", "valhalla", 60, 50, 6, 6, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeProvider()
+			provider, stub := newStubProvider(t, tt.flavor, fake, nil)
+			t.Setenv("ROUTING_MATRIX_MAX_REQUESTS", strconv.Itoa(tt.budget))
+			points := waypointsAlong(max(tt.sources, tt.destinations))
+			sources, destinations := points[:tt.sources], points[len(points)-tt.destinations:]
+
+			got, err := BatchMatrix(context.Background(), provider, sources, destinations)
+			if requests := stub.calls.Load(); requests != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", requests, tt.wantRequests)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want, _ := fake.Matrix(context.Background(), sources, destinations)
+			for i := range sources {
+				for j := range destinations {
+					if !closeTo(got.Distances[i][j], want.Distances[i][j]) || !closeTo(got.Durations[i][j], want.Durations[i][j]) {
+						t.Fatalf("cell %d,%d = %v, %v; want %v, %v", i, j, got.Distances[i][j], got.Durations[i][j], want.Distances[i][j], want.Durations[i][j])
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package routing
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const publicNominatim = "https://nominatim.openstreetmap.org"
+
+// nominatimGeocoder talks to the Nominatim search API.
+type nominatimGeocoder struct {
+	baseURL string
+	client  *http.Client
+
+	// The public instance allows one request per second from each client,
+	// well under the guard's default rate.
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newNominatimGeocoder(cfg GeocoderConfig, client *http.Client) *nominatimGeocoder {
+	g := &nominatimGeocoder{
+		baseURL: orDefault(cfg.BaseURL, publicNominatim),
+		client:  client,
+	}
+	if g.baseURL == publicNominatim {
+		g.interval = time.Second
+	}
+	return g
+}
+
+type nominatimPlace struct {
+	Lat         string `json:"lat"`
+	Lon         string `json:"lon"`
+	DisplayName string `json:"display_name"`
+	PlaceRank   int    `json:"place_rank"` // 30 for a house, 26 for a street, lower for areas
+}
+
+func (g *nominatimGeocoder) Name() string { return "nominatim" }
+
+func (g *nominatimGeocoder) Geocode(ctx context.Context, address string) (*GeocodeResult, error) {
+	if err := g.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"q": {address}, "format": {"jsonv2"}, "limit": {"1"}}
+	var places []nominatimPlace
+	// Nominatim's usage policy requires an identifying User-Agent
+	headers := map[string]string{"User-Agent": "shipt-route-optimizer"}
+	if err := doJSON(ctx, g.client, g.Name(), http.MethodGet, g.baseURL+"/search?"+query.Encode(), headers, nil, &places); err != nil {
+		return nil, err
+	}
+	if len(places) == 0 {
+		return nil, ErrNoMatch
+	}
+	place := places[0]
+	lat, errLat := strconv.ParseFloat(strings.TrimSpace(place.Lat), 64)
+	lng, errLng := strconv.ParseFloat(strings.TrimSpace(place.Lon), 64)
+	if errLat != nil || errLng != nil {
+		return nil, ErrBadResponse
+	}
+	// Nominatim reports no confidence; how specific the match is stands in,
+	// so a street or town matched for a house address scores lower.
+	confidence := math.Round(float64(min(max(place.PlaceRank, 0), 30))/30*100) / 100
+	return &GeocodeResult{
+		Lat:        lat,
+		Lng:        lng,
+		Confidence: confidence,
+		Label:      place.DisplayName,
+		Source:     g.Name(),
+	}, nil
+}
+
+// wait spaces requests interval apart.
+func (g *nominatimGeocoder) wait(ctx context.Context) error {
+	if g.interval <= 0 {
+		return nil
+	}
+	g.mu.Lock()
+	now := time.Now()
+	at := g.next
+	if at.Before(now) {
+		at = now
+	}
+	g.next = at.Add(g.interval)
+	g.mu.Unlock()
+
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
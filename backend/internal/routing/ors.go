@@ -0,0 +1,370 @@
+package routing
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+)
+
+// orsProvider talks to the OpenRouteService v2 API.
+type orsProvider struct {
+	baseURL string
+	apiKey  string
+	profile string
+	client  *http.Client
+}
+
+func newORSProvider(cfg Config, client *http.Client) *orsProvider {
+	return &orsProvider{
+		baseURL: orDefault(cfg.BaseURL, "https://api.openrouteservice.org"),
+		apiKey:  cfg.APIKey,
+		profile: orDefault(cfg.Profile, "driving-car"),
+		client:  client,
+	}
+}
+
+// openRouteServiceResponse represents the API response
+// The geometry can be either a string (encoded) or an array of coordinates
+type openRouteServiceResponse struct {
+	Routes []struct {
+		Summary struct {
+			Distance float64 `json:"distance"` // in meters
+			Duration float64 `json:"duration"` // in seconds
+		} `json:"summary"`
+		Geometry interface{} `json:"geometry"` // Can be string or coordinate array
+		Segments []struct {
+			Distance float64   `json:"distance"` // in meters
+			Duration float64   `json:"duration"` // in seconds
+			Steps    []orsStep `json:"steps"`
+		} `json:"segments"` // one per waypoint pair
+		WayPoints []int `json:"way_points"` // geometry index of each waypoint
+	} `json:"routes"`
+}
+
+// orsStep is one instruction of a directions segment.
+type orsStep struct {
+	Distance    float64 `json:"distance"` // in meters
+	Duration    float64 `json:"duration"` // in seconds
+	Type        int     `json:"type"`
+	Instruction string  `json:"instruction"`
+	Name        string  `json:"name"`       // "-" when the road has no name
+	WayPoints   [2]int  `json:"way_points"` // geometry index range of the step
+}
+
+// orsManeuvers maps ORS instruction types, by number, to maneuvers.
+var orsManeuvers = []string{
+	ManeuverTurnLeft,
+	ManeuverTurnRight,
+	ManeuverSharpLeft,
+	ManeuverSharpRight,
+	ManeuverSlightLeft,
+	ManeuverSlightRight,
+	ManeuverStraight,
+	ManeuverEnterRoundabout,
+	ManeuverExitRoundabout,
+	ManeuverUTurn,
+	ManeuverArrive,
+	ManeuverDepart,
+	ManeuverKeepLeft,
+	ManeuverKeepRight,
+}
+
+// orsManeuverType is the ORS instruction type for a maneuver.
+func orsManeuverType(maneuver string) int {
+	for i, m := range orsManeuvers {
+		if m == maneuver {
+			return i
+		}
+	}
+	return 6 // straight
+}
+
+func (s orsStep) step() Step {
+	maneuver := ManeuverStraight
+	if s.Type >= 0 && s.Type < len(orsManeuvers) {
+		maneuver = orsManeuvers[s.Type]
+	}
+	street := s.Name
+	if street == "-" {
+		street = ""
+	}
+	return Step{
+		Instruction:   s.Instruction,
+		Street:        street,
+		Distance:      s.Distance / 1000.0,
+		Duration:      s.Duration / 60.0,
+		Maneuver:      maneuver,
+		GeometryStart: s.WayPoints[0],
+		GeometryEnd:   s.WayPoints[1],
+	}
+}
+
+type orsMatrixResponse struct {
+	Distances [][]*float64 `json:"distances"` // in kilometers (units=km)
+	Durations [][]*float64 `json:"durations"` // in seconds
+}
+
+func (p *orsProvider) Name() string { return "ors" }
+
+// ORS counts sources and destinations together; the public API allows 50 locations.
+func (p *orsProvider) matrixLimit() int { return 50 }
+
+// The public directions API accepts up to 50 waypoints per request.
+func (p *orsProvider) waypointLimit() int { return 50 }
+
+func (p *orsProvider) headers() map[string]string {
+	return map[string]string{"Authorization": p.apiKey}
+}
+
+func (p *orsProvider) Route(ctx context.Context, waypoints []RoutePoint) (*RouteSegment, error) {
+	return p.routeAvoiding(ctx, waypoints, nil)
+}
+
+// routeAvoiding passes the areas as ORS avoid_polygons.
+func (p *orsProvider) routeAvoiding(ctx context.Context, waypoints []RoutePoint, areas []AvoidArea) (*RouteSegment, error) {
+	if p.apiKey == "" {
+		return nil, ErrNoAPIKey
+	}
+
+	// Request JSON format (not encoded); OpenRouteService uses [lng, lat] order
+	body := map[string]interface{}{
+		"coordinates":  lngLatPairs(waypoints),
+		"geometry":     true,
+		"instructions": true,
+	}
+	if len(areas) > 0 {
+		body["options"] = map[string]interface{}{"avoid_polygons": multiPolygon(areas)}
+	}
+
+	var orsResp openRouteServiceResponse
+	url := p.baseURL + "/v2/directions/" + p.profile + "/json"
+	if err := doJSON(ctx, p.client, p.Name(), http.MethodPost, url, p.headers(), body, &orsResp); err != nil {
+		return nil, err
+	}
+
+	if len(orsResp.Routes) == 0 {
+		return nil, ErrNoRoute
+	}
+
+	route := orsResp.Routes[0]
+	geometry, ok := parseGeometry(route.Geometry, 5)
+	if !ok {
+		return nil, ErrBadResponse
+	}
+
+	segment := &RouteSegment{
+		Distance: route.Summary.Distance / 1000.0, // convert meters to km
+		Duration: route.Summary.Duration / 60.0,   // convert seconds to minutes
+		Geometry: geometry,
+	}
+	if len(route.Segments) == len(waypoints)-1 && len(route.WayPoints) == len(waypoints) {
+		distances := make([]float64, len(route.Segments))
+		durations := make([]float64, len(route.Segments))
+		for i, seg := range route.Segments {
+			distances[i], durations[i] = seg.Distance/1000.0, seg.Duration/60.0
+		}
+		segment.Legs = legsFromSplits(route.WayPoints, distances, durations)
+		for i, seg := range route.Segments {
+			for _, step := range seg.Steps {
+				segment.Legs[i].Steps = append(segment.Legs[i].Steps, step.step())
+			}
+		}
+	}
+	return segment, nil
+}
+
+// multiPolygon is the areas as one GeoJSON MultiPolygon with closed rings.
+func multiPolygon(areas []AvoidArea) map[string]interface{} {
+	polygons := [][][][]float64{}
+	for _, area := range areas {
+		for _, polygon := range area.Polygons {
+			rings := make([][][]float64, len(polygon))
+			for i, ring := range polygon {
+				rings[i] = lngLatPairs(append(ring[:len(ring):len(ring)], ring[0]))
+			}
+			polygons = append(polygons, rings)
+		}
+	}
+	return map[string]interface{}{"type": "MultiPolygon", "coordinates": polygons}
+}
+
+func (p *orsProvider) Matrix(ctx context.Context, sources, destinations []RoutePoint) (*Matrix, error) {
+	if p.apiKey == "" {
+		return nil, ErrNoAPIKey
+	}
+
+	locations, sourceIdx, destIdx := combineLocations(sources, destinations)
+	body := map[string]interface{}{
+		"locations":    lngLatPairs(locations),
+		"sources":      sourceIdx,
+		"destinations": destIdx,
+		"metrics":      []string{"distance", "duration"},
+		"units":        "km",
+	}
+
+	var resp orsMatrixResponse
+	url := p.baseURL + "/v2/matrix/" + p.profile
+	if err := doJSON(ctx, p.client, p.Name(), http.MethodPost, url, p.headers(), body, &resp); err != nil {
+		return nil, err
+	}
+	return buildMatrix(len(sources), len(destinations), func(i, j int) (float64, float64, bool) {
+		if i >= len(resp.Distances) || j >= len(resp.Distances[i]) || i >= len(resp.Durations) || j >= len(resp.Durations[i]) {
+			return 0, 0, false
+		}
+		dist, dur := resp.Distances[i][j], resp.Durations[i][j]
+		if dist == nil || dur == nil {
+			return math.Inf(1), math.Inf(1), true // unreachable
+		}
+		return *dist, *dur / 60.0, true
+	})
+}
+
+func (p *orsProvider) Health(ctx context.Context) error {
+	return doJSON(ctx, p.client, p.Name(), http.MethodGet, p.baseURL+"/v2/health", p.headers(), nil, nil)
+}
+
+// parseGeometry reads a route geometry that can be a GeoJSON object, a bare
+// [lng, lat] coordinate array, or an encoded polyline string.
+func parseGeometry(raw interface{}, precision int) ([]RoutePoint, bool) {
+	switch geom := raw.(type) {
+	case map[string]interface{}:
+		// GeoJSON format: {"coordinates": [[lng, lat], ...]}
+		coords, ok := geom["coordinates"].([]interface{})
+		if !ok {
+			return nil, false
+		}
+		return parseCoordinateArray(coords), true
+	case string:
+		// Encoded polyline format - decode it
+		return decodePolylinePrecision(geom, precision), true
+	case []interface{}:
+		// Direct array of coordinates
+		return parseCoordinateArray(geom), true
+	default:
+		return nil, false
+	}
+}
+
+func parseCoordinateArray(coords []interface{}) []RoutePoint {
+	geometry := []RoutePoint{}
+	for _, coordInterface := range coords {
+		if coord, ok := coordInterface.([]interface{}); ok && len(coord) >= 2 {
+			lng, _ := coord[0].(float64)
+			lat, _ := coord[1].(float64)
+			geometry = append(geometry, RoutePoint{Lat: lat, Lng: lng})
+		}
+	}
+	return geometry
+}
+
+func lngLatPairs(points []RoutePoint) [][]float64 {
+	pairs := make([][]float64, len(points))
+	for i, p := range points {
+		pairs[i] = []float64{p.Lng, p.Lat}
+	}
+	return pairs
+}
+
+// combineLocations concatenates sources and destinations into one location
+// list and returns the indices of each group, as matrix APIs expect.
+func combineLocations(sources, destinations []RoutePoint) ([]RoutePoint, []int, []int) {
+	locations := make([]RoutePoint, 0, len(sources)+len(destinations))
+	locations = append(locations, sources...)
+	locations = append(locations, destinations...)
+	sourceIdx := make([]int, len(sources))
+	for i := range sources {
+		sourceIdx[i] = i
+	}
+	destIdx := make([]int, len(destinations))
+	for i := range destinations {
+		destIdx[i] = len(sources) + i
+	}
+	return locations, sourceIdx, destIdx
+}
+
+// buildMatrix fills a Matrix from a cell accessor returning distance (km),
+// duration (minutes) and whether the response had the cell at all. Pairs the
+// provider cannot route are +Inf and the rest of the matrix is kept; a
+// response short of cells is ErrBadResponse, and one with no routable pair
+// is ErrNoRoute.
+func buildMatrix(rows, cols int, cell func(i, j int) (float64, float64, bool)) (*Matrix, error) {
+	m := &Matrix{
+		Distances: make([][]float64, rows),
+		Durations: make([][]float64, rows),
+	}
+	routable := false
+	for i := 0; i < rows; i++ {
+		m.Distances[i] = make([]float64, cols)
+		m.Durations[i] = make([]float64, cols)
+		for j := 0; j < cols; j++ {
+			dist, dur, ok := cell(i, j)
+			if !ok {
+				return nil, ErrBadResponse
+			}
+			m.Distances[i][j] = dist
+			m.Durations[i][j] = dur
+			routable = routable || !math.IsInf(dur, 1)
+		}
+	}
+	if !routable && rows > 0 && cols > 0 {
+		return nil, ErrNoRoute
+	}
+	return m, nil
+}
+
+// orsGeocoder talks to the OpenRouteService geocode API, a hosted Pelias.
+type orsGeocoder struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func newORSGeocoder(cfg GeocoderConfig, client *http.Client) *orsGeocoder {
+	return &orsGeocoder{
+		baseURL: orDefault(cfg.BaseURL, "https://api.openrouteservice.org"),
+		apiKey:  cfg.APIKey,
+		client:  client,
+	}
+}
+
+type orsGeocodeResponse struct {
+	Features []struct {
+		Geometry struct {
+			Coordinates []float64 `json:"coordinates"` // [lng, lat]
+		} `json:"geometry"`
+		Properties struct {
+			Label      string  `json:"label"`
+			Confidence float64 `json:"confidence"` // 0-1
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+func (g *orsGeocoder) Name() string { return "ors" }
+
+func (g *orsGeocoder) Geocode(ctx context.Context, address string) (*GeocodeResult, error) {
+	if g.apiKey == "" {
+		return nil, ErrNoAPIKey
+	}
+
+	query := url.Values{"text": {address}, "size": {"1"}}
+	var resp orsGeocodeResponse
+	headers := map[string]string{"Authorization": g.apiKey}
+	if err := doJSON(ctx, g.client, g.Name(), http.MethodGet, g.baseURL+"/geocode/search?"+query.Encode(), headers, nil, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Features) == 0 {
+		return nil, ErrNoMatch
+	}
+	feature := resp.Features[0]
+	if len(feature.Geometry.Coordinates) < 2 {
+		return nil, ErrBadResponse
+	}
+	return &GeocodeResult{
+		Lat:        feature.Geometry.Coordinates[1],
+		Lng:        feature.Geometry.Coordinates[0],
+		Confidence: feature.Properties.Confidence,
+		Label:      feature.Properties.Label,
+		Source:     g.Name(),
+	}, nil
+}
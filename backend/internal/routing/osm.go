@@ -0,0 +1,320 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoGraph is returned by the offline provider when no road extract is configured.
+var ErrNoGraph = errors.New("routing: no road graph configured (set ROUTING_GRAPH_PATH)")
+
+// highwaySpeeds are default driving speeds in km/h by OSM highway type.
+// Ways of any other type (footways, cycleways, tracks...) are not drivable.
+var highwaySpeeds = map[string]float64{
+	"motorway":       105,
+	"motorway_link":  60,
+	"trunk":          85,
+	"trunk_link":     50,
+	"primary":        65,
+	"primary_link":   45,
+	"secondary":      55,
+	"secondary_link": 40,
+	"tertiary":       45,
+	"tertiary_link":  35,
+	"unclassified":   35,
+	"residential":    30,
+	"living_street":  10,
+	"service":        15,
+	"road":           30,
+}
+
+// wayProfile decides from OSM tags whether a way is drivable, how fast, and
+// in which directions.
+func wayProfile(tags map[string]string) (speedKmh float64, forward, backward bool) {
+	highway := tags["highway"]
+	speedKmh, ok := highwaySpeeds[highway]
+	if !ok || tags["area"] == "yes" {
+		return 0, false, false
+	}
+	for _, key := range []string{"access", "motor_vehicle", "motorcar"} {
+		if v := tags[key]; v == "no" || v == "private" {
+			return 0, false, false
+		}
+	}
+	if maxspeed := parseMaxSpeed(tags["maxspeed"]); maxspeed > 0 {
+		speedKmh = maxspeed
+	}
+
+	forward, backward = true, true
+	if highway == "motorway" || highway == "motorway_link" ||
+		tags["junction"] == "roundabout" || tags["junction"] == "circular" {
+		backward = false
+	}
+	switch tags["oneway"] {
+	case "yes", "true", "1":
+		forward, backward = true, false
+	case "-1", "reverse":
+		forward, backward = false, true
+	case "no", "false", "0":
+		forward, backward = true, true
+	}
+	return speedKmh, forward, backward
+}
+
+// parseMaxSpeed reads an OSM maxspeed value such as "50", "30 mph" or
+// "50;60" (the first value wins). Symbolic values yield zero.
+func parseMaxSpeed(value string) float64 {
+	value = strings.TrimSpace(strings.Split(value, ";")[0])
+	factor := 1.0
+	if strings.HasSuffix(value, "mph") {
+		factor = 1.609344
+		value = strings.TrimSpace(strings.TrimSuffix(value, "mph"))
+	}
+	speed, err := strconv.ParseFloat(value, 64)
+	if err != nil || speed <= 0 {
+		return 0
+	}
+	return speed * factor
+}
+
+// LoadRoadGraph builds a road graph from an OSM extract, or reads one
+// saved by WriteRoadGraph. Files ending in .pbf are read as OSM PBF; other
+// extracts as GeoJSON LineStrings whose properties (or a nested "tags"
+// object) carry the OSM tags.
+func LoadRoadGraph(path string) (*RoadGraph, error) {
+	var (
+		g   *RoadGraph
+		err error
+	)
+	switch {
+	case isGraphFile(path):
+		g, err = readRoadGraph(path)
+	case strings.EqualFold(filepath.Ext(path), ".pbf"):
+		g, err = loadPBFGraph(path)
+	default:
+		g, err = loadGeoJSONGraph(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("routing: loading road graph %s: %w", path, err)
+	}
+	if len(g.edges) == 0 {
+		return nil, fmt.Errorf("routing: road graph %s has no drivable roads", path)
+	}
+	return g, nil
+}
+
+type geoJSONFeature struct {
+	Geometry struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+func loadGeoJSONGraph(path string) (*RoadGraph, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var collection struct {
+		Features []geoJSONFeature `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, err
+	}
+
+	builder := newGraphBuilder()
+	for _, feature := range collection.Features {
+		tags := map[string]string{}
+		for key, value := range feature.Properties {
+			if nested, ok := value.(map[string]interface{}); ok && key == "tags" {
+				for k, v := range nested {
+					tags[k] = fmt.Sprint(v)
+				}
+				continue
+			}
+			if value != nil {
+				tags[key] = fmt.Sprint(value)
+			}
+		}
+		speed, forward, backward := wayProfile(tags)
+		if speed == 0 {
+			continue
+		}
+
+		var lines [][][]float64
+		switch feature.Geometry.Type {
+		case "LineString":
+			var line [][]float64
+			if json.Unmarshal(feature.Geometry.Coordinates, &line) == nil {
+				lines = append(lines, line)
+			}
+		case "MultiLineString":
+			_ = json.Unmarshal(feature.Geometry.Coordinates, &lines)
+		}
+		for _, line := range lines {
+			vertices := make([]int32, 0, len(line))
+			for _, lngLat := range line {
+				if len(lngLat) < 2 {
+					continue
+				}
+				point := RoutePoint{Lat: lngLat[1], Lng: lngLat[0]}
+				vertices = append(vertices, builder.vertex(coordinateKey(point), point))
+			}
+			builder.addWay(vertices, speed, forward, backward)
+		}
+	}
+	return builder.build(), nil
+}
+
+// coordinateKey identifies a GeoJSON vertex by its coordinates at 1e-7
+// degrees, the precision OSM stores, so ways meeting at a node connect.
+func coordinateKey(point RoutePoint) int64 {
+	lat := int64(math.Round(point.Lat * 1e7))
+	lng := int64(math.Round(point.Lng * 1e7))
+	return lat<<32 | int64(uint32(lng))
+}
+
+var (
+	graphsMu sync.Mutex
+	graphs   = map[string]*loadedGraph{}
+)
+
+type loadedGraph struct {
+	once  sync.Once
+	graph *RoadGraph
+	err   error
+}
+
+// graphFor loads and contracts the extract at path once per process;
+// providers are built per request and share it.
+func graphFor(path string) (*RoadGraph, error) {
+	graphsMu.Lock()
+	loaded, ok := graphs[path]
+	if !ok {
+		loaded = &loadedGraph{}
+		graphs[path] = loaded
+	}
+	graphsMu.Unlock()
+
+	loaded.once.Do(func() {
+		loaded.graph, loaded.err = loadPreparedGraph(path)
+	})
+	return loaded.graph, loaded.err
+}
+
+// osmProvider routes over a road graph loaded from an OSM extract, without
+// any network access.
+type osmProvider struct {
+	graph *RoadGraph
+}
+
+func newOSMProvider(cfg Config) (*osmProvider, error) {
+	if cfg.GraphPath == "" {
+		return nil, ErrNoGraph
+	}
+	graph, err := graphFor(cfg.GraphPath)
+	if err != nil {
+		return nil, err
+	}
+	return &osmProvider{graph: graph}, nil
+}
+
+func (p *osmProvider) Name() string { return "osm" }
+
+// Routes and matrices are computed in process, so there are no request limits.
+func (p *osmProvider) matrixLimit() int { return 0 }
+
+func (p *osmProvider) waypointLimit() int { return 0 }
+
+func (p *osmProvider) Route(ctx context.Context, waypoints []RoutePoint) (*RouteSegment, error) {
+	if len(waypoints) < 2 {
+		return nil, ErrNoRoute
+	}
+	snaps, err := p.snapAll(waypoints)
+	if err != nil {
+		return nil, err
+	}
+
+	segment := &RouteSegment{Geometry: []RoutePoint{snaps[0].point}}
+	for i := 0; i < len(snaps)-1; i++ {
+		path, ok := p.graph.route(ctx, snaps[i], snaps[i+1])
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrNoRoute
+		}
+		start := len(segment.Geometry) - 1
+		for _, v := range path.vertices {
+			segment.Geometry = appendDistinct(segment.Geometry, p.graph.points[v])
+		}
+		segment.Geometry = appendDistinct(segment.Geometry, snaps[i+1].point)
+		segment.Distance += path.distance
+		segment.Duration += path.duration
+		segment.Legs = append(segment.Legs, RouteLeg{
+			Distance:      path.distance,
+			Duration:      path.duration,
+			GeometryStart: start,
+			GeometryEnd:   len(segment.Geometry) - 1,
+		})
+	}
+	return segment, nil
+}
+
+func (p *osmProvider) Matrix(ctx context.Context, sources, destinations []RoutePoint) (*Matrix, error) {
+	sourceSnaps, err := p.snapAll(sources)
+	if err != nil {
+		return nil, err
+	}
+	destinationSnaps, err := p.snapAll(destinations)
+	if err != nil {
+		return nil, err
+	}
+
+	distances, durations := p.graph.table(ctx, sourceSnaps, destinationSnaps)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildMatrix(len(sources), len(destinations), func(i, j int) (float64, float64, bool) {
+		// Unreachable pairs are already +Inf
+		return distances[i][j], durations[i][j], true
+	})
+}
+
+func (p *osmProvider) Health(ctx context.Context) error {
+	if len(p.graph.edges) == 0 {
+		return ErrNoGraph
+	}
+	return ctx.Err()
+}
+
+func (p *osmProvider) snapAll(points []RoutePoint) ([]snap, error) {
+	snaps := make([]snap, len(points))
+	for i, point := range points {
+		s, ok := p.graph.nearest(point)
+		if !ok {
+			return nil, fmt.Errorf("%w: %.5f,%.5f is more than %.0f km from a road", ErrNoRoute, point.Lat, point.Lng, maxSnapKm)
+		}
+		snaps[i] = s
+	}
+	return snaps, nil
+}
+
+// appendDistinct appends point unless it repeats the last one, which
+// happens when a waypoint snaps exactly onto a vertex.
+func appendDistinct(points []RoutePoint, point RoutePoint) []RoutePoint {
+	if n := len(points); n > 0 && points[n-1] == point {
+		return points
+	}
+	return append(points, point)
+}
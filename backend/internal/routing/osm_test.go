@@ -0,0 +1,78 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWayProfile(t *testing.T) {
+	tests := []struct {
+		name              string
+		tags              map[string]string
+		speed             float64
+		forward, backward bool
+	}{
+		{"residential", map[string]string{"highway": "residential"}, 30, true, true},
+		{"footway", map[string]string{"highway": "footway"}, 0, false, false},
+		{"private", map[string]string{"highway": "service", "access": "private"}, 0, false, false},
+		{"motorway is one way", map[string]string{"highway": "motorway"}, 105, true, false},
+		{"reverse one way", map[string]string{"highway": "primary", "oneway": "-1"}, 65, false, true},
+		{"two-way roundabout", map[string]string{"highway": "tertiary", "junction": "roundabout", "oneway": "no"}, 45, true, true},
+		{"maxspeed in mph", map[string]string{"highway": "secondary", "maxspeed": "25 mph"}, 25 * 1.609344, true, true},
+		{"symbolic maxspeed", map[string]string{"highway": "secondary", "maxspeed": "walk"}, 55, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			speed, forward, backward := wayProfile(tt.tags)
+			if !closeTo(speed, tt.speed) || forward != tt.forward || backward != tt.backward {
+				t.Errorf("wayProfile = %v km/h forward %v backward %v, want %v km/h forward %v backward %v",
+					speed, forward, backward, tt.speed, tt.forward, tt.backward)
+			}
+		})
+	}
+}
+
+func TestOSMProvider(t *testing.T) {
+	provider, err := newOSMProvider(Config{GraphPath: writeGridExtract(t, 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	waypoints := []RoutePoint{{Lat: 33.481, Lng: -86.849}, {Lat: 33.497, Lng: -86.831}, {Lat: 33.513, Lng: -86.818}}
+
+	route, err := provider.Route(ctx, waypoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(route.Legs) != len(waypoints)-1 {
+		t.Fatalf("got %d legs, want %d", len(route.Legs), len(waypoints)-1)
+	}
+	matrix, err := provider.Matrix(ctx, waypoints, waypoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	distance := 0.0
+	for i, leg := range route.Legs {
+		// Each leg is the fastest path, the same one the matrix measures
+		if !closeTo(leg.Duration, matrix.Durations[i][i+1]) || !closeTo(leg.Distance, matrix.Distances[i][i+1]) {
+			t.Errorf("leg %d is %v km %v min, matrix says %v km %v min",
+				i, leg.Distance, leg.Duration, matrix.Distances[i][i+1], matrix.Durations[i][i+1])
+		}
+		if i > 0 && leg.GeometryStart != route.Legs[i-1].GeometryEnd {
+			t.Errorf("leg %d starts at %d, previous ends at %d", i, leg.GeometryStart, route.Legs[i-1].GeometryEnd)
+		}
+		distance += leg.Distance
+	}
+	if !closeTo(distance, route.Distance) {
+		t.Errorf("legs sum to %v km, route is %v km", distance, route.Distance)
+	}
+
+	seattle := RoutePoint{Lat: 47.6097, Lng: -122.3331}
+	if _, err := provider.Route(ctx, []RoutePoint{waypoints[0], seattle}); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("route to a point far from any road: err %v, want ErrNoRoute", err)
+	}
+	if _, err := newOSMProvider(Config{}); !errors.Is(err, ErrNoGraph) {
+		t.Errorf("provider without a graph: err %v, want ErrNoGraph", err)
+	}
+}
@@ -0,0 +1,133 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// osrmProvider talks to the OSRM HTTP API (route and table services).
+type osrmProvider struct {
+	baseURL string
+	profile string
+	client  *http.Client
+}
+
+func newOSRMProvider(cfg Config, client *http.Client) *osrmProvider {
+	return &osrmProvider{
+		baseURL: orDefault(cfg.BaseURL, "https://router.project-osrm.org"),
+		profile: orDefault(cfg.Profile, "driving"),
+		client:  client,
+	}
+}
+
+type osrmRouteResponse struct {
+	Code   string `json:"code"`
+	Routes []struct {
+		Distance float64     `json:"distance"` // in meters
+		Duration float64     `json:"duration"` // in seconds
+		Geometry interface{} `json:"geometry"`
+		Legs     []struct {
+			Distance float64 `json:"distance"` // in meters
+			Duration float64 `json:"duration"` // in seconds
+		} `json:"legs"`
+	} `json:"routes"`
+}
+
+type osrmTableResponse struct {
+	Code      string       `json:"code"`
+	Distances [][]*float64 `json:"distances"` // in meters
+	Durations [][]*float64 `json:"durations"` // in seconds
+}
+
+func (p *osrmProvider) Name() string { return "osrm" }
+
+// OSRM's default --max-table-size is 100 locations.
+func (p *osrmProvider) matrixLimit() int { return 100 }
+
+// Keep route URLs well under common proxy limits; OSRM itself allows 500 waypoints.
+func (p *osrmProvider) waypointLimit() int { return 100 }
+
+func (p *osrmProvider) Route(ctx context.Context, waypoints []RoutePoint) (*RouteSegment, error) {
+	url := fmt.Sprintf("%s/route/v1/%s/%s?overview=full&geometries=geojson", p.baseURL, p.profile, osrmCoordinates(waypoints))
+
+	var resp osrmRouteResponse
+	if err := doJSON(ctx, p.client, p.Name(), http.MethodGet, url, nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != "Ok" || len(resp.Routes) == 0 {
+		return nil, ErrNoRoute
+	}
+
+	route := resp.Routes[0]
+	geometry, ok := parseGeometry(route.Geometry, 5)
+	if !ok {
+		return nil, ErrBadResponse
+	}
+	segment := &RouteSegment{
+		Distance: route.Distance / 1000.0,
+		Duration: route.Duration / 60.0,
+		Geometry: geometry,
+	}
+	// OSRM reports per-leg totals but not where each leg starts in the geometry
+	if len(route.Legs) == len(waypoints)-1 {
+		distances := make([]float64, len(route.Legs))
+		durations := make([]float64, len(route.Legs))
+		for i, leg := range route.Legs {
+			distances[i], durations[i] = leg.Distance/1000.0, leg.Duration/60.0
+		}
+		segment.Legs = legsFromSplits(splitGeometry(geometry, waypoints), distances, durations)
+	}
+	return segment, nil
+}
+
+func (p *osrmProvider) Matrix(ctx context.Context, sources, destinations []RoutePoint) (*Matrix, error) {
+	locations, sourceIdx, destIdx := combineLocations(sources, destinations)
+	url := fmt.Sprintf("%s/table/v1/%s/%s?sources=%s&destinations=%s&annotations=distance,duration",
+		p.baseURL, p.profile, osrmCoordinates(locations), joinInts(sourceIdx), joinInts(destIdx))
+
+	var resp osrmTableResponse
+	if err := doJSON(ctx, p.client, p.Name(), http.MethodGet, url, nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != "Ok" {
+		return nil, ErrNoRoute
+	}
+	return buildMatrix(len(sources), len(destinations), func(i, j int) (float64, float64, bool) {
+		if i >= len(resp.Distances) || j >= len(resp.Distances[i]) || i >= len(resp.Durations) || j >= len(resp.Durations[i]) {
+			return 0, 0, false
+		}
+		dist, dur := resp.Distances[i][j], resp.Durations[i][j]
+		if dist == nil || dur == nil {
+			return math.Inf(1), math.Inf(1), true // unreachable
+		}
+		return *dist / 1000.0, *dur / 60.0, true
+	})
+}
+
+// Health asks OSRM for the nearest road to a single coordinate; any 200
+// response means the service is up.
+func (p *osrmProvider) Health(ctx context.Context) error {
+	url := fmt.Sprintf("%s/nearest/v1/%s/-86.8104,33.5186", p.baseURL, p.profile)
+	return doJSON(ctx, p.client, p.Name(), http.MethodGet, url, nil, nil, nil)
+}
+
+// osrmCoordinates formats points as OSRM's "lng,lat;lng,lat" path segment.
+func osrmCoordinates(points []RoutePoint) string {
+	parts := make([]string, len(points))
+	for i, p := range points {
+		parts[i] = strconv.FormatFloat(p.Lng, 'f', 6, 64) + "," + strconv.FormatFloat(p.Lat, 'f', 6, 64)
+	}
+	return strings.Join(parts, ";")
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ";")
+}
@@ -0,0 +1,420 @@
+package routing
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// OSM PBF is a sequence of blobs, each a length-prefixed BlobHeader followed
+// by a zlib-compressed protobuf PrimitiveBlock. Only the handful of fields
+// needed to build a road graph are decoded, by hand, so the backend does
+// not need generated protobuf code.
+
+const maxPBFBlobSize = 64 * 1024 * 1024
+
+var errBadPBF = errors.New("malformed OSM PBF")
+
+// pbfWay is a drivable way kept from the first pass over the file.
+type pbfWay struct {
+	refs              []int64
+	speed             float64
+	forward, backward bool
+}
+
+// loadPBFGraph reads the file twice: once for the drivable ways, then for
+// the coordinates of just the nodes they use, so memory stays proportional
+// to the road network rather than the whole extract.
+func loadPBFGraph(path string) (*RoadGraph, error) {
+	ways := []pbfWay{}
+	needed := map[int64]RoutePoint{}
+	err := readPBF(path, func(block *pbfBlock) error {
+		return block.ways(func(refs []int64, tags map[string]string) {
+			speed, forward, backward := wayProfile(tags)
+			if speed == 0 || len(refs) < 2 {
+				return
+			}
+			ways = append(ways, pbfWay{refs: refs, speed: speed, forward: forward, backward: backward})
+			for _, ref := range refs {
+				needed[ref] = RoutePoint{}
+			}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[int64]bool, len(needed))
+	err = readPBF(path, func(block *pbfBlock) error {
+		return block.nodes(func(id int64, point RoutePoint) {
+			if _, ok := needed[id]; ok {
+				needed[id] = point
+				found[id] = true
+			}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	builder := newGraphBuilder()
+	for _, way := range ways {
+		vertices := make([]int32, 0, len(way.refs))
+		for _, ref := range way.refs {
+			// Extracts clipped to a boundary reference nodes outside it
+			if !found[ref] {
+				builder.addWay(vertices, way.speed, way.forward, way.backward)
+				vertices = vertices[:0]
+				continue
+			}
+			vertices = append(vertices, builder.vertex(ref, needed[ref]))
+		}
+		builder.addWay(vertices, way.speed, way.forward, way.backward)
+	}
+	return builder.build(), nil
+}
+
+// readPBF calls fn for every data block in the file.
+func readPBF(path string, fn func(*pbfBlock) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		headerSize := binary.BigEndian.Uint32(size[:])
+		if headerSize > maxPBFBlobSize {
+			return errBadPBF
+		}
+		header := make([]byte, headerSize)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+
+		var blobType string
+		var dataSize int
+		d := protoDecoder{buf: header}
+		for d.next() {
+			switch d.field {
+			case 1:
+				blobType = string(d.bytes())
+			case 3:
+				dataSize = int(d.varint())
+			default:
+				d.skip()
+			}
+		}
+		if d.err != nil || dataSize <= 0 || dataSize > maxPBFBlobSize {
+			return errBadPBF
+		}
+		blob := make([]byte, dataSize)
+		if _, err := io.ReadFull(r, blob); err != nil {
+			return err
+		}
+		if blobType != "OSMData" {
+			continue
+		}
+
+		data, err := inflateBlob(blob)
+		if err != nil {
+			return err
+		}
+		block, err := parseBlock(data)
+		if err != nil {
+			return err
+		}
+		if err := fn(block); err != nil {
+			return err
+		}
+	}
+}
+
+// inflateBlob returns the uncompressed contents of a Blob message.
+func inflateBlob(blob []byte) ([]byte, error) {
+	for d := (protoDecoder{buf: blob}); d.next(); {
+		switch d.field {
+		case 1: // raw
+			return d.bytes(), nil
+		case 3: // zlib_data
+			zr, err := zlib.NewReader(bytes.NewReader(d.bytes()))
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+			return io.ReadAll(zr)
+		case 4, 5, 6, 7:
+			return nil, fmt.Errorf("%w: unsupported blob compression (field %d)", errBadPBF, d.field)
+		default:
+			d.skip()
+		}
+	}
+	return nil, errBadPBF
+}
+
+// pbfBlock is a decoded PrimitiveBlock: its string table, coordinate
+// scaling and raw primitive groups.
+type pbfBlock struct {
+	strings     []string
+	granularity int64
+	latOffset   int64
+	lonOffset   int64
+	groups      [][]byte
+}
+
+func parseBlock(data []byte) (*pbfBlock, error) {
+	block := &pbfBlock{granularity: 100}
+	d := protoDecoder{buf: data}
+	for d.next() {
+		switch d.field {
+		case 1:
+			for s := (protoDecoder{buf: d.bytes()}); s.next(); {
+				if s.field == 1 {
+					block.strings = append(block.strings, string(s.bytes()))
+				} else {
+					s.skip()
+				}
+			}
+		case 2:
+			block.groups = append(block.groups, d.bytes())
+		case 17:
+			block.granularity = int64(d.varint())
+		case 19:
+			block.latOffset = int64(d.varint())
+		case 20:
+			block.lonOffset = int64(d.varint())
+		default:
+			d.skip()
+		}
+	}
+	return block, d.err
+}
+
+func (b *pbfBlock) point(lat, lon int64) RoutePoint {
+	return RoutePoint{
+		Lat: 1e-9 * float64(b.latOffset+b.granularity*lat),
+		Lng: 1e-9 * float64(b.lonOffset+b.granularity*lon),
+	}
+}
+
+func (b *pbfBlock) str(i uint64) string {
+	if i < uint64(len(b.strings)) {
+		return b.strings[i]
+	}
+	return ""
+}
+
+// ways calls fn with the node references and tags of every way.
+func (b *pbfBlock) ways(fn func(refs []int64, tags map[string]string)) error {
+	for _, group := range b.groups {
+		g := protoDecoder{buf: group}
+		for g.next() {
+			if g.field != 3 {
+				g.skip()
+				continue
+			}
+			var keys, vals []uint64
+			var refs []int64
+			w := protoDecoder{buf: g.bytes()}
+			for w.next() {
+				switch w.field {
+				case 2:
+					keys = w.packedVarints()
+				case 3:
+					vals = w.packedVarints()
+				case 8:
+					ref := int64(0)
+					for _, delta := range w.packedVarints() {
+						ref += zigzag(delta)
+						refs = append(refs, ref)
+					}
+				default:
+					w.skip()
+				}
+			}
+			if w.err != nil {
+				return w.err
+			}
+			tags := make(map[string]string, len(keys))
+			for i := 0; i < len(keys) && i < len(vals); i++ {
+				tags[b.str(keys[i])] = b.str(vals[i])
+			}
+			fn(refs, tags)
+		}
+		if g.err != nil {
+			return g.err
+		}
+	}
+	return nil
+}
+
+// nodes calls fn with the id and position of every node, plain or dense.
+func (b *pbfBlock) nodes(fn func(id int64, point RoutePoint)) error {
+	for _, group := range b.groups {
+		g := protoDecoder{buf: group}
+		for g.next() {
+			switch g.field {
+			case 1:
+				var id, lat, lon int64
+				n := protoDecoder{buf: g.bytes()}
+				for n.next() {
+					switch n.field {
+					case 1:
+						id = zigzag(n.varint())
+					case 8:
+						lat = zigzag(n.varint())
+					case 9:
+						lon = zigzag(n.varint())
+					default:
+						n.skip()
+					}
+				}
+				if n.err != nil {
+					return n.err
+				}
+				fn(id, b.point(lat, lon))
+			case 2:
+				var ids, lats, lons []uint64
+				n := protoDecoder{buf: g.bytes()}
+				for n.next() {
+					switch n.field {
+					case 1:
+						ids = n.packedVarints()
+					case 8:
+						lats = n.packedVarints()
+					case 9:
+						lons = n.packedVarints()
+					default:
+						n.skip()
+					}
+				}
+				if n.err != nil {
+					return n.err
+				}
+				if len(lats) != len(ids) || len(lons) != len(ids) {
+					return errBadPBF
+				}
+				// Dense nodes are delta coded
+				var id, lat, lon int64
+				for i := range ids {
+					id += zigzag(ids[i])
+					lat += zigzag(lats[i])
+					lon += zigzag(lons[i])
+					fn(id, b.point(lat, lon))
+				}
+			default:
+				g.skip()
+			}
+		}
+		if g.err != nil {
+			return g.err
+		}
+	}
+	return nil
+}
+
+// protoDecoder walks the fields of one protobuf message.
+type protoDecoder struct {
+	buf   []byte
+	pos   int
+	field int
+	wire  int
+	err   error
+}
+
+// next advances to the next field, returning false at the end of the
+// message or on malformed input (recorded in err).
+func (d *protoDecoder) next() bool {
+	if d.err != nil || d.pos >= len(d.buf) {
+		return false
+	}
+	key := d.varint()
+	d.field, d.wire = int(key>>3), int(key&7)
+	return d.err == nil
+}
+
+func (d *protoDecoder) varint() uint64 {
+	value, n := binary.Uvarint(d.buf[d.pos:])
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.pos += n
+	return value
+}
+
+func (d *protoDecoder) bytes() []byte {
+	if d.wire != 2 {
+		d.fail()
+		return nil
+	}
+	size := d.varint()
+	if d.err != nil || size > uint64(len(d.buf)-d.pos) {
+		d.fail()
+		return nil
+	}
+	out := d.buf[d.pos : d.pos+int(size)]
+	d.pos += int(size)
+	return out
+}
+
+// packedVarints reads a packed repeated integer field.
+func (d *protoDecoder) packedVarints() []uint64 {
+	if d.wire == 0 {
+		return []uint64{d.varint()}
+	}
+	packed := protoDecoder{buf: d.bytes()}
+	values := []uint64{}
+	for packed.pos < len(packed.buf) && packed.err == nil {
+		values = append(values, packed.varint())
+	}
+	if packed.err != nil {
+		d.fail()
+	}
+	return values
+}
+
+func (d *protoDecoder) skip() {
+	switch d.wire {
+	case 0:
+		d.varint()
+	case 1:
+		d.advance(8)
+	case 2:
+		d.bytes()
+	case 5:
+		d.advance(4)
+	default:
+		d.fail()
+	}
+}
+
+func (d *protoDecoder) advance(n int) {
+	if n > len(d.buf)-d.pos {
+		d.fail()
+		return
+	}
+	d.pos += n
+}
+
+func (d *protoDecoder) fail() {
+	d.err = errBadPBF
+	d.pos = len(d.buf)
+}
+
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
@@ -0,0 +1,87 @@
+package routing
+
+import (
+	"math"
+	"strings"
+)
+
+// DecodePolyline decodes a Google encoded polyline of [lat, lng] pairs.
+// precision is the number of decimal digits: 5 for Google, ORS and OSRM's
+// "polyline" format, 6 for Valhalla and "polyline6".
+func DecodePolyline(encoded string, precision int) []RoutePoint {
+	return decodePolylinePrecision(encoded, precision)
+}
+
+// EncodePolyline encodes points as a Google encoded polyline with the given
+// number of decimal digits.
+func EncodePolyline(points []RoutePoint, precision int) string {
+	return encodePolylinePrecision(points, precision)
+}
+
+// decodePolylinePrecision decodes an encoded polyline string into a slice of
+// RoutePoints. This uses the standard Google Polyline encoding algorithm;
+// precision is the number of decimal digits (5 for Google/ORS, 6 for Valhalla).
+func decodePolylinePrecision(encoded string, precision int) []RoutePoint {
+	var points []RoutePoint
+	factor := math.Pow10(precision)
+	index := 0
+	lat := 0
+	lng := 0
+
+	next := func() int {
+		var shift uint = 0
+		var result int = 0
+		for index < len(encoded) {
+			b := int(encoded[index]) - 63
+			index++
+			result |= (b & 0x1f) << shift
+			shift += 5
+			if b < 0x20 {
+				break
+			}
+		}
+		if (result & 1) != 0 {
+			return ^(result >> 1)
+		}
+		return result >> 1
+	}
+
+	for index < len(encoded) {
+		lat += next()
+		lng += next()
+		points = append(points, RoutePoint{
+			Lat: float64(lat) / factor,
+			Lng: float64(lng) / factor,
+		})
+	}
+
+	return points
+}
+
+// encodePolylinePrecision is the inverse of decodePolylinePrecision.
+func encodePolylinePrecision(points []RoutePoint, precision int) string {
+	var sb strings.Builder
+	factor := math.Pow10(precision)
+	prevLat, prevLng := 0, 0
+
+	write := func(value int) {
+		shifted := value << 1
+		if value < 0 {
+			shifted = ^shifted
+		}
+		for shifted >= 0x20 {
+			sb.WriteByte(byte((0x20 | (shifted & 0x1f)) + 63))
+			shifted >>= 5
+		}
+		sb.WriteByte(byte(shifted + 63))
+	}
+
+	for _, p := range points {
+		lat := int(math.Round(p.Lat * factor))
+		lng := int(math.Round(p.Lng * factor))
+		write(lat - prevLat)
+		write(lng - prevLng)
+		prevLat, prevLng = lat, lng
+	}
+	return sb.String()
+}
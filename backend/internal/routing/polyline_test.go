@@ -0,0 +1,38 @@
+package routing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPolyline(t *testing.T) {
+	// The example from Google's polyline algorithm documentation
+	google := []RoutePoint{{Lat: 38.5, Lng: -120.2}, {Lat: 40.7, Lng: -120.95}, {Lat: 43.252, Lng: -126.453}}
+	const encoded = "_p~iF~ps|U_ulLnnqC_mqNvxq`@"
+
+	if got := EncodePolyline(google, 5); got != encoded {
+		t.Errorf("EncodePolyline = %q, want %q", got, encoded)
+	}
+	decoded := DecodePolyline(encoded, 5)
+	if len(decoded) != len(google) {
+		t.Fatalf("decoded %d points, want %d", len(decoded), len(google))
+	}
+	for i := range google {
+		if !samePoint(decoded[i], google[i]) {
+			t.Errorf("point %d = %+v, want %+v", i, decoded[i], google[i])
+		}
+	}
+
+	// polyline6 keeps the sixth decimal that precision 5 rounds away
+	fine := []RoutePoint{{Lat: 33.518601, Lng: -86.810357}, {Lat: 33.518609, Lng: -86.810349}, {Lat: -0.000001, Lng: 0.000001}}
+	for _, tt := range []struct {
+		precision int
+		tolerance float64
+	}{{5, 0.5e-5}, {6, 0.5e-6}} {
+		for i, point := range DecodePolyline(EncodePolyline(fine, tt.precision), tt.precision) {
+			if diff := math.Max(math.Abs(point.Lat-fine[i].Lat), math.Abs(point.Lng-fine[i].Lng)); diff > tt.tolerance+1e-12 {
+				t.Errorf("precision %d: point %d = %+v, want %+v", tt.precision, i, point, fine[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Provider is a road routing backend. Implementations talk to a specific
+// HTTP API (or compute routes in process) and report failures as errors;
+// callers decide whether to fall back to straight lines.
+type Provider interface {
+	// Name identifies the provider, e.g. "ors" or "osrm".
+	Name() string
+	// Route returns the driving route through the waypoints in order.
+	Route(ctx context.Context, waypoints []RoutePoint) (*RouteSegment, error)
+	// Matrix returns travel distances and durations from every source to every destination.
+	Matrix(ctx context.Context, sources, destinations []RoutePoint) (*Matrix, error)
+	// Health checks that the backend is reachable.
+	Health(ctx context.Context) error
+}
+
+// Matrix holds many-to-many travel costs indexed [source][destination].
+type Matrix struct {
+	Distances [][]float64 `json:"distances"` // in kilometers
+	Durations [][]float64 `json:"durations"` // in minutes
+}
+
+// Config selects and configures a routing provider.
+type Config struct {
+	Provider  string        // "ors", "osrm", "graphhopper", "valhalla", "osm" or "fake"
+	BaseURL   string        // API root; empty uses the provider's public endpoint
+	APIKey    string        // required by ORS and GraphHopper's hosted APIs
+	Profile   string        // vehicle profile; empty uses the provider default
+	GraphPath string        // OSM extract (.pbf or GeoJSON) for the offline "osm" provider
+	Timeout   time.Duration // per-request timeout
+}
+
+var (
+	// ErrNoAPIKey is returned by providers that need a key when none is configured.
+	ErrNoAPIKey = errors.New("routing: no API key configured")
+	// ErrNoRoute is returned when the provider answers without a usable route.
+	ErrNoRoute = errors.New("routing: provider returned no route")
+	// ErrBadResponse is returned when the provider's answer cannot be parsed.
+	ErrBadResponse = errors.New("routing: could not parse provider response")
+)
+
+// StatusError reports a non-200 response from a provider.
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("routing: %s returned HTTP %d", e.Provider, e.StatusCode)
+}
+
+const defaultProvider = "ors"
+
+// ProviderNames lists the providers accepted by NewProvider.
+func ProviderNames() []string {
+	return []string{"ors", "osrm", "graphhopper", "valhalla", "osm", "fake"}
+}
+
+// ConfigFromEnv reads provider settings from ROUTING_PROVIDER,
+// ROUTING_BASE_URL, ROUTING_API_KEY, ROUTING_PROFILE and ROUTING_GRAPH_PATH.
+// OPENROUTE_API_KEY is still honoured as the key for the default ORS provider.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Provider:  strings.ToLower(os.Getenv("ROUTING_PROVIDER")),
+		BaseURL:   os.Getenv("ROUTING_BASE_URL"),
+		APIKey:    os.Getenv("ROUTING_API_KEY"),
+		Profile:   os.Getenv("ROUTING_PROFILE"),
+		GraphPath: os.Getenv("ROUTING_GRAPH_PATH"),
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = defaultProvider
+	}
+	if cfg.APIKey == "" && cfg.Provider == "ors" {
+		cfg.APIKey = os.Getenv("OPENROUTE_API_KEY")
+	}
+	return cfg
+}
+
+// ProviderFor builds a provider from the environment configuration, letting
+// a request override the provider name and API key. When the request picks
+// a different provider than the environment, the environment's base URL,
+// key and profile are not carried over; the road extract is, so "osm" can
+// be picked per request.
+func ProviderFor(name, apiKey string) (Provider, error) {
+	cfg := ConfigFromEnv()
+	name = strings.ToLower(name)
+	if name != "" && name != cfg.Provider {
+		cfg = Config{Provider: name, GraphPath: cfg.GraphPath}
+	}
+	if apiKey != "" {
+		cfg.APIKey = apiKey
+	}
+	return NewProvider(cfg)
+}
+
+// NewProvider returns the provider described by cfg.
+func NewProvider(cfg Config) (Provider, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	// Providers are built per request; sharing the transport keeps
+	// connections to the backend alive between them.
+	client := &http.Client{Timeout: cfg.Timeout, Transport: sharedTransport}
+
+	var provider Provider
+	switch strings.ToLower(cfg.Provider) {
+	case "", "ors", "openrouteservice":
+		provider = newORSProvider(cfg, client)
+	case "osrm":
+		provider = newOSRMProvider(cfg, client)
+	case "graphhopper":
+		provider = newGraphHopperProvider(cfg, client)
+	case "valhalla":
+		provider = newValhallaProvider(cfg, client)
+	case "osm":
+		// Routed in process over a local extract; nothing worth caching
+		return newOSMProvider(cfg)
+	case "fake":
+		// Computed in process; caching would only fill the store
+		return NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("routing: unknown provider %q", cfg.Provider)
+	}
+	return withCache(provider, cfg, defaultCache(), defaultCellCache()), nil
+}
+
+var sharedTransport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 16,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return strings.TrimRight(value, "/")
+}
+
+// doJSON sends a request with an optional JSON body and decodes a JSON
+// response into out, turning non-200 responses into a StatusError. Calls go
+// through the backend's shared guard, so they are rate limited and retried.
+func doJSON(ctx context.Context, client *http.Client, provider, method, rawURL string, headers map[string]string, body interface{}, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	key := provider
+	if parsed, err := url.Parse(rawURL); err == nil {
+		key = provider + "@" + parsed.Host
+	}
+	return guardFor(key).do(ctx, func() error {
+		return doJSONOnce(ctx, client, provider, method, rawURL, headers, payload, out)
+	})
+}
+
+func doJSONOnce(ctx context.Context, client *http.Client, provider, method, rawURL string, headers map[string]string, payload []byte, out interface{}) error {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reader)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return &StatusError{
+			Provider:   provider,
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(bodyBytes, out)
+}
@@ -0,0 +1,397 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var stubFlavors = []string{"ors", "osrm", "graphhopper", "valhalla"}
+
+// Three stops around downtown Birmingham
+var testWaypoints = []RoutePoint{
+	{Lat: 33.5186, Lng: -86.8104},
+	{Lat: 33.5250, Lng: -86.8000},
+	{Lat: 33.5100, Lng: -86.7900},
+}
+
+// recordedRequest is what the provider sent to the stub.
+type recordedRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Header http.Header
+	Body   []byte
+}
+
+// stubBackend serves a provider's wire format from a FakeProvider and
+// records every request. Handlers in before run first and may answer a
+// request themselves by returning true.
+type stubBackend struct {
+	mu       sync.Mutex
+	requests []recordedRequest
+	calls    atomic.Int64
+	before   func(w http.ResponseWriter, r *http.Request, call int64) bool
+}
+
+func (b *stubBackend) last() recordedRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.requests[len(b.requests)-1]
+}
+
+// newStubProvider starts a stub server of the given flavor and returns the
+// real HTTP adapter pointed at it, bypassing the cache.
+func newStubProvider(t *testing.T, flavor string, backend Provider, before func(w http.ResponseWriter, r *http.Request, call int64) bool) (Provider, *stubBackend) {
+	t.Helper()
+	// Guards are per host, so each test server gets fresh ones with these settings
+	t.Setenv("ROUTING_RATE_LIMIT", "1000")
+	t.Setenv("ROUTING_BURST", "1000")
+	t.Setenv("ROUTING_MAX_RETRIES", "1")
+
+	stub := &stubBackend{before: before}
+	handler := stubHandler(flavor, backend)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		stub.mu.Lock()
+		stub.requests = append(stub.requests, recordedRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Header: r.Header.Clone(), Body: body})
+		stub.mu.Unlock()
+		call := stub.calls.Add(1)
+		if stub.before != nil && stub.before(w, r, call) {
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := Config{BaseURL: server.URL, APIKey: "test-key"}
+	switch flavor {
+	case "osrm":
+		return newOSRMProvider(cfg, server.Client()), stub
+	case "graphhopper":
+		return newGraphHopperProvider(cfg, server.Client()), stub
+	case "valhalla":
+		return newValhallaProvider(cfg, server.Client()), stub
+	default:
+		return newORSProvider(cfg, server.Client()), stub
+	}
+}
+
+func closeTo(got, want float64) bool {
+	return math.Abs(got-want) <= 1e-6*math.Max(1, math.Abs(want))
+}
+
+func TestProviderRequests(t *testing.T) {
+	tests := []struct {
+		flavor string
+		check  func(t *testing.T, req recordedRequest)
+	}{
+		{"ors", func(t *testing.T, req recordedRequest) {
+			if req.Method != http.MethodPost || req.Path != "/v2/directions/driving-car/json" {
+				t.Errorf("request = %s %s", req.Method, req.Path)
+			}
+			if got := req.Header.Get("Authorization"); got != "test-key" {
+				t.Errorf("Authorization = %q", got)
+			}
+			var body struct {
+				Coordinates [][]float64 `json:"coordinates"`
+			}
+			if err := json.Unmarshal(req.Body, &body); err != nil {
+				t.Fatal(err)
+			}
+			// ORS takes [lng, lat]
+			if len(body.Coordinates) != 3 || body.Coordinates[0][0] != -86.8104 || body.Coordinates[0][1] != 33.5186 {
+				t.Errorf("coordinates = %v", body.Coordinates)
+			}
+		}},
+		{"osrm", func(t *testing.T, req recordedRequest) {
+			want := "/route/v1/driving/-86.810400,33.518600;-86.800000,33.525000;-86.790000,33.510000"
+			if req.Method != http.MethodGet || req.Path != want {
+				t.Errorf("request = %s %s, want GET %s", req.Method, req.Path, want)
+			}
+			if !strings.Contains(req.Query, "geometries=geojson") {
+				t.Errorf("query = %q", req.Query)
+			}
+		}},
+		{"graphhopper", func(t *testing.T, req recordedRequest) {
+			if req.Method != http.MethodGet || req.Path != "/route" {
+				t.Errorf("request = %s %s", req.Method, req.Path)
+			}
+			// GraphHopper takes lat,lng points and the key as a query parameter
+			for _, want := range []string{"point=33.518600%2C-86.810400", "key=test-key", "profile=car", "points_encoded=false"} {
+				if !strings.Contains(req.Query, want) {
+					t.Errorf("query %q lacks %q", req.Query, want)
+				}
+			}
+		}},
+		{"valhalla", func(t *testing.T, req recordedRequest) {
+			if req.Method != http.MethodPost || req.Path != "/route" {
+				t.Errorf("request = %s %s", req.Method, req.Path)
+			}
+			var body struct {
+				Locations []valhallaLocation `json:"locations"`
+				Costing   string             `json:"costing"`
+			}
+			if err := json.Unmarshal(req.Body, &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Locations) != 3 || body.Locations[0] != (valhallaLocation{Lat: 33.5186, Lon: -86.8104}) || body.Costing != "auto" {
+				t.Errorf("body = %+v", body)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flavor, func(t *testing.T) {
+			provider, stub := newStubProvider(t, tt.flavor, NewFakeProvider(), nil)
+			if _, err := provider.Route(context.Background(), testWaypoints); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, stub.last())
+		})
+	}
+}
+
+func TestProviderRouteParsing(t *testing.T) {
+	fake := NewFakeProvider()
+	want, err := fake.Route(context.Background(), testWaypoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		flavor string
+		legs   bool // GraphHopper reports route totals only
+	}{
+		{"ors", true},
+		{"osrm", true},
+		{"graphhopper", false},
+		{"valhalla", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.flavor, func(t *testing.T) {
+			provider, _ := newStubProvider(t, tt.flavor, fake, nil)
+			got, err := provider.Route(context.Background(), testWaypoints)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !closeTo(got.Distance, want.Distance) || !closeTo(got.Duration, want.Duration) {
+				t.Errorf("distance, duration = %v, %v; want %v, %v", got.Distance, got.Duration, want.Distance, want.Duration)
+			}
+			if len(got.Geometry) != len(want.Geometry) {
+				t.Fatalf("geometry has %d points, want %d", len(got.Geometry), len(want.Geometry))
+			}
+			last := got.Geometry[len(got.Geometry)-1]
+			if math.Abs(last.Lat-33.51) > 1e-5 || math.Abs(last.Lng+86.79) > 1e-5 {
+				t.Errorf("geometry ends at %+v", last)
+			}
+
+			if !tt.legs {
+				if len(got.Legs) != 0 {
+					t.Errorf("got %d legs, want none", len(got.Legs))
+				}
+				return
+			}
+			if len(got.Legs) != len(want.Legs) {
+				t.Fatalf("got %d legs, want %d", len(got.Legs), len(want.Legs))
+			}
+			for i, leg := range got.Legs {
+				if !closeTo(leg.Distance, want.Legs[i].Distance) || !closeTo(leg.Duration, want.Legs[i].Duration) {
+					t.Errorf("leg %d = %v km, %v min; want %v, %v", i, leg.Distance, leg.Duration, want.Legs[i].Distance, want.Legs[i].Duration)
+				}
+				if leg.GeometryStart != want.Legs[i].GeometryStart || leg.GeometryEnd != want.Legs[i].GeometryEnd {
+					t.Errorf("leg %d spans %d-%d, want %d-%d", i, leg.GeometryStart, leg.GeometryEnd, want.Legs[i].GeometryStart, want.Legs[i].GeometryEnd)
+				}
+			}
+		})
+	}
+}
+
+func TestProviderMatrixParsing(t *testing.T) {
+	fake := NewFakeProvider()
+	sources, destinations := testWaypoints[:2], testWaypoints
+	want, err := fake.Matrix(context.Background(), sources, destinations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, flavor := range stubFlavors {
+		t.Run(flavor, func(t *testing.T) {
+			provider, _ := newStubProvider(t, flavor, fake, nil)
+			got, err := provider.Matrix(context.Background(), sources, destinations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Distances) != len(sources) || len(got.Distances[0]) != len(destinations) {
+				t.Fatalf("matrix is %dx%d", len(got.Distances), len(got.Distances[0]))
+			}
+			for i := range sources {
+				for j := range destinations {
+					if !closeTo(got.Distances[i][j], want.Distances[i][j]) || !closeTo(got.Durations[i][j], want.Durations[i][j]) {
+						t.Errorf("cell %d,%d = %v km, %v min; want %v, %v", i, j, got.Distances[i][j], got.Durations[i][j], want.Distances[i][j], want.Durations[i][j])
+					}
+				}
+			}
+		})
+	}
+}
+
+// failingProvider has no route between any points.
+type failingProvider struct{ FakeProvider }
+
+func (failingProvider) Route(context.Context, []RoutePoint) (*RouteSegment, error) {
+	return nil, ErrNoRoute
+}
+
+func (failingProvider) Matrix(context.Context, []RoutePoint, []RoutePoint) (*Matrix, error) {
+	return nil, ErrNoRoute
+}
+
+func TestProviderErrors(t *testing.T) {
+	respond := func(status int, body string) func(http.ResponseWriter, *http.Request, int64) bool {
+		return func(w http.ResponseWriter, r *http.Request, call int64) bool {
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, body)
+			return true
+		}
+	}
+
+	tests := []struct {
+		name       string
+		flavor     string
+		backend    Provider
+		before     func(http.ResponseWriter, *http.Request, int64) bool
+		wantReason string
+		wantCalls  int64
+	}{
+		{"ors no route", "ors", &failingProvider{}, nil, "http-404", 1},
+		{"osrm no route", "osrm", &failingProvider{}, nil, ReasonEmptyRoute, 1},
+		{"graphhopper no route", "graphhopper", &failingProvider{}, nil, "http-400", 1},
+		{"valhalla no route", "valhalla", &failingProvider{}, nil, "http-400", 1},
+		{"ors empty routes", "ors", nil, respond(http.StatusOK, `{"routes":[]}`), ReasonEmptyRoute, 1},
+		{"graphhopper empty paths", "graphhopper", nil, respond(http.StatusOK, `{"paths":[]}`), ReasonEmptyRoute, 1},
+		{"valhalla empty trip", "valhalla", nil, respond(http.StatusOK, `{"trip":{"legs":[]}}`), ReasonEmptyRoute, 1},
+		{"ors unparseable geometry", "ors", nil, respond(http.StatusOK, `{"routes":[{"geometry":42}]}`), ReasonParseError, 1},
+		{"osrm malformed body", "osrm", nil, respond(http.StatusOK, `{"code":`), ReasonParseError, 1},
+		{"graphhopper wrong types", "graphhopper", nil, respond(http.StatusOK, `{"paths":"none"}`), ReasonParseError, 1},
+		// Rate limiting and server errors are retried once (ROUTING_MAX_RETRIES=1)
+		{"ors rate limited", "ors", nil, respond(http.StatusTooManyRequests, ""), "http-429", 2},
+		{"osrm rate limited", "osrm", nil, respond(http.StatusTooManyRequests, ""), "http-429", 2},
+		{"graphhopper rate limited", "graphhopper", nil, respond(http.StatusTooManyRequests, ""), "http-429", 2},
+		{"valhalla server error", "valhalla", nil, respond(http.StatusBadGateway, ""), "http-502", 2},
+		// Client errors are not
+		{"ors forbidden", "ors", nil, respond(http.StatusForbidden, `{"error":"quota"}`), "http-403", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := tt.backend
+			if backend == nil {
+				backend = NewFakeProvider()
+			}
+			provider, stub := newStubProvider(t, tt.flavor, backend, tt.before)
+			_, err := provider.Route(context.Background(), testWaypoints)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := fallbackReason(err); got != tt.wantReason {
+				t.Errorf("reason = %q (%v), want %q", got, err, tt.wantReason)
+			}
+			if got := stub.calls.Load(); got != tt.wantCalls {
+				t.Errorf("made %d requests, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestProviderRetriesAfterRateLimit(t *testing.T) {
+	for _, flavor := range stubFlavors {
+		t.Run(flavor, func(t *testing.T) {
+			provider, stub := newStubProvider(t, flavor, NewFakeProvider(), func(w http.ResponseWriter, r *http.Request, call int64) bool {
+				if call > 1 {
+					return false
+				}
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return true
+			})
+			if _, err := provider.Route(context.Background(), testWaypoints); err != nil {
+				t.Fatal(err)
+			}
+			if got := stub.calls.Load(); got != 2 {
+				t.Errorf("made %d requests, want 2", got)
+			}
+		})
+	}
+}
+
+func TestProviderMatrixUnreachableCell(t *testing.T) {
+	tests := []struct {
+		flavor string
+		body   string
+	}{
+		{"ors", `{"distances":[[1,null]],"durations":[[60,null]]}`},
+		{"osrm", `{"code":"Ok","distances":[[1000,null]],"durations":[[60,null]]}`},
+		{"graphhopper", `{"distances":[[1000,null]],"times":[[60,null]]}`},
+		{"valhalla", `{"sources_to_targets":[[{"distance":1,"time":60},{"distance":null,"time":null}]]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.flavor, func(t *testing.T) {
+			provider, _ := newStubProvider(t, tt.flavor, NewFakeProvider(), func(w http.ResponseWriter, r *http.Request, call int64) bool {
+				_, _ = io.WriteString(w, tt.body)
+				return true
+			})
+			matrix, err := provider.Matrix(context.Background(), testWaypoints[:1], testWaypoints[1:])
+			if err != nil {
+				t.Fatalf("Matrix: %v", err)
+			}
+			if !closeTo(matrix.Distances[0][0], 1) || !closeTo(matrix.Durations[0][0], 1) {
+				t.Errorf("routable cell = %v km, %v min, want 1 km, 1 min", matrix.Distances[0][0], matrix.Durations[0][0])
+			}
+			if !math.IsInf(matrix.Distances[0][1], 1) || !math.IsInf(matrix.Durations[0][1], 1) {
+				t.Errorf("unreachable cell = %v km, %v min, want +Inf", matrix.Distances[0][1], matrix.Durations[0][1])
+			}
+		})
+	}
+}
+
+func TestProviderMatrixUnroutable(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error
+	}{
+		{"no routable pair", `{"distances":[[null,null]],"durations":[[null,null]]}`, ErrNoRoute},
+		{"missing cells", `{"distances":[[1]],"durations":[[60]]}`, ErrBadResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, _ := newStubProvider(t, "ors", NewFakeProvider(), func(w http.ResponseWriter, r *http.Request, call int64) bool {
+				_, _ = io.WriteString(w, tt.body)
+				return true
+			})
+			if _, err := provider.Matrix(context.Background(), testWaypoints[:1], testWaypoints[1:]); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderNeedsAPIKey(t *testing.T) {
+	provider := newORSProvider(Config{BaseURL: "http://127.0.0.1:1"}, http.DefaultClient)
+	if _, err := provider.Route(context.Background(), testWaypoints); !errors.Is(err, ErrNoAPIKey) {
+		t.Errorf("Route err = %v, want ErrNoAPIKey", err)
+	}
+	if _, err := provider.Matrix(context.Background(), testWaypoints, testWaypoints); !errors.Is(err, ErrNoAPIKey) {
+		t.Errorf("Matrix err = %v, want ErrNoAPIKey", err)
+	}
+}
@@ -0,0 +1,323 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the provider while its
+// circuit breaker is open after repeated failures.
+var ErrCircuitOpen = errors.New("routing: provider circuit open after repeated failures")
+
+// ResilienceConfig controls how hard we lean on a routing backend.
+type ResilienceConfig struct {
+	RatePerSecond    float64       // sustained request rate per backend
+	Burst            int           // requests allowed back to back before the rate applies
+	Concurrency      int           // requests in flight per backend
+	MaxRetries       int           // retries for 429, 5xx and network errors
+	BaseBackoff      time.Duration // first retry delay; doubles per attempt
+	MaxBackoff       time.Duration // cap on a single retry delay
+	BreakerThreshold int           // consecutive failed calls that open the breaker
+	BreakerCooldown  time.Duration // how long the breaker stays open before a trial call
+}
+
+// ResilienceConfigFromEnv reads ROUTING_RATE_LIMIT, ROUTING_BURST,
+// ROUTING_CONCURRENCY, ROUTING_MAX_RETRIES, ROUTING_BREAKER_THRESHOLD and
+// ROUTING_BREAKER_COOLDOWN, defaulting to the 5 requests per second the
+// public ORS plan allows.
+func ResilienceConfigFromEnv() ResilienceConfig {
+	cfg := ResilienceConfig{
+		RatePerSecond:    5,
+		Burst:            5,
+		Concurrency:      4,
+		MaxRetries:       3,
+		BaseBackoff:      250 * time.Millisecond,
+		MaxBackoff:       10 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("ROUTING_RATE_LIMIT"), 64); err == nil && v > 0 {
+		cfg.RatePerSecond = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("ROUTING_BURST")); err == nil && v > 0 {
+		cfg.Burst = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("ROUTING_CONCURRENCY")); err == nil && v > 0 {
+		cfg.Concurrency = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("ROUTING_MAX_RETRIES")); err == nil && v >= 0 {
+		cfg.MaxRetries = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("ROUTING_BREAKER_THRESHOLD")); err == nil && v > 0 {
+		cfg.BreakerThreshold = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("ROUTING_BREAKER_COOLDOWN")); err == nil && v > 0 {
+		cfg.BreakerCooldown = v
+	}
+	return cfg
+}
+
+// tokenBucket is a rate limiter shared by every request to one backend.
+type tokenBucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	rate     float64 // tokens per second
+	last     time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{tokens: float64(burst), capacity: float64(burst), rate: rate, last: time.Now()}
+}
+
+// wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// Breaker states reported by BreakerStates.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// breaker opens after threshold consecutive failed calls and lets a single
+// trial call through once the cooldown has passed.
+type breaker struct {
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openedAt  time.Time
+	threshold int
+	cooldown  time.Duration
+}
+
+// allow reports whether a call may proceed and whether it is the single
+// trial call of a half-open breaker.
+func (b *breaker) allow() (ok, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false, false
+		}
+		b.state = BreakerHalfOpen
+		return true, true
+	case BreakerHalfOpen:
+		// A trial call is already in flight
+		return false, false
+	default:
+		return true, false
+	}
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = BreakerClosed
+	b.failures = 0
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// release returns a half-open breaker to open when the trial call ended
+// without telling us anything about the backend (e.g. it was cancelled).
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+	}
+}
+
+func (b *breaker) current() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// guard applies rate limiting, bounded concurrency, retries and a circuit
+// breaker to calls against one backend.
+type guard struct {
+	cfg     ResilienceConfig
+	limiter *tokenBucket
+	slots   chan struct{}
+	breaker *breaker
+}
+
+var (
+	guardsMu sync.Mutex
+	guards   = map[string]*guard{}
+)
+
+// guardFor returns the shared guard for a backend, creating it on first use.
+func guardFor(key string) *guard {
+	guardsMu.Lock()
+	defer guardsMu.Unlock()
+	if g, ok := guards[key]; ok {
+		return g
+	}
+	cfg := ResilienceConfigFromEnv()
+	g := &guard{
+		cfg:     cfg,
+		limiter: newTokenBucket(cfg.RatePerSecond, cfg.Burst),
+		slots:   make(chan struct{}, cfg.Concurrency),
+		breaker: &breaker{state: BreakerClosed, threshold: cfg.BreakerThreshold, cooldown: cfg.BreakerCooldown},
+	}
+	guards[key] = g
+	return g
+}
+
+// BreakerStates reports the circuit breaker state of every backend used so far.
+func BreakerStates() map[string]string {
+	guardsMu.Lock()
+	defer guardsMu.Unlock()
+	states := make(map[string]string, len(guards))
+	for key, g := range guards {
+		states[key] = g.breaker.current()
+	}
+	return states
+}
+
+// do runs call under the guard, retrying transient failures with
+// exponential backoff. Only calls that still fail after every retry count
+// against the breaker; client errors such as "no route" do not.
+func (g *guard) do(ctx context.Context, call func() error) error {
+	ok, trial := g.breaker.allow()
+	if !ok {
+		return ErrCircuitOpen
+	}
+	maxRetries := g.cfg.MaxRetries
+	if trial {
+		// Probe a recovering backend once rather than hammering it
+		maxRetries = 0
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = g.attempt(ctx, call)
+		if err == nil {
+			g.breaker.success()
+			return nil
+		}
+		if ctx.Err() != nil {
+			g.breaker.release()
+			return err
+		}
+		if !retryable(err) {
+			// The backend answered; it is healthy even if the request was bad
+			g.breaker.success()
+			return err
+		}
+		if attempt >= maxRetries {
+			break
+		}
+		if sleepErr := sleepContext(ctx, g.backoff(attempt, err)); sleepErr != nil {
+			g.breaker.release()
+			return err
+		}
+	}
+	g.breaker.failure()
+	return err
+}
+
+func (g *guard) attempt(ctx context.Context, call func() error) error {
+	select {
+	case g.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-g.slots }()
+
+	if err := g.limiter.wait(ctx); err != nil {
+		return err
+	}
+	return call()
+}
+
+// backoff honours Retry-After when the provider sent one and otherwise
+// doubles the base delay per attempt, with jitter so parallel callers spread out.
+func (g *guard) backoff(attempt int, err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return min(statusErr.RetryAfter, g.cfg.MaxBackoff)
+	}
+	delay := g.cfg.BaseBackoff << attempt
+	if delay <= 0 || delay > g.cfg.MaxBackoff {
+		delay = g.cfg.MaxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryable reports whether err is worth retrying: rate limiting, server
+// errors and transport failures.
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && !errors.Is(err, context.Canceled)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,121 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestGuard(cfg ResilienceConfig) *guard {
+	return &guard{
+		cfg:     cfg,
+		limiter: newTokenBucket(cfg.RatePerSecond, cfg.Burst),
+		slots:   make(chan struct{}, cfg.Concurrency),
+		breaker: &breaker{state: BreakerClosed, threshold: cfg.BreakerThreshold, cooldown: cfg.BreakerCooldown},
+	}
+}
+
+func TestGuardBreaker(t *testing.T) {
+	g := newTestGuard(ResilienceConfig{
+		RatePerSecond:    1000,
+		Burst:            100,
+		Concurrency:      1,
+		MaxRetries:       2,
+		BaseBackoff:      time.Millisecond,
+		MaxBackoff:       time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  20 * time.Millisecond,
+	})
+	var calls int
+	failWith := func(status int) func() error {
+		return func() error {
+			calls++
+			return &StatusError{Provider: "test", StatusCode: status}
+		}
+	}
+	ctx := context.Background()
+
+	// Client errors are answers, not outages
+	for i := 0; i < 3; i++ {
+		_ = g.do(ctx, failWith(http.StatusBadRequest))
+	}
+	if calls != 3 || g.breaker.current() != BreakerClosed {
+		t.Fatalf("after 3 bad requests: %d calls, breaker %s; want 3 calls, closed", calls, g.breaker.current())
+	}
+
+	calls = 0
+	for i := 0; i < 2; i++ {
+		_ = g.do(ctx, failWith(http.StatusBadGateway))
+	}
+	if calls != 6 || g.breaker.current() != BreakerOpen {
+		t.Fatalf("after 2 failed calls: %d attempts, breaker %s; want 6 attempts, open", calls, g.breaker.current())
+	}
+	if err := g.do(ctx, failWith(http.StatusBadGateway)); !errors.Is(err, ErrCircuitOpen) || calls != 6 {
+		t.Fatalf("open breaker: err %v after %d attempts, want ErrCircuitOpen without a call", err, calls)
+	}
+
+	// After the cooldown one trial goes through, without retries
+	time.Sleep(25 * time.Millisecond)
+	_ = g.do(ctx, failWith(http.StatusBadGateway))
+	if calls != 7 || g.breaker.current() != BreakerOpen {
+		t.Fatalf("failed trial: %d attempts, breaker %s; want 7 attempts, open", calls, g.breaker.current())
+	}
+	time.Sleep(25 * time.Millisecond)
+	if err := g.do(ctx, func() error { return nil }); err != nil || g.breaker.current() != BreakerClosed {
+		t.Fatalf("successful trial: err %v, breaker %s; want closed", err, g.breaker.current())
+	}
+}
+
+func TestGuardBoundsConcurrency(t *testing.T) {
+	g := newTestGuard(ResilienceConfig{RatePerSecond: 1000, Burst: 100, Concurrency: 2, BreakerThreshold: 5, BreakerCooldown: time.Second})
+	var inFlight, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = g.do(context.Background(), func() error {
+				n := inFlight.Add(1)
+				for {
+					old := peak.Load()
+					if n <= old || peak.CompareAndSwap(old, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				inFlight.Add(-1)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	if peak.Load() > 2 {
+		t.Errorf("%d calls in flight, want at most 2", peak.Load())
+	}
+}
+
+func TestTokenBucketRate(t *testing.T) {
+	bucket := newTokenBucket(100, 2)
+	start := time.Now()
+	for i := 0; i < 7; i++ {
+		if err := bucket.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Two from the burst, then five at 10ms each
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("7 tokens took %v, want at least 40ms at 100 per second after a burst of 2", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	empty := newTokenBucket(0.001, 1)
+	_ = empty.wait(ctx)
+	if err := empty.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait on a cancelled context = %v, want context.Canceled", err)
+	}
+}
@@ -1,13 +1,12 @@
 package routing
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"io"
+	"errors"
 	"math"
-	"net/http"
-	"os"
-	"time"
+	"net"
+	"strconv"
 )
 
 // RoutePoint represents a coordinate
@@ -18,137 +17,104 @@ type RoutePoint struct {
 
 // RouteSegment contains route information between two points
 type RouteSegment struct {
-	Distance float64       `json:"distance"` // in kilometers
-	Duration float64       `json:"duration"` // in minutes
-	Geometry []RoutePoint  `json:"geometry"` // actual road path
+	Distance       float64      `json:"distance"`                 // in kilometers
+	Duration       float64      `json:"duration"`                 // in minutes
+	Geometry       []RoutePoint `json:"geometry"`                 // actual road path
+	Source         string       `json:"source"`                   // provider name, or "fallback" for a straight line
+	FallbackReason string       `json:"fallbackReason,omitempty"` // why the provider route was not used
+	Legs           []RouteLeg   `json:"legs,omitempty"`           // per-waypoint-pair breakdown of multi-waypoint routes
 }
 
-// OpenRouteServiceResponse represents the API response
-// The geometry can be either a string (encoded) or an array of coordinates
-type openRouteServiceResponse struct {
-	Routes []struct {
-		Summary struct {
-			Distance float64 `json:"distance"` // in meters
-			Duration float64 `json:"duration"` // in seconds
-		} `json:"summary"`
-		Geometry interface{} `json:"geometry"` // Can be string or coordinate array
-	} `json:"routes"`
-}
+// SourceFallback marks a straight-line segment drawn because no road route was available
+const SourceFallback = "fallback"
+
+// Fallback reasons reported on straight-line segments. HTTP failures are
+// reported as "http-<status>", e.g. "http-429".
+const (
+	ReasonNoProvider  = "no-provider"
+	ReasonNoAPIKey    = "no-api-key"
+	ReasonTimeout     = "timeout"
+	ReasonParseError  = "parse-error"
+	ReasonEmptyRoute  = "empty-route"
+	ReasonCircuitOpen = "circuit-open"
+	ReasonNetwork     = "network-error"
+	ReasonCancelled   = "cancelled"
+	ReasonAvoidArea   = "avoid-area"
+)
 
-// GetRouteWithKey fetches actual driving route from OpenRouteService using provided API key
+// GetRouteWithKey fetches actual driving route from the configured provider using provided API key
 func GetRouteWithKey(fromLat, fromLng, toLat, toLng float64, apiKey string) (*RouteSegment, error) {
-	// Using public OpenRouteService API
-	url := "https://api.openrouteservice.org/v2/directions/driving-car/json"
-	
-	// Log API key status
-	if apiKey == "" {
-		return getFallbackRoute(fromLat, fromLng, toLat, toLng), nil
-	}
-	
-	// Prepare request body - request JSON format (not encoded)
-	body := map[string]interface{}{
-		"coordinates": [][]float64{
-			{fromLng, fromLat}, // OpenRouteService uses [lng, lat] format
-			{toLng, toLat},
-		},
-		"geometry": true, // Explicitly request geometry
-	}
-	
-	jsonData, err := json.Marshal(body)
-	if err != nil {
-		return nil, err
-	}
-	
-	// Create request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
-	}
-	
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", apiKey) // Use provided API key
-	
-	// Make request with timeout
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	provider, err := ProviderFor("", apiKey)
 	if err != nil {
-		return getFallbackRoute(fromLat, fromLng, toLat, toLng), nil
+		return getFallbackRoute(fromLat, fromLng, toLat, toLng, ReasonNoProvider), nil
 	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		return getFallbackRoute(fromLat, fromLng, toLat, toLng), nil
+	return GetRouteWith(context.Background(), provider, fromLat, fromLng, toLat, toLng)
+}
+
+// GetRouteWith fetches a driving route from the given provider, falling back
+// to a straight line when the provider fails or is nil. The segment's Source
+// and FallbackReason record which of the two happened.
+func GetRouteWith(ctx context.Context, provider Provider, fromLat, fromLng, toLat, toLng float64) (*RouteSegment, error) {
+	if provider == nil {
+		return getFallbackRoute(fromLat, fromLng, toLat, toLng, ReasonNoProvider), nil
 	}
-	
-	// Parse response
-	bodyBytes, err := io.ReadAll(resp.Body)
+	segment, err := provider.Route(ctx, []RoutePoint{
+		{Lat: fromLat, Lng: fromLng},
+		{Lat: toLat, Lng: toLng},
+	})
 	if err != nil {
-		return getFallbackRoute(fromLat, fromLng, toLat, toLng), nil
-	}
-	
-	var orsResp openRouteServiceResponse
-	if err := json.Unmarshal(bodyBytes, &orsResp); err != nil {
-		return getFallbackRoute(fromLat, fromLng, toLat, toLng), nil
+		return fallbackLeg(provider, RoutePoint{Lat: fromLat, Lng: fromLng}, RoutePoint{Lat: toLat, Lng: toLng}, fallbackReason(err)), nil
 	}
-	
-	if len(orsResp.Routes) == 0 {
-		return getFallbackRoute(fromLat, fromLng, toLat, toLng), nil
+	if segment.Source == "" {
+		segment.Source = provider.Name()
 	}
-	
-	route := orsResp.Routes[0]
-	
-	// Parse geometry - it can be a map (GeoJSON), array, or string (encoded)
-	geometry := []RoutePoint{}
-	
-	switch geom := route.Geometry.(type) {
-	case map[string]interface{}:
-		// GeoJSON format: {"coordinates": [[lng, lat], ...]}
-		if coords, ok := geom["coordinates"].([]interface{}); ok {
-			for _, coordInterface := range coords {
-				if coord, ok := coordInterface.([]interface{}); ok && len(coord) >= 2 {
-					lng, _ := coord[0].(float64)
-					lat, _ := coord[1].(float64)
-					geometry = append(geometry, RoutePoint{Lat: lat, Lng: lng})
-				}
-			}
-		}
-	case string:
-		// Encoded polyline format - decode it
-		geometry = decodePolyline(geom)
-	case []interface{}:
-		// Direct array of coordinates
-		for _, coordInterface := range geom {
-			if coord, ok := coordInterface.([]interface{}); ok && len(coord) >= 2 {
-				lng, _ := coord[0].(float64)
-				lat, _ := coord[1].(float64)
-				geometry = append(geometry, RoutePoint{Lat: lat, Lng: lng})
-			}
-		}
+	defaultCalibration().observeRoute(provider.Name(), []RoutePoint{{Lat: fromLat, Lng: fromLng}, {Lat: toLat, Lng: toLng}}, segment)
+	return segment, nil
+}
+
+// fallbackReason classifies a provider error for RouteSegment.FallbackReason.
+func fallbackReason(err error) string {
+	var statusErr *StatusError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr):
+		return "http-" + strconv.Itoa(statusErr.StatusCode)
+	case errors.Is(err, ErrNoAPIKey):
+		return ReasonNoAPIKey
+	case errors.Is(err, ErrNoRoute):
+		return ReasonEmptyRoute
+	case errors.Is(err, ErrBadResponse), errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return ReasonParseError
+	case errors.Is(err, ErrCircuitOpen):
+		return ReasonCircuitOpen
+	case errors.Is(err, ErrAvoidArea):
+		return ReasonAvoidArea
+	case errors.Is(err, errNoProvider):
+		return ReasonNoProvider
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ReasonTimeout
+	case errors.Is(err, context.Canceled):
+		return ReasonCancelled
 	default:
-		return getFallbackRoute(fromLat, fromLng, toLat, toLng), nil
+		return ReasonNetwork
 	}
-	
-	return &RouteSegment{
-		Distance: route.Summary.Distance / 1000.0, // convert meters to km
-		Duration: route.Summary.Duration / 60.0,   // convert seconds to minutes
-		Geometry: geometry,
-	}, nil
 }
 
-// GetRoute fetches actual driving route from OpenRouteService (legacy - uses env var)
+// GetRoute fetches actual driving route using only the environment configuration (legacy)
 func GetRoute(fromLat, fromLng, toLat, toLng float64) (*RouteSegment, error) {
-	// For backward compatibility, check environment variable
-	apiKey := os.Getenv("OPENROUTE_API_KEY")
-	return GetRouteWithKey(fromLat, fromLng, toLat, toLng, apiKey)
+	return GetRouteWithKey(fromLat, fromLng, toLat, toLng, "")
 }
 
 // getFallbackRoute creates a simple straight line route using haversine
-func getFallbackRoute(fromLat, fromLng, toLat, toLng float64) *RouteSegment {
-	distance := haversineDistance(fromLat, fromLng, toLat, toLng)
-	
-	// Estimate duration assuming average speed of 40 km/h in city
-	duration := (distance / 40.0) * 60.0 // in minutes
-	
+func getFallbackRoute(fromLat, fromLng, toLat, toLng float64, reason string) *RouteSegment {
+	// Scaled by the detour factor and speed learned for the area, if any.
+	// The duration is free-flow; the schedule applies traffic later.
+	estimator := Estimates()
+	distance := estimator.Distance(fromLat, fromLng, toLat, toLng)
+	duration := estimator.Duration(fromLat, fromLng, toLat, toLng) // in minutes
+
 	return &RouteSegment{
 		Distance: distance,
 		Duration: duration,
@@ -156,149 +122,63 @@ func getFallbackRoute(fromLat, fromLng, toLat, toLng float64) *RouteSegment {
 			{Lat: fromLat, Lng: fromLng},
 			{Lat: toLat, Lng: toLng},
 		},
+		Source:         SourceFallback,
+		FallbackReason: reason,
 	}
 }
 
 // haversineDistance calculates distance between two points in kilometers
 func haversineDistance(lat1, lng1, lat2, lng2 float64) float64 {
 	const earthRadius = 6371.0
-	
+
 	lat1Rad := lat1 * math.Pi / 180
 	lat2Rad := lat2 * math.Pi / 180
 	deltaLat := (lat2 - lat1) * math.Pi / 180
 	deltaLng := (lng2 - lng1) * math.Pi / 180
-	
+
 	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
 		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
 			math.Sin(deltaLng/2)*math.Sin(deltaLng/2)
 	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	
+
 	return earthRadius * c
 }
 
-// GetMultiPointRoute calculates route through multiple points
+// GetMultiPointRoute calculates route through multiple points with as few
+// provider requests as its waypoint limit allows
 func GetMultiPointRoute(points []RoutePoint) (*RouteSegment, error) {
 	if len(points) < 2 {
 		return &RouteSegment{}, nil
 	}
-	
-	totalDistance := 0.0
-	totalDuration := 0.0
-	allGeometry := []RoutePoint{}
-	
-	// Calculate route between consecutive points
-	for i := 0; i < len(points)-1; i++ {
-		segment, err := GetRoute(
-			points[i].Lat, points[i].Lng,
-			points[i+1].Lat, points[i+1].Lng,
-		)
-		if err != nil {
-			continue
-		}
-		
-		totalDistance += segment.Distance
-		totalDuration += segment.Duration
-		allGeometry = append(allGeometry, segment.Geometry...)
+
+	provider, err := ProviderFor("", "")
+	if err != nil {
+		provider = nil
 	}
-	
-	return &RouteSegment{
-		Distance: totalDistance,
-		Duration: totalDuration,
-		Geometry: allGeometry,
-	}, nil
+	return GetRouteThrough(context.Background(), provider, points), nil
 }
 
 // BatchGetRoutes fetches multiple routes in parallel (with rate limiting)
 func BatchGetRoutes(pairs [][]RoutePoint) ([]*RouteSegment, error) {
-	results := make([]*RouteSegment, len(pairs))
-	
-	// For simplicity, process sequentially with small delay
-	for i, pair := range pairs {
-		if len(pair) != 2 {
-			results[i] = getFallbackRoute(0, 0, 0, 0)
-			continue
-		}
-		
-		segment, err := GetRoute(pair[0].Lat, pair[0].Lng, pair[1].Lat, pair[1].Lng)
-		if err != nil {
-			results[i] = getFallbackRoute(pair[0].Lat, pair[0].Lng, pair[1].Lat, pair[1].Lng)
-		} else {
-			results[i] = segment
-		}
-		
-		// Small delay to respect rate limits (5 requests per second)
-		time.Sleep(200 * time.Millisecond)
+	provider, err := ProviderFor("", "")
+	if err != nil {
+		provider = nil
 	}
-	
-	return results, nil
+	return GetRoutesWith(context.Background(), provider, pairs), nil
 }
 
-// decodePolyline decodes an encoded polyline string into a slice of RoutePoints
-// This uses the standard Google Polyline encoding algorithm
-func decodePolyline(encoded string) []RoutePoint {
-	var points []RoutePoint
-	index := 0
-	lat := 0
-	lng := 0
-	
-	for index < len(encoded) {
-		// Decode latitude
-		var shift uint = 0
-		var result int = 0
-		var b int
-		
-		for {
-			if index >= len(encoded) {
-				break
-			}
-			b = int(encoded[index]) - 63
-			index++
-			result |= (b & 0x1f) << shift
-			shift += 5
-			if b < 0x20 {
-				break
-			}
-		}
-		
-		var dlat int
-		if (result & 1) != 0 {
-			dlat = ^(result >> 1)
-		} else {
-			dlat = result >> 1
-		}
-		lat += dlat
-		
-		// Decode longitude
-		shift = 0
-		result = 0
-		
-		for {
-			if index >= len(encoded) {
-				break
-			}
-			b = int(encoded[index]) - 63
-			index++
-			result |= (b & 0x1f) << shift
-			shift += 5
-			if b < 0x20 {
-				break
-			}
-		}
-		
-		var dlng int
-		if (result & 1) != 0 {
-			dlng = ^(result >> 1)
-		} else {
-			dlng = result >> 1
+// GetRoutesWith fetches many legs concurrently, bounded by the configured
+// routing concurrency. Each entry falls back to a straight line on its own,
+// so one failing leg never discards the rest.
+func GetRoutesWith(ctx context.Context, provider Provider, pairs [][]RoutePoint) []*RouteSegment {
+	results := make([]*RouteSegment, len(pairs))
+	forEachConcurrently(len(pairs), func(i int) {
+		pair := pairs[i]
+		if len(pair) != 2 {
+			results[i] = getFallbackRoute(0, 0, 0, 0, ReasonEmptyRoute)
+			return
 		}
-		lng += dlng
-		
-		points = append(points, RoutePoint{
-			Lat: float64(lat) / 1e5,
-			Lng: float64(lng) / 1e5,
-		})
-	}
-	
-	return points
+		results[i], _ = GetRouteWith(ctx, provider, pair[0].Lat, pair[0].Lng, pair[1].Lat, pair[1].Lng)
+	})
+	return results
 }
-
@@ -0,0 +1,179 @@
+package routing
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Simplification methods for SimplifyPath.
+const (
+	SimplifyDouglasPeucker = "douglas-peucker"
+	SimplifyVisvalingam    = "visvalingam"
+)
+
+// metersPerPixel is the Web Mercator ground resolution of zoom 0 at the
+// equator for 256 px tiles.
+const metersPerPixel = 156543.03392
+
+// ZoomTolerance returns the ground size in meters of one map pixel at the
+// given zoom level and latitude, a tolerance below which simplification is
+// invisible on screen.
+func ZoomTolerance(zoom int, lat float64) float64 {
+	return metersPerPixel * math.Cos(lat*math.Pi/180) / math.Pow(2, float64(zoom))
+}
+
+// SimplifyPath drops points that move the path by less than toleranceMeters.
+// The first and last points are always kept unchanged. method is
+// SimplifyDouglasPeucker (the default) or SimplifyVisvalingam, which treats
+// the tolerance as the side of a square of equivalent triangle area.
+func SimplifyPath(points []RoutePoint, toleranceMeters float64, method string) []RoutePoint {
+	if len(points) < 3 || toleranceMeters <= 0 {
+		return points
+	}
+	xy := project(points)
+	var keep []bool
+	if method == SimplifyVisvalingam {
+		keep = visvalingam(xy, toleranceMeters*toleranceMeters)
+	} else {
+		keep = douglasPeucker(xy, toleranceMeters)
+	}
+
+	simplified := make([]RoutePoint, 0, len(points))
+	for i, kept := range keep {
+		if kept {
+			simplified = append(simplified, points[i])
+		}
+	}
+	return simplified
+}
+
+// planar is a point in meters on a local equirectangular projection.
+type planar struct{ x, y float64 }
+
+// project maps points to meters around the first point's latitude, which is
+// accurate to well under a meter over the length of a city route.
+func project(points []RoutePoint) []planar {
+	const metersPerDegree = 6371000.0 * math.Pi / 180
+	scale := math.Cos(points[0].Lat * math.Pi / 180)
+	xy := make([]planar, len(points))
+	for i, p := range points {
+		xy[i] = planar{x: p.Lng * scale * metersPerDegree, y: p.Lat * metersPerDegree}
+	}
+	return xy
+}
+
+// douglasPeucker marks the points to keep, splitting at the point farthest
+// from each chord while it lies beyond the tolerance. It uses an explicit
+// stack so paths with thousands of points cannot overflow the call stack.
+func douglasPeucker(xy []planar, tolerance float64) []bool {
+	keep := make([]bool, len(xy))
+	keep[0], keep[len(xy)-1] = true, true
+
+	stack := [][2]int{{0, len(xy) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		first, last := span[0], span[1]
+
+		farthest, farthestDist := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(xy[i], xy[first], xy[last]); d > farthestDist {
+				farthest, farthestDist = i, d
+			}
+		}
+		if farthest < 0 {
+			continue
+		}
+		keep[farthest] = true
+		stack = append(stack, [2]int{first, farthest}, [2]int{farthest, last})
+	}
+	return keep
+}
+
+// segmentDistance is the distance from p to the segment a-b.
+func segmentDistance(p, a, b planar) float64 {
+	dx, dy := b.x-a.x, b.y-a.y
+	lengthSq := dx*dx + dy*dy
+	t := 0.0
+	if lengthSq > 0 {
+		t = math.Max(0, math.Min(1, ((p.x-a.x)*dx+(p.y-a.y)*dy)/lengthSq))
+	}
+	return math.Hypot(p.x-(a.x+t*dx), p.y-(a.y+t*dy))
+}
+
+// visvalingam marks the points to keep, repeatedly removing the point whose
+// triangle with its neighbours has the smallest area while that area is
+// below minArea.
+func visvalingam(xy []planar, minArea float64) []bool {
+	n := len(xy)
+	keep := make([]bool, n)
+	prev := make([]int, n)
+	next := make([]int, n)
+	for i := range xy {
+		keep[i] = true
+		prev[i], next[i] = i-1, i+1
+	}
+
+	queue := make(areaQueue, 0, n-2)
+	entries := make([]*areaEntry, n)
+	for i := 1; i < n-1; i++ {
+		entries[i] = &areaEntry{point: i, area: triangleArea(xy[i-1], xy[i], xy[i+1]), index: len(queue)}
+		queue = append(queue, entries[i])
+	}
+	heap.Init(&queue)
+
+	for queue.Len() > 0 {
+		smallest := heap.Pop(&queue).(*areaEntry)
+		if smallest.area >= minArea {
+			break
+		}
+		i := smallest.point
+		keep[i] = false
+		before, after := prev[i], next[i]
+		next[before], prev[after] = after, before
+
+		// A neighbour never gets a smaller area than the point just removed,
+		// so removal order stays monotonic
+		for _, j := range []int{before, after} {
+			if j == 0 || j == n-1 {
+				continue
+			}
+			entry := entries[j]
+			entry.area = math.Max(smallest.area, triangleArea(xy[prev[j]], xy[j], xy[next[j]]))
+			heap.Fix(&queue, entry.index)
+		}
+	}
+	return keep
+}
+
+func triangleArea(a, b, c planar) float64 {
+	return math.Abs((b.x-a.x)*(c.y-a.y)-(c.x-a.x)*(b.y-a.y)) / 2
+}
+
+type areaEntry struct {
+	point int
+	area  float64
+	index int
+}
+
+// areaQueue is a min-heap of points by effective area.
+type areaQueue []*areaEntry
+
+func (q areaQueue) Len() int           { return len(q) }
+func (q areaQueue) Less(i, j int) bool { return q[i].area < q[j].area }
+func (q areaQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *areaQueue) Push(x any) {
+	entry := x.(*areaEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+func (q *areaQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,76 @@
+package routing
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// wanderingPath is a random walk of roughly 10 m steps through Birmingham.
+func wanderingPath(n int) []RoutePoint {
+	rng := rand.New(rand.NewSource(4))
+	points := make([]RoutePoint, n)
+	lat, lng, heading := 33.51, -86.81, 0.0
+	for i := range points {
+		points[i] = RoutePoint{Lat: lat, Lng: lng}
+		heading += rng.NormFloat64() * 0.4
+		lat += math.Cos(heading) * 0.00009
+		lng += math.Sin(heading) * 0.00011
+	}
+	return points
+}
+
+func TestSimplifyPath(t *testing.T) {
+	path := wanderingPath(500)
+	for _, method := range []string{SimplifyDouglasPeucker, SimplifyVisvalingam} {
+		for _, tolerance := range []float64{2, 10, 50} {
+			simplified := SimplifyPath(path, tolerance, method)
+			if len(simplified) >= len(path) || len(simplified) < 2 {
+				t.Errorf("%s at %v m kept %d of %d points", method, tolerance, len(simplified), len(path))
+				continue
+			}
+			if simplified[0] != path[0] || simplified[len(simplified)-1] != path[len(path)-1] {
+				t.Errorf("%s at %v m moved the path's ends", method, tolerance)
+			}
+
+			// Kept points are original points in order
+			kept := []int{}
+			for i, point := range path {
+				if len(kept) < len(simplified) && point == simplified[len(kept)] {
+					kept = append(kept, i)
+				}
+			}
+			if len(kept) != len(simplified) {
+				t.Errorf("%s at %v m: kept points are not a subsequence of the path", method, tolerance)
+				continue
+			}
+
+			// With Douglas-Peucker every dropped point is within the tolerance
+			if method != SimplifyDouglasPeucker {
+				continue
+			}
+			xy := project(path)
+			for k := 1; k < len(kept); k++ {
+				for i := kept[k-1] + 1; i < kept[k]; i++ {
+					if d := segmentDistance(xy[i], xy[kept[k-1]], xy[kept[k]]); d > tolerance+1e-6 {
+						t.Errorf("%s at %v m: point %d is %v m from the simplified path", method, tolerance, i, d)
+					}
+				}
+			}
+		}
+	}
+
+	short := path[:2]
+	if got := SimplifyPath(short, 50, SimplifyDouglasPeucker); len(got) != 2 {
+		t.Errorf("two-point path simplified to %d points", len(got))
+	}
+}
+
+func TestZoomTolerance(t *testing.T) {
+	if got := ZoomTolerance(0, 0); !closeTo(got, metersPerPixel) {
+		t.Errorf("zoom 0 at the equator = %v m, want %v", got, metersPerPixel)
+	}
+	if got, want := ZoomTolerance(15, 60), metersPerPixel/2/math.Pow(2, 15); !closeTo(got, want) {
+		t.Errorf("zoom 15 at 60°N = %v m, want %v", got, want)
+	}
+}
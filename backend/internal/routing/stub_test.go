@@ -0,0 +1,360 @@
+package routing
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// stubHandler serves a provider's HTTP wire format ("ors", "osrm",
+// "graphhopper" or "valhalla") backed by an in-process Provider, usually a
+// FakeProvider. Pointing ROUTING_BASE_URL at an httptest server running this
+// handler exercises the real HTTP adapters without leaving the machine.
+func stubHandler(flavor string, backend Provider) http.Handler {
+	s := &stubServer{backend: backend}
+	switch flavor {
+	case "osrm":
+		return http.HandlerFunc(s.osrm)
+	case "graphhopper":
+		return http.HandlerFunc(s.graphHopper)
+	case "valhalla":
+		return http.HandlerFunc(s.valhalla)
+	default:
+		return http.HandlerFunc(s.ors)
+	}
+}
+
+type stubServer struct {
+	backend Provider
+}
+
+func (s *stubServer) ors(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v2/directions/"):
+		var req struct {
+			Coordinates [][]float64 `json:"coordinates"`
+		}
+		if !decodeStubBody(w, r, &req) {
+			return
+		}
+		route, err := s.backend.Route(r.Context(), fromLngLatPairs(req.Coordinates))
+		if err != nil {
+			stubError(w, http.StatusNotFound, err)
+			return
+		}
+		segments := []map[string]interface{}{}
+		wayPoints := []int{}
+		for i, leg := range route.Legs {
+			steps := []orsStep{}
+			for _, step := range leg.Steps {
+				steps = append(steps, orsStep{
+					Distance:    step.Distance * 1000,
+					Duration:    step.Duration * 60,
+					Type:        orsManeuverType(step.Maneuver),
+					Instruction: step.Instruction,
+					Name:        orDefault(step.Street, "-"),
+					WayPoints:   [2]int{step.GeometryStart, step.GeometryEnd},
+				})
+			}
+			segments = append(segments, map[string]interface{}{"distance": leg.Distance * 1000, "duration": leg.Duration * 60, "steps": steps})
+			if i == 0 {
+				wayPoints = append(wayPoints, leg.GeometryStart)
+			}
+			wayPoints = append(wayPoints, leg.GeometryEnd)
+		}
+		writeStubJSON(w, map[string]interface{}{
+			"routes": []interface{}{map[string]interface{}{
+				"summary":    map[string]float64{"distance": route.Distance * 1000, "duration": route.Duration * 60},
+				"geometry":   map[string]interface{}{"type": "LineString", "coordinates": lngLatPairs(route.Geometry)},
+				"segments":   segments,
+				"way_points": wayPoints,
+			}},
+		})
+	case strings.HasPrefix(r.URL.Path, "/v2/matrix/"):
+		var req struct {
+			Locations    [][]float64 `json:"locations"`
+			Sources      []int       `json:"sources"`
+			Destinations []int       `json:"destinations"`
+		}
+		if !decodeStubBody(w, r, &req) {
+			return
+		}
+		locations := fromLngLatPairs(req.Locations)
+		matrix, err := s.backend.Matrix(r.Context(), pick(locations, req.Sources), pick(locations, req.Destinations))
+		if err != nil {
+			stubError(w, http.StatusNotFound, err)
+			return
+		}
+		writeStubJSON(w, map[string]interface{}{
+			"distances": scale(matrix.Distances, 1),
+			"durations": scale(matrix.Durations, 60),
+		})
+	case r.URL.Path == "/v2/health":
+		writeStubJSON(w, map[string]string{"status": "ready"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *stubServer) osrm(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 4 {
+		http.NotFound(w, r)
+		return
+	}
+	service, coords := parts[0], parseOSRMCoordinates(parts[3])
+
+	switch service {
+	case "route":
+		route, err := s.backend.Route(r.Context(), coords)
+		if err != nil {
+			writeStubJSON(w, map[string]string{"code": "NoRoute"})
+			return
+		}
+		legs := []map[string]float64{}
+		for _, leg := range route.Legs {
+			legs = append(legs, map[string]float64{"distance": leg.Distance * 1000, "duration": leg.Duration * 60})
+		}
+		writeStubJSON(w, map[string]interface{}{
+			"code": "Ok",
+			"routes": []interface{}{map[string]interface{}{
+				"distance": route.Distance * 1000,
+				"duration": route.Duration * 60,
+				"geometry": map[string]interface{}{"type": "LineString", "coordinates": lngLatPairs(route.Geometry)},
+				"legs":     legs,
+			}},
+		})
+	case "table":
+		sources := pick(coords, parseIndexList(rawQueryParam(r, "sources"), len(coords)))
+		destinations := pick(coords, parseIndexList(rawQueryParam(r, "destinations"), len(coords)))
+		matrix, err := s.backend.Matrix(r.Context(), sources, destinations)
+		if err != nil {
+			writeStubJSON(w, map[string]string{"code": "NoTable"})
+			return
+		}
+		writeStubJSON(w, map[string]interface{}{
+			"code":      "Ok",
+			"distances": scale(matrix.Distances, 1000),
+			"durations": scale(matrix.Durations, 60),
+		})
+	case "nearest":
+		writeStubJSON(w, map[string]string{"code": "Ok"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *stubServer) graphHopper(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/route":
+		points := []RoutePoint{}
+		for _, raw := range r.URL.Query()["point"] {
+			latLng := strings.Split(raw, ",")
+			if len(latLng) != 2 {
+				continue
+			}
+			lat, _ := strconv.ParseFloat(latLng[0], 64)
+			lng, _ := strconv.ParseFloat(latLng[1], 64)
+			points = append(points, RoutePoint{Lat: lat, Lng: lng})
+		}
+		route, err := s.backend.Route(r.Context(), points)
+		if err != nil {
+			stubError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeStubJSON(w, map[string]interface{}{
+			"paths": []interface{}{map[string]interface{}{
+				"distance": route.Distance * 1000,
+				"time":     route.Duration * 60000,
+				"points":   map[string]interface{}{"type": "LineString", "coordinates": lngLatPairs(route.Geometry)},
+			}},
+		})
+	case "/matrix":
+		var req struct {
+			FromPoints [][]float64 `json:"from_points"`
+			ToPoints   [][]float64 `json:"to_points"`
+		}
+		if !decodeStubBody(w, r, &req) {
+			return
+		}
+		matrix, err := s.backend.Matrix(r.Context(), fromLngLatPairs(req.FromPoints), fromLngLatPairs(req.ToPoints))
+		if err != nil {
+			stubError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeStubJSON(w, map[string]interface{}{
+			"distances": scale(matrix.Distances, 1000),
+			"times":     scale(matrix.Durations, 60),
+		})
+	case "/health":
+		writeStubJSON(w, "OK")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *stubServer) valhalla(w http.ResponseWriter, r *http.Request) {
+	type location struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	}
+	toPoints := func(locations []location) []RoutePoint {
+		points := make([]RoutePoint, len(locations))
+		for i, l := range locations {
+			points[i] = RoutePoint{Lat: l.Lat, Lng: l.Lon}
+		}
+		return points
+	}
+
+	switch r.URL.Path {
+	case "/route":
+		var req struct {
+			Locations []location `json:"locations"`
+		}
+		if !decodeStubBody(w, r, &req) {
+			return
+		}
+		points := toPoints(req.Locations)
+		if len(points) < 2 {
+			stubError(w, http.StatusBadRequest, ErrNoRoute)
+			return
+		}
+		legs := []interface{}{}
+		total := &RouteSegment{}
+		for i := 0; i < len(points)-1; i++ {
+			leg, err := s.backend.Route(r.Context(), points[i:i+2])
+			if err != nil {
+				stubError(w, http.StatusBadRequest, err)
+				return
+			}
+			total.Distance += leg.Distance
+			total.Duration += leg.Duration
+			legs = append(legs, map[string]interface{}{
+				"summary": map[string]float64{"length": leg.Distance, "time": leg.Duration * 60},
+				"shape":   encodePolylinePrecision(leg.Geometry, 6),
+			})
+		}
+		writeStubJSON(w, map[string]interface{}{
+			"trip": map[string]interface{}{
+				"summary": map[string]float64{"length": total.Distance, "time": total.Duration * 60},
+				"legs":    legs,
+			},
+		})
+	case "/sources_to_targets":
+		var req struct {
+			Sources []location `json:"sources"`
+			Targets []location `json:"targets"`
+		}
+		if !decodeStubBody(w, r, &req) {
+			return
+		}
+		matrix, err := s.backend.Matrix(r.Context(), toPoints(req.Sources), toPoints(req.Targets))
+		if err != nil {
+			stubError(w, http.StatusBadRequest, err)
+			return
+		}
+		distances, times := scale(matrix.Distances, 1), scale(matrix.Durations, 60)
+		rows := make([][]map[string]*float64, len(distances))
+		for i := range distances {
+			rows[i] = make([]map[string]*float64, len(distances[i]))
+			for j := range distances[i] {
+				rows[i][j] = map[string]*float64{"distance": distances[i][j], "time": times[i][j]}
+			}
+		}
+		writeStubJSON(w, map[string]interface{}{"sources_to_targets": rows})
+	case "/status":
+		writeStubJSON(w, map[string]string{"version": "stub"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func decodeStubBody(w http.ResponseWriter, r *http.Request, out interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(out); err != nil {
+		stubError(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func writeStubJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func stubError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func fromLngLatPairs(pairs [][]float64) []RoutePoint {
+	points := make([]RoutePoint, 0, len(pairs))
+	for _, pair := range pairs {
+		if len(pair) >= 2 {
+			points = append(points, RoutePoint{Lat: pair[1], Lng: pair[0]})
+		}
+	}
+	return points
+}
+
+func parseOSRMCoordinates(raw string) []RoutePoint {
+	points := []RoutePoint{}
+	for _, pair := range strings.Split(raw, ";") {
+		lngLat := strings.Split(pair, ",")
+		if len(lngLat) != 2 {
+			continue
+		}
+		lng, _ := strconv.ParseFloat(lngLat[0], 64)
+		lat, _ := strconv.ParseFloat(lngLat[1], 64)
+		points = append(points, RoutePoint{Lat: lat, Lng: lng})
+	}
+	return points
+}
+
+// rawQueryParam reads a query parameter without url.ParseQuery, which drops
+// pairs containing the semicolons OSRM uses as a list separator.
+func rawQueryParam(r *http.Request, key string) string {
+	for _, pair := range strings.Split(r.URL.RawQuery, "&") {
+		if value, ok := strings.CutPrefix(pair, key+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseIndexList parses OSRM's "0;1;2" index lists; empty means all.
+func parseIndexList(raw string, count int) []int {
+	if raw == "" || raw == "all" {
+		all := make([]int, count)
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+	indices := []int{}
+	for _, part := range strings.Split(raw, ";") {
+		if idx, err := strconv.Atoi(part); err == nil && idx >= 0 && idx < count {
+			indices = append(indices, idx)
+		}
+	}
+	return indices
+}
+
+// scale converts matrix cells to the backend's units, writing unreachable
+// (+Inf) cells as null the way the backends do.
+func scale(values [][]float64, factor float64) [][]*float64 {
+	scaled := make([][]*float64, len(values))
+	for i, row := range values {
+		scaled[i] = make([]*float64, len(row))
+		for j, v := range row {
+			if !math.IsInf(v, 1) {
+				cell := v * factor
+				scaled[i][j] = &cell
+			}
+		}
+	}
+	return scaled
+}
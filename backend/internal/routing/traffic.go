@@ -0,0 +1,228 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FallbackSpeedKmh is the off-peak city speed assumed for straight-line
+// legs until calibration has learned one; the traffic model slows it down at
+// busy times of day.
+const FallbackSpeedKmh = 40.0
+
+// Road classes for speed profiles. Routing providers only report a leg's
+// distance and free-flow duration, so the class is inferred from the speed
+// those imply.
+const (
+	ClassMotorway = "motorway"
+	ClassArterial = "arterial"
+	ClassLocal    = "local"
+)
+
+// minSpeedFactor keeps a misconfigured profile from stopping traffic
+// entirely, which would make travel times unbounded.
+const minSpeedFactor = 0.05
+
+// SpeedProfile holds, for each local hour of the day, the fraction of
+// free-flow speed that traffic allows.
+type SpeedProfile [24]float64
+
+// TrafficZone slows traffic inside a bounding box, e.g. a downtown grid,
+// on top of the road class profile.
+type TrafficZone struct {
+	Name    string       `json:"name"`
+	MinLat  float64      `json:"minLat"`
+	MinLng  float64      `json:"minLng"`
+	MaxLat  float64      `json:"maxLat"`
+	MaxLng  float64      `json:"maxLng"`
+	Profile SpeedProfile `json:"profile"` // multiplies the class profile for legs starting in the zone
+}
+
+func (z TrafficZone) contains(point RoutePoint) bool {
+	return point.Lat >= z.MinLat && point.Lat <= z.MaxLat && point.Lng >= z.MinLng && point.Lng <= z.MaxLng
+}
+
+// TrafficModel turns free-flow leg durations into time-dependent ones.
+// Speed is constant within each hour and changes at the hour, so a leg
+// started later never arrives earlier (the FIFO property schedules rely on).
+// A nil model leaves durations at free flow.
+type TrafficModel struct {
+	Location *time.Location          // clock the hourly profiles follow
+	Classes  map[string]SpeedProfile // by road class; missing classes use ClassLocal
+	Zones    []TrafficZone
+}
+
+// DefaultTrafficModel returns weekday profiles for the Birmingham, AL
+// metro: morning and evening peaks that hit interstates hardest, with
+// extra slowdown downtown.
+func DefaultTrafficModel() *TrafficModel {
+	location, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		location = time.UTC
+	}
+	return &TrafficModel{
+		Location: location,
+		Classes: map[string]SpeedProfile{
+			//                00    01    02    03    04    05    06    07    08    09    10    11    12    13    14    15    16    17    18    19    20    21    22    23
+			ClassMotorway: {1.00, 1.00, 1.00, 1.00, 1.00, 0.95, 0.80, 0.55, 0.60, 0.80, 0.92, 0.90, 0.88, 0.90, 0.88, 0.75, 0.58, 0.50, 0.68, 0.85, 0.95, 1.00, 1.00, 1.00},
+			ClassArterial: {1.00, 1.00, 1.00, 1.00, 1.00, 0.97, 0.85, 0.65, 0.70, 0.85, 0.93, 0.90, 0.85, 0.88, 0.87, 0.78, 0.65, 0.58, 0.72, 0.88, 0.95, 1.00, 1.00, 1.00},
+			ClassLocal:    {1.00, 1.00, 1.00, 1.00, 1.00, 1.00, 0.92, 0.80, 0.82, 0.92, 0.97, 0.95, 0.92, 0.93, 0.92, 0.87, 0.80, 0.75, 0.83, 0.93, 0.97, 1.00, 1.00, 1.00},
+		},
+		Zones: []TrafficZone{{
+			Name:   "downtown",
+			MinLat: 33.500, MinLng: -86.830,
+			MaxLat: 33.530, MaxLng: -86.790,
+			Profile: SpeedProfile{1, 1, 1, 1, 1, 1, 0.95, 0.85, 0.85, 0.95, 1, 0.95, 0.90, 0.95, 1, 0.95, 0.85, 0.80, 0.90, 1, 1, 1, 1, 1},
+		}},
+	}
+}
+
+// trafficFile is the JSON layout read from TRAFFIC_PROFILE.
+type trafficFile struct {
+	Timezone string                  `json:"timezone"`
+	Classes  map[string]SpeedProfile `json:"classes"`
+	Zones    []TrafficZone           `json:"zones"`
+}
+
+// LoadTrafficModel reads a model from a JSON file with a "timezone" (IANA
+// name), "classes" (24 hourly factors per road class) and optional "zones".
+func LoadTrafficModel(path string) (*TrafficModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file trafficFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("routing: traffic profile %s: %w", path, err)
+	}
+	location := time.UTC
+	if file.Timezone != "" {
+		if location, err = time.LoadLocation(file.Timezone); err != nil {
+			return nil, fmt.Errorf("routing: traffic profile %s: %w", path, err)
+		}
+	}
+	if _, ok := file.Classes[ClassLocal]; !ok {
+		return nil, fmt.Errorf("routing: traffic profile %s has no %q class", path, ClassLocal)
+	}
+	for class, profile := range file.Classes {
+		if !profile.valid() {
+			return nil, fmt.Errorf("routing: traffic profile %s: class %q needs 24 positive factors", path, class)
+		}
+	}
+	for _, zone := range file.Zones {
+		if !zone.Profile.valid() {
+			return nil, fmt.Errorf("routing: traffic profile %s: zone %q needs 24 positive factors", path, zone.Name)
+		}
+	}
+	return &TrafficModel{Location: location, Classes: file.Classes, Zones: file.Zones}, nil
+}
+
+var (
+	trafficOnce  sync.Once
+	trafficModel *TrafficModel
+)
+
+// Traffic returns the process-wide traffic model from TRAFFIC_PROFILE: empty
+// for the built-in Birmingham profiles, "off" for free-flow travel all day,
+// or the path of a JSON profile. A profile that fails to load falls back to
+// the built-in one.
+func Traffic() *TrafficModel {
+	trafficOnce.Do(func() {
+		switch path := os.Getenv("TRAFFIC_PROFILE"); strings.ToLower(path) {
+		case "off", "none", "flat":
+		case "":
+			trafficModel = DefaultTrafficModel()
+		default:
+			model, err := LoadTrafficModel(path)
+			if err != nil {
+				model = DefaultTrafficModel()
+			}
+			trafficModel = model
+		}
+	})
+	return trafficModel
+}
+
+// RoadClass infers the class of a leg from its free-flow speed.
+func RoadClass(speedKmh float64) string {
+	switch {
+	case speedKmh >= 70:
+		return ClassMotorway
+	case speedKmh >= 45:
+		return ClassArterial
+	default:
+		return ClassLocal
+	}
+}
+
+// TravelTime returns the minutes a leg takes when it leaves from at depart,
+// given its length and free-flow duration. The zone is decided by where the
+// leg starts.
+func (m *TrafficModel) TravelTime(from RoutePoint, distanceKm, freeFlowMinutes float64, depart time.Time) float64 {
+	if m == nil || freeFlowMinutes <= 0 {
+		return freeFlowMinutes
+	}
+	profile := m.profile(from, RoadClass(distanceKm/freeFlowMinutes*60))
+	local := depart.UTC()
+	if m.Location != nil {
+		local = depart.In(m.Location)
+	}
+	clock := float64(local.Hour()*60+local.Minute()) + float64(local.Second())/60
+	return profile.travelMinutes(clock, freeFlowMinutes)
+}
+
+// Arrival returns when a leg leaving from at depart arrives.
+func (m *TrafficModel) Arrival(from RoutePoint, distanceKm, freeFlowMinutes float64, depart time.Time) time.Time {
+	minutes := m.TravelTime(from, distanceKm, freeFlowMinutes, depart)
+	return depart.Add(time.Duration(minutes * float64(time.Minute)))
+}
+
+func (p SpeedProfile) valid() bool {
+	for _, factor := range p {
+		if factor <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// profile combines the class profile with the zone containing from, if any.
+func (m *TrafficModel) profile(from RoutePoint, class string) SpeedProfile {
+	profile, ok := m.Classes[class]
+	if !ok {
+		profile = m.Classes[ClassLocal]
+	}
+	for _, zone := range m.Zones {
+		if zone.contains(from) {
+			for h := range profile {
+				profile[h] *= zone.Profile[h]
+			}
+			break
+		}
+	}
+	return profile
+}
+
+// travelMinutes covers freeFlowMinutes worth of free-flow travel starting
+// at clock (minutes after local midnight), hour by hour at each hour's speed.
+func (p SpeedProfile) travelMinutes(clock, freeFlowMinutes float64) float64 {
+	remaining := freeFlowMinutes
+	elapsed := 0.0
+	for {
+		hour := int(math.Mod(clock/60, 24))
+		factor := math.Max(p[hour], minSpeedFactor)
+		untilHour := 60 - math.Mod(clock, 60)
+		covered := untilHour * factor
+		if covered >= remaining {
+			return elapsed + remaining/factor
+		}
+		remaining -= covered
+		elapsed += untilHour
+		clock += untilHour
+	}
+}
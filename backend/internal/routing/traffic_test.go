@@ -0,0 +1,86 @@
+package routing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// utcTraffic is the default model on a UTC clock, so hours read directly.
+func utcTraffic() *TrafficModel {
+	model := DefaultTrafficModel()
+	model.Location = time.UTC
+	return model
+}
+
+func TestTrafficTravelTime(t *testing.T) {
+	suburb := RoutePoint{Lat: 33.40, Lng: -86.70}
+	downtown := RoutePoint{Lat: 33.515, Lng: -86.81}
+	at := func(hour, minute int) time.Time { return time.Date(2024, 3, 5, hour, minute, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		model    *TrafficModel
+		from     RoutePoint
+		km, mins float64
+		depart   time.Time
+		want     float64
+	}{
+		{"no model", nil, suburb, 20, 10, at(17, 0), 10},
+		{"night", utcTraffic(), suburb, 20, 10, at(2, 0), 10},
+		{"motorway evening peak", utcTraffic(), suburb, 20, 10, at(17, 0), 10 / 0.50},
+		{"local evening peak", utcTraffic(), suburb, 5, 10, at(17, 0), 10 / 0.75},
+		{"downtown evening peak", utcTraffic(), downtown, 5, 10, at(17, 0), 10 / (0.75 * 0.80)},
+		// 10 minutes at 16:00's 0.58 cover 5.8 free-flow minutes, the other 14.2 run at 0.50
+		{"into the peak hour", utcTraffic(), suburb, 40, 20, at(16, 50), 10 + 14.2/0.50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.model.TravelTime(tt.from, tt.km, tt.mins, tt.depart); !closeTo(got, tt.want) {
+				t.Errorf("TravelTime = %v minutes, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrafficLaterDeparturesArriveNoEarlier(t *testing.T) {
+	model := utcTraffic()
+	from := RoutePoint{Lat: 33.515, Lng: -86.81}
+	for _, leg := range []struct{ km, mins float64 }{{30, 15}, {10, 12}, {2, 45}} {
+		previous := time.Time{}
+		for depart := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC); depart.Day() == 5; depart = depart.Add(time.Minute) {
+			arrival := model.Arrival(from, leg.km, leg.mins, depart)
+			if arrival.Before(previous) {
+				t.Fatalf("%v km leg leaving at %s arrives at %s, before the one leaving a minute earlier", leg.km, depart.Format("15:04"), arrival.Format("15:04:05"))
+			}
+			previous = arrival
+		}
+	}
+}
+
+func TestLoadTrafficModel(t *testing.T) {
+	flat := "[1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1]"
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{"valid", `{"timezone":"America/New_York","classes":{"local":` + flat + `}}`, false},
+		{"no local class", `{"classes":{"motorway":` + flat + `}}`, true},
+		{"zero factor", `{"classes":{"local":[0,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1,1]}}`, true},
+		{"unknown timezone", `{"timezone":"Mars/Olympus","classes":{"local":` + flat + `}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "traffic.json")
+			if err := os.WriteFile(path, []byte(tt.body), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadTrafficModel(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadTrafficModel error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package routing
+
+import (
+	"context"
+	"math"
+	"net/http"
+)
+
+// valhallaProvider talks to the Valhalla route and sources_to_targets APIs.
+type valhallaProvider struct {
+	baseURL string
+	costing string
+	client  *http.Client
+}
+
+func newValhallaProvider(cfg Config, client *http.Client) *valhallaProvider {
+	return &valhallaProvider{
+		baseURL: orDefault(cfg.BaseURL, "https://valhalla1.openstreetmap.de"),
+		costing: orDefault(cfg.Profile, "auto"),
+		client:  client,
+	}
+}
+
+type valhallaLocation struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type valhallaRouteResponse struct {
+	Trip struct {
+		Summary struct {
+			Length float64 `json:"length"` // in kilometers
+			Time   float64 `json:"time"`   // in seconds
+		} `json:"summary"`
+		Legs []struct {
+			Summary struct {
+				Length float64 `json:"length"` // in kilometers
+				Time   float64 `json:"time"`   // in seconds
+			} `json:"summary"`
+			Shape string `json:"shape"` // polyline with 6 digits of precision
+		} `json:"legs"`
+	} `json:"trip"`
+}
+
+type valhallaMatrixResponse struct {
+	SourcesToTargets [][]struct {
+		Distance *float64 `json:"distance"` // in kilometers
+		Time     *float64 `json:"time"`     // in seconds
+	} `json:"sources_to_targets"`
+}
+
+func (p *valhallaProvider) Name() string { return "valhalla" }
+
+// Valhalla's default max_matrix_locations is 50.
+func (p *valhallaProvider) matrixLimit() int { return 50 }
+
+// Valhalla's default max_locations for routes is 20.
+func (p *valhallaProvider) waypointLimit() int { return 20 }
+
+func (p *valhallaProvider) Route(ctx context.Context, waypoints []RoutePoint) (*RouteSegment, error) {
+	return p.routeAvoiding(ctx, waypoints, nil)
+}
+
+// routeAvoiding passes the areas' outer rings as Valhalla exclude_polygons.
+func (p *valhallaProvider) routeAvoiding(ctx context.Context, waypoints []RoutePoint, areas []AvoidArea) (*RouteSegment, error) {
+	body := map[string]interface{}{
+		"locations":          valhallaLocations(waypoints),
+		"costing":            p.costing,
+		"directions_options": map[string]string{"units": "kilometers"},
+	}
+	if len(areas) > 0 {
+		rings := [][][]float64{}
+		for _, area := range areas {
+			for _, polygon := range area.Polygons {
+				rings = append(rings, lngLatPairs(polygon[0]))
+			}
+		}
+		body["exclude_polygons"] = rings
+	}
+
+	var resp valhallaRouteResponse
+	if err := doJSON(ctx, p.client, p.Name(), http.MethodPost, p.baseURL+"/route", nil, body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Trip.Legs) == 0 {
+		return nil, ErrNoRoute
+	}
+
+	segment := &RouteSegment{
+		Distance: resp.Trip.Summary.Length,
+		Duration: resp.Trip.Summary.Time / 60.0,
+		Geometry: []RoutePoint{},
+	}
+	for i, leg := range resp.Trip.Legs {
+		points := decodePolylinePrecision(leg.Shape, 6)
+		start := len(segment.Geometry)
+		// Consecutive legs share their joining waypoint.
+		if i > 0 && len(points) > 0 {
+			points = points[1:]
+			start--
+		}
+		segment.Geometry = append(segment.Geometry, points...)
+		segment.Legs = append(segment.Legs, RouteLeg{
+			Distance:      leg.Summary.Length,
+			Duration:      leg.Summary.Time / 60.0,
+			GeometryStart: max(start, 0),
+			GeometryEnd:   len(segment.Geometry) - 1,
+		})
+	}
+	return segment, nil
+}
+
+func (p *valhallaProvider) Matrix(ctx context.Context, sources, destinations []RoutePoint) (*Matrix, error) {
+	body := map[string]interface{}{
+		"sources": valhallaLocations(sources),
+		"targets": valhallaLocations(destinations),
+		"costing": p.costing,
+		"units":   "kilometers",
+	}
+
+	var resp valhallaMatrixResponse
+	if err := doJSON(ctx, p.client, p.Name(), http.MethodPost, p.baseURL+"/sources_to_targets", nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return buildMatrix(len(sources), len(destinations), func(i, j int) (float64, float64, bool) {
+		if i >= len(resp.SourcesToTargets) || j >= len(resp.SourcesToTargets[i]) {
+			return 0, 0, false
+		}
+		cell := resp.SourcesToTargets[i][j]
+		if cell.Distance == nil || cell.Time == nil {
+			return math.Inf(1), math.Inf(1), true // unreachable
+		}
+		return *cell.Distance, *cell.Time / 60.0, true
+	})
+}
+
+func (p *valhallaProvider) Health(ctx context.Context) error {
+	return doJSON(ctx, p.client, p.Name(), http.MethodGet, p.baseURL+"/status", nil, nil, nil)
+}
+
+func valhallaLocations(points []RoutePoint) []valhallaLocation {
+	locations := make([]valhallaLocation, len(points))
+	for i, p := range points {
+		locations[i] = valhallaLocation{Lat: p.Lat, Lon: p.Lng}
+	}
+	return locations
+}
@@ -118,6 +118,12 @@ function App() {
         setError(null);
         setHybridTimeline([]);
         setHybridStats(null);
+        setRouteGeometries([]);
+
+        // Routes of the best plan so far, by shopper, rebuilt from snapshots
+        let bestRoutes = new Map();
+        // Version of the last snapshot applied; 0 waits for a full one
+        let snapshotVersion = 0;
 
         try {
             const availableCores = typeof navigator !== 'undefined' && navigator.hardwareConcurrency
@@ -134,11 +140,33 @@ function App() {
                     destroyRate: 0.35,
                     localSearchIterations: 60,
                     emitIntervalMillis: 200,
+                    snapshots: 'delta',
                     randomSeed: Date.now(),
                     useRealRoutes,
                     apiKey,
                 },
-                onProgress: (progress) => {
+                onProgress: ({ snapshot, ...progress }) => {
+                    // A delta only applies on top of the snapshot it was taken
+                    // against; after a gap, wait for the next full snapshot
+                    if (snapshot && !snapshot.full && snapshot.baseVersion !== snapshotVersion) {
+                        snapshotVersion = 0;
+                    } else if (snapshot) {
+                        if (snapshot.full) {
+                            bestRoutes = new Map();
+                        }
+                        snapshotVersion = snapshot.version;
+                        snapshot.routes.forEach((route) => bestRoutes.set(route.shopperId, route));
+                        setAssignments(
+                            [...bestRoutes.values()]
+                                .filter((route) => route.route.length > 0)
+                                .map((route) => ({
+                                    shopperId: route.shopperId,
+                                    route: route.route,
+                                    totalDistance: route.distance,
+                                }))
+                                .sort((a, b) => a.shopperId.localeCompare(b.shopperId, undefined, { numeric: true }))
+                        );
+                    }
                     setHybridTimeline((prev) => {
                         const next = [...prev, progress];
                         return next.length > 200 ? next.slice(next.length - 200) : next;
@@ -1,5 +1,53 @@
 const BASE_URL = "http://localhost:8080/api";
 
+// Route geometries are requested as precision-6 encoded polylines, which are a
+// fraction of the size of raw point arrays, and decoded back to points here.
+const GEOMETRY_FORMAT = "polyline6";
+
+// Routes are simplified server-side to stay within a pixel at street zoom,
+// well past the map's default zoom of 11.
+const SIMPLIFY_ZOOM = 16;
+
+// decodePolyline turns a Google encoded polyline into [lat, lng] pairs.
+export function decodePolyline(encoded, precision = 5) {
+    const factor = Math.pow(10, precision);
+    const points = [];
+    let index = 0;
+    let lat = 0;
+    let lng = 0;
+
+    const nextValue = () => {
+        let result = 0;
+        let shift = 0;
+        let byte;
+        do {
+            byte = encoded.charCodeAt(index++) - 63;
+            result |= (byte & 0x1f) << shift;
+            shift += 5;
+        } while (byte >= 0x20);
+        return result & 1 ? ~(result >> 1) : result >> 1;
+    };
+
+    while (index < encoded.length) {
+        lat += nextValue();
+        lng += nextValue();
+        points.push([lat / factor, lng / factor]);
+    }
+    return points;
+}
+
+function withDecodedGeometries(analytics) {
+    if (!analytics || !analytics.routeGeometries) {
+        return analytics;
+    }
+    analytics.routeGeometries = analytics.routeGeometries.map((geometry) =>
+        geometry.polyline
+            ? { ...geometry, points: decodePolyline(geometry.polyline, geometry.precision) }
+            : geometry
+    );
+    return analytics;
+}
+
 export async function getSampleData() {
     try {
         const res = await fetch(`${BASE_URL}/sample-data`);
@@ -40,13 +88,17 @@ export async function optimizeWithAnalytics(data, useRealRoutes = false, algorit
                 shoppers: data.shoppers,
                 useRealRoutes: useRealRoutes,
                 algorithm: algorithm,
-                apiKey: apiKey  // Pass API key to backend
+                apiKey: apiKey,  // Pass API key to backend
+                geometryFormat: GEOMETRY_FORMAT,
+                simplifyZoom: SIMPLIFY_ZOOM,
             }),
         });
         if (!res.ok) {
             throw new Error(`HTTP error! status: ${res.status}`);
         }
-        return await res.json();
+        const result = await res.json();
+        withDecodedGeometries(result.analytics);
+        return result;
     } catch (error) {
         console.error("Error optimizing with analytics:", error);
         throw error;
@@ -71,7 +123,7 @@ export async function runHybridOptimization({ orders, shoppers, options, onProgr
             body: JSON.stringify({
                 orders,
                 shoppers,
-                options,
+                options: { ...options, geometryFormat: GEOMETRY_FORMAT, simplifyZoom: SIMPLIFY_ZOOM },
             }),
             signal,
         });
@@ -103,6 +155,7 @@ export async function runHybridOptimization({ orders, shoppers, options, onProgr
                 if (event.type === "progress") {
                     onProgress && onProgress(event.data);
                 } else if (event.type === "completed") {
+                    withDecodedGeometries(event.data.analytics);
                     return event.data;
                 } else if (event.type === "error") {
                     throw new Error(event.error || "Hybrid solver error");
@@ -115,6 +168,7 @@ export async function runHybridOptimization({ orders, shoppers, options, onProgr
         if (trailing) {
             const event = JSON.parse(trailing);
             if (event.type === "completed") {
+                withDecodedGeometries(event.data.analytics);
                 return event.data;
             }
             if (event.type === "error") {
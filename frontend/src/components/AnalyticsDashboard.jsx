@@ -93,6 +93,12 @@ function ShopperCard({ shopper, index }) {
                 <div className="flex items-center gap-2">
                     <Clock className="w-3 h-3" />
                     <span>{shopper.estimatedStartTime} - {shopper.estimatedEndTime}</span>
+                    {shopper.waitingTime > 0 && (
+                        <span className="text-gray-500">· {shopper.waitingTime.toFixed(0)} min waiting</span>
+                    )}
+                    {shopper.lateStops > 0 && (
+                        <span className="text-red-600 font-semibold">· {shopper.lateStops} late</span>
+                    )}
                 </div>
             </div>
         </motion.div>
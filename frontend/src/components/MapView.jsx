@@ -85,6 +85,8 @@ export default function MapView({ orders, shoppers, assignments, routeGeometries
                 coords: geometry.points,
                 color: routeColors[idx % routeColors.length],
                 shopperId: geometry.shopperId,
+                // Dash routes where any leg fell back to a straight line
+                straightLine: (geometry.fallbackLegs || 0) > 0 || !geometry.roadLegs,
             };
         })
         : assignments.map((assignment, idx) => {
@@ -104,6 +106,7 @@ export default function MapView({ orders, shoppers, assignments, routeGeometries
                 coords: routeCoords,
                 color: routeColors[idx % routeColors.length],
                 shopperId: assignment.shopperId,
+                straightLine: true,
             };
         }).filter(Boolean);
 
@@ -166,7 +169,7 @@ export default function MapView({ orders, shoppers, assignments, routeGeometries
                             color: route.color,
                             weight: 4,
                             opacity: 0.8,
-                            dashArray: routeGeometries.length > 0 ? null : '10, 10',
+                            dashArray: route.straightLine ? '10, 10' : null,
                             lineCap: 'round',
                             lineJoin: 'round',
                         }}